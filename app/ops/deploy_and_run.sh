@@ -37,7 +37,7 @@ popd &>/dev/null
 
 # Copy everything over to VPS and restart service
 echo "Transferring assets"
-rsync $RSYNC_OPTS ./{named_zones,public_html} "$VPS_FQDN":
+rsync $RSYNC_OPTS ./{named_zones,boundary_zones,public_html,config.yaml} "$VPS_FQDN":
 
 echo "Transferring service definition"
 rsync $RSYNC_OPTS ops/"$SERVICE_FILE" "$VPS_FQDN":/etc/systemd/system/"$SERVICE_FILE"
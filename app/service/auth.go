@@ -0,0 +1,44 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+)
+
+// isAuthorised checks the request's "auth" header against the key, logging
+// why it was refused. Without the header, a POSTed form's "auth" field is
+// used, so admin pages can work from a browser. It's never taken from the
+// query string, where it'd end up in logs. Nor is it logged - a mistyped key
+// is usually most of the real one.
+func isAuthorised(r *http.Request, key string) bool {
+	from := "header"
+	auths, ok := r.Header[http.CanonicalHeaderKey("auth")]
+	if !ok && r.Method == http.MethodPost && isForm(r) {
+		from = "form"
+		auths, ok = []string{r.PostFormValue("auth")}, true
+	}
+	if !ok || len(auths) != 1 {
+		errorLogger.Printf("Auth key not set in header, or too many set, for %s from %s\n", r.URL.Path, clientAddress(r))
+		return false
+	}
+
+	authKey := auths[0]
+
+	if authKey == "" {
+		errorLogger.Printf("Got an empty auth key in the %s for %s from %s\n", from, r.URL.Path, clientAddress(r))
+		return false
+	}
+
+	if authKey != key {
+		errorLogger.Printf("Rejected a bad auth key in the %s for %s from %s\n", from, r.URL.Path, clientAddress(r))
+		return false
+	}
+
+	return true
+}
+
+// isForm is whether the request's body is an HTML form.
+func isForm(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/x-www-form-urlencoded"
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsAuthorisedDoesntLogKeys(t *testing.T) {
+	var logged bytes.Buffer
+	orig := errorLogger.Writer()
+	errorLogger.SetOutput(&logged)
+	defer errorLogger.SetOutput(orig)
+
+	// GIVEN near misses of the key, in the header and in a form
+	header := httptest.NewRequest(http.MethodGet, "http://example.com/admin/tags", http.NoBody)
+	header.Header.Add("auth", "s3cret-kex")
+
+	form := httptest.NewRequest(http.MethodPost, "http://example.com/admin/pending", strings.NewReader(url.Values{"auth": {"s3cret-kez"}}.Encode()))
+	form.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	// WHEN they're checked
+	require.False(t, isAuthorised(header, "s3cret-key"))
+	require.False(t, isAuthorised(form, "s3cret-key"))
+
+	// THEN where they came from is logged, but not what they were.
+	require.Contains(t, logged.String(), "bad auth key in the header for /admin/tags")
+	require.Contains(t, logged.String(), "bad auth key in the form for /admin/pending")
+	require.NotContains(t, logged.String(), "s3cret")
+}
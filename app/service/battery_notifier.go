@@ -5,16 +5,19 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/bitwombat/gps-tags/config"
 	"github.com/bitwombat/gps-tags/model"
 	"github.com/bitwombat/gps-tags/notify"
 	oshotpkg "github.com/bitwombat/gps-tags/oneshot"
-	"github.com/bitwombat/gps-tags/zones"
+	"github.com/bitwombat/gps-tags/registry"
 )
 
 type batteryNotifier struct {
-	namedZones []zones.Zone
+	zones      *zoneHolder
 	oneShot    oshotpkg.OneShot
 	notifier   notify.Notifier
+	tags       *registry.Registry
+	thresholds config.Battery
 }
 
 func (bn batteryNotifier) Notify(ctx context.Context, now func() time.Time, tagData model.TagTx) {
@@ -32,11 +35,12 @@ func (bn batteryNotifier) Notify(ctx context.Context, now func() time.Time, tagD
 		}
 	}
 
-	dogName := model.UpperSerNoToName(tagData.SerNo)
-	notifyAboutBattery(ctx, now, latestAnalogue.ar, dogName, bn.oneShot, bn.notifier)
+	dogName := bn.tags.UpperName(tagData.SerNo)
+	tag := notify.Event{SerNo: tagData.SerNo, Tag: bn.tags.Name(tagData.SerNo)}
+	notifyAboutBattery(ctx, now, latestAnalogue.ar, dogName, tag, bn.thresholds, bn.oneShot, bn.notifier)
 }
 
-func notifyAboutBattery(ctx context.Context, now func() time.Time, latestAnalogue *model.AnalogueReading, dogName string, oneShot oshotpkg.OneShot, notifier notify.Notifier) {
+func notifyAboutBattery(ctx context.Context, now func() time.Time, latestAnalogue *model.AnalogueReading, dogName string, tag notify.Event, thresholds config.Battery, oneShot oshotpkg.OneShot, notifier notify.Notifier) {
 	if latestAnalogue == nil {
 		debugLogger.Println("No Analogue reading in transmission")
 
@@ -45,25 +49,28 @@ func notifyAboutBattery(ctx context.Context, now func() time.Time, latestAnalogu
 
 	batteryVoltage := float64(latestAnalogue.InternalBatteryVoltage) / 1000
 
-	// We don't want to hear about low battery in the middle of the night.
-	nowIsWakingHours := now().Hour() >= 8 && now().Hour() <= 22
+	event := func(kind string, severity notify.Severity, title string) notify.Event {
+		e := tag
+		e.Kind = kind
+		e.Severity = severity
+		e.Title = notify.Title(title)
+		e.Message = notify.Message(fmt.Sprintf("Battery voltage: %.3f V", batteryVoltage))
+		e.BatteryVoltage = batteryVoltage
+		e.Time = now()
 
-	err := oneShot.SetReset(dogName+"lowBattery",
+		return e
+	}
+
+	// Alerts in the middle of the night are held back by the notifier's quiet
+	// hours, not here.
+	err := oneShot.SetReset(eventKey(tag.SerNo, "lowBattery"),
 		oshotpkg.Config{
-			SetIf: (batteryVoltage < BatteryLowThreshold) && nowIsWakingHours,
-			OnSet: makeNotifier(
-				ctx,
-				notifier,
-				notify.Title(fmt.Sprintf("%s's battery low", dogName)),
-				notify.Message(fmt.Sprintf("Battery voltage: %.3f V", batteryVoltage)),
-			),
-			ResetIf: batteryVoltage > BatteryLowThreshold+BatteryHysteresis,
-			OnReset: makeNotifier(
-				ctx,
-				notifier,
-				notify.Title(fmt.Sprintf("New battery for %s detected", dogName)),
-				notify.Message(fmt.Sprintf("Battery voltage: %.3f V", batteryVoltage)),
-			),
+			SetIf: batteryVoltage < thresholds.LowThreshold,
+			OnSet: makeNotifier(ctx, notifier,
+				event(notify.EventLowBattery, notify.SeverityWarning, fmt.Sprintf("%s's battery low", dogName))),
+			ResetIf: batteryVoltage > thresholds.LowThreshold+thresholds.Hysteresis,
+			OnReset: makeNotifier(ctx, notifier,
+				event(notify.EventNewBattery, notify.SeverityInfo, fmt.Sprintf("New battery for %s detected", dogName))),
 		})
 	if err != nil {
 		debugLogger.Println("error when setting: ", err) // notifications are not important enough to return an error.
@@ -71,17 +78,12 @@ func notifyAboutBattery(ctx context.Context, now func() time.Time, latestAnalogu
 		return
 	}
 
-	err = oneShot.SetReset(dogName+"criticalBattery",
+	err = oneShot.SetReset(eventKey(tag.SerNo, "criticalBattery"),
 		oshotpkg.Config{
-			SetIf: (batteryVoltage < BatteryCriticalThreshold) && nowIsWakingHours,
-			OnSet: makeNotifier(
-				ctx,
-				notifier,
-				notify.Title(fmt.Sprintf("%s's battery critical", dogName)),
-				notify.Message(fmt.Sprintf("Battery voltage: %.3f V",
-					batteryVoltage)),
-			),
-			ResetIf: batteryVoltage > BatteryLowThreshold,
+			SetIf: batteryVoltage < thresholds.CriticalThreshold,
+			OnSet: makeNotifier(ctx, notifier,
+				event(notify.EventCriticalBattery, notify.SeverityCritical, fmt.Sprintf("%s's battery critical", dogName))),
+			ResetIf: batteryVoltage > thresholds.LowThreshold,
 		})
 	if err != nil {
 		debugLogger.Println("error when setting: ", err) // notifications are not important enough to return an error.
@@ -0,0 +1,123 @@
+// Command tags administers the tag registry directly in the database. The
+// database is the one in the service's config file, unless -db says otherwise.
+// A running service only sees the changes once it's reloaded (SIGHUP).
+//
+//	tags [-config config.yaml] [-db dogtags.db] list
+//	tags [-config config.yaml] [-db dogtags.db] add <serNo> <name> [colour]
+//	tags [-config config.yaml] [-db dogtags.db] rename <serNo> <name>
+//	tags [-config config.yaml] [-db dogtags.db] retire <serNo>
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	_ "time/tzdata" // For the config's time zones, as in the service
+
+	"github.com/bitwombat/gps-tags/config"
+	"github.com/bitwombat/gps-tags/model"
+	"github.com/bitwombat/gps-tags/registry"
+	"github.com/bitwombat/gps-tags/storage"
+)
+
+func usage() {
+	fmt.Println("Usage:")
+	fmt.Println("  tags [flags] list")
+	fmt.Println("  tags [flags] add <serNo> <name> [colour]")
+	fmt.Println("  tags [flags] rename <serNo> <name>")
+	fmt.Println("  tags [flags] retire <serNo>")
+	fmt.Println("Flags:")
+	flag.PrintDefaults()
+	os.Exit(1)
+}
+
+func main() {
+	configPath := flag.String("config", "config.yaml", "path to the service's config file, for the database path")
+	dbPath := flag.String("db", "", "path to the database (default the config file's database.path)")
+	flag.Usage = usage
+	flag.Parse()
+
+	cmdArgs := flag.Args()
+	if len(cmdArgs) < 1 {
+		usage()
+	}
+
+	if *dbPath == "" {
+		cfg, err := config.Load(*configPath)
+		if err != nil {
+			fmt.Printf("loading config: %v\n", err)
+			os.Exit(1)
+		}
+		*dbPath = cfg.Database.Path
+	}
+
+	ctx := context.Background()
+
+	storer, err := storage.NewSQLiteStorer(*dbPath)
+	if err != nil {
+		fmt.Printf("opening database: %v\n", err)
+		os.Exit(1)
+	}
+
+	err = storer.Migrate(ctx)
+	if err != nil {
+		fmt.Printf("migrating database: %v\n", err)
+		os.Exit(1)
+	}
+
+	tags := registry.New(storer)
+	err = tags.Load(ctx)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+
+	args := cmdArgs[1:]
+
+	var serNo int
+	if len(args) > 0 {
+		serNo, err = strconv.Atoi(args[0])
+		if err != nil {
+			fmt.Printf("bad serial number %q: %v\n", args[0], err)
+			os.Exit(1)
+		}
+	}
+
+	switch {
+	case cmdArgs[0] == "list":
+		for _, t := range tags.All() {
+			status := "active"
+			if !t.Active {
+				status = "retired"
+			}
+			fmt.Printf("%d\t%s\t%s\t%s\t%s\n", t.SerNo, t.Name, t.Colour, t.Icon, status)
+		}
+
+	case cmdArgs[0] == "add" && (len(args) == 2 || len(args) == 3):
+		t := model.Tag{SerNo: serNo, Name: args[1]}
+		if len(args) == 3 {
+			t.Colour = args[2]
+		}
+		err = tags.Add(ctx, t)
+
+	case cmdArgs[0] == "rename" && len(args) == 2:
+		err = tags.Rename(ctx, serNo, args[1])
+
+	case cmdArgs[0] == "retire" && len(args) == 1:
+		err = tags.Retire(ctx, serNo)
+
+	default:
+		usage()
+	}
+
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+
+	if cmdArgs[0] != "list" {
+		fmt.Println("Done. Reload the service (systemctl reload dog-tracking, or kill -HUP) for it to see the change.")
+	}
+}
@@ -0,0 +1,514 @@
+// Package config reads the service's settings from a YAML file, with some
+// settings (mostly secrets) overridable by environment variables.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bitwombat/gps-tags/notify"
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	Server     Server     `yaml:"server"`
+	Database   Database   `yaml:"database"`
+	Auth       Auth       `yaml:"auth"`
+	Zones      Zones      `yaml:"zones"`
+	Battery    Battery    `yaml:"battery"`
+	Ntfy       Ntfy       `yaml:"ntfy"`
+	Webhooks   []Webhook  `yaml:"webhooks"`
+	Email      Email      `yaml:"email"`
+	Routes     []Route    `yaml:"routes"`
+	Retry      Retry      `yaml:"retry"`
+	QuietHours QuietHours `yaml:"quietHours"`
+	Alerts     Alerts     `yaml:"alerts"`
+	Digest     Digest     `yaml:"digest"`
+	Watchdog   Watchdog   `yaml:"watchdog"`
+}
+
+type Server struct {
+	HTTPAddr  string `yaml:"httpAddr"`  // Health checks from the load balancer
+	HTTPSAddr string `yaml:"httpsAddr"` // Everything else
+	// StaticDirs maps hostnames to the directory their static files are served
+	// from. Hostnames not listed get DefaultStaticDir.
+	StaticDirs       map[string]string `yaml:"staticDirs"`
+	DefaultStaticDir string            `yaml:"defaultStaticDir"`
+}
+
+type Database struct {
+	Path string `yaml:"path"`
+}
+
+// Auth keys are secrets, so are best set with environment variables.
+type Auth struct {
+	TagKey   string `yaml:"tagKey"`   // Sent by the tags with uploads
+	AdminKey string `yaml:"adminKey"` // Empty disables the admin endpoints
+}
+
+type Zones struct {
+	NamedZonesDir string `yaml:"namedZonesDir"`
+	// Every zone in BoundaryZonesDir is an alert boundary - we notify when a
+	// dog leaves or comes back into it.
+	BoundaryZonesDir string `yaml:"boundaryZonesDir"`
+}
+
+type Battery struct {
+	LowThreshold      float64 `yaml:"lowThreshold"`      // Volts
+	CriticalThreshold float64 `yaml:"criticalThreshold"` // Volts
+	// Hysteresis is how far above LowThreshold the voltage has to go before
+	// we believe it's a new battery.
+	Hysteresis float64 `yaml:"hysteresis"`
+}
+
+type Ntfy struct {
+	URLBase        string `yaml:"urlBase"`
+	SubscriptionID string `yaml:"subscriptionID"`
+	ClickURL       string `yaml:"clickURL"` // Where the "Show me" action goes
+	Disabled       bool   `yaml:"disabled"` // Use the null notifier instead
+}
+
+// Webhook is somewhere (e.g. Home Assistant, a chat bot) that every
+// notification is POSTed to, as well as ntfy.
+type Webhook struct {
+	Name        string            `yaml:"name"`        // For logs and errors
+	URL         string            `yaml:"url"`         // http or https
+	ContentType string            `yaml:"contentType"` // Default application/json
+	Template    string            `yaml:"template"`    // Body template. Default is JSON with every field.
+	Headers     map[string]string `yaml:"headers"`
+	// Secret, if set, signs the body (HMAC-SHA256). It's best read from the
+	// environment variable named by SecretEnv.
+	Secret    string `yaml:"secret"`
+	SecretEnv string `yaml:"secretEnv"`
+}
+
+// Email is sent for every notification, for people who don't use ntfy.
+// It's off unless Host is set.
+type Email struct {
+	Host     string   `yaml:"host"`
+	Port     int      `yaml:"port"`
+	Security string   `yaml:"security"` // starttls, tls (implicit, usually port 465) or none
+	Username string   `yaml:"username"` // No auth if empty
+	Password string   `yaml:"password"` // Best set with the SMTP_PASSWORD env var
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+	// CurrentURL is the current locations map page, linked to from emails.
+	CurrentURL string `yaml:"currentURL"`
+}
+
+// Route sends the notifications it matches to some of the channels: "ntfy",
+// "email", or a webhook's name. Notifications no route matches go to every
+// channel.
+type Route struct {
+	Events      []string `yaml:"events"`      // Any event if empty
+	Tags        []string `yaml:"tags"`        // Dogs' names. Any dog if empty.
+	MinSeverity string   `yaml:"minSeverity"` // info (default), warning or critical
+	Channels    []string `yaml:"channels"`
+}
+
+// Retry says how notifications a channel fails to take are retried. The
+// wait doubles after each failure, up to MaxDelay. After MaxAttempts they're
+// kept as failed, to be seen at /admin/notifications, for KeepFor.
+type Retry struct {
+	InitialDelay time.Duration `yaml:"initialDelay"`
+	MaxDelay     time.Duration `yaml:"maxDelay"`
+	MaxAttempts  int           `yaml:"maxAttempts"` // Including the first
+	KeepFor      time.Duration `yaml:"keepFor"`     // Failed and held back notifications
+}
+
+// QuietHours are when some notifications are held back from some channels.
+// What's held back is summed up, per channel, when its quiet hours are over.
+type QuietHours struct {
+	TimeZone string        `yaml:"timeZone"` // e.g. Australia/Sydney. The server's if empty.
+	Periods  []QuietPeriod `yaml:"periods"`
+}
+
+// QuietPeriod is a time of day to hold back notifications. It runs overnight
+// if End is before Start, and all day if they're the same. Empty Days, Events
+// or Channels match anything.
+type QuietPeriod struct {
+	Days     []string `yaml:"days"`  // mon, tue, ... - the day the period starts on
+	Start    string   `yaml:"start"` // HH:MM
+	End      string   `yaml:"end"`   // HH:MM
+	Events   []string `yaml:"events"`
+	Channels []string `yaml:"channels"`
+}
+
+// Alerts are notifications that someone has to acknowledge. Until they do,
+// they're sent again at growing intervals, and after EscalateAfter reminders
+// escalated to more channels or people.
+type Alerts struct {
+	Events              []string      `yaml:"events"` // Events that need acknowledging. None if empty.
+	AckURL              string        `yaml:"ackURL"` // Where ack links go, e.g. https://tags.example.com/ack
+	FirstReminder       time.Duration `yaml:"firstReminder"`
+	MaxReminderInterval time.Duration `yaml:"maxReminderInterval"`
+	EscalateAfter       int           `yaml:"escalateAfter"`   // Reminders before escalating
+	EscalateTo          []string      `yaml:"escalateTo"`      // Channels
+	EscalateEmailTo     []string      `yaml:"escalateEmailTo"` // Sent with email's server settings
+}
+
+// Digest sums up each dog's day or week - distance, zones, boundary breaches,
+// battery and missed check-ins - sent as a notification, and optionally
+// emailed as an HTML report.
+type Digest struct {
+	Period   string   `yaml:"period"`   // daily or weekly. No digests if empty.
+	At       string   `yaml:"at"`       // HH:MM
+	Day      string   `yaml:"day"`      // mon, tue, ... - weekly digests' day
+	TimeZone string   `yaml:"timeZone"` // e.g. Australia/Sydney. The server's if empty.
+	EmailTo  []string `yaml:"emailTo"`  // Sent with email's server settings
+}
+
+// Watchdog notices tags that have stopped checking in - usually a flat
+// battery, no coverage, or a lost collar - and tags checking in without a
+// GPS fix, so the map's out of date.
+type Watchdog struct {
+	SilentAfter   time.Duration `yaml:"silentAfter"`   // 0 turns this off
+	StaleFixAfter time.Duration `yaml:"staleFixAfter"` // 0 turns this off
+}
+
+// ChannelNames are the notification channels set up by the config.
+func (c Config) ChannelNames() []string {
+	names := []string{"ntfy"}
+	for _, wh := range c.Webhooks {
+		names = append(names, wh.Name)
+	}
+	if c.Email.Host != "" {
+		names = append(names, "email")
+	}
+
+	return names
+}
+
+// Default returns the settings used for anything the config file leaves out.
+// There are no default keys.
+func Default() Config {
+	return Config{
+		Server: Server{
+			HTTPAddr:         ":80",
+			HTTPSAddr:        ":443",
+			DefaultStaticDir: "./public_html",
+		},
+		Database: Database{
+			Path: "dogtags.db",
+		},
+		Zones: Zones{
+			NamedZonesDir:    "named_zones",
+			BoundaryZonesDir: "boundary_zones",
+		},
+		Battery: Battery{
+			LowThreshold:      4.0,
+			CriticalThreshold: 3.8,
+			Hysteresis:        0.1,
+		},
+		Ntfy: Ntfy{
+			URLBase: "https://ntfy.sh/",
+		},
+		Email: Email{
+			Port:     587,
+			Security: "starttls",
+		},
+		Retry: Retry{
+			InitialDelay: time.Minute,
+			MaxDelay:     time.Hour,
+			MaxAttempts:  10,
+			KeepFor:      30 * 24 * time.Hour,
+		},
+		Alerts: Alerts{
+			FirstReminder:       5 * time.Minute,
+			MaxReminderInterval: time.Hour,
+			EscalateAfter:       2,
+		},
+		Digest: Digest{
+			At:  "07:00",
+			Day: "mon",
+		},
+		Watchdog: Watchdog{
+			SilentAfter:   time.Hour,
+			StaleFixAfter: time.Hour,
+		},
+		// We don't want to hear about batteries in the middle of the night.
+		QuietHours: QuietHours{
+			Periods: []QuietPeriod{{
+				Start:  "23:00",
+				End:    "08:00",
+				Events: []string{notify.EventLowBattery, notify.EventCriticalBattery},
+			}},
+		},
+	}
+}
+
+// envOverrides are the environment variables that, when set, replace a value
+// from the config file.
+var envOverrides = []struct {
+	name  string
+	apply func(*Config, string)
+}{
+	{"TAG_AUTH_KEY", func(c *Config, v string) { c.Auth.TagKey = v }},
+	{"ADMIN_AUTH_KEY", func(c *Config, v string) { c.Auth.AdminKey = v }},
+	{"NTFY_SUBSCRIPTION_ID", func(c *Config, v string) { c.Ntfy.SubscriptionID = v }},
+	{"NONOTIFY", func(c *Config, _ string) { c.Ntfy.Disabled = true }},
+	{"SMTP_PASSWORD", func(c *Config, v string) { c.Email.Password = v }},
+	{"DOGTAGS_DB_PATH", func(c *Config, v string) { c.Database.Path = v }},
+	{"DOGTAGS_HTTP_ADDR", func(c *Config, v string) { c.Server.HTTPAddr = v }},
+	{"DOGTAGS_HTTPS_ADDR", func(c *Config, v string) { c.Server.HTTPSAddr = v }},
+}
+
+// Load reads the config file over the defaults, applies environment variable
+// overrides, and validates the result. Unknown keys in the file are errors, to
+// catch typos.
+func Load(path string) (Config, error) {
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("reading config file: %w", err)
+	}
+
+	cfg := Default()
+
+	dec := yaml.NewDecoder(bytes.NewReader(blob))
+	dec.KnownFields(true)
+	err = dec.Decode(&cfg)
+	if err != nil {
+		return Config{}, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	for _, o := range envOverrides {
+		if v := os.Getenv(o.name); v != "" {
+			o.apply(&cfg, v)
+		}
+	}
+	for i, wh := range cfg.Webhooks {
+		if wh.SecretEnv != "" {
+			cfg.Webhooks[i].Secret = os.Getenv(wh.SecretEnv)
+		}
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid config in %s:\n%w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// Validate returns all the problems with the config, joined, or nil.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	// Addresses can have names, e.g. "Dog Tags <tags@example.com>".
+	checkAddress := func(field, addr string) {
+		_, err := mail.ParseAddress(addr)
+		check(err == nil, "%s %q isn't an email address: %v", field, addr, err)
+	}
+
+	check(c.Server.HTTPAddr != "", "server.httpAddr is empty")
+	check(c.Server.HTTPSAddr != "", "server.httpsAddr is empty")
+	check(c.Server.DefaultStaticDir != "", "server.defaultStaticDir is empty")
+	check(c.Database.Path != "", "database.path is empty")
+	check(c.Auth.TagKey != "", "auth.tagKey is empty (set it, or the TAG_AUTH_KEY env var)")
+
+	check(c.Zones.NamedZonesDir != "", "zones.namedZonesDir is empty")
+	check(c.Zones.BoundaryZonesDir != "", "zones.boundaryZonesDir is empty")
+
+	b := c.Battery
+	check(b.LowThreshold > 0, "battery.lowThreshold must be positive, got %v", b.LowThreshold)
+	check(b.CriticalThreshold > 0, "battery.criticalThreshold must be positive, got %v", b.CriticalThreshold)
+	check(b.CriticalThreshold < b.LowThreshold, "battery.criticalThreshold (%v) must be below battery.lowThreshold (%v)", b.CriticalThreshold, b.LowThreshold)
+	check(b.Hysteresis >= 0, "battery.hysteresis can't be negative, got %v", b.Hysteresis)
+
+	if !c.Ntfy.Disabled {
+		check(c.Ntfy.URLBase != "", "ntfy.urlBase is empty")
+	}
+
+	if e := c.Email; e.Host != "" {
+		check(e.Port > 0 && e.Port <= 65535, "email.port must be 1-65535, got %d", e.Port)
+		check(e.Security == "starttls" || e.Security == "tls" || e.Security == "none",
+			"email.security must be starttls, tls or none, got %q", e.Security)
+		check(e.From != "", "email.from is empty")
+		if e.From != "" {
+			checkAddress("email.from", e.From)
+		}
+		check(len(e.To) > 0, "email.to is empty")
+		for i, to := range e.To {
+			checkAddress(fmt.Sprintf("email.to[%d]", i), to)
+		}
+	}
+
+	for i, wh := range c.Webhooks {
+		check(wh.Name != "", "webhooks[%d].name is empty", i)
+		check(wh.Name != "ntfy" && wh.Name != "email", "webhooks[%d].name can't be %q, it's taken", i, wh.Name)
+		check(!slices.ContainsFunc(c.Webhooks[:i], func(o Webhook) bool { return o.Name == wh.Name }),
+			"webhooks[%d].name %q is used twice", i, wh.Name)
+		u, err := url.Parse(wh.URL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"webhooks[%d].url should be an http or https URL, got %q", i, wh.URL)
+		check(wh.SecretEnv == "" || wh.Secret != "", "webhooks[%d].secretEnv: %s is not set", i, wh.SecretEnv)
+	}
+
+	rt := c.Retry
+	check(rt.InitialDelay > 0, "retry.initialDelay must be positive, got %v", rt.InitialDelay)
+	check(rt.MaxDelay >= rt.InitialDelay, "retry.maxDelay (%v) is less than retry.initialDelay (%v)", rt.MaxDelay, rt.InitialDelay)
+	check(rt.MaxAttempts >= 1, "retry.maxAttempts must be at least 1, got %d", rt.MaxAttempts)
+	check(rt.KeepFor > 0, "retry.keepFor must be positive, got %v", rt.KeepFor)
+
+	channels := c.ChannelNames()
+	for i, r := range c.Routes {
+		check(len(r.Channels) > 0, "routes[%d].channels is empty", i)
+		for _, ch := range r.Channels {
+			check(slices.Contains(channels, ch), "routes[%d]: no channel called %q (have %v)", i, ch, channels)
+		}
+		for _, e := range r.Events {
+			check(slices.Contains(notify.Events, e), "routes[%d]: unknown event %q (have %v)", i, e, notify.Events)
+		}
+		if r.MinSeverity != "" {
+			_, err := notify.ParseSeverity(r.MinSeverity)
+			check(err == nil, "routes[%d].minSeverity: %v", i, err)
+		}
+	}
+
+	if a := c.Alerts; len(a.Events) > 0 {
+		u, err := url.Parse(a.AckURL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"alerts.ackURL should be an http or https URL, got %q", a.AckURL)
+		for _, e := range a.Events {
+			check(slices.Contains(notify.Events, e), "alerts: unknown event %q (have %v)", e, notify.Events)
+		}
+		check(a.FirstReminder > 0, "alerts.firstReminder must be positive, got %v", a.FirstReminder)
+		check(a.MaxReminderInterval >= a.FirstReminder, "alerts.maxReminderInterval (%v) is less than alerts.firstReminder (%v)",
+			a.MaxReminderInterval, a.FirstReminder)
+		check(a.EscalateAfter >= 0, "alerts.escalateAfter can't be negative, got %d", a.EscalateAfter)
+		for _, ch := range a.EscalateTo {
+			check(slices.Contains(channels, ch), "alerts.escalateTo: no channel called %q (have %v)", ch, channels)
+		}
+		check(len(a.EscalateEmailTo) == 0 || c.Email.Host != "", "alerts.escalateEmailTo needs email.host set")
+		for i, to := range a.EscalateEmailTo {
+			checkAddress(fmt.Sprintf("alerts.escalateEmailTo[%d]", i), to)
+		}
+	}
+
+	check(c.Watchdog.SilentAfter >= 0, "watchdog.silentAfter can't be negative, got %v", c.Watchdog.SilentAfter)
+	check(c.Watchdog.StaleFixAfter >= 0, "watchdog.staleFixAfter can't be negative, got %v", c.Watchdog.StaleFixAfter)
+
+	if d := c.Digest; d.Period != "" {
+		check(d.Period == "daily" || d.Period == "weekly", "digest.period must be daily or weekly, got %q", d.Period)
+		_, err := parseTimeOfDay(d.At)
+		check(err == nil, "digest.at: %v", err)
+		_, err = parseWeekday(d.Day)
+		check(err == nil, "digest.day: %v", err)
+		_, err = loadLocation(d.TimeZone)
+		check(err == nil, "digest.timeZone: %v", err)
+		check(len(d.EmailTo) == 0 || c.Email.Host != "", "digest.emailTo needs email.host set")
+		for i, to := range d.EmailTo {
+			checkAddress(fmt.Sprintf("digest.emailTo[%d]", i), to)
+		}
+	}
+
+	_, err := loadLocation(c.QuietHours.TimeZone)
+	check(err == nil, "quietHours.timeZone: %v", err)
+	for i, p := range c.QuietHours.Periods {
+		for _, d := range p.Days {
+			_, err := parseWeekday(d)
+			check(err == nil, "quietHours.periods[%d].days: %v", i, err)
+		}
+		_, err := parseTimeOfDay(p.Start)
+		check(err == nil, "quietHours.periods[%d].start: %v", i, err)
+		_, err = parseTimeOfDay(p.End)
+		check(err == nil, "quietHours.periods[%d].end: %v", i, err)
+		for _, e := range p.Events {
+			check(slices.Contains(notify.Events, e), "quietHours.periods[%d]: unknown event %q (have %v)", i, e, notify.Events)
+		}
+		for _, ch := range p.Channels {
+			check(slices.Contains(channels, ch), "quietHours.periods[%d]: no channel called %q (have %v)", i, ch, channels)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// NotifyRules turns the routes into rules for notify.NewMultiNotifier. The
+// routes must have been validated.
+func (c Config) NotifyRules() []notify.Rule {
+	rules := make([]notify.Rule, 0, len(c.Routes))
+	for _, r := range c.Routes {
+		var severity notify.Severity
+		if r.MinSeverity != "" {
+			severity, _ = notify.ParseSeverity(r.MinSeverity) //nolint:errcheck // validated
+		}
+		rules = append(rules, notify.Rule{Events: r.Events, Tags: r.Tags, MinSeverity: severity, Channels: r.Channels})
+	}
+
+	return rules
+}
+
+// QuietSchedule turns the quiet hours into a notify.Schedule. The quiet hours
+// must have been validated.
+func (c Config) QuietSchedule() notify.Schedule {
+	loc, _ := loadLocation(c.QuietHours.TimeZone) //nolint:errcheck // validated
+
+	periods := make([]notify.QuietPeriod, 0, len(c.QuietHours.Periods))
+	for _, p := range c.QuietHours.Periods {
+		qp := notify.QuietPeriod{Events: p.Events, Channels: p.Channels}
+		for _, d := range p.Days {
+			day, _ := parseWeekday(d) //nolint:errcheck // validated
+			qp.Days = append(qp.Days, day)
+		}
+		qp.Start, _ = parseTimeOfDay(p.Start) //nolint:errcheck // validated
+		qp.End, _ = parseTimeOfDay(p.End)     //nolint:errcheck // validated
+		periods = append(periods, qp)
+	}
+
+	return notify.Schedule{Location: loc, Periods: periods}
+}
+
+// DigestTimes says when digests are sent: at a time of day in a time zone,
+// and for weekly digests, on a day. The digest settings must have been
+// validated.
+func (c Config) DigestTimes() (day time.Weekday, at time.Duration, loc *time.Location) {
+	day, _ = parseWeekday(c.Digest.Day)      //nolint:errcheck // validated
+	at, _ = parseTimeOfDay(c.Digest.At)      //nolint:errcheck // validated
+	loc, _ = loadLocation(c.Digest.TimeZone) //nolint:errcheck // validated
+
+	return day, at, loc
+}
+
+// loadLocation loads a time zone, the server's if the name is empty.
+// time.LoadLocation would take "" to be UTC.
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+
+	return time.LoadLocation(name)
+}
+
+// parseWeekday turns "mon" or "Monday" (any case) into a time.Weekday.
+func parseWeekday(name string) (time.Weekday, error) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		full := strings.ToLower(d.String())
+		if n := strings.ToLower(name); n == full || n == full[:3] {
+			return d, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown day %q, should be mon, tue, ... or sun", name)
+}
+
+// parseTimeOfDay turns "HH:MM" into the time since midnight.
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("should be HH:MM, got %q", s)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
@@ -0,0 +1,414 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bitwombat/gps-tags/notify"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, contents string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte(contents), 0o600)
+	require.Nil(t, err)
+
+	return path
+}
+
+const minimalConfig = `
+auth:
+  tagKey: abc
+`
+
+func TestLoadShippedConfig(t *testing.T) {
+	t.Setenv("TAG_AUTH_KEY", "xxxx")
+
+	cfg, err := Load("../../config.yaml")
+	require.Nil(t, err)
+	require.Equal(t, "./public_html.photos", cfg.Server.StaticDirs["photos.bitwombat.com.au"])
+	require.Equal(t, "boundary_zones", cfg.Zones.BoundaryZonesDir)
+}
+
+func TestLoadUsesDefaults(t *testing.T) {
+	cfg, err := Load(writeConfig(t, minimalConfig))
+	require.Nil(t, err)
+
+	require.Equal(t, Default().Battery, cfg.Battery)
+	require.Equal(t, Default().Retry, cfg.Retry)
+	require.Equal(t, Default().Watchdog, cfg.Watchdog)
+	require.Equal(t, ":443", cfg.Server.HTTPSAddr)
+	require.Equal(t, "abc", cfg.Auth.TagKey)
+}
+
+func TestLoadEnvOverrides(t *testing.T) {
+	t.Setenv("TAG_AUTH_KEY", "fromenv")
+	t.Setenv("NONOTIFY", "1")
+	t.Setenv("DOGTAGS_DB_PATH", "/tmp/other.db")
+
+	cfg, err := Load(writeConfig(t, minimalConfig))
+	require.Nil(t, err)
+
+	require.Equal(t, "fromenv", cfg.Auth.TagKey)
+	require.True(t, cfg.Ntfy.Disabled)
+	require.Equal(t, "/tmp/other.db", cfg.Database.Path)
+}
+
+func TestLoadWebhooks(t *testing.T) {
+	t.Setenv("HA_WEBHOOK_SECRET", "shh")
+
+	cfg, err := Load(writeConfig(t, minimalConfig+`
+webhooks:
+  - name: home assistant
+    url: https://ha.example.com/api/webhook/dogs
+    secretEnv: HA_WEBHOOK_SECRET
+  - name: chat bot
+    url: http://localhost:8080/hook
+    contentType: application/x-www-form-urlencoded
+    template: "text={{urlquery .Title}}"
+    headers:
+      Authorization: Bearer abc
+`))
+	require.Nil(t, err)
+
+	require.Len(t, cfg.Webhooks, 2)
+	require.Equal(t, "shh", cfg.Webhooks[0].Secret)
+	require.Equal(t, "Bearer abc", cfg.Webhooks[1].Headers["Authorization"])
+}
+
+func TestLoadEmail(t *testing.T) {
+	t.Setenv("SMTP_PASSWORD", "fromenv")
+
+	cfg, err := Load(writeConfig(t, minimalConfig+`
+email:
+  host: smtp.example.com
+  username: dogs
+  from: tags@example.com
+  to: [a@example.com, b@example.com]
+`))
+	require.Nil(t, err)
+
+	require.Equal(t, 587, cfg.Email.Port)
+	require.Equal(t, "starttls", cfg.Email.Security)
+	require.Equal(t, "fromenv", cfg.Email.Password)
+	require.Len(t, cfg.Email.To, 2)
+}
+
+func TestLoadRoutes(t *testing.T) {
+	cfg, err := Load(writeConfig(t, minimalConfig+`
+webhooks:
+  - name: chat
+    url: https://chat.example.com/hook
+email:
+  host: smtp.example.com
+  from: tags@example.com
+  to: [a@example.com]
+routes:
+  - events: [criticalBattery]
+    channels: [ntfy, email]
+  - events: [leave, enter, approach]
+    tags: [Rueger]
+    minSeverity: warning
+    channels: [ntfy, chat]
+`))
+	require.Nil(t, err)
+
+	require.Equal(t, []string{"ntfy", "chat", "email"}, cfg.ChannelNames())
+	require.Equal(t, []notify.Rule{
+		{Events: []string{"criticalBattery"}, Channels: []string{"ntfy", "email"}},
+		{Events: []string{"leave", "enter", "approach"}, Tags: []string{"Rueger"}, MinSeverity: notify.SeverityWarning, Channels: []string{"ntfy", "chat"}},
+	}, cfg.NotifyRules())
+}
+
+func TestLoadRetry(t *testing.T) {
+	cfg, err := Load(writeConfig(t, minimalConfig+`
+retry:
+  initialDelay: 30s
+  maxDelay: 2h
+  maxAttempts: 20
+  keepFor: 168h
+`))
+	require.Nil(t, err)
+
+	require.Equal(t, Retry{InitialDelay: 30 * time.Second, MaxDelay: 2 * time.Hour, MaxAttempts: 20, KeepFor: 7 * 24 * time.Hour}, cfg.Retry)
+}
+
+func TestLoadQuietHours(t *testing.T) {
+	cfg, err := Load(writeConfig(t, minimalConfig+`
+quietHours:
+  timeZone: Australia/Sydney
+  periods:
+    - start: "22:30"
+      end: "07:00"
+      events: [lowBattery, newBattery]
+    - days: [sat, Sunday]
+      start: "00:00"
+      end: "00:00"
+      channels: [ntfy]
+`))
+	require.Nil(t, err)
+
+	schedule := cfg.QuietSchedule()
+	require.Equal(t, "Australia/Sydney", schedule.Location.String())
+	require.Equal(t, []notify.QuietPeriod{
+		{Start: 22*time.Hour + 30*time.Minute, End: 7 * time.Hour, Events: []string{"lowBattery", "newBattery"}},
+		{Days: []time.Weekday{time.Saturday, time.Sunday}, Channels: []string{"ntfy"}},
+	}, schedule.Periods)
+}
+
+func TestDefaultQuietHours(t *testing.T) {
+	// Battery alerts are held back overnight, in the server's time zone.
+	schedule := Default().QuietSchedule()
+	require.Equal(t, time.Local, schedule.Location)
+
+	night := time.Date(2025, 9, 6, 23, 30, 0, 0, time.Local)
+	require.True(t, schedule.IsQuiet(night, "ntfy", notify.Event{Kind: notify.EventLowBattery}))
+	require.False(t, schedule.IsQuiet(night, "ntfy", notify.Event{Kind: notify.EventLeave}))
+	require.False(t, schedule.IsQuiet(night.Add(9*time.Hour), "ntfy", notify.Event{Kind: notify.EventLowBattery}))
+}
+
+func TestLoadAlerts(t *testing.T) {
+	cfg, err := Load(writeConfig(t, minimalConfig+`
+email:
+  host: smtp.example.com
+  from: tags@example.com
+  to: [a@example.com]
+alerts:
+  events: [leave, criticalBattery]
+  ackURL: https://tags.example.com/ack
+  firstReminder: 2m
+  escalateTo: [email]
+  escalateEmailTo: [neighbour@example.com]
+`))
+	require.Nil(t, err)
+
+	require.Equal(t, Alerts{
+		Events:              []string{"leave", "criticalBattery"},
+		AckURL:              "https://tags.example.com/ack",
+		FirstReminder:       2 * time.Minute,
+		MaxReminderInterval: time.Hour,
+		EscalateAfter:       2,
+		EscalateTo:          []string{"email"},
+		EscalateEmailTo:     []string{"neighbour@example.com"},
+	}, cfg.Alerts)
+}
+
+func TestLoadDigest(t *testing.T) {
+	cfg, err := Load(writeConfig(t, minimalConfig+`
+email:
+  host: smtp.example.com
+  from: tags@example.com
+  to: [a@example.com]
+digest:
+  period: weekly
+  at: "18:30"
+  day: Sunday
+  timeZone: Australia/Sydney
+  emailTo: [reports@example.com]
+`))
+	require.Nil(t, err)
+
+	day, at, loc := cfg.DigestTimes()
+	require.Equal(t, time.Sunday, day)
+	require.Equal(t, 18*time.Hour+30*time.Minute, at)
+	require.Equal(t, "Australia/Sydney", loc.String())
+	require.Equal(t, []string{"reports@example.com"}, cfg.Digest.EmailTo)
+}
+
+func TestLoadErrors(t *testing.T) {
+	for _, tc := range []struct {
+		description string
+		contents    string
+		wantErrs    []string
+	}{
+		{
+			description: "malformed YAML",
+			contents:    "battery: [",
+			wantErrs:    []string{"parsing config file"},
+		},
+		{
+			description: "misspelt key",
+			contents:    minimalConfig + "batery:\n  lowThreshold: 4\n",
+			wantErrs:    []string{"field batery not found"},
+		},
+		{
+			description: "every problem is reported",
+			contents: `
+battery:
+  lowThreshold: 3.5
+  criticalThreshold: 3.8
+zones:
+  boundaryZonesDir: ""
+`,
+			wantErrs: []string{
+				"auth.tagKey is empty",
+				"zones.boundaryZonesDir is empty",
+				"battery.criticalThreshold (3.8) must be below battery.lowThreshold (3.5)",
+			},
+		},
+		{
+			description: "bad webhooks",
+			contents: minimalConfig + `
+webhooks:
+  - url: ha.example.com/hook
+  - name: signed
+    url: https://example.com/hook
+    secretEnv: NOT_SET_ANYWHERE
+`,
+			wantErrs: []string{
+				"webhooks[0].name is empty",
+				`webhooks[0].url should be an http or https URL, got "ha.example.com/hook"`,
+				"webhooks[1].secretEnv: NOT_SET_ANYWHERE is not set",
+			},
+		},
+		{
+			description: "bad email",
+			contents: minimalConfig + `
+email:
+  host: smtp.example.com
+  port: 0
+  security: ssl
+`,
+			wantErrs: []string{
+				"email.port must be 1-65535, got 0",
+				`email.security must be starttls, tls or none, got "ssl"`,
+				"email.from is empty",
+				"email.to is empty",
+			},
+		},
+		{
+			description: "bad email addresses",
+			contents: minimalConfig + `
+email:
+  host: smtp.example.com
+  from: Dog Tags tags@example.com
+  to: ["Jo <jo@example.com>", "nobody"]
+`,
+			wantErrs: []string{
+				`email.from "Dog Tags tags@example.com" isn't an email address`,
+				`email.to[1] "nobody" isn't an email address`,
+			},
+		},
+		{
+			description: "bad routes",
+			contents: minimalConfig + `
+webhooks:
+  - name: email
+    url: https://example.com/a
+  - name: chat
+    url: https://example.com/b
+  - name: chat
+    url: https://example.com/c
+routes:
+  - events: [escaped]
+    minSeverity: dire
+    channels: [ntfy, sms]
+  - events: [leave]
+`,
+			wantErrs: []string{
+				`webhooks[0].name can't be "email", it's taken`,
+				`webhooks[2].name "chat" is used twice`,
+				`routes[0]: no channel called "sms"`,
+				`routes[0]: unknown event "escaped"`,
+				`routes[0].minSeverity: unknown severity "dire"`,
+				"routes[1].channels is empty",
+			},
+		},
+		{
+			description: "bad retry",
+			contents: minimalConfig + `
+retry:
+  initialDelay: 10m
+  maxDelay: 5m
+  maxAttempts: 0
+  keepFor: -1h
+`,
+			wantErrs: []string{
+				"retry.maxDelay (5m0s) is less than retry.initialDelay (10m0s)",
+				"retry.maxAttempts must be at least 1, got 0",
+				"retry.keepFor must be positive, got -1h0m0s",
+			},
+		},
+		{
+			description: "bad alerts",
+			contents: minimalConfig + `
+alerts:
+  events: [leave, howling]
+  ackURL: /ack
+  firstReminder: 0s
+  escalateAfter: -1
+  escalateTo: [pager]
+  escalateEmailTo: [neighbour@example.com]
+`,
+			wantErrs: []string{
+				`alerts.ackURL should be an http or https URL, got "/ack"`,
+				`alerts: unknown event "howling"`,
+				"alerts.firstReminder must be positive, got 0s",
+				"alerts.escalateAfter can't be negative, got -1",
+				`alerts.escalateTo: no channel called "pager"`,
+				"alerts.escalateEmailTo needs email.host set",
+			},
+		},
+		{
+			description: "bad digest and watchdog",
+			contents: minimalConfig + `
+watchdog:
+  silentAfter: -5m
+  staleFixAfter: -1h
+digest:
+  period: fortnightly
+  at: noon
+  day: someday
+  timeZone: Australia/Woop_Woop
+  emailTo: [reports@example.com]
+`,
+			wantErrs: []string{
+				`digest.period must be daily or weekly, got "fortnightly"`,
+				`digest.at: should be HH:MM, got "noon"`,
+				`digest.day: unknown day "someday"`,
+				"digest.timeZone: unknown time zone Australia/Woop_Woop",
+				"digest.emailTo needs email.host set",
+				"watchdog.silentAfter can't be negative, got -5m0s",
+				"watchdog.staleFixAfter can't be negative, got -1h0m0s",
+			},
+		},
+		{
+			description: "bad quiet hours",
+			contents: minimalConfig + `
+quietHours:
+  timeZone: Australia/Woop_Woop
+  periods:
+    - days: [mon, funday]
+      start: "25:00"
+      end: 8am
+      events: [barking]
+      channels: [sms]
+`,
+			wantErrs: []string{
+				"quietHours.timeZone: unknown time zone Australia/Woop_Woop",
+				`quietHours.periods[0].days: unknown day "funday"`,
+				`quietHours.periods[0].start: should be HH:MM, got "25:00"`,
+				`quietHours.periods[0].end: should be HH:MM, got "8am"`,
+				`quietHours.periods[0]: unknown event "barking"`,
+				`quietHours.periods[0]: no channel called "sms"`,
+			},
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			_, err := Load(writeConfig(t, tc.contents))
+			require.NotNil(t, err)
+			for _, want := range tc.wantErrs {
+				require.ErrorContains(t, err, want)
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := Load(filepath.Join(t.TempDir(), "nope.yaml"))
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
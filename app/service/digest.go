@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/bitwombat/gps-tags/model"
+	"github.com/bitwombat/gps-tags/notify"
+	"github.com/bitwombat/gps-tags/poly"
+	"github.com/bitwombat/gps-tags/registry"
+	"github.com/bitwombat/gps-tags/storage"
+	zonespkg "github.com/bitwombat/gps-tags/zones"
+)
+
+// DigestStorer handles reading what goes into the digests.
+type DigestStorer interface {
+	GetFixesBetween(ctx context.Context, serNo int, from, to time.Time) ([]storage.Fix, error)
+	GetZoneVisits(ctx context.Context, serNo int, from, to time.Time) ([]model.ZoneVisit, error)
+	GetBatteryReadings(ctx context.Context, serNo int, from, to time.Time) ([]storage.BatteryReading, error)
+	GetCheckIns(ctx context.Context, serNo int, from, to time.Time) ([]time.Time, error)
+}
+
+// minMove is how far (metres) a dog has to go for it to count towards the
+// distance travelled, so GPS jitter while it lies in the sun doesn't add up.
+const minMove = 10
+
+// tagDigest sums up what a tag did over a day or a week.
+type tagDigest struct {
+	Name           string
+	Period         string // daily or weekly
+	From, To       time.Time
+	Distance       float64    // Metres
+	Zones          []zoneTime // Most first
+	Breaches       int        // Times it left an alert boundary
+	Battery        batteryTrend
+	CheckIns       int
+	MissedCheckIns int
+}
+
+// batteryTrend is how a battery's voltage went over a period.
+type batteryTrend struct {
+	Readings            int
+	First, Last, Lowest float64 // Volts
+	PerDay              float64 // Volts. 0 if there's not enough to tell.
+	DaysLeft            float64 // Until critical, at PerDay. -1 if it's not going down.
+}
+
+// distanceTravelled adds up the distance between fixes, in metres, ignoring
+// moves of less than minMove.
+func distanceTravelled(fixes []storage.Fix) float64 {
+	if len(fixes) == 0 {
+		return 0
+	}
+
+	var total float64
+	last := poly.Point{X: fixes[0].Longitude, Y: fixes[0].Latitude}
+	for _, f := range fixes[1:] {
+		p := poly.Point{X: f.Longitude, Y: f.Latitude}
+		if d := poly.Distance(last, p); d >= minMove {
+			total += d
+			last = p
+		}
+	}
+
+	return total
+}
+
+// boundaryBreaches counts the times the fixes go from inside an alert
+// boundary to outside it.
+func boundaryBreaches(fixes []storage.Fix, boundaryZones []zonespkg.Zone) int {
+	var breaches int
+	for i := range boundaryZones {
+		wasInside := false
+		for j, f := range fixes {
+			isInside := boundaryZones[i].IsInside(zonespkg.Point{Latitude: f.Latitude, Longitude: f.Longitude})
+			if j > 0 && wasInside && !isInside {
+				breaches++
+			}
+			wasInside = isInside
+		}
+	}
+
+	return breaches
+}
+
+// batteryTrendOf fits a straight line to the readings, to say how fast the
+// battery's going down, and how long until it's critical.
+func batteryTrendOf(readings []storage.BatteryReading, critical float64) batteryTrend {
+	bt := batteryTrend{Readings: len(readings), DaysLeft: -1}
+	if len(readings) == 0 {
+		return bt
+	}
+
+	bt.First, bt.Last, bt.Lowest = readings[0].Volts, readings[len(readings)-1].Volts, readings[0].Volts
+	for _, r := range readings {
+		bt.Lowest = min(bt.Lowest, r.Volts)
+	}
+
+	// Least squares, with days since the first reading against volts.
+	start := readings[0].DeviceUTC
+	if readings[len(readings)-1].DeviceUTC.Sub(start) < time.Hour {
+		return bt
+	}
+	var n, sumX, sumY, sumXY, sumXX float64
+	for _, r := range readings {
+		x := r.DeviceUTC.Sub(start).Hours() / 24
+		n++
+		sumX += x
+		sumY += r.Volts
+		sumXY += x * r.Volts
+		sumXX += x * x
+	}
+	bt.PerDay = (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
+
+	if bt.PerDay < 0 {
+		bt.DaysLeft = max(0, (bt.Last-critical)/-bt.PerDay)
+	}
+
+	return bt
+}
+
+// missedCheckIns counts the heartbeats missing between from and to.
+func missedCheckIns(checkIns []time.Time, from, to time.Time) int {
+	var missed int
+	last := from
+	for _, t := range append(checkIns, to) {
+		missed += max(0, int(math.Round(float64(t.Sub(last))/float64(heartBeatTime)))-1)
+		last = t
+	}
+
+	return missed
+}
+
+// makeDigest sums up what the tag did from one time up to another.
+func makeDigest(ctx context.Context, storer DigestStorer, tag model.Tag, period string, from, to time.Time, boundaryZones []zonespkg.Zone, critical float64) (tagDigest, error) {
+	fixes, err := storer.GetFixesBetween(ctx, tag.SerNo, from, to)
+	if err != nil {
+		return tagDigest{}, fmt.Errorf("getting fixes: %w", err)
+	}
+	visits, err := storer.GetZoneVisits(ctx, tag.SerNo, from, to)
+	if err != nil {
+		return tagDigest{}, fmt.Errorf("getting zone visits: %w", err)
+	}
+	readings, err := storer.GetBatteryReadings(ctx, tag.SerNo, from, to)
+	if err != nil {
+		return tagDigest{}, fmt.Errorf("getting battery readings: %w", err)
+	}
+	checkIns, err := storer.GetCheckIns(ctx, tag.SerNo, from, to)
+	if err != nil {
+		return tagDigest{}, fmt.Errorf("getting check-ins: %w", err)
+	}
+
+	return tagDigest{
+		Name:           tag.Name,
+		Period:         period,
+		From:           from,
+		To:             to,
+		Distance:       distanceTravelled(fixes),
+		Zones:          timePerZone(visits, from, to),
+		Breaches:       boundaryBreaches(fixes, boundaryZones),
+		Battery:        batteryTrendOf(readings, critical),
+		CheckIns:       len(checkIns),
+		MissedCheckIns: missedCheckIns(checkIns, from, to),
+	}, nil
+}
+
+// Km is the distance travelled, for display.
+func (d tagDigest) Km() string {
+	return fmt.Sprintf("%.1f km", d.Distance/1000)
+}
+
+// Dates is the period covered, for display.
+func (d tagDigest) Dates() string {
+	last := d.To.AddDate(0, 0, -1)
+	if last.Equal(d.From) {
+		return d.From.Format("Mon 2 Jan")
+	}
+
+	return d.From.Format("Mon 2 Jan") + " to " + last.Format("Mon 2 Jan")
+}
+
+// Summary says how the battery went, for display.
+func (bt batteryTrend) Summary() string {
+	if bt.Readings == 0 {
+		return "no readings"
+	}
+
+	s := fmt.Sprintf("%.2f V to %.2f V", bt.First, bt.Last)
+	switch {
+	case bt.PerDay == 0:
+	case bt.DaysLeft < 0:
+		s += fmt.Sprintf(" (%+.3f V/day)", bt.PerDay)
+	default:
+		s += fmt.Sprintf(" (%+.3f V/day, about %.0f days left)", bt.PerDay, bt.DaysLeft)
+	}
+
+	return s
+}
+
+func (d tagDigest) zonesText() string {
+	if len(d.Zones) == 0 {
+		return "no fixes"
+	}
+
+	zones := make([]string, 0, len(d.Zones))
+	for _, zt := range d.Zones {
+		zones = append(zones, zt.Zone+" "+zt.Hours()+" h")
+	}
+
+	return strings.Join(zones, ", ")
+}
+
+var digestHTMLTemplate = template.Must(template.New("digest").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif">
+<h2>{{.Name}}'s {{.Period}} digest</h2>
+<p>{{.Dates}}</p>
+<table cellpadding="4">
+<tr><th align="left">Distance</th><td>{{.Km}}</td></tr>
+<tr><th align="left">Boundary breaches</th><td>{{.Breaches}}</td></tr>
+<tr><th align="left">Battery</th><td>{{.Battery.Summary}}</td></tr>
+<tr><th align="left">Check-ins</th><td>{{.CheckIns}} ({{.MissedCheckIns}} missed)</td></tr>
+</table>
+<h3>Time in zones</h3>
+<table cellpadding="4">
+{{range .Zones}}<tr><td>{{.Zone}}</td><td align="right">{{.Hours}} h</td></tr>
+{{else}}<tr><td>No fixes</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// event is the digest as a notification, with the HTML report for those that
+// can show it.
+func (d tagDigest) event(serNo int, now time.Time) (notify.Event, error) {
+	var html bytes.Buffer
+	err := digestHTMLTemplate.Execute(&html, d)
+	if err != nil {
+		return notify.Event{}, fmt.Errorf("rendering digest report: %w", err)
+	}
+
+	return notify.Event{
+		Kind:     notify.EventDigest,
+		Severity: notify.SeverityInfo,
+		Title:    notify.Title(fmt.Sprintf("%s's %s digest", d.Name, d.Period)),
+		Message: notify.Message(fmt.Sprintf(
+			"%s\nDistance: %s\nZones: %s\nBoundary breaches: %d\nBattery: %s\nCheck-ins: %d (%d missed)",
+			d.Dates(), d.Km(), d.zonesText(), d.Breaches, d.Battery.Summary(), d.CheckIns, d.MissedCheckIns)),
+		SerNo: serNo,
+		Tag:   d.Name,
+		Time:  now,
+		HTML:  html.String(),
+	}, nil
+}
+
+// digester sends a digest for each tag every day or week.
+type digester struct {
+	storer   DigestStorer
+	tags     *registry.Registry
+	zones    *zoneHolder
+	notifier notify.Notifier
+	report   notify.Notifier // Emails the report as well, if not nil
+	weekly   bool
+	day      time.Weekday  // Weekly digests' day
+	at       time.Duration // Time of day
+	loc      *time.Location
+	critical float64 // Battery volts
+	now      func() time.Time
+}
+
+// next is when the first digest after a time is due.
+func (dg digester) next(after time.Time) time.Time {
+	local := after.In(dg.loc)
+	hour, minute := int(dg.at/time.Hour), int(dg.at%time.Hour/time.Minute)
+
+	for i := 0; ; i++ {
+		t := time.Date(local.Year(), local.Month(), local.Day()+i, hour, minute, 0, 0, dg.loc)
+		if t.After(after) && (!dg.weekly || t.Weekday() == dg.day) {
+			return t
+		}
+	}
+}
+
+// Send sends each active tag's digest for the day, or the week, before the
+// one due is in.
+func (dg digester) Send(ctx context.Context, due time.Time) error {
+	local := due.In(dg.loc)
+	to := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, dg.loc)
+	from, period := to.AddDate(0, 0, -1), "daily"
+	if dg.weekly {
+		from, period = to.AddDate(0, 0, -7), "weekly"
+	}
+
+	var errs []error
+	for _, tag := range dg.tags.Active() {
+		d, err := makeDigest(ctx, dg.storer, tag, period, from, to, dg.zones.Get().boundaryZones, dg.critical)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", tag.Name, err))
+			continue
+		}
+
+		e, err := d.event(tag.SerNo, dg.now())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", tag.Name, err))
+			continue
+		}
+
+		err = dg.notifier.Notify(ctx, e)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: sending digest: %w", tag.Name, err))
+		}
+		if dg.report != nil {
+			err = dg.report.Notify(ctx, e)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: emailing digest: %w", tag.Name, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// run sends digests when they're due, until ctx is done.
+func (dg digester) run(ctx context.Context) {
+	for {
+		due := dg.next(dg.now())
+		timer := time.NewTimer(time.Until(due))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			err := dg.Send(ctx, due)
+			if err != nil {
+				errorLogger.Printf("Error sending digests: %v", err)
+			}
+		}
+	}
+}
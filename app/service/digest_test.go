@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bitwombat/gps-tags/model"
+	"github.com/bitwombat/gps-tags/notify"
+	"github.com/bitwombat/gps-tags/storage"
+	zonespkg "github.com/bitwombat/gps-tags/zones"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDistanceTravelled(t *testing.T) {
+	// GIVEN a dog walking 0.01 degrees of latitude (about 1.1 km) north, with
+	// jitter of a few metres at each end
+	fixes := []storage.Fix{
+		{Latitude: 0, Longitude: 0},
+		{Latitude: 0.00002, Longitude: 0},
+		{Latitude: 0, Longitude: 0.00002},
+		{Latitude: 0.005, Longitude: 0},
+		{Latitude: 0.01, Longitude: 0},
+		{Latitude: 0.01002, Longitude: 0},
+	}
+
+	// WHEN the distance is added up
+	got := distanceTravelled(fixes)
+
+	// THEN the jitter doesn't count.
+	require.InDelta(t, 1112, got, 5)
+	require.Zero(t, distanceTravelled(nil))
+}
+
+func TestBoundaryBreaches(t *testing.T) {
+	// GIVEN a dog that leaves the square twice, starting outside it
+	square := []zonespkg.Zone{{Name: "Square", Polygons: testSquare}}
+	fixes := []storage.Fix{
+		{Latitude: 2, Longitude: 0},
+		{Latitude: 0, Longitude: 0},
+		{Latitude: 2, Longitude: 0},
+		{Latitude: 2, Longitude: 2},
+		{Latitude: 0, Longitude: 0},
+		{Latitude: 0, Longitude: -2},
+	}
+
+	// WHEN the breaches are counted
+	// THEN it's the times it went from in to out.
+	require.Equal(t, 2, boundaryBreaches(fixes, square))
+}
+
+func TestBatteryTrend(t *testing.T) {
+	start := mkTime("2025-09-01 00:00:00")
+
+	for _, tc := range []struct {
+		name     string
+		readings []storage.BatteryReading
+		want     batteryTrend
+	}{
+		{
+			name: "no readings",
+			want: batteryTrend{DaysLeft: -1},
+		},
+		{
+			name: "going down 0.05 V a day",
+			readings: []storage.BatteryReading{
+				{DeviceUTC: start, Volts: 4.10},
+				{DeviceUTC: start.Add(12 * time.Hour), Volts: 4.075},
+				{DeviceUTC: start.Add(24 * time.Hour), Volts: 4.05},
+			},
+			want: batteryTrend{Readings: 3, First: 4.10, Last: 4.05, Lowest: 4.05, PerDay: -0.05, DaysLeft: 5},
+		},
+		{
+			name: "charging",
+			readings: []storage.BatteryReading{
+				{DeviceUTC: start, Volts: 3.9},
+				{DeviceUTC: start.Add(24 * time.Hour), Volts: 4.1},
+			},
+			want: batteryTrend{Readings: 2, First: 3.9, Last: 4.1, Lowest: 3.9, PerDay: 0.2, DaysLeft: -1},
+		},
+		{
+			name: "too close together to tell",
+			readings: []storage.BatteryReading{
+				{DeviceUTC: start, Volts: 4.1},
+				{DeviceUTC: start.Add(10 * time.Minute), Volts: 4.0},
+			},
+			want: batteryTrend{Readings: 2, First: 4.1, Last: 4.0, Lowest: 4.0, DaysLeft: -1},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := batteryTrendOf(tc.readings, 3.8)
+			require.InDelta(t, tc.want.PerDay, got.PerDay, 1e-9)
+			require.InDelta(t, tc.want.DaysLeft, got.DaysLeft, 1e-6)
+			got.PerDay, got.DaysLeft = tc.want.PerDay, tc.want.DaysLeft
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestMissedCheckIns(t *testing.T) {
+	// GIVEN check-ins every 10 minutes for an hour, but for a 30 minute gap,
+	// and none for the last 20 minutes
+	from := mkTime("2025-09-01 00:00:00")
+	checkIns := []time.Time{
+		from.Add(10 * time.Minute),
+		from.Add(40 * time.Minute),
+	}
+
+	// WHEN the missed ones are counted
+	// THEN it's the 2 in the gap, and 1 before the end.
+	require.Equal(t, 3, missedCheckIns(checkIns, from, from.Add(time.Hour)))
+}
+
+func TestDigesterNext(t *testing.T) {
+	sydney, err := time.LoadLocation("Australia/Sydney")
+	require.Nil(t, err)
+
+	daily := digester{at: 7 * time.Hour, loc: sydney}
+	weekly := digester{weekly: true, day: time.Monday, at: 7 * time.Hour, loc: sydney}
+
+	for _, tc := range []struct {
+		name  string
+		dg    digester
+		after time.Time
+		want  time.Time
+	}{
+		{"daily, later today", daily, time.Date(2025, 9, 3, 6, 0, 0, 0, sydney), time.Date(2025, 9, 3, 7, 0, 0, 0, sydney)},
+		{"daily, tomorrow", daily, time.Date(2025, 9, 3, 7, 0, 0, 0, sydney), time.Date(2025, 9, 4, 7, 0, 0, 0, sydney)},
+		{"daily, across daylight saving", daily, time.Date(2025, 10, 4, 8, 0, 0, 0, sydney), time.Date(2025, 10, 5, 7, 0, 0, 0, sydney)},
+		{"weekly", weekly, time.Date(2025, 9, 3, 6, 0, 0, 0, sydney), time.Date(2025, 9, 8, 7, 0, 0, 0, sydney)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, tc.dg.next(tc.after))
+		})
+	}
+}
+
+func TestDigesterSend(t *testing.T) {
+	// GIVEN a day's worth of Rueger, and nothing for Charlie
+	day := mkTime("2025-09-01 00:00:00")
+	storer := FakeDigestStorer{
+		fixes: map[int][]storage.Fix{
+			810095: {
+				{GpsUTC: day.Add(time.Hour), Latitude: 0, Longitude: 0},
+				{GpsUTC: day.Add(2 * time.Hour), Latitude: 0.02, Longitude: 0},
+			},
+		},
+		visits: map[int][]model.ZoneVisit{
+			810095: {
+				{Zone: "House", Entered: day, Exited: day.Add(20 * time.Hour)},
+				{Zone: "East dam", Entered: day.Add(20 * time.Hour), LastSeen: day.Add(24 * time.Hour)},
+			},
+		},
+		readings: map[int][]storage.BatteryReading{
+			810095: {
+				{DeviceUTC: day, Volts: 4.10},
+				{DeviceUTC: day.Add(24 * time.Hour), Volts: 4.05},
+			},
+		},
+		checkIns: map[int][]time.Time{
+			810095: {day.Add(10 * time.Minute)},
+		},
+	}
+	notifier, report := &FakeNotifier{}, &FakeNotifier{}
+	dg := digester{
+		storer:   storer,
+		tags:     newFakeRegistry(),
+		zones:    newStaticZoneHolder(zoneSet{boundaryZones: []zonespkg.Zone{{Name: "Square", Polygons: testSquareSmall}}}),
+		notifier: notifier,
+		report:   report,
+		at:       7 * time.Hour,
+		loc:      time.UTC,
+		critical: 3.8,
+		now:      func() time.Time { return day.Add(31 * time.Hour) },
+	}
+
+	// WHEN the digests due the next morning are sent
+	err := dg.Send(context.Background(), day.Add(31*time.Hour))
+	require.Nil(t, err)
+
+	// THEN each dog gets one, sent and emailed
+	require.Len(t, notifier.notifications, 2)
+	require.Len(t, report.notifications, 2)
+
+	var rueger notify.Event
+	for _, n := range notifier.notifications {
+		if n.event.SerNo == 810095 {
+			rueger = n.event
+		}
+	}
+
+	// AND it sums up the day.
+	require.Equal(t, notify.EventDigest, rueger.Kind)
+	require.Equal(t, notify.Title("Rueger's daily digest"), rueger.Title)
+	require.Equal(t, notify.Message(`Mon 1 Sep
+Distance: 2.2 km
+Zones: House 20.0 h, East dam 4.0 h
+Boundary breaches: 1
+Battery: 4.10 V to 4.05 V (-0.050 V/day, about 5 days left)
+Check-ins: 1 (142 missed)`), rueger.Message)
+	require.Contains(t, rueger.HTML, "<h2>Rueger's daily digest</h2>")
+	require.Contains(t, rueger.HTML, "<tr><td>East dam</td><td align=\"right\">4.0 h</td></tr>")
+}
@@ -3,43 +3,323 @@ package main
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/bitwombat/gps-tags/model"
 	"github.com/bitwombat/gps-tags/notify"
+	"github.com/bitwombat/gps-tags/registry"
 	"github.com/bitwombat/gps-tags/storage"
 )
 
 type FakeStorer struct {
 	writtenTx         model.TagTx
 	fnGetLastStatuses func(context.Context) (storage.Statuses, error)
-	fnGetLastNCoords  func(context.Context, int) (storage.Coords, error)
+	fnGetTrack        func(context.Context, int, time.Time, time.Time, storage.FixQuality) ([]storage.TrackPoint, error)
+	fnGetStatus       func(context.Context, int) (storage.Status, error)
+
+	fnGetZoneVisits     func(context.Context, int, time.Time, time.Time) ([]model.ZoneVisit, error)
+	fnGetLastZoneVisits func(context.Context, int) ([]model.ZoneVisit, error)
 }
 
-func (s *FakeStorer) WriteTx(_ context.Context, tagTx model.TagTx) (string, error) {
+func (s *FakeStorer) WriteTx(_ context.Context, tagTx model.TagTx) (storage.WriteResult, error) {
 	s.writtenTx = tagTx
-	return "", nil
+	return storage.WriteResult{New: len(tagTx.Records)}, nil
 }
 
 func (s FakeStorer) GetLastStatuses(ctx context.Context) (storage.Statuses, error) {
 	return s.fnGetLastStatuses(ctx)
 }
 
-func (s FakeStorer) GetLastNCoords(ctx context.Context, n int) (storage.Coords, error) {
-	return s.fnGetLastNCoords(ctx, n)
+func (s FakeStorer) GetTrack(ctx context.Context, serNo int, from, to time.Time, quality storage.FixQuality, page storage.Page) ([]storage.TrackPoint, error) {
+	track, err := s.fnGetTrack(ctx, serNo, from, to, quality)
+	return fakePage(track, page), err
+}
+
+func (s FakeStorer) GetStatus(ctx context.Context, serNo int) (storage.Status, error) {
+	return s.fnGetStatus(ctx, serNo)
+}
+
+func (s FakeStorer) GetZoneVisits(ctx context.Context, serNo int, from, to time.Time) ([]model.ZoneVisit, error) {
+	return s.fnGetZoneVisits(ctx, serNo, from, to)
+}
+
+func (s FakeStorer) GetLastZoneVisits(ctx context.Context, serNo int) ([]model.ZoneVisit, error) {
+	return s.fnGetLastZoneVisits(ctx, serNo)
 }
 
 type notification struct {
 	title   notify.Title
 	message notify.Message
+	event   notify.Event
 }
 
 type FakeNotifier struct {
 	notifications []notification
 }
 
-func (n *FakeNotifier) Notify(_ context.Context, title notify.Title, message notify.Message) error {
-	fmt.Println("FAKE notification ", title, message)
-	n.notifications = append(n.notifications, notification{title: title, message: message})
+func (n *FakeNotifier) Notify(_ context.Context, e notify.Event) error {
+	fmt.Println("FAKE notification ", e.Title, e.Message)
+	n.notifications = append(n.notifications, notification{title: e.Title, message: e.Message, event: e})
 
 	return nil
 }
+
+type FakeTagStorer struct {
+	tags       map[int]model.Tag
+	pending    map[int]model.PendingTag
+	pendingErr error // Returned when recording a pending tag
+}
+
+func (s *FakeTagStorer) GetTags(_ context.Context) ([]model.Tag, error) {
+	var tags []model.Tag
+	for _, t := range s.tags {
+		tags = append(tags, t)
+	}
+	return tags, nil
+}
+
+func (s *FakeTagStorer) AddTag(_ context.Context, t model.Tag) error {
+	if _, ok := s.tags[t.SerNo]; ok {
+		return fmt.Errorf("tag %d: %w", t.SerNo, storage.ErrExists)
+	}
+	s.tags[t.SerNo] = t
+	return nil
+}
+
+func (s *FakeTagStorer) UpdateTag(_ context.Context, t model.Tag) error {
+	if _, ok := s.tags[t.SerNo]; !ok {
+		return storage.ErrNotFound
+	}
+	s.tags[t.SerNo] = t
+	return nil
+}
+
+func (s *FakeTagStorer) GetPendingTags(_ context.Context) ([]model.PendingTag, error) {
+	var pending []model.PendingTag
+	for _, p := range s.pending {
+		pending = append(pending, p)
+	}
+	return pending, nil
+}
+
+func (s *FakeTagStorer) UpsertPendingTag(_ context.Context, p model.PendingTag) error {
+	if s.pendingErr != nil {
+		return s.pendingErr
+	}
+	if existing, ok := s.pending[p.SerNo]; ok {
+		p.FirstSeen = existing.FirstSeen
+		p.Uploads = existing.Uploads + 1
+	} else {
+		p.FirstSeen = p.LastSeen
+		p.Uploads = 1
+	}
+	s.pending[p.SerNo] = p
+	return nil
+}
+
+func (s *FakeTagStorer) PromotePendingTag(_ context.Context, t model.Tag) error {
+	p, ok := s.pending[t.SerNo]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	if _, ok := s.tags[t.SerNo]; ok {
+		return fmt.Errorf("tag %d: %w", t.SerNo, storage.ErrExists)
+	}
+	delete(s.pending, t.SerNo)
+	t.IMEI = p.IMEI
+	t.ICCID = p.ICCID
+	s.tags[t.SerNo] = t
+	return nil
+}
+
+// newFakeRegistry returns a registry holding the two dogs the tests use.
+func newFakeRegistry() *registry.Registry {
+	r := registry.New(&FakeTagStorer{
+		tags: map[int]model.Tag{
+			810095: {SerNo: 810095, Name: "Rueger", Colour: "purple", Icon: "R", Active: true},
+			810243: {SerNo: 810243, Name: "Charlie", Colour: "blue", Icon: "C", Active: true},
+		},
+		pending: make(map[int]model.PendingTag),
+	})
+	_ = r.Load(context.Background()) //nolint:errcheck // the fake can't fail
+
+	return r
+}
+
+// FakeZoneVisitStorer keeps zone visits in memory, and hands out fixes set up
+// by the test.
+type FakeZoneVisitStorer struct {
+	fixes    map[int][]storage.Fix
+	fixesErr error // Returned for every tag but the first
+	visits   []model.ZoneVisit
+}
+
+func (s *FakeZoneVisitStorer) GetFixesAfter(_ context.Context, serNo int, after time.Time) ([]storage.Fix, error) {
+	if s.fixesErr != nil && serNo != 810095 {
+		return nil, s.fixesErr
+	}
+
+	var fixes []storage.Fix
+	for _, f := range s.fixes[serNo] {
+		if f.GpsUTC.After(after) {
+			fixes = append(fixes, f)
+		}
+	}
+	return fixes, nil
+}
+
+func (s *FakeZoneVisitStorer) GetLatestZoneVisit(_ context.Context, serNo int) (model.ZoneVisit, error) {
+	for i := len(s.visits) - 1; i >= 0; i-- {
+		if s.visits[i].SerNo == serNo {
+			return s.visits[i], nil
+		}
+	}
+	return model.ZoneVisit{}, storage.ErrNotFound
+}
+
+func (s *FakeZoneVisitStorer) SaveZoneVisits(_ context.Context, visits []model.ZoneVisit) error {
+	for _, v := range visits {
+		if v.ID == 0 {
+			v.ID = int64(len(s.visits) + 1)
+			s.visits = append(s.visits, v)
+			continue
+		}
+		s.visits[v.ID-1] = v
+	}
+	return nil
+}
+
+func (s *FakeZoneVisitStorer) ReplaceZoneVisits(ctx context.Context, visits []model.ZoneVisit) error {
+	s.visits = nil
+	return s.SaveZoneVisits(ctx, visits)
+}
+
+type FakeNotificationLister struct {
+	queued []notify.QueuedNotification
+}
+
+func (l FakeNotificationLister) List(_ context.Context) ([]notify.QueuedNotification, error) {
+	return l.queued, nil
+}
+
+type FakeAlertAcknowledger struct {
+	alerts map[string]notify.Alert // By token
+	acks   []string                // "by from"
+}
+
+func (a *FakeAlertAcknowledger) Get(_ context.Context, token string) (notify.Alert, error) {
+	alert, ok := a.alerts[token]
+	if !ok {
+		return notify.Alert{}, storage.ErrNotFound
+	}
+
+	return alert, nil
+}
+
+func (a *FakeAlertAcknowledger) Acknowledge(_ context.Context, token, by, from string) (notify.Alert, error) {
+	alert, ok := a.alerts[token]
+	if !ok {
+		return notify.Alert{}, storage.ErrNotFound
+	}
+
+	a.acks = append(a.acks, by+" "+from)
+	now := alert.Raised.Add(3 * time.Minute)
+	alert.Audit = append(alert.Audit, notify.AlertAudit{Time: now, Action: notify.AlertAcknowledged, By: by, Detail: "from " + from})
+	if alert.Closed.IsZero() {
+		alert.Closed = now
+	}
+	a.alerts[token] = alert
+
+	return alert, nil
+}
+
+type FakeAlertLister struct {
+	alerts []notify.Alert
+	since  time.Time
+}
+
+func (l *FakeAlertLister) GetAlerts(_ context.Context, since time.Time) ([]notify.Alert, error) {
+	l.since = since
+
+	return l.alerts, nil
+}
+
+// FakeDigestStorer hands out what the test sets up for each tag.
+type FakeDigestStorer struct {
+	fixes    map[int][]storage.Fix
+	visits   map[int][]model.ZoneVisit
+	readings map[int][]storage.BatteryReading
+	checkIns map[int][]time.Time
+}
+
+func (s FakeDigestStorer) GetFixesBetween(_ context.Context, serNo int, _, _ time.Time) ([]storage.Fix, error) {
+	return s.fixes[serNo], nil
+}
+
+func (s FakeDigestStorer) GetZoneVisits(_ context.Context, serNo int, _, _ time.Time) ([]model.ZoneVisit, error) {
+	return s.visits[serNo], nil
+}
+
+func (s FakeDigestStorer) GetBatteryReadings(_ context.Context, serNo int, _, _ time.Time) ([]storage.BatteryReading, error) {
+	return s.readings[serNo], nil
+}
+
+func (s FakeDigestStorer) GetCheckIns(_ context.Context, serNo int, _, _ time.Time) ([]time.Time, error) {
+	return s.checkIns[serNo], nil
+}
+
+type FakeLastSeenReader struct {
+	lastSeen []storage.LastSeen
+}
+
+func (r *FakeLastSeenReader) GetLastSeen(_ context.Context) ([]storage.LastSeen, error) {
+	return r.lastSeen, nil
+}
+
+// FakeAPIStorer serves the fixes and readings set up by the test, paging and
+// filtering them as the real one does.
+type FakeAPIStorer struct {
+	statuses map[int]storage.Status
+	track    []storage.TrackPoint // All Rueger's
+	readings []storage.BatteryReading
+}
+
+func (s FakeAPIStorer) GetStatus(_ context.Context, serNo int) (storage.Status, error) {
+	st, ok := s.statuses[serNo]
+	if !ok {
+		return storage.Status{}, storage.ErrNotFound
+	}
+	return st, nil
+}
+
+func (s FakeAPIStorer) GetTrack(_ context.Context, _ int, from, to time.Time, quality storage.FixQuality, page storage.Page) ([]storage.TrackPoint, error) {
+	var track []storage.TrackPoint
+	for _, p := range s.track {
+		if p.GpsUTC.Before(from) || !p.GpsUTC.Before(to) {
+			continue
+		}
+		if quality.MaxPosAcc > 0 && p.PosAcc > quality.MaxPosAcc {
+			continue
+		}
+		track = append(track, p)
+	}
+	return fakePage(track, page), nil
+}
+
+func (s FakeAPIStorer) GetBatteryHistory(_ context.Context, _ int, from, to time.Time, page storage.Page) ([]storage.BatteryReading, error) {
+	var readings []storage.BatteryReading
+	for _, br := range s.readings {
+		if !br.DeviceUTC.Before(from) && br.DeviceUTC.Before(to) {
+			readings = append(readings, br)
+		}
+	}
+	return fakePage(readings, page), nil
+}
+
+func fakePage[T any](items []T, page storage.Page) []T {
+	items = items[min(page.Offset, len(items)):]
+	if page.Limit > 0 {
+		items = items[:min(page.Limit, len(items))]
+	}
+	return items
+}
@@ -1,24 +0,0 @@
-package main
-
-import "github.com/bitwombat/gps-tags/poly"
-
-var propertyBoundary = []poly.Point{
-	{X: -31.4586212322512, Y: 152.6422124774594},
-	{X: -31.4595509701308, Y: 152.6438560831193},
-	{X: -31.45812972583087, Y: 152.6451090582995},
-	{X: -31.45580841978974, Y: 152.6409669973841},
-	{X: -31.45613159545191, Y: 152.6404602174576},
-	{X: -31.4586212322512, Y: 152.6422124774594},
-}
-
-var safeZoneBoundary = []poly.Point{
-	{X: -31.45682907060356, Y: 152.6423896947185},
-	{X: -31.4566607599576, Y: 152.6418404324234},
-	{X: -31.45698678814134, Y: 152.641332228427},
-	{X: -31.45717818300943, Y: 152.6413883863712},
-	{X: -31.45785626006774, Y: 152.6418268829714},
-	{X: -31.4583193861515, Y: 152.6422250491253},
-	{X: -31.45863308808003, Y: 152.6432598845506},
-	{X: -31.45757700831948, Y: 152.6435985457414},
-	{X: -31.45682907060356, Y: 152.6423896947185},
-}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bitwombat/gps-tags/notify"
+	"github.com/bitwombat/gps-tags/storage"
+	"github.com/bitwombat/gps-tags/substitute"
+)
+
+// AlertAcknowledger is what the ack page looks up and acknowledges alerts
+// through.
+type AlertAcknowledger interface {
+	Get(ctx context.Context, token string) (notify.Alert, error)
+	Acknowledge(ctx context.Context, token, by, from string) (notify.Alert, error)
+}
+
+// ackPage is what ack.html is rendered with.
+type ackPage struct {
+	Title   string
+	Message string
+	Raised  string
+	Open    bool
+	Status  string // How it was closed
+	By      string // Who's acknowledging, to fill in the form with
+	Audit   []ackAuditLine
+}
+
+type ackAuditLine struct {
+	When   string
+	Action string
+	By     string
+	Detail string
+}
+
+func toAckPage(alert notify.Alert, by string, loc *time.Location) ackPage {
+	const layout = "Mon 2 Jan 15:04:05"
+
+	page := ackPage{
+		Title:   string(alert.Event.Title),
+		Message: string(alert.Event.Message),
+		Raised:  alert.Raised.In(loc).Format(layout),
+		Open:    alert.Closed.IsZero(),
+		By:      by,
+	}
+
+	for _, entry := range alert.Audit {
+		page.Audit = append(page.Audit, ackAuditLine{
+			When:   entry.Time.In(loc).Format(layout),
+			Action: entry.Action,
+			By:     entry.By,
+			Detail: entry.Detail,
+		})
+
+		if !entry.Time.Equal(alert.Closed) || page.Status != "" {
+			continue
+		}
+		switch entry.Action {
+		case notify.AlertAcknowledged:
+			page.Status = "Acknowledged by " + entry.By + " at " + entry.Time.In(loc).Format(layout)
+		case notify.AlertResolved:
+			page.Status = "Resolved at " + entry.Time.In(loc).Format(layout) + ": " + entry.Detail
+		}
+	}
+
+	return page
+}
+
+// clientAddress is where the request came from - the first X-Forwarded-For
+// address if it came through the load balancer.
+func clientAddress(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		first, _, _ := strings.Cut(forwarded, ",")
+		return strings.TrimSpace(first)
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// newAckHandler shows an alert, and acknowledges it when POSTed to. The
+// token in the URL is the authentication - it's secret, and only sent with
+// the alert. Showing it on GET means link checkers and previews in email
+// clients don't acknowledge it for anyone. Who acknowledged it is whatever
+// they say they are - nothing checks it. Times are shown in loc.
+func newAckHandler(alerts AlertAcknowledger, loc *time.Location) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		debugLogger.Println("Got an ack request.")
+		lastWasHealthCheck = false
+
+		ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+		defer cancel()
+
+		token := r.PathValue("token")
+		by := r.FormValue("by") // From the query string (ntfy, email) or the form
+
+		var alert notify.Alert
+		var err error
+		switch r.Method {
+		case http.MethodGet:
+			alert, err = alerts.Get(ctx, token)
+		case http.MethodPost:
+			if by == "" {
+				by = "someone"
+			}
+			alert, err = alerts.Acknowledge(ctx, token, by, clientAddress(r))
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "no such alert", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			errorLogger.Printf("Error getting alert: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		ackPage, err := substitute.ContentsOf("public_html/ack.html", toAckPage(alert, by, loc))
+		if err != nil {
+			errorLogger.Printf("Error getting contents of ack.html: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		_, err = w.Write([]byte(ackPage)) // NOTE: writes http.StatusOK header
+		if err != nil {
+			errorLogger.Printf("Error writing response: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitwombat/gps-tags/notify"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAckHandler(t *testing.T) {
+	// Save current directory to restore after test
+	origDir, err := os.Getwd()
+	require.Nil(t, err, "getting current directory")
+	defer func() {
+		err := os.Chdir(origDir)
+		require.Nil(t, err, "restoring original directory")
+	}()
+
+	err = os.Chdir("..")
+	require.Nil(t, err, "changing directory to where public_html is")
+
+	// GIVEN an open alert, reminded about once
+	alerts := &FakeAlertAcknowledger{alerts: map[string]notify.Alert{
+		"abc123": {
+			ID:     1,
+			Token:  "abc123",
+			Event:  notify.Event{Kind: notify.EventLeave, Title: "RUEGER has left the property", Message: "Last seen <near> the house"},
+			Raised: mkTime("2025-09-01 12:00:00"),
+			Audit: []notify.AlertAudit{
+				{Time: mkTime("2025-09-01 12:00:00"), Action: notify.AlertRaised, Detail: "RUEGER has left the property"},
+				{Time: mkTime("2025-09-01 12:05:00"), Action: notify.AlertReminded, Detail: "reminder 1"},
+			},
+		},
+	}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ack/{token}", newAckHandler(alerts, time.UTC))
+
+	// WHEN its ack link is followed
+	req := httptest.NewRequest(http.MethodGet, "https://tags.example.com/ack/abc123?by=email", http.NoBody)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	// THEN it's shown with a form to acknowledge it, but isn't acknowledged.
+	resp := w.Result()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	assertGolden(t, "ack_page", string(body))
+	require.Empty(t, alerts.acks)
+
+	// WHEN it's acknowledged with the form, through the load balancer
+	form := url.Values{"by": {"Greg"}}
+	req = httptest.NewRequest(http.MethodPost, "https://tags.example.com/ack/abc123", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Forwarded-For", "203.0.113.9, 10.0.0.1")
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	// THEN it's acknowledged by them, from their address, and says so.
+	resp = w.Result()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err = io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	require.Equal(t, []string{"Greg 203.0.113.9"}, alerts.acks)
+	require.Contains(t, string(body), "Acknowledged by Greg at Mon 1 Sep 12:03:00")
+	require.NotContains(t, string(body), "<form")
+
+	// WHEN ntfy's action POSTs to it, with nothing but the query string
+	req = httptest.NewRequest(http.MethodPost, "https://tags.example.com/ack/abc123?by=ntfy", http.NoBody)
+	req.RemoteAddr = "198.51.100.7:43210"
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	// THEN that's recorded too.
+	require.Equal(t, http.StatusOK, w.Result().StatusCode)
+	require.Equal(t, []string{"Greg 203.0.113.9", "ntfy 198.51.100.7"}, alerts.acks)
+
+	// AND unknown tokens aren't found.
+	req = httptest.NewRequest(http.MethodPost, "https://tags.example.com/ack/guess", http.NoBody)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	require.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+}
@@ -0,0 +1,611 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bitwombat/gps-tags/model"
+	"github.com/bitwombat/gps-tags/notify"
+	oshotpkg "github.com/bitwombat/gps-tags/oneshot"
+	"github.com/bitwombat/gps-tags/registry"
+	"github.com/bitwombat/gps-tags/storage"
+	"github.com/bitwombat/gps-tags/substitute"
+)
+
+// tagJSON is a tag as seen through the admin endpoints.
+type tagJSON struct {
+	SerNo  int    `json:"serNo"`
+	Name   string `json:"name"`
+	Colour string `json:"colour"`
+	Icon   string `json:"icon"`
+	IMEI   string `json:"imei"`
+	ICCID  string `json:"iccid"`
+	Active bool   `json:"active"`
+}
+
+func toTagJSON(t model.Tag) tagJSON {
+	return tagJSON(t)
+}
+
+// pendingTagJSON is a pending tag as seen through the admin endpoints.
+type pendingTagJSON struct {
+	SerNo     int       `json:"serNo"`
+	IMEI      string    `json:"imei"`
+	ICCID     string    `json:"iccid"`
+	Fw        string    `json:"fw"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Uploads   int       `json:"uploads"`
+}
+
+// oneShotStateJSON is a one-shot event's state as seen through the admin
+// endpoints.
+type oneShotStateJSON struct {
+	Set       bool      `json:"set"`
+	LastSet   time.Time `json:"lastSet"`
+	LastReset time.Time `json:"lastReset"`
+}
+
+// queuedNotificationJSON is a notification waiting to be retried, given up on,
+// or held back for quiet hours, as seen through the admin endpoints.
+type queuedNotificationJSON struct {
+	ID          int64     `json:"id"`
+	Channel     string    `json:"channel"`
+	Event       string    `json:"event"`
+	Severity    string    `json:"severity"`
+	SerNo       int       `json:"serNo,omitempty"`
+	Tag         string    `json:"tag,omitempty"`
+	Title       string    `json:"title"`
+	Message     string    `json:"message"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"lastError"`
+	Queued      time.Time `json:"queued"`
+	NextAttempt time.Time `json:"nextAttempt,omitzero"` // Pending only
+}
+
+func toQueuedNotificationJSON(qn notify.QueuedNotification) queuedNotificationJSON {
+	j := queuedNotificationJSON{
+		ID:        qn.ID,
+		Channel:   qn.Channel,
+		Event:     qn.Event.Kind,
+		Severity:  qn.Event.Severity.String(),
+		SerNo:     qn.Event.SerNo,
+		Tag:       qn.Event.Tag,
+		Title:     string(qn.Event.Title),
+		Message:   string(qn.Event.Message),
+		Attempts:  qn.Attempts,
+		LastError: qn.LastError,
+		Queued:    qn.Queued,
+	}
+	if qn.Status == notify.QueuePending {
+		j.NextAttempt = qn.NextAttempt
+	}
+
+	return j
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		errorLogger.Printf("Error writing response: %v\n", err)
+	}
+}
+
+// newAdminTagsHandler lists tags (GET) and adds new ones (POST).
+func newAdminTagsHandler(tags *registry.Registry, adminAuthKey string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		debugLogger.Println("Got an admin tags request.")
+		lastWasHealthCheck = false
+
+		if !isAuthorised(r, adminAuthKey) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+		defer cancel()
+
+		switch r.Method {
+		case http.MethodGet:
+			all := tags.All()
+			tj := make([]tagJSON, 0, len(all))
+			for _, t := range all {
+				tj = append(tj, toTagJSON(t))
+			}
+			writeJSON(w, tj)
+
+		case http.MethodPost:
+			var tj tagJSON
+			err := json.NewDecoder(r.Body).Decode(&tj)
+			if err != nil {
+				errorLogger.Printf("Error decoding tag: %v", err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			if tj.SerNo == 0 {
+				errorLogger.Println("Got a tag without a serial number")
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			err = tags.Add(ctx, model.Tag(tj))
+			if errors.Is(err, storage.ErrExists) {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			if err != nil {
+				errorLogger.Printf("Error adding tag: %v", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			infoLogger.Printf("Added tag %d as %s", tj.SerNo, tj.Name)
+			w.WriteHeader(http.StatusCreated)
+
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// newAdminTagHandler changes a tag (PUT) or retires it (DELETE). Fields left
+// out of a PUT are unchanged.
+func newAdminTagHandler(tags *registry.Registry, adminAuthKey string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		debugLogger.Println("Got an admin tag request.")
+		lastWasHealthCheck = false
+
+		if !isAuthorised(r, adminAuthKey) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+		defer cancel()
+
+		serNo, err := strconv.Atoi(r.PathValue("serNo"))
+		if err != nil {
+			errorLogger.Printf("Bad serial number in path: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		tag, ok := tags.Lookup(serNo)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, toTagJSON(tag))
+
+		case http.MethodPut:
+			var changes struct {
+				Name   *string `json:"name"`
+				Colour *string `json:"colour"`
+				Icon   *string `json:"icon"`
+				Active *bool   `json:"active"`
+			}
+			err := json.NewDecoder(r.Body).Decode(&changes)
+			if err != nil {
+				errorLogger.Printf("Error decoding tag changes: %v", err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			if changes.Name != nil {
+				tag.Name = *changes.Name
+			}
+			if changes.Colour != nil {
+				tag.Colour = *changes.Colour
+			}
+			if changes.Icon != nil {
+				tag.Icon = *changes.Icon
+			}
+			if changes.Active != nil {
+				tag.Active = *changes.Active
+			}
+
+			err = tags.Update(ctx, tag)
+			if err != nil {
+				errorLogger.Printf("Error updating tag: %v", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			infoLogger.Printf("Updated tag %d", serNo)
+			writeJSON(w, toTagJSON(tag))
+
+		case http.MethodDelete:
+			err := tags.Retire(ctx, serNo)
+			if errors.Is(err, registry.ErrUnknownTag) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				errorLogger.Printf("Error retiring tag: %v", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			infoLogger.Printf("Retired tag %d", serNo)
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// newAdminPendingTagsHandler lists the tags that have uploaded but that nobody
+// has named yet.
+func newAdminPendingTagsHandler(tags *registry.Registry, adminAuthKey string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		debugLogger.Println("Got an admin pending tags request.")
+		lastWasHealthCheck = false
+
+		if !isAuthorised(r, adminAuthKey) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+		defer cancel()
+
+		pending, err := tags.Pending(ctx)
+		if err != nil {
+			errorLogger.Printf("Error getting pending tags: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		pj := make([]pendingTagJSON, 0, len(pending))
+		for _, p := range pending {
+			pj = append(pj, pendingTagJSON(p))
+		}
+		writeJSON(w, pj)
+	}
+}
+
+// pendingTagsPage is what pending-tags.html is rendered with.
+type pendingTagsPage struct {
+	Auth     string // The admin key, for the forms to send back. Empty asks for it.
+	Promoted string // The tag just promoted, if any
+	Tags     []pendingTagLine
+}
+
+type pendingTagLine struct {
+	SerNo     int
+	IMEI      string
+	ICCID     string
+	Fw        string
+	FirstSeen string
+	LastSeen  string
+	Uploads   int
+}
+
+// writePendingTagsPage lists the pending tags, each with a form to promote
+// it. Times are shown in loc.
+func writePendingTagsPage(ctx context.Context, w http.ResponseWriter, tags *registry.Registry, page pendingTagsPage, loc *time.Location) {
+	const layout = "Mon 2 Jan 15:04:05"
+
+	if page.Auth != "" {
+		pending, err := tags.Pending(ctx)
+		if err != nil {
+			errorLogger.Printf("Error getting pending tags: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		for _, p := range pending {
+			page.Tags = append(page.Tags, pendingTagLine{
+				SerNo:     p.SerNo,
+				IMEI:      p.IMEI,
+				ICCID:     p.ICCID,
+				Fw:        p.Fw,
+				FirstSeen: p.FirstSeen.In(loc).Format(layout),
+				LastSeen:  p.LastSeen.In(loc).Format(layout),
+				Uploads:   p.Uploads,
+			})
+		}
+	}
+
+	pendingTagsPage, err := substitute.ContentsOf("public_html/pending-tags.html", page)
+	if err != nil {
+		errorLogger.Printf("Error getting contents of pending-tags.html: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write([]byte(pendingTagsPage)) // NOTE: writes http.StatusOK header
+	if err != nil {
+		errorLogger.Printf("Error writing response: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// newAdminPendingTagsPageHandler is the browser's way to name pending tags.
+// A GET asks for the admin key, and POSTing it lists the pending tags, each
+// with a form that promotes it through newAdminPromoteTagHandler.
+func newAdminPendingTagsPageHandler(tags *registry.Registry, adminAuthKey string, loc *time.Location) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		debugLogger.Println("Got an admin pending tags page request.")
+		lastWasHealthCheck = false
+
+		ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+		defer cancel()
+
+		switch r.Method {
+		case http.MethodGet:
+			writePendingTagsPage(ctx, w, tags, pendingTagsPage{}, loc)
+
+		case http.MethodPost:
+			if !isAuthorised(r, adminAuthKey) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			writePendingTagsPage(ctx, w, tags, pendingTagsPage{Auth: adminAuthKey}, loc)
+
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// newAdminPromoteTagHandler names a pending tag (POST), making it a real one.
+// The tag comes as JSON, or from the pending tags page's form, which gets the
+// page back.
+func newAdminPromoteTagHandler(tags *registry.Registry, adminAuthKey string, loc *time.Location) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		debugLogger.Println("Got an admin promote tag request.")
+		lastWasHealthCheck = false
+
+		if !isAuthorised(r, adminAuthKey) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+		defer cancel()
+
+		serNo, err := strconv.Atoi(r.PathValue("serNo"))
+		if err != nil {
+			errorLogger.Printf("Bad serial number in path: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		fromPage := isForm(r)
+
+		var tj tagJSON
+		if fromPage {
+			tj.Name = r.PostFormValue("name")
+			tj.Colour = r.PostFormValue("colour")
+			tj.Icon = r.PostFormValue("icon")
+		} else {
+			err = json.NewDecoder(r.Body).Decode(&tj)
+			if err != nil {
+				errorLogger.Printf("Error decoding tag: %v", err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		tj.SerNo = serNo
+
+		err = tags.Promote(ctx, model.Tag(tj))
+		if errors.Is(err, storage.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, storage.ErrExists) {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		if err != nil {
+			errorLogger.Printf("Error promoting tag: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		infoLogger.Printf("Promoted pending tag %d to %s", serNo, tj.Name)
+
+		if fromPage {
+			writePendingTagsPage(ctx, w, tags, pendingTagsPage{Auth: adminAuthKey, Promoted: fmt.Sprintf("%d as %s", serNo, tj.Name)}, loc)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+// newAdminOneShotsHandler shows the state of every notification event, eg.
+// whether "off the property" has fired and not yet been reset.
+func newAdminOneShotsHandler(oneShot oshotpkg.OneShot, adminAuthKey string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		debugLogger.Println("Got an admin one-shots request.")
+		lastWasHealthCheck = false
+
+		if !isAuthorised(r, adminAuthKey) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		states := make(map[string]oneShotStateJSON)
+		for event, state := range oneShot.States() {
+			states[event] = oneShotStateJSON(state)
+		}
+		writeJSON(w, states)
+	}
+}
+
+// NotificationLister is what the admin notifications endpoint reads the retry
+// queue through.
+type NotificationLister interface {
+	List(context.Context) ([]notify.QueuedNotification, error)
+}
+
+// newAdminNotificationsHandler lists the notifications waiting to be retried,
+// those given up on, and those held back for quiet hours.
+func newAdminNotificationsHandler(queue NotificationLister, adminAuthKey string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		debugLogger.Println("Got an admin notifications request.")
+		lastWasHealthCheck = false
+
+		if !isAuthorised(r, adminAuthKey) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+		defer cancel()
+
+		queued, err := queue.List(ctx)
+		if err != nil {
+			errorLogger.Printf("Error listing queued notifications: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		list := struct {
+			Pending    []queuedNotificationJSON `json:"pending"`
+			Failed     []queuedNotificationJSON `json:"failed"`
+			Suppressed []queuedNotificationJSON `json:"suppressed"`
+		}{
+			Pending:    []queuedNotificationJSON{},
+			Failed:     []queuedNotificationJSON{},
+			Suppressed: []queuedNotificationJSON{},
+		}
+		for _, qn := range queued {
+			switch qn.Status {
+			case notify.QueuePending:
+				list.Pending = append(list.Pending, toQueuedNotificationJSON(qn))
+			case notify.QueueSuppressed:
+				list.Suppressed = append(list.Suppressed, toQueuedNotificationJSON(qn))
+			default:
+				list.Failed = append(list.Failed, toQueuedNotificationJSON(qn))
+			}
+		}
+		writeJSON(w, list)
+	}
+}
+
+// alertJSON is an alert and its audit trail, as seen through the admin
+// endpoints.
+type alertJSON struct {
+	ID        int64            `json:"id"`
+	Event     string           `json:"event"`
+	SerNo     int              `json:"serNo,omitempty"`
+	Tag       string           `json:"tag,omitempty"`
+	Title     string           `json:"title"`
+	Raised    time.Time        `json:"raised"`
+	Reminders int              `json:"reminders"`
+	Escalated bool             `json:"escalated"`
+	Closed    time.Time        `json:"closed,omitzero"`
+	Audit     []alertAuditJSON `json:"audit"`
+}
+
+type alertAuditJSON struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	By     string    `json:"by,omitempty"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+func toAlertJSON(a notify.Alert) alertJSON {
+	j := alertJSON{
+		ID:        a.ID,
+		Event:     a.Event.Kind,
+		SerNo:     a.Event.SerNo,
+		Tag:       a.Event.Tag,
+		Title:     string(a.Event.Title),
+		Raised:    a.Raised,
+		Reminders: a.Reminders,
+		Escalated: a.Escalated,
+		Closed:    a.Closed,
+		Audit:     []alertAuditJSON{},
+	}
+	for _, entry := range a.Audit {
+		j.Audit = append(j.Audit, alertAuditJSON(entry))
+	}
+
+	return j
+}
+
+// AlertLister is what the admin alerts endpoint reads alerts through.
+type AlertLister interface {
+	GetAlerts(ctx context.Context, since time.Time) ([]notify.Alert, error)
+}
+
+// newAdminAlertsHandler lists the alerts raised in the last week (or since
+// ?since=YYYY-MM-DD, a day in loc), with who acknowledged them and when.
+func newAdminAlertsHandler(alerts AlertLister, adminAuthKey string, now func() time.Time, loc *time.Location) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		debugLogger.Println("Got an admin alerts request.")
+		lastWasHealthCheck = false
+
+		if !isAuthorised(r, adminAuthKey) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		since := now().AddDate(0, 0, -7)
+		if s := r.URL.Query().Get("since"); s != "" {
+			var err error
+			since, err = time.ParseInLocation(time.DateOnly, s, loc)
+			if err != nil {
+				http.Error(w, "since should be YYYY-MM-DD", http.StatusBadRequest)
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+		defer cancel()
+
+		got, err := alerts.GetAlerts(ctx, since)
+		if err != nil {
+			errorLogger.Printf("Error getting alerts: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		list := make([]alertJSON, 0, len(got))
+		for _, a := range got {
+			list = append(list, toAlertJSON(a))
+		}
+		writeJSON(w, list)
+	}
+}
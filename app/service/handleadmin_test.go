@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitwombat/gps-tags/model"
+	"github.com/bitwombat/gps-tags/notify"
+	oshotpkg "github.com/bitwombat/gps-tags/oneshot"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminTagsHandler(t *testing.T) {
+	tags := newFakeRegistry()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/tags", newAdminTagsHandler(tags, "xxxx"))
+	mux.HandleFunc("/admin/tags/{serNo}", newAdminTagHandler(tags, "xxxx"))
+
+	do := func(method, path, body string) *http.Response {
+		req := httptest.NewRequest(method, "http://example.com"+path, strings.NewReader(body))
+		req.Header.Add("auth", "xxxx")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	t.Run("needs auth", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/admin/tags", http.NoBody)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		require.Equal(t, http.StatusUnauthorized, w.Result().StatusCode)
+	})
+
+	t.Run("add", func(t *testing.T) {
+		resp := do(http.MethodPost, "/admin/tags", `{"serNo": 810300, "name": "Tucker", "colour": "green"}`)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		require.Equal(t, "Tucker", tags.Name(810300))
+	})
+
+	t.Run("add existing", func(t *testing.T) {
+		resp := do(http.MethodPost, "/admin/tags", `{"serNo": 810095, "name": "Imposter"}`)
+		require.Equal(t, http.StatusConflict, resp.StatusCode)
+		require.Equal(t, "Rueger", tags.Name(810095))
+	})
+
+	t.Run("rename", func(t *testing.T) {
+		resp := do(http.MethodPut, "/admin/tags/810300", `{"name": "Tuck"}`)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		tag, _ := tags.Lookup(810300)
+		require.Equal(t, "Tuck", tag.Name)
+		require.Equal(t, "green", tag.Colour, "fields not in the request are unchanged")
+	})
+
+	t.Run("retire", func(t *testing.T) {
+		resp := do(http.MethodDelete, "/admin/tags/810243", "")
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+		tag, _ := tags.Lookup(810243)
+		require.False(t, tag.Active)
+	})
+
+	t.Run("unknown tag", func(t *testing.T) {
+		resp := do(http.MethodDelete, "/admin/tags/1", "")
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		resp := do(http.MethodGet, "/admin/tags", "")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var got []tagJSON
+		err := json.NewDecoder(resp.Body).Decode(&got)
+		resp.Body.Close()
+		require.Nil(t, err)
+		require.Len(t, got, 3)
+		require.Equal(t, 810095, got[0].SerNo)
+		require.Equal(t, "Tuck", got[2].Name)
+	})
+}
+
+func TestAdminPendingTagsHandler(t *testing.T) {
+	tags := newFakeRegistry()
+	err := tags.RecordPending(context.Background(), model.PendingTag{SerNo: 810400, IMEI: "1234", LastSeen: mkTime("2025-09-01 12:00:00")})
+	require.Nil(t, err)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/pending-tags", newAdminPendingTagsHandler(tags, "xxxx"))
+	mux.HandleFunc("/admin/pending-tags/{serNo}", newAdminPromoteTagHandler(tags, "xxxx", time.UTC))
+
+	do := func(method, path, body string) *http.Response {
+		req := httptest.NewRequest(method, "http://example.com"+path, strings.NewReader(body))
+		req.Header.Add("auth", "xxxx")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	resp := do(http.MethodGet, "/admin/pending-tags", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var got []pendingTagJSON
+	err = json.NewDecoder(resp.Body).Decode(&got)
+	resp.Body.Close()
+	require.Nil(t, err)
+	require.Len(t, got, 1)
+	require.Equal(t, "1234", got[0].IMEI)
+	require.Equal(t, 1, got[0].Uploads)
+
+	resp = do(http.MethodPost, "/admin/pending-tags/810400", `{"name": "Blue"}`)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	tag, ok := tags.Lookup(810400)
+	require.True(t, ok)
+	require.Equal(t, "Blue", tag.Name)
+	require.Equal(t, "1234", tag.IMEI)
+
+	resp = do(http.MethodPost, "/admin/pending-tags/810400", `{"name": "Blue"}`)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode, "no longer pending")
+
+	err = tags.RecordPending(context.Background(), model.PendingTag{SerNo: 810095, LastSeen: mkTime("2025-09-01 12:00:00")})
+	require.Nil(t, err)
+	resp = do(http.MethodPost, "/admin/pending-tags/810095", `{"name": "Imposter"}`)
+	require.Equal(t, http.StatusConflict, resp.StatusCode, "already registered")
+	require.Equal(t, "Rueger", tags.Name(810095))
+}
+
+func TestAdminPendingTagsPageHandler(t *testing.T) {
+	// Save current directory to restore after test
+	origDir, err := os.Getwd()
+	require.Nil(t, err, "getting current directory")
+	defer func() {
+		err := os.Chdir(origDir)
+		require.Nil(t, err, "restoring original directory")
+	}()
+
+	err = os.Chdir("..")
+	require.Nil(t, err, "changing directory to where public_html is")
+
+	// GIVEN a tag that's uploaded but not been named
+	tags := newFakeRegistry()
+	err = tags.RecordPending(context.Background(), model.PendingTag{SerNo: 810400, IMEI: "1234", Fw: "<b>1.2</b>", LastSeen: mkTime("2025-09-01 12:00:00")})
+	require.Nil(t, err)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/pending", newAdminPendingTagsPageHandler(tags, "xxxx", time.UTC))
+	mux.HandleFunc("/admin/pending-tags/{serNo}", newAdminPromoteTagHandler(tags, "xxxx", time.UTC))
+
+	post := func(path string, form url.Values) *http.Response {
+		req := httptest.NewRequest(http.MethodPost, "http://example.com"+path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	// WHEN the page is opened
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/admin/pending", http.NoBody)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	// THEN it asks for the admin key, and shows nothing without it.
+	resp := w.Result()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	require.Contains(t, string(body), `name="auth"`)
+	require.NotContains(t, string(body), "810400")
+
+	resp = post("/admin/pending", url.Values{"auth": {"wrong"}})
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// WHEN the key is given
+	resp = post("/admin/pending", url.Values{"auth": {"xxxx"}})
+
+	// THEN the pending tag is listed with a form to promote it.
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err = io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	assertGolden(t, "pending_tags_page", string(body))
+
+	// WHEN that form is sent
+	resp = post("/admin/pending-tags/810400", url.Values{"auth": {"xxxx"}, "name": {"Blue"}, "colour": {"orange"}})
+
+	// THEN the tag is promoted, and the page says so and no longer lists it.
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err = io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	require.Contains(t, string(body), "Now tracking 810400 as Blue.")
+	require.Contains(t, string(body), "No tags are waiting to be named.")
+
+	tag, ok := tags.Lookup(810400)
+	require.True(t, ok)
+	require.Equal(t, "Blue", tag.Name)
+	require.Equal(t, "orange", tag.Colour)
+}
+
+func TestAdminOneShotsHandler(t *testing.T) {
+	oneShot := oshotpkg.NewOneShot()
+	err := oneShot.SetReset("RUEGERoffProperty", oshotpkg.Config{SetIf: true})
+	require.Nil(t, err)
+
+	handler := newAdminOneShotsHandler(oneShot, "xxxx")
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/admin/oneshots", http.NoBody)
+	req.Header.Add("auth", "xxxx")
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	resp := w.Result()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var got map[string]oneShotStateJSON
+	err = json.NewDecoder(resp.Body).Decode(&got)
+	resp.Body.Close()
+	require.Nil(t, err)
+	require.True(t, got["RUEGERoffProperty"].Set)
+	require.False(t, got["RUEGERoffProperty"].LastSet.IsZero())
+}
+
+func TestAdminNotificationsHandler(t *testing.T) {
+	// GIVEN one notification waiting to be retried, one given up on and one
+	// held back for quiet hours
+	queued := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	lister := FakeNotificationLister{queued: []notify.QueuedNotification{
+		{
+			ID: 1, Channel: "email", Status: notify.QueueFailed, Attempts: 10, LastError: "connection refused",
+			Event:  notify.Event{Kind: notify.EventLeave, Severity: notify.SeverityCritical, SerNo: 810095, Tag: "Rueger", Title: "RUEGER has left the property"},
+			Queued: queued, NextAttempt: queued.Add(time.Hour),
+		},
+		{
+			ID: 2, Channel: "ntfy", Status: notify.QueuePending, Attempts: 1, LastError: "502 Bad Gateway",
+			Event:  notify.Event{Kind: notify.EventTest, Title: "Test notification"},
+			Queued: queued, NextAttempt: queued.Add(time.Minute),
+		},
+		{
+			ID: 3, Channel: "ntfy", Status: notify.QueueSuppressed,
+			Event:  notify.Event{Kind: notify.EventLowBattery, Severity: notify.SeverityWarning, SerNo: 810095, Tag: "Rueger", Title: "RUEGER's battery low"},
+			Queued: queued,
+		},
+	}}
+	handler := newAdminNotificationsHandler(lister, "xxxx")
+
+	// WHEN they're listed without the key
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/admin/notifications", http.NoBody)
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	// THEN it's refused.
+	require.Equal(t, http.StatusUnauthorized, w.Result().StatusCode)
+
+	// WHEN they're listed with the key
+	req.Header.Add("auth", "xxxx")
+	w = httptest.NewRecorder()
+	handler(w, req)
+
+	// THEN they're split into pending, failed and suppressed.
+	resp := w.Result()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var got struct {
+		Pending    []queuedNotificationJSON `json:"pending"`
+		Failed     []queuedNotificationJSON `json:"failed"`
+		Suppressed []queuedNotificationJSON `json:"suppressed"`
+	}
+	err := json.NewDecoder(resp.Body).Decode(&got)
+	resp.Body.Close()
+	require.Nil(t, err)
+
+	require.Equal(t, []queuedNotificationJSON{{
+		ID: 2, Channel: "ntfy", Event: "test", Severity: "info", Title: "Test notification",
+		Attempts: 1, LastError: "502 Bad Gateway", Queued: queued, NextAttempt: queued.Add(time.Minute),
+	}}, got.Pending)
+	require.Equal(t, []queuedNotificationJSON{{
+		ID: 1, Channel: "email", Event: "leave", Severity: "critical", SerNo: 810095, Tag: "Rueger", Title: "RUEGER has left the property",
+		Attempts: 10, LastError: "connection refused", Queued: queued,
+	}}, got.Failed)
+	require.Equal(t, []queuedNotificationJSON{{
+		ID: 3, Channel: "ntfy", Event: "lowBattery", Severity: "warning", SerNo: 810095, Tag: "Rueger", Title: "RUEGER's battery low",
+		Queued: queued,
+	}}, got.Suppressed)
+}
+
+func TestAdminAlertsHandler(t *testing.T) {
+	// GIVEN an acknowledged alert
+	raised := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	lister := &FakeAlertLister{alerts: []notify.Alert{{
+		ID:        1,
+		Token:     "abc123",
+		Event:     notify.Event{Kind: notify.EventLeave, SerNo: 810095, Tag: "Rueger", Title: "RUEGER has left the property"},
+		Raised:    raised,
+		Reminders: 1,
+		Closed:    raised.Add(7 * time.Minute),
+		Audit: []notify.AlertAudit{
+			{Time: raised, Action: notify.AlertRaised, Detail: "RUEGER has left the property"},
+			{Time: raised.Add(7 * time.Minute), Action: notify.AlertAcknowledged, By: "ntfy", Detail: "from 203.0.113.9"},
+		},
+	}}}
+	now := func() time.Time { return raised.Add(24 * time.Hour) }
+	sydney, err := time.LoadLocation("Australia/Sydney")
+	require.Nil(t, err)
+	handler := newAdminAlertsHandler(lister, "xxxx", now, sydney)
+
+	// WHEN alerts are listed
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/admin/alerts", http.NoBody)
+	req.Header.Add("auth", "xxxx")
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	// THEN it's there with its audit trail, from the last week, without its
+	// token.
+	resp := w.Result()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, raised.Add(-6*24*time.Hour), lister.since)
+
+	var got []alertJSON
+	err = json.NewDecoder(resp.Body).Decode(&got)
+	resp.Body.Close()
+	require.Nil(t, err)
+	require.Equal(t, []alertJSON{{
+		ID: 1, Event: "leave", SerNo: 810095, Tag: "Rueger", Title: "RUEGER has left the property",
+		Raised: raised, Reminders: 1, Closed: raised.Add(7 * time.Minute),
+		Audit: []alertAuditJSON{
+			{Time: raised, Action: "raised", Detail: "RUEGER has left the property"},
+			{Time: raised.Add(7 * time.Minute), Action: "acknowledged", By: "ntfy", Detail: "from 203.0.113.9"},
+		},
+	}}, got)
+
+	// WHEN they're asked for since a day
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/admin/alerts?since=2025-09-01", http.NoBody)
+	req.Header.Add("auth", "xxxx")
+	w = httptest.NewRecorder()
+	handler(w, req)
+
+	// THEN it's from the start of that day where the dogs are.
+	require.Equal(t, http.StatusOK, w.Result().StatusCode)
+	require.Equal(t, mkTime("2025-08-31 14:00:00"), lister.since.UTC())
+
+	// WHEN a bad date is asked for
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/admin/alerts?since=yesterday", http.NoBody)
+	req.Header.Add("auth", "xxxx")
+	w = httptest.NewRecorder()
+	handler(w, req)
+
+	// THEN it's refused.
+	require.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+}
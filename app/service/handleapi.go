@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/bitwombat/gps-tags/model"
+	"github.com/bitwombat/gps-tags/registry"
+	"github.com/bitwombat/gps-tags/storage"
+	zonespkg "github.com/bitwombat/gps-tags/zones"
+)
+
+// APIStorer handles reading what the JSON API serves.
+type APIStorer interface {
+	GetStatus(ctx context.Context, serNo int) (storage.Status, error)
+	GetTrack(ctx context.Context, serNo int, from, to time.Time, quality storage.FixQuality, page storage.Page) ([]storage.TrackPoint, error)
+	GetBatteryHistory(ctx context.Context, serNo int, from, to time.Time, page storage.Page) ([]storage.BatteryReading, error)
+}
+
+const (
+	apiDefaultLimit = 1000
+	apiMaxLimit     = 10000
+	apiDefaultRange = 24 * time.Hour
+)
+
+// apiTagJSON is a tag as seen through the API. Unlike the admin endpoints,
+// it leaves out the SIM and modem numbers.
+type apiTagJSON struct {
+	SerNo  int    `json:"serNo"`
+	Name   string `json:"name"`
+	Colour string `json:"colour"`
+	Icon   string `json:"icon"`
+	Active bool   `json:"active"`
+}
+
+// apiStatusJSON is a tag's latest check-in as seen through the API.
+type apiStatusJSON struct {
+	SerNo          int       `json:"serNo"`
+	Name           string    `json:"name"`
+	LastCheckIn    time.Time `json:"lastCheckIn"`
+	Reason         string    `json:"reason"`
+	GpsUTC         time.Time `json:"gpsUTC"`
+	Latitude       float64   `json:"latitude"`
+	Longitude      float64   `json:"longitude"`
+	Altitude       int32     `json:"altitude"` // Metres
+	Speed          int32     `json:"speed"`    // km/h
+	PosAcc         int32     `json:"posAcc"`   // Metres
+	GpsStat        int32     `json:"gpsStat"`
+	Zone           string    `json:"zone"` // Named zone, empty if none
+	BatteryVoltage float64   `json:"batteryVoltage"`
+}
+
+type apiTrackPointJSON struct {
+	GpsUTC    time.Time `json:"gpsUTC"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Altitude  int       `json:"altitude"` // Metres
+	Speed     int       `json:"speed"`    // km/h
+	Heading   int       `json:"heading"`  // Degrees clockwise from north
+	PosAcc    int       `json:"posAcc"`   // Metres
+	PDOP      int       `json:"pdop"`     // Tenths
+	GpsStat   int       `json:"gpsStat"`
+}
+
+type apiBatteryReadingJSON struct {
+	DeviceUTC time.Time `json:"deviceUTC"`
+	Volts     float64   `json:"volts"`
+}
+
+// apiPageJSON is one page of a list. Next is the URL of the next page, if
+// there is one.
+type apiPageJSON[T any] struct {
+	SerNo int       `json:"serNo"`
+	From  time.Time `json:"from"`
+	To    time.Time `json:"to"`
+	Items []T       `json:"items"`
+	Next  string    `json:"next,omitempty"`
+}
+
+// newAPITagsHandler lists every tag, retired ones too.
+func newAPITagsHandler(tags *registry.Registry) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		debugLogger.Println("Got an API tags request.")
+		lastWasHealthCheck = false
+
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		all := tags.All()
+		list := make([]apiTagJSON, 0, len(all))
+		for _, t := range all {
+			list = append(list, apiTagJSON{SerNo: t.SerNo, Name: t.Name, Colour: t.Colour, Icon: t.Icon, Active: t.Active})
+		}
+		writeJSON(w, list)
+	}
+}
+
+// newAPIStatusHandler serves a tag's latest check-in.
+func newAPIStatusHandler(storer APIStorer, tags *registry.Registry, zones *zoneHolder) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		debugLogger.Println("Got an API status request.")
+		lastWasHealthCheck = false
+
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		tag, ok := apiTag(w, r, tags)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+		defer cancel()
+
+		st, err := storer.GetStatus(ctx, tag.SerNo)
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "no check-ins from this tag yet", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			errorLogger.Printf("Error getting status: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, apiStatusJSON{
+			SerNo:          tag.SerNo,
+			Name:           tag.Name,
+			LastCheckIn:    st.DateUTC,
+			Reason:         st.Reason.String(),
+			GpsUTC:         st.GpsUTC,
+			Latitude:       st.Latitude,
+			Longitude:      st.Longitude,
+			Altitude:       st.Altitude,
+			Speed:          st.Speed,
+			PosAcc:         st.PosAcc,
+			GpsStat:        st.GpsStatus,
+			Zone:           zoneNameAt(zones.Get().named, zonespkg.Point{Latitude: st.Latitude, Longitude: st.Longitude}),
+			BatteryVoltage: float64(st.Battery) / 1000,
+		})
+	}
+}
+
+// newAPITrackHandler serves a page of a tag's fixes in a time range, of at
+// least the quality asked for (?maxPosAcc=, ?maxPdop=).
+func newAPITrackHandler(storer APIStorer, tags *registry.Registry, now func() time.Time, loc *time.Location) func(http.ResponseWriter, *http.Request) {
+	return newAPIListHandler("track", tags, now, loc, func(ctx context.Context, q url.Values, serNo int, from, to time.Time, page storage.Page) ([]apiTrackPointJSON, error) {
+		quality, err := parseFixQuality(q)
+		if err != nil {
+			return nil, badRequestError{err}
+		}
+
+		track, err := storer.GetTrack(ctx, serNo, from, to, quality, page)
+		list := make([]apiTrackPointJSON, 0, len(track))
+		for _, p := range track {
+			list = append(list, apiTrackPointJSON(p))
+		}
+		return list, err
+	})
+}
+
+// newAPIBatteryHandler serves a page of a tag's battery readings in a time
+// range.
+func newAPIBatteryHandler(storer APIStorer, tags *registry.Registry, now func() time.Time, loc *time.Location) func(http.ResponseWriter, *http.Request) {
+	return newAPIListHandler("battery", tags, now, loc, func(ctx context.Context, _ url.Values, serNo int, from, to time.Time, page storage.Page) ([]apiBatteryReadingJSON, error) {
+		readings, err := storer.GetBatteryHistory(ctx, serNo, from, to, page)
+		list := make([]apiBatteryReadingJSON, 0, len(readings))
+		for _, br := range readings {
+			list = append(list, apiBatteryReadingJSON(br))
+		}
+		return list, err
+	})
+}
+
+// newAPIListHandler serves a page of a tag's something in a time range:
+// ?from= and ?to= (RFC 3339 times or YYYY-MM-DD dates in loc, the last day by
+// default), ?limit= and ?offset=. get can read other parameters from q, and
+// say they're bad with a badRequestError.
+func newAPIListHandler[T any](what string, tags *registry.Registry, now func() time.Time, loc *time.Location,
+	get func(ctx context.Context, q url.Values, serNo int, from, to time.Time, page storage.Page) ([]T, error),
+) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		debugLogger.Printf("Got an API %s request.", what)
+		lastWasHealthCheck = false
+
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		tag, ok := apiTag(w, r, tags)
+		if !ok {
+			return
+		}
+
+		from, to, err := parseTimeRange(r.URL.Query(), now(), loc)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		page, err := parsePage(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+		defer cancel()
+
+		// One more than asked for says whether there's another page.
+		items, err := get(ctx, r.URL.Query(), tag.SerNo, from, to, storage.Page{Limit: page.Limit + 1, Offset: page.Offset})
+		var badRequest badRequestError
+		if errors.As(err, &badRequest) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			errorLogger.Printf("Error getting %s: %v", what, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		resp := apiPageJSON[T]{SerNo: tag.SerNo, From: from, To: to, Items: items}
+		if len(items) > page.Limit {
+			resp.Items = items[:page.Limit]
+
+			next := r.URL.Query()
+			next.Set("from", from.Format(time.RFC3339))
+			next.Set("to", to.Format(time.RFC3339))
+			next.Set("limit", strconv.Itoa(page.Limit))
+			next.Set("offset", strconv.Itoa(page.Offset+page.Limit))
+			resp.Next = r.URL.Path + "?" + next.Encode()
+		}
+		writeJSON(w, resp)
+	}
+}
+
+// apiTag is the tag whose serial number is in the path. If there isn't one,
+// it's said so in w.
+func apiTag(w http.ResponseWriter, r *http.Request, tags *registry.Registry) (model.Tag, bool) {
+	serNo, err := strconv.Atoi(r.PathValue("serNo"))
+	if err != nil {
+		http.Error(w, "serial number should be a number", http.StatusBadRequest)
+		return model.Tag{}, false
+	}
+
+	tag, ok := tags.Lookup(serNo)
+	if !ok {
+		http.Error(w, "no such tag", http.StatusNotFound)
+		return model.Tag{}, false
+	}
+
+	return tag, true
+}
+
+// parseTimeRange reads ?from= and ?to=, each an RFC 3339 time or a
+// YYYY-MM-DD date in loc. A from date is the start of that day and a to date
+// the end of it, so from=D&to=D is all of day D. to defaults to now, and from
+// to a day before to.
+func parseTimeRange(q url.Values, now time.Time, loc *time.Location) (from, to time.Time, err error) {
+	parse := func(name string, def time.Time, days int) (time.Time, error) {
+		s := q.Get(name)
+		if s == "" {
+			return def, nil
+		}
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			return t, nil
+		}
+		if t, err := time.ParseInLocation(time.DateOnly, s, loc); err == nil {
+			return t.AddDate(0, 0, days), nil
+		}
+		return time.Time{}, fmt.Errorf("%s should be an RFC 3339 time or YYYY-MM-DD, got %q", name, s)
+	}
+
+	to, err = parse("to", now, 1)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	from, err = parse("from", to.Add(-apiDefaultRange), 0)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, errors.New("from should be before to")
+	}
+
+	return from, to, nil
+}
+
+// badRequestError is a problem with a request's parameters.
+type badRequestError struct {
+	err error
+}
+
+func (e badRequestError) Error() string {
+	return e.err.Error()
+}
+
+// parseFixQuality reads ?maxPosAcc= (metres) and ?maxPdop= (tenths), each
+// 0 or left out for any. Readings that aren't fixes are always left out.
+func parseFixQuality(q url.Values) (storage.FixQuality, error) {
+	quality := storage.AnyValidFix
+
+	for _, p := range []struct {
+		name string
+		dst  *int
+	}{
+		{"maxPosAcc", &quality.MaxPosAcc},
+		{"maxPdop", &quality.MaxPDOP},
+	} {
+		s := q.Get(p.name)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return storage.FixQuality{}, fmt.Errorf("%s should be 0 or more, got %q", p.name, s)
+		}
+		*p.dst = n
+	}
+
+	return quality, nil
+}
+
+// parsePage reads ?limit= (1 to apiMaxLimit) and ?offset=.
+func parsePage(q url.Values) (storage.Page, error) {
+	page := storage.Page{Limit: apiDefaultLimit}
+
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > apiMaxLimit {
+			return storage.Page{}, fmt.Errorf("limit should be 1 to %d, got %q", apiMaxLimit, s)
+		}
+		page.Limit = n
+	}
+
+	if s := q.Get("offset"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return storage.Page{}, fmt.Errorf("offset should be 0 or more, got %q", s)
+		}
+		page.Offset = n
+	}
+
+	return page, nil
+}
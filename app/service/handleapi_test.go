@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bitwombat/gps-tags/storage"
+	zonespkg "github.com/bitwombat/gps-tags/zones"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPI(t *testing.T) {
+	// GIVEN Rueger checked in at noon, in the square, with a fix an hour for
+	// the last day
+	now := func() time.Time { return mkTime("2025-09-02 00:00:00") }
+	storer := FakeAPIStorer{
+		statuses: map[int]storage.Status{
+			810095: {
+				Reason:    11,
+				Latitude:  0.0005,
+				Longitude: 0.0005,
+				DateUTC:   mkTime("2025-09-01 12:00:00"),
+				GpsUTC:    mkTime("2025-09-01 11:55:00"),
+				PosAcc:    5,
+				Battery:   4090,
+			},
+		},
+		readings: []storage.BatteryReading{
+			{DeviceUTC: mkTime("2025-08-31 12:00:00"), Volts: 4.1},
+			{DeviceUTC: mkTime("2025-09-01 12:00:00"), Volts: 4.09},
+		},
+	}
+	for h := range 24 {
+		storer.track = append(storer.track, storage.TrackPoint{GpsUTC: mkTime("2025-09-01 00:00:00").Add(time.Duration(h) * time.Hour), Latitude: float64(h), PosAcc: h})
+	}
+	zones := newStaticZoneHolder(zoneSet{named: []zonespkg.Zone{{Name: "Square", Polygons: testSquareSmall}}})
+	tags := newFakeRegistry()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/tags", newAPITagsHandler(tags))
+	mux.HandleFunc("/api/v1/tags/{serNo}/status", newAPIStatusHandler(storer, tags, zones))
+	mux.HandleFunc("/api/v1/tags/{serNo}/track", newAPITrackHandler(storer, tags, now, time.UTC))
+	mux.HandleFunc("/api/v1/tags/{serNo}/battery", newAPIBatteryHandler(storer, tags, now, time.UTC))
+
+	get := func(t *testing.T, path string, wantStatus int, v any) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com"+path, http.NoBody))
+		require.Equal(t, wantStatus, w.Code, w.Body.String())
+		if v != nil {
+			require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+			require.Nil(t, json.Unmarshal(w.Body.Bytes(), v))
+		}
+	}
+
+	t.Run("tags", func(t *testing.T) {
+		var got []apiTagJSON
+		get(t, "/api/v1/tags", http.StatusOK, &got)
+		require.Len(t, got, 2)
+		require.Contains(t, got, apiTagJSON{SerNo: 810095, Name: "Rueger", Colour: "purple", Icon: "R", Active: true})
+	})
+
+	t.Run("status", func(t *testing.T) {
+		var got apiStatusJSON
+		get(t, "/api/v1/tags/810095/status", http.StatusOK, &got)
+		require.Equal(t, apiStatusJSON{
+			SerNo:          810095,
+			Name:           "Rueger",
+			LastCheckIn:    mkTime("2025-09-01 12:00:00"),
+			Reason:         "HeartbeatStatus",
+			GpsUTC:         mkTime("2025-09-01 11:55:00"),
+			Latitude:       0.0005,
+			Longitude:      0.0005,
+			PosAcc:         5,
+			Zone:           "Square",
+			BatteryVoltage: 4.09,
+		}, got)
+
+		get(t, "/api/v1/tags/810243/status", http.StatusNotFound, nil)
+		get(t, "/api/v1/tags/1/status", http.StatusNotFound, nil)
+		get(t, "/api/v1/tags/rueger/status", http.StatusBadRequest, nil)
+	})
+
+	t.Run("track, in pages", func(t *testing.T) {
+		// The last day by default, in pages of 10.
+		var got apiPageJSON[apiTrackPointJSON]
+		get(t, "/api/v1/tags/810095/track?limit=10", http.StatusOK, &got)
+		require.Equal(t, mkTime("2025-09-01 00:00:00"), got.From)
+		require.Equal(t, mkTime("2025-09-02 00:00:00"), got.To)
+		require.Len(t, got.Items, 10)
+		require.Equal(t, "/api/v1/tags/810095/track?from=2025-09-01T00%3A00%3A00Z&limit=10&offset=10&to=2025-09-02T00%3A00%3A00Z", got.Next)
+
+		var last apiPageJSON[apiTrackPointJSON]
+		get(t, "/api/v1/tags/810095/track?from=2025-09-01T00:00:00Z&to=2025-09-02T00:00:00Z&limit=10&offset=20", http.StatusOK, &last)
+		require.Len(t, last.Items, 4)
+		require.InDelta(t, 23, last.Items[3].Latitude, 1e-9)
+		require.Empty(t, last.Next)
+	})
+
+	t.Run("track, accurate fixes only", func(t *testing.T) {
+		var got apiPageJSON[apiTrackPointJSON]
+		get(t, "/api/v1/tags/810095/track?maxPosAcc=5&limit=4", http.StatusOK, &got)
+		require.Len(t, got.Items, 4)
+		require.Equal(t, 3, got.Items[3].PosAcc)
+		require.Equal(t, "/api/v1/tags/810095/track?from=2025-09-01T00%3A00%3A00Z&limit=4&maxPosAcc=5&offset=4&to=2025-09-02T00%3A00%3A00Z", got.Next, "the next page is filtered too")
+
+		get(t, "/api/v1/tags/810095/track?maxPosAcc=close", http.StatusBadRequest, nil)
+	})
+
+	t.Run("battery, in a time range", func(t *testing.T) {
+		var got apiPageJSON[apiBatteryReadingJSON]
+		get(t, "/api/v1/tags/810095/battery?from=2025-08-31T00:00:00Z", http.StatusOK, &got)
+		require.Equal(t, []apiBatteryReadingJSON{
+			{DeviceUTC: mkTime("2025-08-31 12:00:00"), Volts: 4.1},
+			{DeviceUTC: mkTime("2025-09-01 12:00:00"), Volts: 4.09},
+		}, got.Items)
+	})
+
+	t.Run("bad requests", func(t *testing.T) {
+		for _, query := range []string{
+			"?from=yesterday",
+			"?from=2025-09-02T00:00:00Z&to=2025-09-01T00:00:00Z",
+			"?limit=0",
+			"?limit=100000",
+			"?offset=-1",
+		} {
+			get(t, "/api/v1/tags/810095/track"+query, http.StatusBadRequest, nil)
+		}
+	})
+}
+
+func TestParseTimeRange(t *testing.T) {
+	sydney, err := time.LoadLocation("Australia/Sydney")
+	require.Nil(t, err)
+	now := mkTime("2025-09-01 12:00:00")
+
+	for _, tc := range []struct {
+		name     string
+		query    string
+		from, to time.Time
+	}{
+		{"default", "", mkTime("2025-08-31 12:00:00"), now},
+		{"one day", "from=2025-09-01&to=2025-09-01", mkTime("2025-08-31 14:00:00"), mkTime("2025-09-01 14:00:00")},
+		{"to a day", "from=2025-08-31T00:00:00Z&to=2025-08-31", mkTime("2025-08-31 00:00:00"), mkTime("2025-08-31 14:00:00")},
+		{"times", "from=2025-09-01T06:00:00%2B10:00&to=2025-09-01T00:00:00Z", mkTime("2025-08-31 20:00:00"), mkTime("2025-09-01 00:00:00")},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := url.ParseQuery(tc.query)
+			require.Nil(t, err)
+
+			// Dates are days in Sydney, and a to date is the end of the day.
+			from, to, err := parseTimeRange(q, now, sydney)
+			require.Nil(t, err)
+			require.True(t, tc.from.Equal(from), "from %v, want %v", from, tc.from)
+			require.True(t, tc.to.Equal(to), "to %v, want %v", to, tc.to)
+		})
+	}
+}
@@ -9,18 +9,20 @@ import (
 	"github.com/bitwombat/gps-tags/device"
 	"github.com/bitwombat/gps-tags/model"
 	"github.com/bitwombat/gps-tags/notify"
+	"github.com/bitwombat/gps-tags/registry"
+	"github.com/bitwombat/gps-tags/storage"
 )
 
 // TxWriter handles writing transmission data.
 type TxWriter interface {
-	WriteTx(context.Context, model.TagTx) (string, error)
+	WriteTx(context.Context, model.TagTx) (storage.WriteResult, error)
 }
 
 var lastWasHealthCheck bool // Used to clean up the log output.
 
-func makeNotifier(ctx context.Context, notifier notify.Notifier, title notify.Title, message notify.Message) func() error {
+func makeNotifier(ctx context.Context, notifier notify.Notifier, event notify.Event) func() error {
 	return func() error {
-		err := notifier.Notify(ctx, title, message)
+		err := notifier.Notify(ctx, event)
 		if err != nil {
 			errorLogger.Printf("error sending notification: %v", err)
 		}
@@ -30,6 +32,7 @@ func makeNotifier(ctx context.Context, notifier notify.Notifier, title notify.Ti
 
 func newDataPostHandler(
 	storer TxWriter,
+	tags *registry.Registry,
 	txLogger txLogger,
 	batteryNotifier batteryNotifier,
 	zoneNotifier zoneNotifier,
@@ -47,23 +50,7 @@ func newDataPostHandler(
 			return
 		}
 
-		auths, ok := r.Header[http.CanonicalHeaderKey("auth")]
-		if !ok || len(auths) != 1 {
-			errorLogger.Printf("Auth key not set in header, or too many set\n")
-			w.WriteHeader(http.StatusUnauthorized)
-			return
-		}
-
-		authKey := auths[0]
-
-		if authKey == "" {
-			errorLogger.Printf("Got an empty auth key: %v\n", authKey)
-			w.WriteHeader(http.StatusUnauthorized)
-			return
-		}
-
-		if authKey != tagAuthKey {
-			errorLogger.Printf("Got a bad auth key: %v\n", authKey)
+		if !isAuthorised(r, tagAuthKey) {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
@@ -90,19 +77,43 @@ func newDataPostHandler(
 			return
 		}
 
-		id, err := storer.WriteTx(ctx, tagData)
+		result, err := storer.WriteTx(ctx, tagData)
 		if err != nil {
 			errorLogger.Printf("Error inserting transmission: %v", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		debugLogger.Print("Successfully inserted transmission, id: ", id)
+		if result.Duplicates > 0 {
+			warningLogger.Printf("Skipped %d already-stored records from tag %v (a retried upload?)", result.Duplicates, tagData.SerNo)
+		}
+		debugLogger.Printf("Successfully inserted transmission, id: %s, new records: %d", result.TxID, result.New)
 
-		_, ok = model.SerNoToName[tagData.SerNo]
+		tag, ok := tags.Lookup(tagData.SerNo)
 		if !ok {
-			errorLogger.Printf("Unknown tag number: %v", tagData.SerNo)
-			w.WriteHeader(http.StatusInternalServerError)
+			// Accept it, or the tag will keep retrying. Someone can name it later.
+			warningLogger.Printf("Unknown tag number: %v. Recording it as pending.", tagData.SerNo)
+			err := tags.RecordPending(ctx, model.PendingTag{
+				SerNo:    tagData.SerNo,
+				IMEI:     tagData.IMEI,
+				ICCID:    tagData.ICCID,
+				Fw:       tagData.Fw,
+				LastSeen: now(),
+			})
+			if err != nil {
+				// The transmission's stored, so still accept it. It'll be
+				// recorded as pending with the tag's next upload.
+				errorLogger.Printf("Error recording pending tag: %v", err)
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		if !tag.Active {
+			// Kept, but a retired tag's alerts would be about a dog that's
+			// hidden everywhere else.
+			debugLogger.Printf("Tag %v (%s) is retired. Not checking it for notifications.", tag.SerNo, tag.Name)
+			w.WriteHeader(http.StatusOK)
 			return
 		}
 
@@ -1,20 +1,53 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/bitwombat/gps-tags/config"
+	"github.com/bitwombat/gps-tags/model"
+	"github.com/bitwombat/gps-tags/notify"
 	oshotpkg "github.com/bitwombat/gps-tags/oneshot"
+	"github.com/bitwombat/gps-tags/registry"
 	zonespkg "github.com/bitwombat/gps-tags/zones"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// testConfigPath is the config shipped with the service. It's worked out
+// before any test changes directory.
+var testConfigPath, _ = filepath.Abs("../config.yaml") //nolint:errcheck // checked when loaded
+
+func testConfig(t *testing.T) config.Config {
+	t.Helper()
+
+	t.Setenv("TAG_AUTH_KEY", "xxxx")
+	cfg, err := config.Load(testConfigPath)
+	require.Nil(t, err, "loading config")
+
+	return cfg
+}
+
+// testBoundaries loads the alert boundaries shipped with the service.
+func testBoundaries(t *testing.T, cfg config.Config) []alertBoundary {
+	t.Helper()
+
+	boundaryZones, err := zonespkg.ReadDir(filepath.Join(filepath.Dir(testConfigPath), cfg.Zones.BoundaryZonesDir))
+	require.Nil(t, err, "reading boundary zones")
+	boundaries, err := newAlertBoundaries(boundaryZones)
+	require.Nil(t, err, "loading boundaries")
+
+	return boundaries
+}
+
 const basicCompleteSample = `{
   "SerNo": 810095,
   "IMEI": "353785725680796",
@@ -106,7 +139,7 @@ func TestPostDataHandler(t *testing.T) {
 	require.Nil(t, err, "changing directory to where zone kml's are")
 
 	now := func() time.Time {
-		t, err := time.Parse(time.DateTime, "2025-09-04 13:21:42") // midday so battery notification happens
+		t, err := time.Parse(time.DateTime, "2025-09-04 13:21:42")
 		if err != nil {
 			panic("parsing time")
 		}
@@ -117,28 +150,35 @@ func TestPostDataHandler(t *testing.T) {
 	storer := &FakeStorer{}
 	notifier := &FakeNotifier{}
 	oneShot := oshotpkg.NewOneShot()
+	tags := newFakeRegistry()
+	cfg := testConfig(t)
 
-	namedZones, err := zonespkg.ReadKMLDir("named_zones") // TODO: No need to Chdir now.
+	namedZones, err := zonespkg.ReadDir("named_zones") // TODO: No need to Chdir now.
 	if err != nil {
 		errorLogger.Printf("Error reading KML files: %v", err)
 		// not a critical error, keep going
 	}
 
-	txLogger := txLogger{namedZones}
+	zones := newStaticZoneHolder(zoneSet{named: namedZones, boundaries: testBoundaries(t, cfg)})
+
+	txLogger := txLogger{zones: zones, tags: tags}
 
 	batteryNotifier := batteryNotifier{
-		namedZones: namedZones,
+		zones:      zones,
 		oneShot:    oneShot,
 		notifier:   notifier,
+		tags:       tags,
+		thresholds: cfg.Battery,
 	}
 
 	zoneNotifier := zoneNotifier{
-		namedZones: namedZones,
-		oneShot:    oneShot,
-		notifier:   notifier,
+		zones:    zones,
+		oneShot:  oneShot,
+		notifier: notifier,
+		tags:     tags,
 	}
 
-	handler := newDataPostHandler(storer, txLogger, batteryNotifier, zoneNotifier, "xxxx", now)
+	handler := newDataPostHandler(storer, tags, txLogger, batteryNotifier, zoneNotifier, "xxxx", now)
 
 	body := strings.NewReader(basicCompleteSample)
 
@@ -157,6 +197,10 @@ func TestPostDataHandler(t *testing.T) {
 	assert.Equal(t, "RUEGER's battery low", string(notifier.notifications[0].title))
 	assert.Equal(t, "Battery voltage: 1.641 V", string(notifier.notifications[0].message))
 	assert.Equal(t, "RUEGER's battery critical", string(notifier.notifications[1].title))
+	assert.Equal(t, notify.EventCriticalBattery, notifier.notifications[1].event.Kind)
+	assert.Equal(t, notify.SeverityCritical, notifier.notifications[1].event.Severity)
+	assert.Equal(t, "Rueger", notifier.notifications[1].event.Tag)
+	assert.InDelta(t, 1.641, notifier.notifications[1].event.BatteryVoltage, 1e-9)
 	assert.Equal(t, "Battery voltage: 1.641 V", string(notifier.notifications[1].message))
 	assert.Equal(t, "RUEGER is off the property", string(notifier.notifications[2].title))
 	assert.Equal(t, "Last seen Not in any known zone.", string(notifier.notifications[2].message))
@@ -170,7 +214,7 @@ func TestPostDataHandlerBatteryLevels(t *testing.T) {
 	require.Nil(t, err, "changing directory to where zone kml's are")
 
 	now := func() time.Time {
-		t, err := time.Parse(time.DateTime, "2025-09-04 13:21:42") // midday so battery notification happens
+		t, err := time.Parse(time.DateTime, "2025-09-04 13:21:42")
 		if err != nil {
 			panic("parsing time")
 		}
@@ -240,28 +284,35 @@ func TestPostDataHandlerBatteryLevels(t *testing.T) {
 			storer := &FakeStorer{}
 			notifier := &FakeNotifier{}
 			oneShot := oshotpkg.NewOneShot()
+			tags := newFakeRegistry()
+			cfg := testConfig(t)
 
-			namedZones, err := zonespkg.ReadKMLDir("named_zones")
+			namedZones, err := zonespkg.ReadDir("named_zones")
 			if err != nil {
 				errorLogger.Printf("Error reading KML files: %v", err)
 				// not a critical error, keep going
 			}
 
-			txLogger := txLogger{namedZones}
+			zones := newStaticZoneHolder(zoneSet{named: namedZones, boundaries: testBoundaries(t, cfg)})
+
+			txLogger := txLogger{zones: zones, tags: tags}
 
 			batteryNotifier := batteryNotifier{
-				namedZones: namedZones,
+				zones:      zones,
 				oneShot:    oneShot,
 				notifier:   notifier,
+				tags:       tags,
+				thresholds: cfg.Battery,
 			}
 
 			zoneNotifier := zoneNotifier{
-				namedZones: namedZones,
-				oneShot:    oneShot,
-				notifier:   notifier,
+				zones:    zones,
+				oneShot:  oneShot,
+				notifier: notifier,
+				tags:     tags,
 			}
 
-			handler := newDataPostHandler(storer, txLogger, batteryNotifier, zoneNotifier, "xxxx", now)
+			handler := newDataPostHandler(storer, tags, txLogger, batteryNotifier, zoneNotifier, "xxxx", now)
 
 			batteryTestSample := fmt.Sprintf(`{
   "SerNo": 810095,
@@ -319,7 +370,7 @@ func TestPostDataHandlerBatteryRecovery(t *testing.T) {
 	require.Nil(t, err, "changing directory to where zone kml's are")
 
 	now := func() time.Time {
-		t, err := time.Parse(time.DateTime, "2025-09-04 13:21:42") // midday so battery notification happens
+		t, err := time.Parse(time.DateTime, "2025-09-04 13:21:42")
 		if err != nil {
 			panic("parsing time")
 		}
@@ -329,28 +380,35 @@ func TestPostDataHandlerBatteryRecovery(t *testing.T) {
 	storer := &FakeStorer{}
 	notifier := &FakeNotifier{}
 	oneShot := oshotpkg.NewOneShot()
+	tags := newFakeRegistry()
+	cfg := testConfig(t)
 
-	namedZones, err := zonespkg.ReadKMLDir("named_zones")
+	namedZones, err := zonespkg.ReadDir("named_zones")
 	if err != nil {
 		errorLogger.Printf("Error reading KML files: %v", err)
 		// not a critical error, keep going
 	}
 
-	txLogger := txLogger{namedZones}
+	zones := newStaticZoneHolder(zoneSet{named: namedZones, boundaries: testBoundaries(t, cfg)})
+
+	txLogger := txLogger{zones: zones, tags: tags}
 
 	batteryNotifier := batteryNotifier{
-		namedZones: namedZones,
+		zones:      zones,
 		oneShot:    oneShot,
 		notifier:   notifier,
+		tags:       tags,
+		thresholds: cfg.Battery,
 	}
 
 	zoneNotifier := zoneNotifier{
-		namedZones: namedZones,
-		oneShot:    oneShot,
-		notifier:   notifier,
+		zones:    zones,
+		oneShot:  oneShot,
+		notifier: notifier,
+		tags:     tags,
 	}
 
-	handler := newDataPostHandler(storer, txLogger, batteryNotifier, zoneNotifier, "xxxx", now)
+	handler := newDataPostHandler(storer, tags, txLogger, batteryNotifier, zoneNotifier, "xxxx", now)
 
 	// First: Send low battery data to trigger the "set" state
 	lowBatterySample := `{
@@ -457,28 +515,35 @@ func TestPostDataHandlerAuth(t *testing.T) {
 
 	notifier := &FakeNotifier{}
 	oneShot := oshotpkg.NewOneShot()
+	tags := newFakeRegistry()
+	cfg := testConfig(t)
 
-	namedZones, err := zonespkg.ReadKMLDir("named_zones") // TODO: DRY this up
+	namedZones, err := zonespkg.ReadDir("named_zones") // TODO: DRY this up
 	if err != nil {
 		errorLogger.Printf("Error reading KML files: %v", err)
 		// not a critical error, keep going
 	}
 
-	txLogger := txLogger{namedZones}
+	zones := newStaticZoneHolder(zoneSet{named: namedZones, boundaries: testBoundaries(t, cfg)})
+
+	txLogger := txLogger{zones: zones, tags: tags}
 
 	batteryNotifier := batteryNotifier{
-		namedZones: namedZones,
+		zones:      zones,
 		oneShot:    oneShot,
 		notifier:   notifier,
+		tags:       tags,
+		thresholds: cfg.Battery,
 	}
 
 	zoneNotifier := zoneNotifier{
-		namedZones: namedZones,
-		oneShot:    oneShot,
-		notifier:   notifier,
+		zones:    zones,
+		oneShot:  oneShot,
+		notifier: notifier,
+		tags:     tags,
 	}
 
-	handler := newDataPostHandler(storer, txLogger, batteryNotifier, zoneNotifier, "xxxx", now)
+	handler := newDataPostHandler(storer, tags, txLogger, batteryNotifier, zoneNotifier, "xxxx", now)
 	req := httptest.NewRequest(http.MethodPost, "http://example.com/foo", http.NoBody)
 
 	t.Run("no auth header", func(t *testing.T) {
@@ -513,3 +578,131 @@ func TestPostDataHandlerAuth(t *testing.T) {
 
 	_ = os.Chdir(cwd) //nolint:errcheck // don't care
 }
+
+func TestPostDataHandlerUnknownTag(t *testing.T) {
+	now := func() time.Time {
+		return mkTime("2025-09-04 13:21:42")
+	}
+
+	storer := &FakeStorer{}
+	notifier := &FakeNotifier{}
+	oneShot := oshotpkg.NewOneShot()
+	tags := newFakeRegistry()
+	cfg := testConfig(t)
+
+	zones := newStaticZoneHolder(zoneSet{boundaries: testBoundaries(t, cfg)})
+
+	txLogger := txLogger{zones: zones, tags: tags}
+
+	batteryNotifier := batteryNotifier{
+		zones:      zones,
+		oneShot:    oneShot,
+		notifier:   notifier,
+		tags:       tags,
+		thresholds: cfg.Battery,
+	}
+
+	zoneNotifier := zoneNotifier{
+		zones:    zones,
+		oneShot:  oneShot,
+		notifier: notifier,
+		tags:     tags,
+	}
+
+	handler := newDataPostHandler(storer, tags, txLogger, batteryNotifier, zoneNotifier, "xxxx", now)
+
+	// The basic sample, from a tag we've never heard of.
+	body := strings.NewReader(strings.Replace(basicCompleteSample, "810095", "999999", 1))
+
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/foo", body)
+	req.Header.Add("auth", "xxxx")
+
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	resp := w.Result()
+	require.Equal(t, http.StatusOK, resp.StatusCode, "accepted so the tag doesn't retry forever")
+
+	require.Equal(t, 999999, storer.writtenTx.SerNo, "transmission still stored")
+	require.Empty(t, notifier.notifications, "no notifications for a tag without a name")
+
+	pending, err := tags.Pending(context.Background())
+	require.Nil(t, err)
+	require.Len(t, pending, 1)
+	require.Equal(t, 999999, pending[0].SerNo)
+	require.Equal(t, "353785725680796", pending[0].IMEI)
+	require.Equal(t, "89610180004127201829", pending[0].ICCID)
+	require.Equal(t, "97.2.1.11", pending[0].Fw)
+	require.Equal(t, now(), pending[0].LastSeen)
+}
+
+func TestPostDataHandlerRetiredTag(t *testing.T) {
+	// GIVEN Rueger's tag has been retired
+	now := func() time.Time {
+		return mkTime("2025-09-04 13:21:42")
+	}
+
+	storer := &FakeStorer{}
+	notifier := &FakeNotifier{}
+	oneShot := oshotpkg.NewOneShot()
+	tags := newFakeRegistry()
+	err := tags.Retire(context.Background(), 810095)
+	require.Nil(t, err)
+	cfg := testConfig(t)
+
+	zones := newStaticZoneHolder(zoneSet{boundaries: testBoundaries(t, cfg)})
+
+	txLogger := txLogger{zones: zones, tags: tags}
+	batteryNotifier := batteryNotifier{zones: zones, oneShot: oneShot, notifier: notifier, tags: tags, thresholds: cfg.Battery}
+	zoneNotifier := zoneNotifier{zones: zones, oneShot: oneShot, notifier: notifier, tags: tags}
+
+	handler := newDataPostHandler(storer, tags, txLogger, batteryNotifier, zoneNotifier, "xxxx", now)
+
+	// WHEN it uploads the basic sample, with a low battery, off the property
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/foo", strings.NewReader(basicCompleteSample))
+	req.Header.Add("auth", "xxxx")
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	// THEN it's stored and accepted, but nobody's told about it.
+	require.Equal(t, http.StatusOK, w.Result().StatusCode)
+	require.Equal(t, 810095, storer.writtenTx.SerNo)
+	require.Empty(t, notifier.notifications)
+}
+
+func TestPostDataHandlerUnknownTagPendingError(t *testing.T) {
+	// GIVEN a registry that can't record pending tags
+	now := func() time.Time {
+		return mkTime("2025-09-04 13:21:42")
+	}
+
+	storer := &FakeStorer{}
+	notifier := &FakeNotifier{}
+	oneShot := oshotpkg.NewOneShot()
+	tags := registry.New(&FakeTagStorer{
+		tags:       map[int]model.Tag{},
+		pending:    map[int]model.PendingTag{},
+		pendingErr: errors.New("database is locked"),
+	})
+	cfg := testConfig(t)
+
+	zones := newStaticZoneHolder(zoneSet{boundaries: testBoundaries(t, cfg)})
+
+	txLogger := txLogger{zones: zones, tags: tags}
+	batteryNotifier := batteryNotifier{zones: zones, oneShot: oneShot, notifier: notifier, tags: tags, thresholds: cfg.Battery}
+	zoneNotifier := zoneNotifier{zones: zones, oneShot: oneShot, notifier: notifier, tags: tags}
+
+	handler := newDataPostHandler(storer, tags, txLogger, batteryNotifier, zoneNotifier, "xxxx", now)
+
+	// WHEN an unknown tag uploads
+	body := strings.NewReader(strings.Replace(basicCompleteSample, "810095", "999999", 1))
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/foo", body)
+	req.Header.Add("auth", "xxxx")
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	// THEN the transmission is stored, so it's still accepted rather than
+	// sent again.
+	require.Equal(t, http.StatusOK, w.Result().StatusCode)
+	require.Equal(t, 999999, storer.writtenTx.SerNo)
+}
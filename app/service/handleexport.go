@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bitwombat/gps-tags/registry"
+	"github.com/bitwombat/gps-tags/storage"
+	"github.com/bitwombat/gps-tags/tracks"
+)
+
+// trackFormat is a file format a track can be downloaded as.
+type trackFormat struct {
+	ext         string
+	contentType string
+	marshal     func(tracks.Track) ([]byte, error)
+}
+
+var (
+	gpxFormat     = trackFormat{"gpx", "application/gpx+xml", tracks.MarshalGPX}
+	kmlFormat     = trackFormat{"kml", "application/vnd.google-earth.kml+xml", tracks.MarshalKML}
+	geoJSONFormat = trackFormat{"geojson", "application/geo+json", tracks.MarshalGeoJSON}
+)
+
+// newTrackExportHandler serves a tag's whole track in a time range as a file
+// to download. It takes the same ?from=, ?to=, ?maxPosAcc= and ?maxPdop= as
+// the JSON track, but isn't paged. The file is named for the day it starts on
+// in loc.
+func newTrackExportHandler(storer TrackReader, tags *registry.Registry, now func() time.Time, loc *time.Location, format trackFormat) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		debugLogger.Printf("Got a %s track export request.", format.ext)
+		lastWasHealthCheck = false
+
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		tag, ok := apiTag(w, r, tags)
+		if !ok {
+			return
+		}
+
+		q := r.URL.Query()
+		from, to, err := parseTimeRange(q, now(), loc)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		quality, err := parseFixQuality(q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+		defer cancel()
+
+		points, err := storer.GetTrack(ctx, tag.SerNo, from, to, quality, storage.Page{})
+		if err != nil {
+			errorLogger.Printf("Error getting track from storage: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		track := tracks.Track{Name: tag.Name}
+		for _, p := range points {
+			track.Points = append(track.Points, tracks.Point{
+				Time:      p.GpsUTC,
+				Latitude:  p.Latitude,
+				Longitude: p.Longitude,
+				Altitude:  float64(p.Altitude),
+				PDOP:      float64(p.PDOP) / 10,
+			})
+		}
+
+		blob, err := format.marshal(track)
+		if err != nil {
+			errorLogger.Printf("Error marshalling %s track: %v\n", format.ext, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		// e.g. rueger-2025-09-01.gpx
+		filename := fmt.Sprintf("%s-%s.%s", strings.ToLower(tag.Name), from.In(loc).Format(time.DateOnly), format.ext)
+		w.Header().Set("Content-Type", format.contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		_, err = w.Write(blob)
+		if err != nil {
+			errorLogger.Printf("Error writing track export response: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bitwombat/gps-tags/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrackExportHandler(t *testing.T) {
+	// GIVEN a morning's walk
+	now := func() time.Time { return mkTime("2025-09-02 00:00:00") }
+	storer := FakeAPIStorer{}
+	for m := range 60 {
+		storer.track = append(storer.track, storage.TrackPoint{
+			GpsUTC:    mkTime("2025-09-01 06:00:00").Add(time.Duration(m) * time.Minute),
+			Latitude:  -31.5 + float64(m)/10000,
+			Longitude: 152.6,
+			Altitude:  40 + m,
+			PosAcc:    m % 20,
+			PDOP:      14,
+		})
+	}
+	tags := newFakeRegistry()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/tags/{serNo}/track.gpx", newTrackExportHandler(storer, tags, now, time.UTC, gpxFormat))
+	mux.HandleFunc("/api/v1/tags/{serNo}/track.kml", newTrackExportHandler(storer, tags, now, time.UTC, kmlFormat))
+	mux.HandleFunc("/api/v1/tags/{serNo}/track.geojson", newTrackExportHandler(storer, tags, now, time.UTC, geoJSONFormat))
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com"+path, http.NoBody))
+		return w
+	}
+
+	t.Run("GPX", func(t *testing.T) {
+		// WHEN it's downloaded as GPX, accurate fixes only
+		w := get("/api/v1/tags/810095/track.gpx?from=2025-09-01T06:00:00Z&to=2025-09-01T07:00:00Z&maxPosAcc=9")
+
+		// THEN it's a GPX file named for the dog and day, with the fixes'
+		// elevations and times.
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		require.Equal(t, "application/gpx+xml", w.Header().Get("Content-Type"))
+		require.Contains(t, w.Header().Get("Content-Disposition"), `filename="rueger-2025-09-01.gpx"`)
+
+		var got struct {
+			Points []struct {
+				Ele  int     `xml:"ele"`
+				Time string  `xml:"time"`
+				PDOP float64 `xml:"pdop"`
+			} `xml:"trk>trkseg>trkpt"`
+		}
+		err := xml.Unmarshal(w.Body.Bytes(), &got)
+		require.Nil(t, err)
+		require.Len(t, got.Points, 30)
+		require.Equal(t, 41, got.Points[1].Ele)
+		require.Equal(t, "2025-09-01T06:01:00Z", got.Points[1].Time)
+		require.Equal(t, 1.4, got.Points[1].PDOP)
+	})
+
+	t.Run("KML", func(t *testing.T) {
+		w := get("/api/v1/tags/810095/track.kml?from=2025-09-01")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		require.Equal(t, "application/vnd.google-earth.kml+xml", w.Header().Get("Content-Type"))
+		require.Contains(t, w.Body.String(), "<when>2025-09-01T06:59:00Z</when>")
+		require.Contains(t, w.Body.String(), "<gx:coord>152.6 -31.4941 99</gx:coord>")
+	})
+
+	t.Run("GeoJSON", func(t *testing.T) {
+		w := get("/api/v1/tags/810095/track.geojson")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		require.Equal(t, "application/geo+json", w.Header().Get("Content-Type"))
+		require.Contains(t, w.Body.String(), `"type":"LineString"`)
+		require.Contains(t, w.Body.String(), "[152.6,-31.5,40]")
+	})
+
+	t.Run("bad requests", func(t *testing.T) {
+		require.Equal(t, http.StatusNotFound, get("/api/v1/tags/1/track.gpx").Code)
+		require.Equal(t, http.StatusBadRequest, get("/api/v1/tags/810095/track.gpx?from=tuesday").Code)
+		require.Equal(t, http.StatusBadRequest, get("/api/v1/tags/810095/track.kml?maxPdop=-1").Code)
+	})
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bitwombat/gps-tags/model"
+	"github.com/bitwombat/gps-tags/registry"
+	"github.com/bitwombat/gps-tags/substitute"
+)
+
+// ZoneVisitReader handles reading zone visits for the history page.
+type ZoneVisitReader interface {
+	GetZoneVisits(context.Context, int, time.Time, time.Time) ([]model.ZoneVisit, error)
+	GetLastZoneVisits(context.Context, int) ([]model.ZoneVisit, error)
+}
+
+// notInAnyZone is what the history page calls time spent outside every named
+// zone.
+const notInAnyZone = "Not in any named zone"
+
+// historyPage is what history.html needs.
+type historyPage struct {
+	Date     string // YYYY-MM-DD
+	PrevDate string
+	NextDate string
+	Tag      string // The tag asked for, if any, for the day links
+	Tags     []historyTag
+}
+
+// historyTag is one tag's part of the history page.
+type historyTag struct {
+	Name       string
+	Colour     string
+	Zones      []zoneTime // Time in each zone on the day, most first
+	LastVisits []historyLastVisit
+}
+
+// historyLastVisit is when a tag was last in a zone.
+type historyLastVisit struct {
+	Zone string
+	When string
+	Ago  string
+}
+
+// zoneTime is how long was spent in a zone.
+type zoneTime struct {
+	Zone     string
+	Duration time.Duration
+}
+
+// Hours is the duration in hours, for display.
+func (zt zoneTime) Hours() string {
+	return fmt.Sprintf("%.1f", zt.Duration.Hours())
+}
+
+// timePerZone adds up how long the visits spent in each zone between from and
+// to, most first. Visits still going count up to their latest fix.
+func timePerZone(visits []model.ZoneVisit, from, to time.Time) []zoneTime {
+	totals := make(map[string]time.Duration)
+
+	for _, v := range visits {
+		start, end := v.Entered, v.End()
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if !end.After(start) {
+			continue
+		}
+
+		zone := v.Zone
+		if zone == "" {
+			zone = notInAnyZone
+		}
+		totals[zone] += end.Sub(start)
+	}
+
+	zoneTimes := make([]zoneTime, 0, len(totals))
+	for zone, d := range totals {
+		zoneTimes = append(zoneTimes, zoneTime{Zone: zone, Duration: d})
+	}
+	slices.SortFunc(zoneTimes, func(a, b zoneTime) int {
+		return cmp.Or(cmp.Compare(b.Duration, a.Duration), cmp.Compare(a.Zone, b.Zone))
+	})
+
+	return zoneTimes
+}
+
+// newHistoryPageHandler serves where each tag spent a day (?date=YYYY-MM-DD,
+// default today) and when it was last in each zone. ?tag=<name> shows just
+// that tag. Days start and end at midnight in loc, and times are shown in it.
+func newHistoryPageHandler(storer ZoneVisitReader, tags *registry.Registry, now func() time.Time, loc *time.Location) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		debugLogger.Println("Got a history page request.")
+		lastWasHealthCheck = false
+
+		ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+		defer cancel()
+
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		today := now().In(loc)
+		dayStart := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, loc)
+		if date := r.URL.Query().Get("date"); date != "" {
+			var err error
+			dayStart, err = time.ParseInLocation(time.DateOnly, date, loc)
+			if err != nil {
+				http.Error(w, "date should look like 2025-09-01", http.StatusBadRequest)
+				return
+			}
+		}
+		dayEnd := dayStart.AddDate(0, 0, 1)
+
+		page := historyPage{
+			Date:     dayStart.Format(time.DateOnly),
+			PrevDate: dayStart.AddDate(0, 0, -1).Format(time.DateOnly),
+			NextDate: dayEnd.Format(time.DateOnly),
+			Tag:      r.URL.Query().Get("tag"),
+		}
+
+		for _, tag := range tags.Active() {
+			if page.Tag != "" && !strings.EqualFold(page.Tag, tag.Name) {
+				continue
+			}
+
+			visits, err := storer.GetZoneVisits(ctx, tag.SerNo, dayStart, dayEnd)
+			if err != nil {
+				errorLogger.Printf("Error getting zone visits from storage: %v\n", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			lastVisits, err := storer.GetLastZoneVisits(ctx, tag.SerNo)
+			if err != nil {
+				errorLogger.Printf("Error getting last zone visits from storage: %v\n", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			slices.SortFunc(lastVisits, func(a, b model.ZoneVisit) int {
+				return b.End().Compare(a.End())
+			})
+
+			ht := historyTag{
+				Name:   tag.Name,
+				Colour: tag.Colour,
+				Zones:  timePerZone(visits, dayStart, dayEnd),
+			}
+			for _, v := range lastVisits {
+				ht.LastVisits = append(ht.LastVisits, historyLastVisit{
+					Zone: v.Zone,
+					When: v.End().In(loc).Format("Mon 2 Jan 15:04"),
+					Ago:  timeAgoAsText(v.End(), now),
+				})
+			}
+
+			page.Tags = append(page.Tags, ht)
+		}
+
+		if page.Tag != "" && len(page.Tags) == 0 {
+			http.Error(w, "no tag called "+page.Tag, http.StatusNotFound)
+			return
+		}
+
+		historyPage, err := substitute.ContentsOf("public_html/history.html", page)
+		if err != nil {
+			errorLogger.Printf("Error getting contents of history.html: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		_, err = w.Write([]byte(historyPage)) // NOTE: writes http.StatusOK header
+		if err != nil {
+			errorLogger.Printf("Error writing response: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bitwombat/gps-tags/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimePerZone(t *testing.T) {
+	// GIVEN visits running into the day from before, out of it after, and
+	// still going
+	visits := []model.ZoneVisit{
+		{Zone: "House", Entered: mkTime("2025-08-31 20:00:00"), Exited: mkTime("2025-09-01 06:00:00")},
+		{Zone: "", Entered: mkTime("2025-09-01 06:00:00"), Exited: mkTime("2025-09-01 06:30:00")},
+		{Zone: "East dam", Entered: mkTime("2025-09-01 06:30:00"), Exited: mkTime("2025-09-01 08:00:00")},
+		{Zone: "House", Entered: mkTime("2025-09-01 08:00:00"), Exited: mkTime("2025-09-01 22:00:00")},
+		{Zone: "East dam", Entered: mkTime("2025-09-01 22:00:00"), LastSeen: mkTime("2025-09-02 03:00:00")},
+	}
+
+	// WHEN the time in each zone on the day is added up
+	got := timePerZone(visits, mkTime("2025-09-01 00:00:00"), mkTime("2025-09-02 00:00:00"))
+
+	// THEN only the time within the day counts, most first.
+	require.Equal(t, []zoneTime{
+		{Zone: "House", Duration: 20 * time.Hour},
+		{Zone: "East dam", Duration: 3*time.Hour + 30*time.Minute},
+		{Zone: notInAnyZone, Duration: 30 * time.Minute},
+	}, got)
+	require.Equal(t, "3.5", got[1].Hours())
+}
+
+func TestHistoryPageHandler(t *testing.T) {
+	// Save current directory to restore after test
+	origDir, err := os.Getwd()
+	require.Nil(t, err, "getting current directory")
+	defer func() {
+		err := os.Chdir(origDir)
+		require.Nil(t, err, "restoring original directory")
+	}()
+
+	err = os.Chdir("..")
+	require.Nil(t, err, "changing directory to where public_html is")
+
+	var askedFrom, askedTo time.Time
+	storer := &FakeStorer{
+		fnGetZoneVisits: func(_ context.Context, serNo int, from, to time.Time) ([]model.ZoneVisit, error) {
+			askedFrom, askedTo = from, to
+			if serNo != 810095 {
+				return nil, nil
+			}
+			return []model.ZoneVisit{
+				{SerNo: serNo, Zone: "House", Entered: mkTime("2025-09-01 00:00:00"), Exited: mkTime("2025-09-01 09:30:00")},
+				{SerNo: serNo, Zone: "East dam", Entered: mkTime("2025-09-01 09:30:00"), LastSeen: mkTime("2025-09-01 12:00:00")},
+			}, nil
+		},
+		fnGetLastZoneVisits: func(_ context.Context, serNo int) ([]model.ZoneVisit, error) {
+			if serNo != 810243 {
+				return nil, nil
+			}
+			return []model.ZoneVisit{
+				{SerNo: serNo, Zone: "East dam", Entered: mkTime("2025-08-30 10:00:00"), Exited: mkTime("2025-08-30 11:00:00")},
+				{SerNo: serNo, Zone: "House", Entered: mkTime("2025-09-01 07:00:00"), LastSeen: mkTime("2025-09-02 08:00:00")},
+			}, nil
+		},
+	}
+
+	now := func() time.Time { return mkTime("2025-09-02 10:00:00") }
+	handler := newHistoryPageHandler(storer, newFakeRegistry(), now, time.UTC)
+
+	for _, tc := range []struct {
+		name       string
+		query      string
+		wantStatus int
+	}{
+		{"bad date", "?date=yesterday", http.StatusBadRequest},
+		{"unknown tag", "?tag=Tucker", http.StatusNotFound},
+		{"one tag", "?tag=rueger", http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest(http.MethodGet, "http://example.com/history"+tc.query, http.NoBody))
+			require.Equal(t, tc.wantStatus, w.Code)
+		})
+	}
+
+	// GIVEN a request for a day, for all tags
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/history?date=2025-09-01", http.NoBody)
+	w := httptest.NewRecorder()
+
+	// WHEN it's handled
+	handler(w, req)
+
+	// THEN the page is for that day
+	resp := w.Result()
+	require.Equal(t, 200, resp.StatusCode, "HTTP status")
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Nil(t, err)
+
+	require.Equal(t, mkTime("2025-09-01 00:00:00"), askedFrom)
+	require.Equal(t, mkTime("2025-09-02 00:00:00"), askedTo)
+
+	// AND shows the time in each zone, and the last visits, latest first.
+	require.Contains(t, string(body), "<td>House</td><td>9.5</td>")
+
+	assertGolden(t, "history_page", string(body))
+}
+
+func TestHistoryPageHandlerEscapesNames(t *testing.T) {
+	origDir, err := os.Getwd()
+	require.Nil(t, err, "getting current directory")
+	defer func() {
+		err := os.Chdir(origDir)
+		require.Nil(t, err, "restoring original directory")
+	}()
+
+	err = os.Chdir("..")
+	require.Nil(t, err, "changing directory to where public_html is")
+
+	// GIVEN a tag and a zone with names that are HTML
+	tags := newFakeRegistry()
+	err = tags.Update(context.Background(), model.Tag{SerNo: 810095, Name: `<b>Rueger</b>`, Colour: `purple"><script>`, Icon: "R", Active: true})
+	require.Nil(t, err)
+
+	visits := func(_ context.Context, serNo int) ([]model.ZoneVisit, error) {
+		if serNo != 810095 {
+			return nil, nil
+		}
+		return []model.ZoneVisit{
+			{SerNo: serNo, Zone: "<i>Dam</i>", Entered: mkTime("2025-09-01 09:00:00"), LastSeen: mkTime("2025-09-01 10:00:00")},
+		}, nil
+	}
+	storer := &FakeStorer{
+		fnGetZoneVisits: func(ctx context.Context, serNo int, _, _ time.Time) ([]model.ZoneVisit, error) {
+			return visits(ctx, serNo)
+		},
+		fnGetLastZoneVisits: visits,
+	}
+
+	// WHEN the history page is drawn
+	handler := newHistoryPageHandler(storer, tags, func() time.Time { return mkTime("2025-09-02 10:00:00") }, time.UTC)
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "http://example.com/history?date=2025-09-01", http.NoBody))
+
+	// THEN the names are shown as text, not HTML.
+	require.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	require.Contains(t, body, `<h2 style="color: purple&#34;&gt;&lt;script&gt;">&lt;b&gt;Rueger&lt;/b&gt;</h2>`)
+	require.Contains(t, body, "<td>&lt;i&gt;Dam&lt;/i&gt;</td><td>1.0</td>")
+	require.NotContains(t, body, "<script>")
+	require.NotContains(t, body, "<i>Dam</i>")
+}
+
+func TestHistoryPageHandlerTimeZone(t *testing.T) {
+	origDir, err := os.Getwd()
+	require.Nil(t, err, "getting current directory")
+	defer func() {
+		err := os.Chdir(origDir)
+		require.Nil(t, err, "restoring original directory")
+	}()
+
+	err = os.Chdir("..")
+	require.Nil(t, err, "changing directory to where public_html is")
+
+	var askedFrom, askedTo time.Time
+	storer := &FakeStorer{
+		fnGetZoneVisits: func(_ context.Context, _ int, from, to time.Time) ([]model.ZoneVisit, error) {
+			askedFrom, askedTo = from, to
+			return nil, nil
+		},
+		fnGetLastZoneVisits: func(_ context.Context, _ int) ([]model.ZoneVisit, error) {
+			return nil, nil
+		},
+	}
+
+	// GIVEN it's just after midnight in Sydney, but still yesterday in UTC
+	sydney, err := time.LoadLocation("Australia/Sydney")
+	require.Nil(t, err)
+	now := func() time.Time { return mkTime("2025-09-01 14:30:00") }
+	handler := newHistoryPageHandler(storer, newFakeRegistry(), now, sydney)
+
+	// WHEN today's history is asked for
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "http://example.com/history", http.NoBody))
+
+	// THEN it's Sydney's today, from its midnight to the next.
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "2025-09-02")
+	require.Equal(t, mkTime("2025-09-01 14:00:00"), askedFrom.UTC())
+	require.Equal(t, mkTime("2025-09-02 14:00:00"), askedTo.UTC())
+
+	// AND a date asked for is a Sydney day too.
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "http://example.com/history?date=2025-08-30", http.NoBody))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, mkTime("2025-08-29 14:00:00"), askedFrom.UTC())
+}
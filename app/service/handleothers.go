@@ -20,7 +20,7 @@ func handleHealthCheck(w http.ResponseWriter, _ *http.Request) {
 }
 
 func newTestNotifyHandler(n notify.Notifier) func(http.ResponseWriter, *http.Request) {
-	notifier := n
+	send := notify.TitleMessage(n, notify.EventTest)
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		debugLogger.Println("Got a request to send a test notification.")
@@ -28,7 +28,7 @@ func newTestNotifyHandler(n notify.Notifier) func(http.ResponseWriter, *http.Req
 		ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
 		defer cancel()
 
-		err := notifier.Notify(ctx, "Test notification", "This is a test notification.")
+		err := send(ctx, "Test notification", "This is a test notification.")
 		if err != nil {
 			errorLogger.Printf("Error sending test notification: %v", err)
 			w.WriteHeader(http.StatusInternalServerError)
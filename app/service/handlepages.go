@@ -2,18 +2,27 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
-	"github.com/bitwombat/gps-tags/model"
+	"github.com/bitwombat/gps-tags/registry"
 	"github.com/bitwombat/gps-tags/storage"
 	"github.com/bitwombat/gps-tags/substitute"
 )
 
-// CoordReader handles reading coordinate data for paths.
-type CoordReader interface {
-	GetLastNCoords(context.Context, int) (storage.Coords, error)
+// TrackReader handles reading tags' tracks for paths.
+type TrackReader interface {
+	GetTrack(ctx context.Context, serNo int, from, to time.Time, quality storage.FixQuality, page storage.Page) ([]storage.TrackPoint, error)
+}
+
+// PathsReader handles reading tags' tracks for paths, and where a tag was
+// last if it has no path.
+type PathsReader interface {
+	TrackReader
+	GetStatus(ctx context.Context, serNo int) (storage.Status, error)
 }
 
 // StatusReader handles reading status data for current locations.
@@ -21,7 +30,32 @@ type StatusReader interface {
 	GetLastStatuses(context.Context) (storage.Statuses, error)
 }
 
-func newPathsMapPageHandler(storer CoordReader) func(http.ResponseWriter, *http.Request) {
+// pathsMapTag is what paths.html needs to draw one tag's path.
+type pathsMapTag struct {
+	Name   string
+	Icon   string
+	Colour string
+	Path   string // A JavaScript array of {lat:, lng:} objects, maybe empty
+	Lat    string // Most recent position, for the marker
+	Lng    string
+}
+
+// currentMapTag is what current-map.html needs to draw one tag's marker.
+type currentMapTag struct {
+	Name           string
+	Icon           string
+	Colour         string
+	Lat            string
+	Lng            string
+	AccuracyRadius string
+	Note           string
+}
+
+// newPathsMapPageHandler serves each tag's path between ?from= and ?to= (RFC
+// 3339 times or YYYY-MM-DD dates in loc, the last day by default). ?tag=<name>
+// shows just that tag, and ?maxPosAcc= and ?maxPdop= leave out poor fixes. A
+// tag without a path in the range is still marked where it was last.
+func newPathsMapPageHandler(storer PathsReader, tags *registry.Registry, now func() time.Time, loc *time.Location) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		debugLogger.Println("Got a paths map page request.")
 		lastWasHealthCheck = false
@@ -29,23 +63,65 @@ func newPathsMapPageHandler(storer CoordReader) func(http.ResponseWriter, *http.
 		ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
 		defer cancel()
 
-		pathpoints, err := storer.GetLastNCoords(ctx, 5)
+		q := r.URL.Query()
+		from, to, err := parseTimeRange(q, now(), loc)
 		if err != nil {
-			errorLogger.Printf("Error getting last N coordinates from storage: %v\n", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		quality, err := parseFixQuality(q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		only := q.Get("tag")
+
+		var mapTags []pathsMapTag
 
-		subs := make(map[string]string)
+		for _, tag := range tags.Active() {
+			if only != "" && !strings.EqualFold(only, tag.Name) {
+				continue
+			}
 
-		for tag, points := range pathpoints {
-			// Start the JavaScript array
+			points, err := storer.GetTrack(ctx, tag.SerNo, from, to, quality, storage.Page{})
+			if err != nil {
+				errorLogger.Printf("Error getting track from storage: %v\n", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			mt := pathsMapTag{
+				Name:   tag.Name,
+				Icon:   tag.Icon,
+				Colour: tag.Colour,
+			}
+
+			if len(points) == 0 {
+				status, err := storer.GetStatus(ctx, tag.SerNo)
+				if errors.Is(err, storage.ErrNotFound) {
+					continue // Never heard from
+				}
+				if err != nil {
+					errorLogger.Printf("Error getting status from storage: %v\n", err)
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				mt.Path = "[]"
+				mt.Lat = fmt.Sprintf("%.7f", status.Latitude)
+				mt.Lng = fmt.Sprintf("%.7f", status.Longitude)
+				mapTags = append(mapTags, mt)
+				continue
+			}
+
+			// Start the JavaScript array. It runs back in time from the most
+			// recent point, as the page's arrows expect.
 			pathpointStr := "["
-			name := model.SerNoToName[int(tag)]
-			for i, pathpoint := range points {
-				if i == 0 { // First point is most recent. Use this for the marker.
-					subs[name+"Lat"] = fmt.Sprintf("%.7f", pathpoint.Latitude)
-					subs[name+"Lng"] = fmt.Sprintf("%.7f", pathpoint.Longitude)
+			for i := len(points) - 1; i >= 0; i-- {
+				pathpoint := points[i]
+				if i == len(points)-1 { // Most recent point. Use this for the marker.
+					mt.Lat = fmt.Sprintf("%.7f", pathpoint.Latitude)
+					mt.Lng = fmt.Sprintf("%.7f", pathpoint.Longitude)
 				}
 				pathpointStr += fmt.Sprintf("{lat: %.7f, lng: %.7f},", pathpoint.Latitude, pathpoint.Longitude)
 			}
@@ -54,10 +130,11 @@ func newPathsMapPageHandler(storer CoordReader) func(http.ResponseWriter, *http.
 			// Close out the array
 			pathpointStr += "]"
 
-			subs[name+"Path"] = pathpointStr
+			mt.Path = pathpointStr
+			mapTags = append(mapTags, mt)
 		}
 
-		mapPage, err := substitute.ContentsOf("public_html/paths.html", subs)
+		mapPage, err := substitute.ContentsOf("public_html/paths.html", mapTags)
 		if err != nil {
 			errorLogger.Printf("Error getting contents of paths.html: %v\n", err)
 			w.WriteHeader(http.StatusInternalServerError)
@@ -75,7 +152,7 @@ func newPathsMapPageHandler(storer CoordReader) func(http.ResponseWriter, *http.
 	}
 }
 
-func newCurrentMapPageHandler(storer StatusReader, now func() time.Time) func(http.ResponseWriter, *http.Request) {
+func newCurrentMapPageHandler(storer StatusReader, tags *registry.Registry, now func() time.Time) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		debugLogger.Println("Got a current map page request.")
 		lastWasHealthCheck = false
@@ -90,18 +167,26 @@ func newCurrentMapPageHandler(storer StatusReader, now func() time.Time) func(ht
 			return
 		}
 
-		subs := make(map[string]string)
+		var mapTags []currentMapTag
+
+		for _, tag := range tags.Active() {
+			status, ok := tagStatuses[int32(tag.SerNo)] //nolint:gosec // serial numbers fit
+			if !ok {
+				continue
+			}
 
-		for serNo, status := range tagStatuses {
-			name := model.SerNoToName[int(serNo)]
-			subs[name+"Lat"] = fmt.Sprintf("%.7f", status.Latitude)
-			subs[name+"Lng"] = fmt.Sprintf("%.7f", status.Longitude)
-			subs[name+"AccuracyRadius"] = fmt.Sprintf("%v", status.PosAcc)
-			subs[name+"Note"] = "Last GPS: " + timeAgoAsText(status.GpsUTC, now) + " ago<br>Last Checkin: " + timeAgoAsText(status.DateUTC, now) + " ago<br>Reason: " + status.Reason.String() + "<br>Battery: " + fmt.Sprintf("%.2f", float64(status.Battery)/1000.) + "V"
-			subs[name+"Colour"] = timeAgoInColour(status.GpsUTC, now)
+			mapTags = append(mapTags, currentMapTag{
+				Name:           tag.Name,
+				Icon:           tag.Icon,
+				Colour:         timeAgoInColour(status.GpsUTC, now),
+				Lat:            fmt.Sprintf("%.7f", status.Latitude),
+				Lng:            fmt.Sprintf("%.7f", status.Longitude),
+				AccuracyRadius: fmt.Sprintf("%v", status.PosAcc),
+				Note:           "Last GPS: " + timeAgoAsText(status.GpsUTC, now) + " ago<br>Last Checkin: " + timeAgoAsText(status.DateUTC, now) + " ago<br>Reason: " + status.Reason.String() + "<br>Battery: " + fmt.Sprintf("%.2f", float64(status.Battery)/1000.) + "V",
+			})
 		}
 
-		mapPage, err := substitute.ContentsOf("public_html/current-map.html", subs)
+		mapPage, err := substitute.ContentsOf("public_html/current-map.html", mapTags)
 		if err != nil {
 			errorLogger.Printf("Error getting contents of current-map.html: %v\n", err)
 			w.WriteHeader(http.StatusInternalServerError)
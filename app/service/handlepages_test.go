@@ -10,6 +10,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/bitwombat/gps-tags/model"
 	"github.com/bitwombat/gps-tags/storage"
 	"github.com/stretchr/testify/require"
 )
@@ -77,7 +78,7 @@ func TestCurrentMapPageHandler(t *testing.T) {
 		return t
 	}
 
-	handler := newCurrentMapPageHandler(storer, now)
+	handler := newCurrentMapPageHandler(storer, newFakeRegistry(), now)
 	req := httptest.NewRequest(http.MethodGet, "http://example.com/foo", http.NoBody)
 	w := httptest.NewRecorder()
 	handler(w, req)
@@ -106,27 +107,36 @@ func TestPathsMapPageHandler(t *testing.T) {
 	err = os.Chdir("..")
 	require.Nil(t, err, "changing directory to where public_html is")
 
+	// GIVEN tracks, oldest first as they come out of storage
+	var gotFrom, gotTo time.Time
 	storer := &FakeStorer{
-		fnGetLastNCoords: func(_ context.Context, _ int) (storage.Coords, error) {
-			return storage.Coords{
+		fnGetTrack: func(_ context.Context, serNo int, from, to time.Time, _ storage.FixQuality) ([]storage.TrackPoint, error) {
+			gotFrom, gotTo = from, to
+			return map[int][]storage.TrackPoint{
 				810095: {
-					{Latitude: 5.0, Longitude: 7.0},
-					{Latitude: 5.1, Longitude: 7.1},
 					{Latitude: 5.2, Longitude: 7.2},
+					{Latitude: 5.1, Longitude: 7.1},
+					{Latitude: 5.0, Longitude: 7.0},
 				},
 				810243: {
-					{Latitude: 15.0, Longitude: 17.0},
 					{Latitude: 15.1, Longitude: 17.1},
+					{Latitude: 15.0, Longitude: 17.0},
 				},
-			}, nil
+			}[serNo], nil
 		},
 	}
+	now := func() time.Time { return mkTime("2025-09-01 12:00:00") }
 
-	handler := newPathsMapPageHandler(storer)
+	// WHEN the page is asked for without a time range
+	handler := newPathsMapPageHandler(storer, newFakeRegistry(), now, time.UTC)
 	req := httptest.NewRequest(http.MethodGet, "http://example.com/foo", http.NoBody)
 	w := httptest.NewRecorder()
 	handler(w, req)
 
+	// THEN it's the last day's paths.
+	require.Equal(t, mkTime("2025-08-31 12:00:00"), gotFrom)
+	require.Equal(t, mkTime("2025-09-01 12:00:00"), gotTo)
+
 	resp := w.Result()
 	require.Equal(t, 200, resp.StatusCode, "HTTP status")
 	body, err := io.ReadAll(resp.Body)
@@ -137,6 +147,96 @@ func TestPathsMapPageHandler(t *testing.T) {
 	require.Contains(t, string(body), "Rueger")
 
 	assertGolden(t, "paths_page", string(body))
+
+	// WHEN just one tag is asked for
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/foo?tag=charlie&from=2025-08-01&to=2025-08-02", http.NoBody)
+	w = httptest.NewRecorder()
+	handler(w, req)
+
+	// THEN it's only that tag's path, in that range.
+	body, err = io.ReadAll(w.Result().Body)
+	require.Nil(t, err)
+	require.Contains(t, string(body), "Charlie")
+	require.NotContains(t, string(body), "Rueger")
+	require.Equal(t, mkTime("2025-08-01 00:00:00"), gotFrom)
+	require.Equal(t, mkTime("2025-08-03 00:00:00"), gotTo, "to the end of the to date")
+
+	// WHEN the range is backwards
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/foo?from=2025-08-02&to=2025-08-01", http.NoBody)
+	w = httptest.NewRecorder()
+	handler(w, req)
+
+	// THEN it's refused.
+	require.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+}
+
+func TestPathsMapPageHandlerMarksTagsWithoutPaths(t *testing.T) {
+	origDir, err := os.Getwd()
+	require.Nil(t, err, "getting current directory")
+	defer func() {
+		err := os.Chdir(origDir)
+		require.Nil(t, err, "restoring original directory")
+	}()
+
+	err = os.Chdir("..")
+	require.Nil(t, err, "changing directory to where public_html is")
+
+	// GIVEN no fixes in the range, Rueger last seen a while ago, and Charlie
+	// never heard from
+	storer := &FakeStorer{
+		fnGetTrack: func(_ context.Context, _ int, _, _ time.Time, _ storage.FixQuality) ([]storage.TrackPoint, error) {
+			return nil, nil
+		},
+		fnGetStatus: func(_ context.Context, serNo int) (storage.Status, error) {
+			if serNo != 810095 {
+				return storage.Status{}, storage.ErrNotFound
+			}
+			return storage.Status{Latitude: 5.5, Longitude: 7.5}, nil
+		},
+	}
+
+	// WHEN the paths page is drawn
+	handler := newPathsMapPageHandler(storer, newFakeRegistry(), time.Now, time.UTC)
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "http://example.com/foo", http.NoBody))
+
+	// THEN Rueger is marked where it was last, without a path, and Charlie
+	// isn't on the map.
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `makePath(map, "Rueger", "R", "purple", [], 5.5000000, 7.5000000)`)
+	require.NotContains(t, w.Body.String(), "Charlie")
+}
+
+func TestPathsMapPageHandlerEscapesNames(t *testing.T) {
+	origDir, err := os.Getwd()
+	require.Nil(t, err, "getting current directory")
+	defer func() {
+		err := os.Chdir(origDir)
+		require.Nil(t, err, "restoring original directory")
+	}()
+
+	err = os.Chdir("..")
+	require.Nil(t, err, "changing directory to where public_html is")
+
+	// GIVEN a tag whose name would break out of a JavaScript string
+	tags := newFakeRegistry()
+	err = tags.Update(context.Background(), model.Tag{SerNo: 810095, Name: `Rue"ger</script>`, Colour: "purple", Icon: `"`, Active: true})
+	require.Nil(t, err)
+
+	storer := &FakeStorer{
+		fnGetTrack: func(_ context.Context, _ int, _, _ time.Time, _ storage.FixQuality) ([]storage.TrackPoint, error) {
+			return []storage.TrackPoint{{Latitude: 5.0, Longitude: 7.0}}, nil
+		},
+	}
+
+	// WHEN the paths page is drawn
+	handler := newPathsMapPageHandler(storer, tags, time.Now, time.UTC)
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "http://example.com/foo", http.NoBody))
+
+	// THEN the name and icon stay inside their strings.
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `makePath(map, "Rue\"ger\u003C/script\u003E", "\"", "purple"`)
 }
 
 func assertGolden(tb testing.TB, fileBasename, got string) {
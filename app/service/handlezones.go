@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+
+	zonespkg "github.com/bitwombat/gps-tags/zones"
+)
+
+// newZonesHandler serves the zones get picks from the current zone set, as a
+// GeoJSON FeatureCollection for the map pages to draw.
+func newZonesHandler(holder *zoneHolder, get func(zoneSet) []zonespkg.Zone) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		debugLogger.Println("Got a zones request.")
+		lastWasHealthCheck = false
+
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		blob, err := zonespkg.MarshalGeoJSON(get(holder.Get()))
+		if err != nil {
+			errorLogger.Printf("Error marshalling zones: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/geo+json")
+		_, err = w.Write(blob)
+		if err != nil {
+			errorLogger.Printf("Error writing zones response: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	zonespkg "github.com/bitwombat/gps-tags/zones"
+	"github.com/stretchr/testify/require"
+)
+
+func getNamed(s zoneSet) []zonespkg.Zone { return s.named }
+
+func TestZonesHandler(t *testing.T) {
+	// GIVEN a loaded zone
+	zones := []zonespkg.Zone{{Name: "Square", Polygons: testSquare}}
+	handler := newZonesHandler(newStaticZoneHolder(zoneSet{named: zones}), getNamed)
+
+	// WHEN it's asked for
+	req := httptest.NewRequest(http.MethodGet, "/zones/named", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	// THEN it comes back as GeoJSON that reads back as the same zone.
+	resp := w.Result()
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/geo+json", resp.Header.Get("Content-Type"))
+
+	body, err := io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	got, err := zonespkg.UnmarshalGeoJSON(body)
+	require.Nil(t, err)
+	require.Equal(t, zones, got)
+}
+
+func TestZonesHandlerNoZones(t *testing.T) {
+	handler := newZonesHandler(newStaticZoneHolder(zoneSet{}), getNamed)
+
+	req := httptest.NewRequest(http.MethodGet, "/zones/named", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"type": "FeatureCollection", "features": []}`, w.Body.String())
+}
+
+func TestZonesHandlerMethodNotAllowed(t *testing.T) {
+	handler := newZonesHandler(newStaticZoneHolder(zoneSet{}), getNamed)
+
+	req := httptest.NewRequest(http.MethodPost, "/zones/named", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	require.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
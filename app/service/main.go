@@ -1,26 +1,28 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"slices"
 	"strings"
+	"syscall"
 	"time"
+	_ "time/tzdata" // The quiet hours and digest time zones, on images without zoneinfo (ie. alpine)
 
+	"github.com/bitwombat/gps-tags/config"
 	"github.com/bitwombat/gps-tags/notify"
 	oshotpkg "github.com/bitwombat/gps-tags/oneshot"
+	"github.com/bitwombat/gps-tags/registry"
 	"github.com/bitwombat/gps-tags/storage"
 	zonespkg "github.com/bitwombat/gps-tags/zones"
 	"golang.org/x/sync/errgroup"
 )
 
-const (
-	BatteryLowThreshold      = 4.0
-	BatteryCriticalThreshold = 3.8
-	BatteryHysteresis        = 0.1
-)
-
 // systemd recognises these prefixes and colors accordingly. Also allows filtering priorities with journalctl.
 var (
 	fatalLog = func(errcode int, msg string) int {
@@ -34,19 +36,14 @@ var (
 	debugLogger   = log.New(os.Stdout, "<7>", log.LstdFlags)
 )
 
-func hostnameBasedFileServer() http.Handler {
+func hostnameBasedFileServer(cfg config.Server) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Determine the directory to serve files from based on the hostname in
 		// the request.
 		host := strings.ToLower(r.Host)
-		var dir string
-		switch host {
-		case "tags.bitwombat.com.au":
-			dir = "./public_html"
-		case "photos.bitwombat.com.au":
-			dir = "./public_html.photos"
-		default:
-			dir = "./public_html"
+		dir, ok := cfg.StaticDirs[host]
+		if !ok {
+			dir = cfg.DefaultStaticDir
 		}
 
 		// Create a new file server for that directory
@@ -56,72 +53,325 @@ func hostnameBasedFileServer() http.Handler {
 	})
 }
 
+func smtpConfig(e config.Email, to []string) notify.SMTPConfig {
+	return notify.SMTPConfig{
+		Host:       e.Host,
+		Port:       e.Port,
+		Security:   e.Security,
+		Username:   e.Username,
+		Password:   e.Password,
+		From:       e.From,
+		To:         to,
+		CurrentURL: e.CurrentURL,
+	}
+}
+
+// newChannels sets up ntfy, the webhooks and email as channels. What each
+// fails to take goes on the queue to be retried, and each holds back what
+// comes in its quiet hours - retries included, as quiet hours are inside the
+// queue.
+func newChannels(cfg config.Config, queue *notify.Queue, quiet *notify.QuietHours) ([]notify.Channel, error) {
+	channels := []notify.Channel{
+		{Name: "ntfy", Notifier: notify.NewNtfyNotifier(cfg.Ntfy.URLBase, cfg.Ntfy.SubscriptionID, cfg.Ntfy.ClickURL)},
+	}
+
+	for _, wh := range cfg.Webhooks {
+		n, err := notify.NewWebhookNotifier(notify.WebhookConfig{
+			URL:         wh.URL,
+			ContentType: wh.ContentType,
+			Template:    wh.Template,
+			Headers:     wh.Headers,
+			Secret:      wh.Secret,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("setting up webhook %s: %w", wh.Name, err)
+		}
+		channels = append(channels, notify.Channel{Name: wh.Name, Notifier: n})
+	}
+
+	if cfg.Email.Host != "" {
+		channels = append(channels, notify.Channel{Name: "email", Notifier: notify.NewSMTPNotifier(smtpConfig(cfg.Email, cfg.Email.To), warningLogger)})
+	}
+
+	for i, ch := range channels {
+		channels[i].Notifier = queue.Channel(ch.Name, quiet.Channel(ch.Name, ch.Notifier))
+	}
+
+	return channels, nil
+}
+
+// newEscalationNotifier sends to the channels alerts are escalated to, and
+// emails the people they are. It's nil if there aren't any.
+func newEscalationNotifier(cfg config.Config, channels []notify.Channel, queue *notify.Queue, quiet *notify.QuietHours) (notify.Notifier, error) {
+	var escalation []notify.Channel
+	for _, ch := range channels {
+		if slices.Contains(cfg.Alerts.EscalateTo, ch.Name) {
+			escalation = append(escalation, ch)
+		}
+	}
+
+	if to := cfg.Alerts.EscalateEmailTo; len(to) > 0 {
+		const name = "escalation email"
+		escalation = append(escalation, notify.Channel{
+			Name:     name,
+			Notifier: queue.Channel(name, quiet.Channel(name, notify.NewSMTPNotifier(smtpConfig(cfg.Email, to), warningLogger))),
+		})
+	}
+
+	if len(escalation) == 0 {
+		return nil, nil
+	}
+
+	return notify.NewMultiNotifier(escalation, nil)
+}
+
 func main() {
-	os.Exit(run())
+	os.Exit(run(os.Args[1:]))
 }
 
-// Start the service - connect to Mongo, set up notification, set up endpoints,
-// and start the HTTP servers.
-func run() int {
+// Start the service - read config, connect to the database, set up
+// notification, set up endpoints, and start the HTTP servers.
+func run(args []string) int {
+	flags := flag.NewFlagSet("gps-tags", flag.ContinueOnError)
+	configPath := flags.String("config", "config.yaml", "path to the config file")
+	checkConfig := flags.Bool("check-config", false, "check the config file, report any errors, and exit")
+	err := flags.Parse(args)
+	if err != nil {
+		return 1
+	}
+
+	cfg, err := config.Load(*configPath)
+	if *checkConfig {
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		_, err = loadZoneSet(cfg.Zones)
+		if err != nil {
+			fmt.Printf("loading zones: %v\n", err)
+			return 1
+		}
+		fmt.Println("Config OK")
+		return 0
+	}
+	if err != nil {
+		return fatalLog(1, fmt.Sprintf("loading config: %v", err))
+	}
+
 	infoLogger.Println("Starting Dog Tag service.")
 
-	storer, err := storage.NewSQLiteStorer("dogtags.db")
+	storer, err := storage.NewSQLiteStorer(cfg.Database.Path)
 	if err != nil {
 		return fatalLog(1, fmt.Sprintf("getting an sqlite storer: %v", err))
 	}
 
-	ntfySubscriptionID := os.Getenv("NTFY_SUBSCRIPTION_ID")
-	if ntfySubscriptionID == "" {
+	err = storer.Migrate(context.Background())
+	if err != nil {
+		return fatalLog(1, fmt.Sprintf("migrating the database: %v", err))
+	}
+
+	tags := registry.New(storer)
+	err = tags.Load(context.Background())
+	if err != nil {
+		return fatalLog(1, fmt.Sprintf("loading the tag registry: %v", err))
+	}
+
+	oneShot, err := oshotpkg.NewPersistentOneShot(context.Background(), storer, time.Now)
+	if err != nil {
+		return fatalLog(1, fmt.Sprintf("loading one-shot state: %v", err))
+	}
+
+	if cfg.Ntfy.SubscriptionID == "" && !cfg.Ntfy.Disabled {
 		warningLogger.Print("WARNING: NTFY_SUBSCRIPTION_ID not set. Notifications will not be sent.")
 	}
 
+	// Notifications that fail are retried from here
+	queue := notify.NewQueue(storer, notify.Backoff{
+		Initial:     cfg.Retry.InitialDelay,
+		Max:         cfg.Retry.MaxDelay,
+		MaxAttempts: cfg.Retry.MaxAttempts,
+	}, time.Now, warningLogger)
+
+	// Notifications in quiet hours are held back to here
+	quiet := notify.NewQuietHours(cfg.QuietSchedule(), storer, time.Now, infoLogger)
+
 	// Set up endpoints
 	httpsMux := http.NewServeMux()
 
-	tagAuthKey := os.Getenv("TAG_AUTH_KEY")
-	if tagAuthKey == "" {
-		return fatalLog(1, "TAG_AUTH_KEY not set")
-	}
-
 	// Current location map page
-	httpsMux.HandleFunc("/current", newCurrentMapPageHandler(storer, time.Now))
+	httpsMux.HandleFunc("/current", newCurrentMapPageHandler(storer, tags, time.Now))
 
 	// Paths travelled page
-	httpsMux.HandleFunc("/paths", newPathsMapPageHandler(storer))
+	httpsMux.HandleFunc("/paths", newPathsMapPageHandler(storer, tags, time.Now, cfg.QuietSchedule().Location))
+
+	// Zone history page
+	httpsMux.HandleFunc("/history", newHistoryPageHandler(storer, tags, time.Now, cfg.QuietSchedule().Location))
 
-	var notifier notify.Notifier
-	if os.Getenv("NONOTIFY") != "" {
-		warningLogger.Print("WARNING: NONOTIFY env var set. Null notifier being used. No notifications will be sent.")
+	// Tag registry and notification state administration
+	adminAuthKey := cfg.Auth.AdminKey
+	if adminAuthKey == "" {
+		warningLogger.Print("WARNING: ADMIN_AUTH_KEY not set. Admin endpoints are disabled.")
+	} else {
+		httpsMux.HandleFunc("/admin/tags", newAdminTagsHandler(tags, adminAuthKey))
+		httpsMux.HandleFunc("/admin/tags/{serNo}", newAdminTagHandler(tags, adminAuthKey))
+		httpsMux.HandleFunc("/admin/pending-tags", newAdminPendingTagsHandler(tags, adminAuthKey))
+		httpsMux.HandleFunc("/admin/pending-tags/{serNo}", newAdminPromoteTagHandler(tags, adminAuthKey, cfg.QuietSchedule().Location))
+		httpsMux.HandleFunc("/admin/pending", newAdminPendingTagsPageHandler(tags, adminAuthKey, cfg.QuietSchedule().Location))
+		httpsMux.HandleFunc("/admin/oneshots", newAdminOneShotsHandler(oneShot, adminAuthKey))
+		httpsMux.HandleFunc("/admin/notifications", newAdminNotificationsHandler(queue, adminAuthKey))
+		httpsMux.HandleFunc("/admin/alerts", newAdminAlertsHandler(storer, adminAuthKey, time.Now, cfg.QuietSchedule().Location))
+	}
+
+	var notifier, digestReport notify.Notifier
+	if cfg.Ntfy.Disabled {
+		warningLogger.Print("WARNING: ntfy disabled (NONOTIFY env var set?). Null notifier being used. No notifications will be sent.")
 		notifier = notify.NewNullNotifier()
 	} else {
-		notifier = notify.NewNtfyNotifier(ntfySubscriptionID)
+		channels, err := newChannels(cfg, queue, quiet)
+		if err != nil {
+			return fatalLog(1, fmt.Sprintf("setting up notifications: %v", err))
+		}
+		notifier, err = notify.NewMultiNotifier(channels, cfg.NotifyRules())
+		if err != nil {
+			return fatalLog(1, fmt.Sprintf("setting up notification routes: %v", err))
+		}
+		go queue.Run(context.Background(), 30*time.Second, cfg.Retry.KeepFor)
+		go quiet.Run(context.Background(), time.Minute)
+
+		// Alerts that need acknowledging, and the page to do it on
+		if a := cfg.Alerts; len(a.Events) > 0 {
+			escalation, err := newEscalationNotifier(cfg, channels, queue, quiet)
+			if err != nil {
+				return fatalLog(1, fmt.Sprintf("setting up alert escalation: %v", err))
+			}
+			alerts := notify.NewAlerts(notify.AlertsConfig{
+				Events:        a.Events,
+				AckURL:        a.AckURL,
+				Backoff:       notify.Backoff{Initial: a.FirstReminder, Max: a.MaxReminderInterval},
+				EscalateAfter: a.EscalateAfter,
+				Escalation:    escalation,
+			}, storer, notifier, time.Now, infoLogger)
+			notifier = alerts
+			go alerts.Run(context.Background(), time.Minute)
+
+			httpsMux.HandleFunc("/ack/{token}", newAckHandler(alerts, cfg.QuietSchedule().Location))
+		}
+
+		if to := cfg.Digest.EmailTo; len(to) > 0 {
+			const name = "digest email"
+			digestReport = queue.Channel(name, notify.NewSMTPNotifier(smtpConfig(cfg.Email, to), warningLogger))
+		}
 	}
 	loggingNotifier := notify.NewLoggingNotifier(notifier, debugLogger)
 
-	oneShot := oshotpkg.NewOneShot()
-
-	namedZones, err := zonespkg.ReadKMLDir("named_zones")
+	// A bad zone file shouldn't stop uploads being stored, or the other
+	// notifications. It's fixed with a reload.
+	zones, err := newZoneHolder(cfg.Zones)
 	if err != nil {
-		errorLogger.Printf("Error reading KML files: %v", err)
-		// not a critical error, keep going
+		errorLogger.Printf("ERROR: loading zones, carrying on with the ones that loaded. Fix them and reload: %v", err)
+	}
+	if len(zones.Get().boundaries) == 0 {
+		warningLogger.Printf("WARNING: No alert boundaries in %s. No zone notifications will be sent.", cfg.Zones.BoundaryZonesDir)
+	}
+
+	// Time spent in each named zone, worked out from the stored fixes. The
+	// first update fills in history from before it was being kept.
+	history := &zoneHistory{storer: storer, zones: zones, tags: tags}
+	go history.keepUpdated(context.Background(), time.Minute)
+
+	// Reload zones on SIGHUP (systemctl reload). Zone history is worked out
+	// again with the new zones.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go zones.reloadOn(hup, func() {
+		err := history.Rebuild(context.Background())
+		if err != nil {
+			errorLogger.Printf("Error rebuilding zone history: %v", err)
+		}
+	})
+
+	// Re-read the tags on SIGHUP too, to pick up changes made with cmd/tags.
+	tagsHup := make(chan os.Signal, 1)
+	signal.Notify(tagsHup, syscall.SIGHUP)
+	go func() {
+		for range tagsHup {
+			err := tags.Load(context.Background())
+			if err != nil {
+				errorLogger.Printf("Error reloading tags, keeping the previous ones: %v", err)
+				continue
+			}
+			infoLogger.Printf("Reloaded %d tags.", len(tags.All()))
+		}
+	}()
+
+	// Zones as GeoJSON, for the map pages
+	httpsMux.HandleFunc("/zones/named", newZonesHandler(zones, func(s zoneSet) []zonespkg.Zone { return s.named }))
+	httpsMux.HandleFunc("/zones/boundaries", newZonesHandler(zones, func(s zoneSet) []zonespkg.Zone { return s.boundaryZones }))
+
+	// Daily or weekly digests of what each dog got up to
+	if cfg.Digest.Period != "" {
+		day, at, loc := cfg.DigestTimes()
+		digests := digester{
+			storer:   storer,
+			tags:     tags,
+			zones:    zones,
+			notifier: loggingNotifier,
+			report:   digestReport,
+			weekly:   cfg.Digest.Period == "weekly",
+			day:      day,
+			at:       at,
+			loc:      loc,
+			critical: cfg.Battery.CriticalThreshold,
+			now:      time.Now,
+		}
+		go digests.run(context.Background())
 	}
 
-	txLogger := txLogger{namedZones}
+	// Read-only JSON API, for scripts and apps. Like the map pages, it's open.
+	httpsMux.HandleFunc("/api/v1/tags", newAPITagsHandler(tags))
+	httpsMux.HandleFunc("/api/v1/tags/{serNo}/status", newAPIStatusHandler(storer, tags, zones))
+	httpsMux.HandleFunc("/api/v1/tags/{serNo}/track", newAPITrackHandler(storer, tags, time.Now, cfg.QuietSchedule().Location))
+	httpsMux.HandleFunc("/api/v1/tags/{serNo}/battery", newAPIBatteryHandler(storer, tags, time.Now, cfg.QuietSchedule().Location))
+
+	// Tracks to download, for Google Earth, OsmAnd and the like
+	httpsMux.HandleFunc("/api/v1/tags/{serNo}/track.gpx", newTrackExportHandler(storer, tags, time.Now, cfg.QuietSchedule().Location, gpxFormat))
+	httpsMux.HandleFunc("/api/v1/tags/{serNo}/track.kml", newTrackExportHandler(storer, tags, time.Now, cfg.QuietSchedule().Location, kmlFormat))
+	httpsMux.HandleFunc("/api/v1/tags/{serNo}/track.geojson", newTrackExportHandler(storer, tags, time.Now, cfg.QuietSchedule().Location, geoJSONFormat))
+
+	txLogger := txLogger{zones: zones, tags: tags}
 
 	batteryNotifier := batteryNotifier{
-		namedZones: namedZones,
+		zones:      zones,
 		oneShot:    oneShot,
 		notifier:   loggingNotifier,
+		tags:       tags,
+		thresholds: cfg.Battery,
 	}
 
 	zoneNotifier := zoneNotifier{
-		namedZones: namedZones,
-		oneShot:    oneShot,
-		notifier:   loggingNotifier,
+		zones:    zones,
+		oneShot:  oneShot,
+		notifier: loggingNotifier,
+		tags:     tags,
+	}
+
+	// Notifications about tags that stop checking in, or lose their fix
+	if wd := cfg.Watchdog; wd.SilentAfter > 0 || wd.StaleFixAfter > 0 {
+		tagWatchdog := watchdog{
+			storer:        storer,
+			zones:         zones,
+			oneShot:       oneShot,
+			notifier:      loggingNotifier,
+			tags:          tags,
+			silentAfter:   wd.SilentAfter,
+			staleFixAfter: wd.StaleFixAfter,
+			now:           time.Now,
+		}
+		go tagWatchdog.run(context.Background(), time.Minute)
 	}
 
 	// Data upload endpoint
-	dataPostHandler := newDataPostHandler(storer, txLogger, batteryNotifier, zoneNotifier, tagAuthKey, time.Now)
+	dataPostHandler := newDataPostHandler(storer, tags, txLogger, batteryNotifier, zoneNotifier, cfg.Auth.TagKey, time.Now)
 	httpsMux.HandleFunc("/upload", dataPostHandler)
 
 	// Notification testing endpoint and aliases
@@ -135,7 +385,7 @@ func run() int {
 	httpMux.HandleFunc("/health", handleHealthCheck)
 
 	// Static file serving
-	httpsMux.Handle("/", hostnameBasedFileServer())
+	httpsMux.Handle("/", hostnameBasedFileServer(cfg.Server))
 
 	// Start servers
 	infoLogger.Println("Starting servers.")
@@ -144,22 +394,22 @@ func run() int {
 
 	g.Go(func() error {
 		server1 := &http.Server{
-			Addr:              ":80",
+			Addr:              cfg.Server.HTTPAddr,
 			Handler:           httpMux,
 			ReadHeaderTimeout: 10 * time.Second,
 		}
-		infoLogger.Println("Server running on :80")
+		infoLogger.Println("Server running on " + cfg.Server.HTTPAddr)
 
 		return server1.ListenAndServe()
 	})
 
 	g.Go(func() error {
 		server2 := &http.Server{
-			Addr:              ":443",
+			Addr:              cfg.Server.HTTPSAddr,
 			Handler:           httpsMux,
 			ReadHeaderTimeout: 10 * time.Second,
 		}
-		infoLogger.Println("Server running on :443")
+		infoLogger.Println("Server running on " + cfg.Server.HTTPSAddr)
 		return server2.ListenAndServe()
 	})
 
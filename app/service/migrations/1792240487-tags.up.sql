@@ -0,0 +1,14 @@
+CREATE TABLE tags (
+    SerNo INTEGER PRIMARY KEY NOT NULL,
+    Name TEXT NOT NULL,
+    Colour TEXT NOT NULL,
+    Icon TEXT NOT NULL,
+    Imei TEXT NOT NULL,
+    Iccid TEXT NOT NULL,
+    Active INTEGER NOT NULL
+) STRICT;
+
+-- The tags that used to be hard-coded.
+INSERT INTO tags (SerNo, Name, Colour, Icon, Imei, Iccid, Active) VALUES
+    (810095, 'Rueger', 'purple', 'R', '', '', 1),
+    (810243, 'Charlie', 'blue', 'C', '', '', 1);
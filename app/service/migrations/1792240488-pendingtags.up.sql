@@ -0,0 +1,9 @@
+CREATE TABLE pendingTags (
+    SerNo INTEGER PRIMARY KEY NOT NULL,
+    Imei TEXT NOT NULL,
+    Iccid TEXT NOT NULL,
+    Fw TEXT NOT NULL,
+    FirstSeen TEXT NOT NULL,
+    LastSeen TEXT NOT NULL,
+    Uploads INTEGER NOT NULL
+) STRICT;
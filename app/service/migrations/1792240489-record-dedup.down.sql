@@ -0,0 +1 @@
+DROP INDEX rec_seq_idx;
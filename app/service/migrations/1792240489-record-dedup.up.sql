@@ -0,0 +1,2 @@
+-- For finding records a device has uploaded before.
+CREATE INDEX rec_seq_idx ON record (SeqNo, DeviceUTC);
@@ -0,0 +1,6 @@
+CREATE TABLE oneShotState (
+    Event TEXT PRIMARY KEY NOT NULL,
+    IsSet INTEGER NOT NULL,
+    LastSet TEXT NOT NULL,
+    LastReset TEXT NOT NULL
+) STRICT;
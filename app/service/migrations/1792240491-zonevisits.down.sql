@@ -0,0 +1,2 @@
+DROP INDEX zoneVisitSerNoEntered;
+DROP TABLE zoneVisit;
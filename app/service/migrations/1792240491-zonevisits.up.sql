@@ -0,0 +1,10 @@
+CREATE TABLE zoneVisit (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+    SerNo INTEGER NOT NULL,
+    Zone TEXT NOT NULL, -- '' if not in any named zone
+    Entered TEXT NOT NULL,
+    LastSeen TEXT NOT NULL,
+    Exited TEXT -- NULL while still there
+) STRICT;
+
+CREATE INDEX zoneVisitSerNoEntered ON zoneVisit (SerNo, Entered);
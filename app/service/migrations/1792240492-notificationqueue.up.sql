@@ -0,0 +1,10 @@
+CREATE TABLE notificationQueue (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+    Channel TEXT NOT NULL,
+    Event TEXT NOT NULL, -- JSON
+    Status TEXT NOT NULL, -- 'pending' or 'failed'
+    Attempts INTEGER NOT NULL,
+    LastError TEXT NOT NULL,
+    Queued TEXT NOT NULL,
+    NextAttempt TEXT NOT NULL
+) STRICT;
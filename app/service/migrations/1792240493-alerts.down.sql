@@ -0,0 +1,4 @@
+DROP INDEX alertAuditAlertID;
+DROP TABLE alertAudit;
+DROP INDEX alertRaised;
+DROP TABLE alert;
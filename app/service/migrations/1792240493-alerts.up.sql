@@ -0,0 +1,23 @@
+CREATE TABLE alert (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+    Token TEXT NOT NULL UNIQUE,
+    Event TEXT NOT NULL, -- JSON
+    Raised TEXT NOT NULL,
+    Reminders INTEGER NOT NULL,
+    NextReminder TEXT NOT NULL,
+    Escalated INTEGER NOT NULL,
+    Closed TEXT -- NULL while open
+) STRICT;
+
+CREATE INDEX alertRaised ON alert (Raised);
+
+CREATE TABLE alertAudit (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+    AlertID INTEGER NOT NULL REFERENCES alert (ID),
+    Time TEXT NOT NULL,
+    Action TEXT NOT NULL,
+    By TEXT NOT NULL,
+    Detail TEXT NOT NULL
+) STRICT;
+
+CREATE INDEX alertAuditAlertID ON alertAudit (AlertID);
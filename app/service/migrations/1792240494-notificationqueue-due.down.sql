@@ -0,0 +1 @@
+DROP INDEX notificationQueueStatusNextAttempt;
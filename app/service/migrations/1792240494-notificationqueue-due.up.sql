@@ -0,0 +1 @@
+CREATE INDEX notificationQueueStatusNextAttempt ON notificationQueue (Status, NextAttempt);
@@ -0,0 +1,16 @@
+WITH kinds (Old, New, HasZone) AS (VALUES
+    ('outside ', 'outside/', 1),
+    ('approaching ', 'approaching/', 1),
+    ('lowBattery', 'lowBattery', 0),
+    ('criticalBattery', 'criticalBattery', 0),
+    ('silent', 'silent', 0),
+    ('staleFix', 'staleFix', 0)
+)
+UPDATE OR IGNORE oneShotState SET Event = (
+    SELECT upper(t.Name) || k.Old || substr(oneShotState.Event, length(t.SerNo || '/' || k.New) + 1)
+    FROM tags t, kinds k
+    WHERE substr(oneShotState.Event, 1, length(t.SerNo || '/' || k.New)) = t.SerNo || '/' || k.New
+        AND (k.HasZone OR oneShotState.Event = t.SerNo || '/' || k.New)
+);
+
+DELETE FROM oneShotState WHERE Event GLOB '[0-9]*/*';
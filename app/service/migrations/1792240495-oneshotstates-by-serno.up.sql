@@ -0,0 +1,21 @@
+-- One-shot events were kept under the tag's name, shouted, so renaming a tag
+-- lost where its events were at. Move them to its serial number, and drop any
+-- left over from tags renamed before now - nothing will look at them again.
+WITH kinds (Old, New, HasZone) AS (VALUES
+    ('outside ', 'outside/', 1),
+    ('approaching ', 'approaching/', 1),
+    ('lowBattery', 'lowBattery', 0),
+    ('criticalBattery', 'criticalBattery', 0),
+    ('silent', 'silent', 0),
+    ('staleFix', 'staleFix', 0)
+)
+UPDATE OR IGNORE oneShotState SET Event = (
+    SELECT t.SerNo || '/' || k.New || substr(oneShotState.Event, length(upper(t.Name) || k.Old) + 1)
+    FROM tags t, kinds k
+    WHERE substr(oneShotState.Event, 1, length(upper(t.Name) || k.Old)) = upper(t.Name) || k.Old
+        AND (k.HasZone OR oneShotState.Event = upper(t.Name) || k.Old)
+    ORDER BY length(t.Name) DESC
+    LIMIT 1
+);
+
+DELETE FROM oneShotState WHERE Event NOT GLOB '[0-9]*/*';
@@ -0,0 +1,8 @@
+// Package migrations holds the database schema migrations. They are embedded
+// so the service can bring its database up to date when it starts.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
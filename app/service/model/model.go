@@ -1,6 +1,6 @@
 package model
 
-import "strings"
+import "time"
 
 // This is a copy of ../device/yabby3.go, because the device's structure is an
 // OK starting point for our model (and db schema). A model that is nearly a
@@ -36,9 +36,9 @@ type Record struct {
 }
 
 type GPSReading struct {
-	Spd     int
-	SpdAcc  int
-	Head    int
+	Spd     int // km/h
+	SpdAcc  int // km/h
+	Head    int // Degrees clockwise from north
 	GpsStat int
 	GpsUTC  Time
 	Lat     float64
@@ -66,11 +66,45 @@ type TripTypeReading struct {
 	Trim int
 }
 
-var SerNoToName = map[int]string{
-	810095: "rueger",
-	810243: "charlie",
+// Tag is a tracking device we know about, and the dog wearing it.
+type Tag struct {
+	SerNo  int
+	Name   string
+	Colour string // Used for drawing the tag's path on maps.
+	Icon   string // Glyph shown inside the tag's map marker.
+	IMEI   string
+	ICCID  string
+	Active bool // Retired tags are kept for their history, but not shown on maps.
 }
 
-func UpperSerNoToName(serNo int) string {
-	return strings.ToUpper(SerNoToName[serNo])
+// PendingTag is a tracking device that has uploaded, but that nobody has named
+// yet.
+type PendingTag struct {
+	SerNo     int
+	IMEI      string
+	ICCID     string
+	Fw        string
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Uploads   int
+}
+
+// ZoneVisit is a stretch of time a tag spent in one named zone, worked out
+// from its GPS fixes.
+type ZoneVisit struct {
+	ID       int64
+	SerNo    int
+	Zone     string    // Empty if the tag wasn't in any named zone
+	Entered  time.Time // First fix in the zone
+	LastSeen time.Time // Latest fix in the zone
+	Exited   time.Time // First fix somewhere else. Zero while the tag is still there.
+}
+
+// End is when the visit ended, or the latest fix if it hasn't.
+func (v ZoneVisit) End() time.Time {
+	if v.Exited.IsZero() {
+		return v.LastSeen
+	}
+
+	return v.Exited
 }
@@ -0,0 +1,277 @@
+package notify
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+// What happened to an alert, as recorded in its audit trail.
+const (
+	AlertRaised       = "raised"
+	AlertReminded     = "reminded"
+	AlertEscalated    = "escalated"
+	AlertAcknowledged = "acknowledged"
+	AlertResolved     = "resolved" // The event it was about was undone, e.g. the dog came back
+)
+
+// Alert is an event that someone needs to acknowledge. Until they do, it's
+// sent again at growing intervals, and escalated.
+type Alert struct {
+	ID           int64
+	Token        string // Secret, in the ack URL
+	Event        Event
+	Raised       time.Time
+	Reminders    int // Sent so far
+	NextReminder time.Time
+	Escalated    bool
+	Closed       time.Time // Zero while open
+	Audit        []AlertAudit
+}
+
+// AlertAudit is one thing that happened to an alert.
+type AlertAudit struct {
+	Time   time.Time
+	Action string // AlertRaised, AlertAcknowledged, ...
+	By     string // Who acknowledged, e.g. "ntfy", "email" or a name
+	Detail string
+}
+
+// AlertStore persists alerts and their audit trails.
+type AlertStore interface {
+	AddAlert(context.Context, Alert) (int64, error)
+	UpdateAlert(context.Context, Alert) error
+	GetOpenAlerts(context.Context) ([]Alert, error)
+	GetAlertByToken(context.Context, string) (Alert, error) // With its audit trail
+	AddAlertAudit(ctx context.Context, alertID int64, entry AlertAudit) error
+}
+
+// resolvedBy are the events that undo others. An alert is closed when one of
+// these comes for the same tag (and boundary, for zone events).
+var resolvedBy = map[string][]string{
+	EventEnter:      {EventLeave, EventApproach},
+	EventNewBattery: {EventLowBattery, EventCriticalBattery},
+	EventReporting:  {EventSilent},
+	EventFreshFix:   {EventStaleFix},
+}
+
+// AlertsConfig says which events need acknowledging, and what happens if
+// they aren't.
+type AlertsConfig struct {
+	Events  []string // Kinds of event that need acknowledging
+	AckURL  string   // Base of the ack links. The token is added to it.
+	Backoff Backoff  // Time to the first reminder, and the longest between them
+	// EscalateAfter is how many reminders go unacknowledged before they go
+	// to Escalation as well.
+	EscalateAfter int
+	Escalation    Notifier // nil to never escalate
+}
+
+// Alerts tracks events that need acknowledging, reminding and escalating
+// until they are.
+type Alerts struct {
+	cfg    AlertsConfig
+	store  AlertStore
+	n      Notifier
+	now    func() time.Time
+	logger *log.Logger
+}
+
+// NewAlerts returns Alerts that sends, and reminds, through n.
+func NewAlerts(cfg AlertsConfig, store AlertStore, n Notifier, now func() time.Time, logger *log.Logger) *Alerts {
+	return &Alerts{cfg: cfg, store: store, n: n, now: now, logger: logger}
+}
+
+func (a *Alerts) ackURL(token string) string {
+	return strings.TrimSuffix(a.cfg.AckURL, "/") + "/" + token
+}
+
+// Notify sends the event, first raising an alert for it if it needs
+// acknowledging, and closing any alerts it resolves. Problems keeping track
+// of alerts are logged rather than stopping the notification.
+func (a *Alerts) Notify(ctx context.Context, e Event) error {
+	a.resolve(ctx, e)
+
+	if slices.Contains(a.cfg.Events, e.Kind) {
+		alert, err := a.raise(ctx, e)
+		if err != nil {
+			a.logger.Printf("Error raising alert for %q, sending without an ack link: %v", e.Title, err)
+		} else {
+			e.AckURL = a.ackURL(alert.Token)
+		}
+	}
+
+	return a.n.Notify(ctx, e)
+}
+
+func (a *Alerts) raise(ctx context.Context, e Event) (Alert, error) {
+	token := make([]byte, 16)
+	_, err := rand.Read(token)
+	if err != nil {
+		return Alert{}, fmt.Errorf("making token: %w", err)
+	}
+
+	now := a.now()
+	alert := Alert{
+		Token:        hex.EncodeToString(token),
+		Event:        e,
+		Raised:       now,
+		NextReminder: now.Add(a.cfg.Backoff.delay(1)),
+	}
+	alert.ID, err = a.store.AddAlert(ctx, alert)
+	if err != nil {
+		return Alert{}, fmt.Errorf("storing alert: %w", err)
+	}
+
+	err = a.store.AddAlertAudit(ctx, alert.ID, AlertAudit{Time: now, Action: AlertRaised, Detail: string(e.Title)})
+	if err != nil {
+		return Alert{}, fmt.Errorf("auditing alert %d: %w", alert.ID, err)
+	}
+
+	return alert, nil
+}
+
+// resolve closes the open alerts that e undoes.
+func (a *Alerts) resolve(ctx context.Context, e Event) {
+	kinds, ok := resolvedBy[e.Kind]
+	if !ok {
+		return
+	}
+
+	open, err := a.store.GetOpenAlerts(ctx)
+	if err != nil {
+		a.logger.Printf("Error getting open alerts to resolve: %v", err)
+		return
+	}
+
+	for _, alert := range open {
+		if !slices.Contains(kinds, alert.Event.Kind) || alert.Event.SerNo != e.SerNo || alert.Event.Zone != e.Zone {
+			continue
+		}
+
+		err = a.close(ctx, alert, AlertAudit{Time: a.now(), Action: AlertResolved, Detail: string(e.Title)})
+		if err != nil {
+			a.logger.Printf("Error resolving alert %d: %v", alert.ID, err)
+		}
+	}
+}
+
+func (a *Alerts) close(ctx context.Context, alert Alert, why AlertAudit) error {
+	alert.Closed = why.Time
+	err := a.store.UpdateAlert(ctx, alert)
+	if err != nil {
+		return fmt.Errorf("closing alert: %w", err)
+	}
+
+	err = a.store.AddAlertAudit(ctx, alert.ID, why)
+	if err != nil {
+		return fmt.Errorf("auditing alert %d: %w", alert.ID, err)
+	}
+
+	return nil
+}
+
+// Get returns the alert with the token, audit trail and all.
+func (a *Alerts) Get(ctx context.Context, token string) (Alert, error) {
+	return a.store.GetAlertByToken(ctx, token)
+}
+
+// Acknowledge records that by (from the address from) has seen the alert
+// with the token, closing it if it's open. Everyone who acknowledges is
+// recorded. Returns the alert as it now is, audit trail and all.
+func (a *Alerts) Acknowledge(ctx context.Context, token, by, from string) (Alert, error) {
+	alert, err := a.store.GetAlertByToken(ctx, token)
+	if err != nil {
+		return Alert{}, err
+	}
+
+	entry := AlertAudit{Time: a.now(), Action: AlertAcknowledged, By: by, Detail: "from " + from}
+	if alert.Closed.IsZero() {
+		err = a.close(ctx, alert, entry)
+	} else {
+		err = a.store.AddAlertAudit(ctx, alert.ID, entry)
+	}
+	if err != nil {
+		return Alert{}, err
+	}
+	a.logger.Printf("Alert %q acknowledged by %s from %s", alert.Event.Title, by, from)
+
+	return a.store.GetAlertByToken(ctx, token)
+}
+
+// RemindDue sends reminders for the open alerts that are due one, escalating
+// those that have had enough.
+func (a *Alerts) RemindDue(ctx context.Context) error {
+	open, err := a.store.GetOpenAlerts(ctx)
+	if err != nil {
+		return fmt.Errorf("getting open alerts: %w", err)
+	}
+
+	var errs []error
+	for _, alert := range open {
+		now := a.now()
+		if alert.NextReminder.After(now) {
+			continue
+		}
+
+		alert.Reminders++
+		alert.NextReminder = now.Add(a.cfg.Backoff.delay(alert.Reminders + 1))
+
+		e := alert.Event
+		e.Title = "Not acknowledged: " + e.Title
+		e.AckURL = a.ackURL(alert.Token)
+
+		err = a.n.Notify(ctx, e)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("reminding about alert %d: %w", alert.ID, err))
+		}
+		entry := AlertAudit{Time: now, Action: AlertReminded, Detail: fmt.Sprintf("reminder %d", alert.Reminders)}
+
+		if a.cfg.Escalation != nil && alert.Reminders > a.cfg.EscalateAfter {
+			err = a.cfg.Escalation.Notify(ctx, e)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("escalating alert %d: %w", alert.ID, err))
+			}
+			if !alert.Escalated {
+				alert.Escalated = true
+				entry.Action = AlertEscalated
+			}
+		}
+
+		err = a.store.UpdateAlert(ctx, alert)
+		if err != nil {
+			return errors.Join(append(errs, fmt.Errorf("updating alert %d: %w", alert.ID, err))...)
+		}
+		err = a.store.AddAlertAudit(ctx, alert.ID, entry)
+		if err != nil {
+			return errors.Join(append(errs, fmt.Errorf("auditing alert %d: %w", alert.ID, err))...)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Run sends reminders every interval until ctx is done. Errors are logged and
+// tried again next time.
+func (a *Alerts) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := a.RemindDue(ctx)
+			if err != nil {
+				a.logger.Printf("Error reminding about alerts: %v", err)
+			}
+		}
+	}
+}
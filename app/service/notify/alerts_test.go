@@ -0,0 +1,212 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// memAlertStore keeps alerts in memory.
+type memAlertStore struct {
+	alerts []Alert
+}
+
+func (s *memAlertStore) AddAlert(_ context.Context, alert Alert) (int64, error) {
+	alert.ID = int64(len(s.alerts) + 1)
+	s.alerts = append(s.alerts, alert)
+
+	return alert.ID, nil
+}
+
+func (s *memAlertStore) UpdateAlert(_ context.Context, alert Alert) error {
+	audit := s.alerts[alert.ID-1].Audit
+	alert.Audit = audit
+	s.alerts[alert.ID-1] = alert
+
+	return nil
+}
+
+func (s *memAlertStore) GetOpenAlerts(context.Context) ([]Alert, error) {
+	var open []Alert
+	for _, alert := range s.alerts {
+		if alert.Closed.IsZero() {
+			open = append(open, alert)
+		}
+	}
+
+	return open, nil
+}
+
+func (s *memAlertStore) GetAlertByToken(_ context.Context, token string) (Alert, error) {
+	for _, alert := range s.alerts {
+		if alert.Token == token {
+			return alert, nil
+		}
+	}
+
+	return Alert{}, errors.New("not found")
+}
+
+func (s *memAlertStore) AddAlertAudit(_ context.Context, alertID int64, entry AlertAudit) error {
+	s.alerts[alertID-1].Audit = append(s.alerts[alertID-1].Audit, entry)
+
+	return nil
+}
+
+func actions(alert Alert) []string {
+	var got []string
+	for _, entry := range alert.Audit {
+		got = append(got, entry.Action)
+	}
+
+	return got
+}
+
+func newTestAlerts(store AlertStore, n, escalation Notifier, now *time.Time) *Alerts {
+	return NewAlerts(AlertsConfig{
+		Events:        []string{EventLeave, EventCriticalBattery},
+		AckURL:        "https://tags.example.com/ack/",
+		Backoff:       Backoff{Initial: 5 * time.Minute, Max: 20 * time.Minute},
+		EscalateAfter: 2,
+		Escalation:    escalation,
+	}, store, n, func() time.Time { return *now }, log.New(io.Discard, "", 0))
+}
+
+func TestAlertsRemindAndEscalate(t *testing.T) {
+	// GIVEN alerts for leaving, escalated to email after two reminders
+	store := &memAlertStore{}
+	ntfy, email := &recordingNotifier{}, &recordingNotifier{}
+	now := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	alerts := newTestAlerts(store, ntfy, email, &now)
+	ctx := context.Background()
+
+	// WHEN Rueger leaves, and nobody acknowledges it for an hour
+	err := alerts.Notify(ctx, Event{Kind: EventLeave, Title: "RUEGER has left the property", SerNo: 810095, Zone: "the property"})
+	require.Nil(t, err)
+	for range 60 {
+		now = now.Add(time.Minute)
+		err = alerts.RemindDue(ctx)
+		require.Nil(t, err)
+	}
+
+	// THEN reminders are sent 5, 10, 20, 20 minutes apart - at 5, 15, 35 and
+	// 55 minutes - and email gets them from the third on.
+	require.Equal(t, []Title{
+		"RUEGER has left the property",
+		"Not acknowledged: RUEGER has left the property",
+		"Not acknowledged: RUEGER has left the property",
+		"Not acknowledged: RUEGER has left the property",
+		"Not acknowledged: RUEGER has left the property",
+	}, ntfy.sent())
+	require.Len(t, email.sent(), 2)
+
+	require.Equal(t, []string{AlertRaised, AlertReminded, AlertReminded, AlertEscalated, AlertReminded}, actions(store.alerts[0]))
+	require.Equal(t, time.Date(2025, 9, 1, 12, 55, 0, 0, time.UTC), store.alerts[0].Audit[4].Time)
+	require.True(t, store.alerts[0].Escalated)
+}
+
+func TestAlertsAcknowledge(t *testing.T) {
+	// GIVEN a critical battery alert
+	store := &memAlertStore{}
+	ntfy := &recordingNotifier{}
+	now := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	alerts := newTestAlerts(store, ntfy, nil, &now)
+	ctx := context.Background()
+
+	err := alerts.Notify(ctx, Event{Kind: EventCriticalBattery, Title: "RUEGER's battery critical", SerNo: 810095})
+	require.Nil(t, err)
+
+	// THEN it was raised with an ack link to it.
+	require.Len(t, store.alerts, 1)
+	token := store.alerts[0].Token
+	require.Len(t, token, 32)
+
+	// WHEN it's acknowledged, twice
+	now = now.Add(2 * time.Minute)
+	alert, err := alerts.Acknowledge(ctx, token, "ntfy", "203.0.113.9")
+	require.Nil(t, err)
+	now = now.Add(time.Minute)
+	_, err = alerts.Acknowledge(ctx, token, "Greg", "198.51.100.7")
+	require.Nil(t, err)
+
+	// THEN it's closed by the first, and both are in the audit trail.
+	require.Equal(t, time.Date(2025, 9, 1, 12, 2, 0, 0, time.UTC), alert.Closed)
+	alert, err = alerts.Get(ctx, token)
+	require.Nil(t, err)
+	require.Equal(t, time.Date(2025, 9, 1, 12, 2, 0, 0, time.UTC), alert.Closed)
+	require.Equal(t, []AlertAudit{
+		{Time: time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC), Action: AlertRaised, Detail: "RUEGER's battery critical"},
+		{Time: time.Date(2025, 9, 1, 12, 2, 0, 0, time.UTC), Action: AlertAcknowledged, By: "ntfy", Detail: "from 203.0.113.9"},
+		{Time: time.Date(2025, 9, 1, 12, 3, 0, 0, time.UTC), Action: AlertAcknowledged, By: "Greg", Detail: "from 198.51.100.7"},
+	}, alert.Audit)
+
+	// AND no reminders come.
+	now = now.Add(time.Hour)
+	err = alerts.RemindDue(ctx)
+	require.Nil(t, err)
+	require.Len(t, ntfy.sent(), 1)
+}
+
+func TestAlertsAckLinks(t *testing.T) {
+	// GIVEN alerts for leaving but not entering
+	store := &memAlertStore{}
+	ntfy := &capturingNotifier{}
+	now := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	alerts := newTestAlerts(store, ntfy, nil, &now)
+
+	// WHEN one of each is sent
+	for _, kind := range []string{EventLeave, EventEnter} {
+		err := alerts.Notify(context.Background(), Event{Kind: kind, SerNo: 810095})
+		require.Nil(t, err)
+	}
+
+	// THEN only the leave has an ack link.
+	require.True(t, strings.HasPrefix(ntfy.events[0].AckURL, "https://tags.example.com/ack/"))
+	require.Equal(t, "https://tags.example.com/ack/"+store.alerts[0].Token, ntfy.events[0].AckURL)
+	require.Empty(t, ntfy.events[1].AckURL)
+}
+
+// capturingNotifier remembers whole events.
+type capturingNotifier struct {
+	events []Event
+}
+
+func (n *capturingNotifier) Notify(_ context.Context, e Event) error {
+	n.events = append(n.events, e)
+
+	return nil
+}
+
+func TestAlertsResolve(t *testing.T) {
+	// GIVEN Rueger and Charlie out of the property, and Rueger's battery
+	// critical
+	store := &memAlertStore{}
+	ntfy := &recordingNotifier{}
+	now := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	alerts := newTestAlerts(store, ntfy, nil, &now)
+	ctx := context.Background()
+
+	for _, e := range []Event{
+		{Kind: EventLeave, SerNo: 810095, Zone: "the property"},
+		{Kind: EventLeave, SerNo: 810243, Zone: "the property"},
+		{Kind: EventCriticalBattery, SerNo: 810095},
+	} {
+		require.Nil(t, alerts.Notify(ctx, e))
+	}
+
+	// WHEN Rueger comes back
+	err := alerts.Notify(ctx, Event{Kind: EventEnter, Title: "RUEGER is back in the property", SerNo: 810095, Zone: "the property"})
+	require.Nil(t, err)
+
+	// THEN only his leave alert is closed.
+	require.False(t, store.alerts[0].Closed.IsZero())
+	require.Equal(t, []string{AlertRaised, AlertResolved}, actions(store.alerts[0]))
+	require.True(t, store.alerts[1].Closed.IsZero())
+	require.True(t, store.alerts[2].Closed.IsZero())
+}
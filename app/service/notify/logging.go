@@ -17,8 +17,8 @@ func NewLoggingNotifier(n Notifier, l *log.Logger) Notifier {
 	}
 }
 
-func (ln LoggingNotifier) Notify(ctx context.Context, title Title, message Message) error {
-	ln.Logger.Print("Sending notification: \"" + string(title) + "\" \"" + string(message) + "\"")
-	err := ln.Notifier.Notify(ctx, title, message)
+func (ln LoggingNotifier) Notify(ctx context.Context, e Event) error {
+	ln.Logger.Print("Sending " + e.Severity.String() + " " + e.Kind + " notification: \"" + string(e.Title) + "\" \"" + string(e.Message) + "\"")
+	err := ln.Notifier.Notify(ctx, e)
 	return err
 }
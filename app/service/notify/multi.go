@@ -0,0 +1,98 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Channel is a named notifier that Multi can send to, e.g. "ntfy" or "email".
+type Channel struct {
+	Name     string
+	Notifier Notifier
+}
+
+// Rule sends the notifications it matches to its channels. Empty Events or
+// Tags match anything.
+type Rule struct {
+	Events      []string
+	Tags        []string // Dogs' names, any case
+	MinSeverity Severity
+	Channels    []string
+}
+
+func (r Rule) matches(e Event) bool {
+	return (len(r.Events) == 0 || slices.Contains(r.Events, e.Kind)) &&
+		(len(r.Tags) == 0 || slices.ContainsFunc(r.Tags, func(t string) bool { return strings.EqualFold(t, e.Tag) })) &&
+		e.Severity >= r.MinSeverity
+}
+
+type Multi struct {
+	channels []Channel
+	rules    []Rule
+}
+
+// NewMultiNotifier returns a notifier that sends each event to the channels of
+// every rule that matches it. A notification that no
+// rule matches goes to every channel, so nothing is lost for want of a rule.
+// It's an error for a rule to name a channel that isn't there.
+func NewMultiNotifier(channels []Channel, rules []Rule) (Notifier, error) {
+	for i, r := range rules {
+		for _, name := range r.Channels {
+			if !slices.ContainsFunc(channels, func(c Channel) bool { return c.Name == name }) {
+				return nil, fmt.Errorf("rule %d: no channel called %q", i+1, name)
+			}
+		}
+	}
+
+	return Multi{channels: channels, rules: rules}, nil
+}
+
+// route returns the channels an event goes to.
+func (m Multi) route(e Event) []Channel {
+	matched := false
+	var names []string
+	for _, r := range m.rules {
+		if r.matches(e) {
+			matched = true
+			names = append(names, r.Channels...)
+		}
+	}
+	if !matched {
+		return m.channels
+	}
+
+	var channels []Channel
+	for _, c := range m.channels {
+		if slices.Contains(names, c.Name) {
+			channels = append(channels, c)
+		}
+	}
+
+	return channels
+}
+
+// Notify sends to the channels all at once, so a slow or failing one doesn't
+// hold up the rest. The errors are joined.
+func (m Multi) Notify(ctx context.Context, e Event) error {
+	channels := m.route(e)
+
+	errs := make([]error, len(channels))
+	var wg sync.WaitGroup
+	for i, c := range channels {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := c.Notifier.Notify(ctx, e)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", c.Name, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,102 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// recordingNotifier remembers the titles it's sent, and fails if told to.
+type recordingNotifier struct {
+	mu     sync.Mutex
+	titles []Title
+	err    error
+	delay  time.Duration
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, e Event) error {
+	select {
+	case <-time.After(n.delay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.titles = append(n.titles, e.Title)
+
+	return n.err
+}
+
+func (n *recordingNotifier) sent() []Title {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.titles
+}
+
+func TestMultiNotifierRouting(t *testing.T) {
+	// GIVEN ntfy, email and a webhook, with critical battery to ntfy and
+	// email, and zone alerts (for Rueger, warning or worse) to ntfy only
+	ntfy, email, hook := &recordingNotifier{}, &recordingNotifier{}, &recordingNotifier{}
+	multi, err := NewMultiNotifier(
+		[]Channel{{"ntfy", ntfy}, {"email", email}, {"hook", hook}},
+		[]Rule{
+			{Events: []string{EventCriticalBattery}, Channels: []string{"ntfy", "email"}},
+			{Events: []string{EventLeave, EventEnter, EventApproach}, Tags: []string{"rueger"}, MinSeverity: SeverityWarning, Channels: []string{"ntfy"}},
+		})
+	require.Nil(t, err)
+
+	for _, tc := range []struct {
+		event Event
+		want  []*recordingNotifier
+	}{
+		{Event{Title: "critical battery", Kind: EventCriticalBattery, Severity: SeverityCritical, Tag: "Charlie"}, []*recordingNotifier{ntfy, email}},
+		{Event{Title: "Rueger left", Kind: EventLeave, Severity: SeverityCritical, Tag: "Rueger"}, []*recordingNotifier{ntfy}},
+		// Below the rule's severity, and a dog it doesn't name - no rule, so everywhere
+		{Event{Title: "Rueger back", Kind: EventEnter, Severity: SeverityInfo, Tag: "Rueger"}, []*recordingNotifier{ntfy, email, hook}},
+		{Event{Title: "Charlie left", Kind: EventLeave, Severity: SeverityCritical, Tag: "Charlie"}, []*recordingNotifier{ntfy, email, hook}},
+		{Event{Title: "test", Kind: EventTest}, []*recordingNotifier{ntfy, email, hook}},
+	} {
+		t.Run(string(tc.event.Title), func(t *testing.T) {
+			// WHEN it's sent
+			err := multi.Notify(context.Background(), tc.event)
+			require.Nil(t, err)
+
+			// THEN it goes to just the right channels.
+			for _, n := range []*recordingNotifier{ntfy, email, hook} {
+				require.Equal(t, slices.Contains(tc.want, n), slices.Contains(n.sent(), tc.event.Title))
+			}
+		})
+	}
+}
+
+func TestMultiNotifierIsolatesFailures(t *testing.T) {
+	// GIVEN a failing channel and a slow one before a working one
+	failing := &recordingNotifier{err: errors.New("nope")}
+	slow := &recordingNotifier{delay: time.Hour}
+	working := &recordingNotifier{}
+	multi, err := NewMultiNotifier([]Channel{{"failing", failing}, {"slow", slow}, {"working", working}}, nil)
+	require.Nil(t, err)
+
+	// WHEN a notification is sent, with a deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = multi.Notify(ctx, Event{Title: "t"})
+
+	// THEN the working channel still gets it, and the others' errors are
+	// returned, named.
+	require.Equal(t, []Title{"t"}, working.sent())
+	require.ErrorContains(t, err, "failing: nope")
+	require.ErrorContains(t, err, "slow: context deadline exceeded")
+}
+
+func TestMultiNotifierUnknownChannel(t *testing.T) {
+	_, err := NewMultiNotifier([]Channel{{"ntfy", &recordingNotifier{}}}, []Rule{{Channels: []string{"ntfy", "sms"}}})
+	require.ErrorContains(t, err, `rule 1: no channel called "sms"`)
+}
@@ -1,12 +1,118 @@
 package notify
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"time"
+)
 
 type (
 	Title   string
 	Message string
 )
 
+// What an event is about.
+const (
+	EventLeave           = "leave"
+	EventEnter           = "enter"
+	EventApproach        = "approach"
+	EventLowBattery      = "lowBattery"
+	EventCriticalBattery = "criticalBattery"
+	EventNewBattery      = "newBattery"
+	EventTest            = "test"
+	EventDigest          = "digest"
+	EventSilent          = "silent"
+	EventReporting       = "reporting"
+	EventStaleFix        = "staleFix"
+	EventFreshFix        = "freshFix"
+)
+
+// Events are all the kinds of event there are.
+var Events = []string{EventLeave, EventEnter, EventApproach, EventLowBattery, EventCriticalBattery, EventNewBattery, EventTest, EventDigest, EventSilent, EventReporting, EventStaleFix, EventFreshFix}
+
+// Severity is how much an event matters.
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityCritical
+)
+
+var severityNames = []string{"info", "warning", "critical"}
+
+func (s Severity) String() string {
+	if s < 0 || int(s) >= len(severityNames) {
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+
+	return severityNames[s]
+}
+
+// ParseSeverity turns "info", "warning" or "critical" into a Severity.
+func ParseSeverity(name string) (Severity, error) {
+	for i, n := range severityNames {
+		if n == name {
+			return Severity(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown severity %q, should be info, warning or critical", name)
+}
+
+// Event is something to tell people about. Title and Message are for humans;
+// the rest is for notifiers to render as they see fit (priorities, map links)
+// and for routing.
+type Event struct {
+	Kind     string // One of Events
+	Severity Severity
+	Title    Title
+	Message  Message
+
+	SerNo int    // The tag's serial number. 0 if not about a tag.
+	Tag   string // The dog's name
+
+	HasPosition bool // Whether Latitude and Longitude are known
+	Latitude    float64
+	Longitude   float64
+
+	Zone           string  // The alert boundary, for zone events
+	BatteryVoltage float64 // Volts, for battery events
+	Time           time.Time
+
+	// AckURL is where to acknowledge the event, for those that need it.
+	// Renderers add "?by=" saying where it was acknowledged from.
+	AckURL string
+
+	// HTML, if set, is a whole HTML page (e.g. a digest report) for
+	// notifiers that can show one to use instead of their own rendering.
+	HTML string
+}
+
+// MapURL is a Google Maps link to the event's position, or "" if it hasn't
+// got one.
+func (e Event) MapURL() string {
+	if !e.HasPosition {
+		return ""
+	}
+
+	return fmt.Sprintf("https://www.google.com/maps/search/?api=1&query=%v,%v", e.Latitude, e.Longitude)
+}
+
 type Notifier interface {
-	Notify(context.Context, Title, Message) error
+	Notify(context.Context, Event) error
+}
+
+// TitleMessage adapts n for callers that only have a title and message to
+// send, as notifiers used to take. Each becomes an Event of the given kind,
+// at info severity, timed when it's sent.
+func TitleMessage(n Notifier, kind string) func(context.Context, Title, Message) error {
+	return func(ctx context.Context, title Title, message Message) error {
+		return n.Notify(ctx, Event{
+			Kind:    kind,
+			Title:   title,
+			Message: message,
+			Time:    time.Now(),
+		})
+	}
 }
@@ -0,0 +1,36 @@
+package notify
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// lastEventNotifier keeps the last event it's sent.
+type lastEventNotifier struct {
+	event Event
+}
+
+func (n *lastEventNotifier) Notify(_ context.Context, e Event) error {
+	n.event = e
+	return nil
+}
+
+func TestTitleMessage(t *testing.T) {
+	// GIVEN a notifier adapted for a caller with just a title and message
+	n := &lastEventNotifier{}
+	send := TitleMessage(n, EventTest)
+
+	// WHEN it's used
+	err := send(context.Background(), "Test notification", "This is a test notification.")
+	require.Nil(t, err)
+
+	// THEN the notifier gets an event of the kind, with the title and message.
+	e := n.event
+	require.Equal(t, EventTest, e.Kind)
+	require.Equal(t, SeverityInfo, e.Severity)
+	require.Equal(t, Title("Test notification"), e.Title)
+	require.Equal(t, Message("This is a test notification."), e.Message)
+	require.False(t, e.Time.IsZero())
+}
@@ -4,20 +4,26 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"strings"
 )
 
-const ntfyURLBase = "https://ntfy.sh/"
-
 type Ntfy struct {
+	urlBase        string
 	subscriptionID string
+	clickURL       string
 }
 
-func NewNtfyNotifier(subscriptionID string) Notifier {
+// NewNtfyNotifier returns a notifier that posts to the subscription at urlBase
+// (eg. https://ntfy.sh/). Notifications get a "Show me" action that opens
+// clickURL, and events that need acknowledging an "Acknowledge" one.
+func NewNtfyNotifier(urlBase, subscriptionID, clickURL string) Notifier {
 	return Ntfy{
+		urlBase:        urlBase,
 		subscriptionID: subscriptionID,
+		clickURL:       clickURL,
 	}
 }
 
@@ -30,19 +36,75 @@ func cacheBustingString() string {
 	return hex.EncodeToString(bytes)
 }
 
-func (n Ntfy) Notify(ctx context.Context, title Title, message Message) error {
+// ntfyPriorities are ntfy's names for how urgent each severity is. Urgent
+// makes phones buzz for longer, even in do-not-disturb.
+var ntfyPriorities = map[Severity]string{
+	SeverityInfo:     "default",
+	SeverityWarning:  "high",
+	SeverityCritical: "urgent",
+}
+
+// ntfyEmoji are the ntfy tags that show as an emoji before the title.
+var ntfyEmoji = map[string]string{
+	EventLeave:           "rotating_light",
+	EventEnter:           "house",
+	EventApproach:        "warning",
+	EventLowBattery:      "battery",
+	EventCriticalBattery: "battery",
+	EventNewBattery:      "battery",
+	EventTest:            "test_tube",
+	EventSummary:         "zzz",
+	EventDigest:          "bar_chart",
+	EventSilent:          "mute",
+	EventReporting:       "signal_strength",
+	EventStaleFix:        "satellite",
+	EventFreshFix:        "satellite",
+}
+
+func (n Ntfy) Notify(ctx context.Context, e Event) error {
 	// Set up
 	client := &http.Client{}
-	buf := strings.NewReader(string(message))
+	buf := strings.NewReader(string(e.Message))
 
 	// Make the request object
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ntfyURLBase+n.subscriptionID, buf)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.urlBase+n.subscriptionID, buf)
 	if err != nil {
 		return fmt.Errorf("error while making http POST request to ntfy.sh: %w", err)
 	}
 
-	req.Header.Set("Title", string(title))
-	req.Header.Set("Actions", `[{ "action": "view", "label": "Show me", "url": "https://tags.bitwombat.com.au/current?q=`+cacheBustingString()+`"}]`)
+	req.Header.Set("Title", string(e.Title))
+	req.Header.Set("Priority", ntfyPriorities[e.Severity])
+
+	// Tags that aren't emoji are shown under the message.
+	var tags []string
+	if emoji, ok := ntfyEmoji[e.Kind]; ok {
+		tags = append(tags, emoji)
+	}
+	if e.Tag != "" {
+		tags = append(tags, e.Tag)
+	}
+	if len(tags) > 0 {
+		req.Header.Set("Tags", strings.Join(tags, ","))
+	}
+
+	// Tapping the notification shows where the dog was, if we know.
+	if e.HasPosition {
+		req.Header.Set("Click", e.MapURL())
+	}
+
+	actions := []map[string]any{
+		{"action": "view", "label": "Show me", "url": n.clickURL + "?q=" + cacheBustingString()},
+	}
+	if e.AckURL != "" {
+		actions = append(actions, map[string]any{
+			"action": "http", "label": "Acknowledge", "url": e.AckURL + "?by=ntfy", "method": "POST", "clear": true,
+		})
+	}
+	actionsJSON, err := json.Marshal(actions)
+	if err != nil {
+		return fmt.Errorf("error encoding ntfy actions: %w", err)
+	}
+	req.Header.Set("Actions", string(actionsJSON))
 
 	// Send the request
 	resp, err := client.Do(req)
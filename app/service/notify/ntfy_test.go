@@ -0,0 +1,84 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNtfyRendersEvents(t *testing.T) {
+	for _, tc := range []struct {
+		description string
+		event       Event
+		want        map[string]string
+	}{
+		{
+			description: "critical zone event, with a position",
+			event:       Event{Kind: EventLeave, Severity: SeverityCritical, Title: "RUEGER is off the property", Tag: "Rueger", HasPosition: true, Latitude: -31.5, Longitude: 152.6},
+			want: map[string]string{
+				"Title":    "RUEGER is off the property",
+				"Priority": "urgent",
+				"Tags":     "rotating_light,Rueger",
+				"Click":    "https://www.google.com/maps/search/?api=1&query=-31.5,152.6",
+			},
+		},
+		{
+			description: "low battery, no position",
+			event:       Event{Kind: EventLowBattery, Severity: SeverityWarning, Title: "RUEGER's battery low", Tag: "Rueger"},
+			want: map[string]string{
+				"Priority": "high",
+				"Tags":     "battery,Rueger",
+				"Click":    "",
+			},
+		},
+		{
+			description: "just a title",
+			event:       Event{Title: "Hello"},
+			want: map[string]string{
+				"Priority": "default",
+				"Tags":     "",
+			},
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			srv, received := newWebhookServer(t, http.StatusOK)
+			n := NewNtfyNotifier(srv.URL+"/", "dogs", "https://tags.example.com/current")
+
+			err := n.Notify(context.Background(), tc.event)
+			require.Nil(t, err)
+
+			require.Len(t, *received, 1)
+			for header, want := range tc.want {
+				require.Equal(t, want, (*received)[0].header.Get(header), header)
+			}
+			require.Contains(t, (*received)[0].header.Get("Actions"), "https://tags.example.com/current?q=")
+		})
+	}
+}
+
+func TestNtfyAcknowledgeAction(t *testing.T) {
+	// GIVEN an event that needs acknowledging
+	srv, received := newWebhookServer(t, http.StatusOK)
+	n := NewNtfyNotifier(srv.URL+"/", "dogs", "https://tags.example.com/current")
+
+	// WHEN it's sent
+	err := n.Notify(context.Background(), Event{Kind: EventLeave, Title: "RUEGER is off the property", AckURL: "https://tags.example.com/ack/abc123"})
+	require.Nil(t, err)
+
+	// THEN it has an action that POSTs to the ack URL, as well as "Show me".
+	var actions []map[string]any
+	err = json.Unmarshal([]byte((*received)[0].header.Get("Actions")), &actions)
+	require.Nil(t, err)
+	require.Len(t, actions, 2)
+	require.Equal(t, "Show me", actions[0]["label"])
+	require.Equal(t, map[string]any{
+		"action": "http",
+		"label":  "Acknowledge",
+		"url":    "https://tags.example.com/ack/abc123?by=ntfy",
+		"method": "POST",
+		"clear":  true,
+	}, actions[1])
+}
@@ -10,6 +10,6 @@ func NewNullNotifier() Notifier {
 	return NullNotifier{}
 }
 
-func (ln NullNotifier) Notify(_ context.Context, _ Title, _ Message) error {
+func (ln NullNotifier) Notify(_ context.Context, _ Event) error {
 	return nil
 }
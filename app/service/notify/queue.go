@@ -0,0 +1,228 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Where a queued notification is at.
+const (
+	QueuePending = "pending" // Waiting to be retried
+	QueueFailed  = "failed"  // Out of attempts. Kept so it can be seen.
+)
+
+// QueuedNotification is an event a channel failed to take, waiting to be
+// tried again.
+type QueuedNotification struct {
+	ID          int64
+	Channel     string
+	Event       Event
+	Status      string // QueuePending or QueueFailed
+	Attempts    int
+	LastError   string
+	Queued      time.Time
+	NextAttempt time.Time
+}
+
+// QueueStore persists queued notifications, so they survive restarts.
+type QueueStore interface {
+	AddQueuedNotification(context.Context, QueuedNotification) (int64, error)
+	UpdateQueuedNotification(context.Context, QueuedNotification) error
+	DeleteQueuedNotification(context.Context, int64) error
+	GetQueuedNotifications(context.Context) ([]QueuedNotification, error)
+	// GetDueNotifications returns those with the status whose NextAttempt
+	// isn't after the time.
+	GetDueNotifications(context.Context, string, time.Time) ([]QueuedNotification, error)
+	// PurgeQueuedNotifications removes failed and held back notifications
+	// queued before the time, and says how many went.
+	PurgeQueuedNotifications(context.Context, time.Time) (int64, error)
+}
+
+// Backoff says how often, and how many times, to try a notification.
+type Backoff struct {
+	Initial     time.Duration // Wait after the first failure
+	Max         time.Duration // Longest wait, however many failures
+	MaxAttempts int           // Including the first
+}
+
+// delay is how long to wait after the given number of failed attempts. It
+// doubles each time.
+func (b Backoff) delay(attempts int) time.Duration {
+	d := b.Initial
+	for i := 1; i < attempts && d < b.Max; i++ {
+		d *= 2
+	}
+
+	return min(d, b.Max)
+}
+
+// storeTimeout is how long saving to the queue gets, whatever the caller's
+// context has left. A notification that timed out still needs queuing.
+const storeTimeout = 10 * time.Second
+
+// Queue retries notifications that channels fail to take, with backoff.
+type Queue struct {
+	store   QueueStore
+	backoff Backoff
+	now     func() time.Time
+	logger  *log.Logger
+
+	mu       sync.Mutex
+	channels map[string]Notifier
+}
+
+func NewQueue(store QueueStore, backoff Backoff, now func() time.Time, logger *log.Logger) *Queue {
+	return &Queue{
+		store:    store,
+		backoff:  backoff,
+		now:      now,
+		logger:   logger,
+		channels: make(map[string]Notifier),
+	}
+}
+
+type queuedChannel struct {
+	q    *Queue
+	name string
+	n    Notifier
+}
+
+// Channel returns n with failures queued for retrying. A failure that's
+// queued isn't an error - the queue has it now.
+func (q *Queue) Channel(name string, n Notifier) Notifier {
+	q.mu.Lock()
+	q.channels[name] = n
+	q.mu.Unlock()
+
+	return queuedChannel{q: q, name: name, n: n}
+}
+
+func (qc queuedChannel) Notify(ctx context.Context, e Event) error {
+	err := qc.n.Notify(ctx, e)
+	if err == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), storeTimeout)
+	defer cancel()
+
+	now := qc.q.now()
+	qn := QueuedNotification{
+		Channel:     qc.name,
+		Event:       e,
+		Status:      QueuePending,
+		Attempts:    1,
+		LastError:   err.Error(),
+		Queued:      now,
+		NextAttempt: now.Add(qc.q.backoff.delay(1)),
+	}
+	if qc.q.backoff.MaxAttempts <= 1 {
+		qn.Status = QueueFailed
+	}
+
+	_, qerr := qc.q.store.AddQueuedNotification(ctx, qn)
+	if qerr != nil {
+		return errors.Join(err, fmt.Errorf("queuing for retry: %w", qerr))
+	}
+
+	qc.q.logger.Printf("Notification %q to %s failed, will retry: %v", e.Title, qc.name, err)
+
+	return nil
+}
+
+// List returns everything in the queue, pending and failed.
+func (q *Queue) List(ctx context.Context) ([]QueuedNotification, error) {
+	return q.store.GetQueuedNotifications(ctx)
+}
+
+// RetryDue tries again each pending notification that's due. Those that get
+// through are removed from the queue; those that run out of attempts are
+// marked failed. A store error for one doesn't hold up the rest.
+func (q *Queue) RetryDue(ctx context.Context) error {
+	queued, err := q.store.GetDueNotifications(ctx, QueuePending, q.now())
+	if err != nil {
+		return fmt.Errorf("getting queued notifications: %w", err)
+	}
+
+	var errs []error
+	for _, qn := range queued {
+		q.mu.Lock()
+		n, ok := q.channels[qn.Channel]
+		q.mu.Unlock()
+
+		err = errors.New("no channel called " + qn.Channel)
+		if ok {
+			attemptCtx, cancel := context.WithTimeout(ctx, storeTimeout)
+			err = n.Notify(attemptCtx, qn.Event)
+			cancel()
+		}
+
+		if err == nil {
+			q.logger.Printf("Notification %q to %s got through on attempt %d", qn.Event.Title, qn.Channel, qn.Attempts+1)
+			err = q.store.DeleteQueuedNotification(ctx, qn.ID)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("removing sent notification %d from the queue: %w", qn.ID, err))
+			}
+			continue
+		}
+
+		qn.Attempts++
+		qn.LastError = err.Error()
+		if !ok || qn.Attempts >= q.backoff.MaxAttempts {
+			qn.Status = QueueFailed
+			q.logger.Printf("Giving up on notification %q to %s after %d attempts: %v", qn.Event.Title, qn.Channel, qn.Attempts, err)
+		} else {
+			qn.NextAttempt = q.now().Add(q.backoff.delay(qn.Attempts))
+		}
+
+		err = q.store.UpdateQueuedNotification(ctx, qn)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("updating queued notification %d: %w", qn.ID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Purge removes failed and held back notifications queued more than keepFor
+// ago, so the queue doesn't grow forever.
+func (q *Queue) Purge(ctx context.Context, keepFor time.Duration) error {
+	n, err := q.store.PurgeQueuedNotifications(ctx, q.now().Add(-keepFor))
+	if err != nil {
+		return fmt.Errorf("purging old notifications: %w", err)
+	}
+	if n > 0 {
+		q.logger.Printf("Purged %d failed or held back notifications older than %v", n, keepFor)
+	}
+
+	return nil
+}
+
+// Run retries due notifications, and purges those kept longer than keepFor,
+// every interval until ctx is done. Errors are logged and tried again next
+// time.
+func (q *Queue) Run(ctx context.Context, interval, keepFor time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := q.RetryDue(ctx)
+			if err != nil {
+				q.logger.Printf("Error retrying notifications: %v", err)
+			}
+
+			err = q.Purge(ctx, keepFor)
+			if err != nil {
+				q.logger.Printf("Error: %v", err)
+			}
+		}
+	}
+}
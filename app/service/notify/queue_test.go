@@ -0,0 +1,290 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// memQueueStore keeps queued notifications in memory.
+type memQueueStore struct {
+	queued []QueuedNotification
+	nextID int64
+	failID int64 // Updating or deleting this one fails
+}
+
+func (s *memQueueStore) AddQueuedNotification(_ context.Context, qn QueuedNotification) (int64, error) {
+	s.nextID++
+	qn.ID = s.nextID
+	s.queued = append(s.queued, qn)
+
+	return qn.ID, nil
+}
+
+func (s *memQueueStore) UpdateQueuedNotification(_ context.Context, qn QueuedNotification) error {
+	if qn.ID == s.failID {
+		return errors.New("database is locked")
+	}
+	for i := range s.queued {
+		if s.queued[i].ID == qn.ID {
+			s.queued[i] = qn
+			return nil
+		}
+	}
+
+	return errors.New("not found")
+}
+
+func (s *memQueueStore) DeleteQueuedNotification(_ context.Context, id int64) error {
+	if id == s.failID {
+		return errors.New("database is locked")
+	}
+	for i := range s.queued {
+		if s.queued[i].ID == id {
+			s.queued = append(s.queued[:i], s.queued[i+1:]...)
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (s *memQueueStore) GetQueuedNotifications(context.Context) ([]QueuedNotification, error) {
+	return append([]QueuedNotification(nil), s.queued...), nil
+}
+
+func (s *memQueueStore) GetDueNotifications(_ context.Context, status string, now time.Time) ([]QueuedNotification, error) {
+	var due []QueuedNotification
+	for _, qn := range s.queued {
+		if qn.Status == status && !qn.NextAttempt.After(now) {
+			due = append(due, qn)
+		}
+	}
+
+	return due, nil
+}
+
+func (s *memQueueStore) PurgeQueuedNotifications(_ context.Context, before time.Time) (int64, error) {
+	var kept []QueuedNotification
+	for _, qn := range s.queued {
+		if qn.Status != QueuePending && qn.Queued.Before(before) {
+			continue
+		}
+		kept = append(kept, qn)
+	}
+	n := len(s.queued) - len(kept)
+	s.queued = kept
+
+	return int64(n), nil
+}
+
+func TestBackoffDelay(t *testing.T) {
+	b := Backoff{Initial: time.Minute, Max: 10 * time.Minute}
+
+	for _, tc := range []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{4, 8 * time.Minute},
+		{5, 10 * time.Minute},
+		{50, 10 * time.Minute},
+	} {
+		require.Equal(t, tc.want, b.delay(tc.attempts), "attempts %d", tc.attempts)
+	}
+}
+
+func TestQueueRetriesUntilSent(t *testing.T) {
+	// GIVEN a channel that's down, behind a queue
+	store := &memQueueStore{}
+	now := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	queue := NewQueue(store, Backoff{Initial: time.Minute, Max: time.Hour, MaxAttempts: 5}, func() time.Time { return now }, log.New(io.Discard, "", 0))
+	email := &recordingNotifier{err: errors.New("connection refused")}
+	channel := queue.Channel("email", email)
+	ctx := context.Background()
+
+	// WHEN a notification is sent
+	err := channel.Notify(ctx, Event{Title: "RUEGER has left the property"})
+
+	// THEN it's queued rather than being an error.
+	require.Nil(t, err)
+	queued, err := queue.List(ctx)
+	require.Nil(t, err)
+	require.Len(t, queued, 1)
+	require.Equal(t, QueuedNotification{
+		ID:          1,
+		Channel:     "email",
+		Event:       Event{Title: "RUEGER has left the property"},
+		Status:      QueuePending,
+		Attempts:    1,
+		LastError:   "connection refused",
+		Queued:      now,
+		NextAttempt: now.Add(time.Minute),
+	}, queued[0])
+
+	// WHEN retries are run before it's due
+	now = now.Add(30 * time.Second)
+	err = queue.RetryDue(ctx)
+	require.Nil(t, err)
+
+	// THEN it isn't tried again.
+	require.Len(t, email.sent(), 1)
+
+	// WHEN it's due, but the channel's still down
+	now = now.Add(time.Minute)
+	err = queue.RetryDue(ctx)
+	require.Nil(t, err)
+
+	// THEN it's tried, and put off for twice as long.
+	require.Len(t, email.sent(), 2)
+	queued, err = queue.List(ctx)
+	require.Nil(t, err)
+	require.Equal(t, 2, queued[0].Attempts)
+	require.Equal(t, now.Add(2*time.Minute), queued[0].NextAttempt)
+
+	// WHEN the channel comes back and it's due again
+	email.mu.Lock()
+	email.err = nil
+	email.mu.Unlock()
+	now = now.Add(2 * time.Minute)
+	err = queue.RetryDue(ctx)
+	require.Nil(t, err)
+
+	// THEN it's sent and leaves the queue.
+	require.Len(t, email.sent(), 3)
+	queued, err = queue.List(ctx)
+	require.Nil(t, err)
+	require.Empty(t, queued)
+}
+
+func TestQueueDeadLetters(t *testing.T) {
+	// GIVEN a channel that stays down, with three attempts allowed
+	store := &memQueueStore{}
+	now := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	queue := NewQueue(store, Backoff{Initial: time.Minute, Max: time.Hour, MaxAttempts: 3}, func() time.Time { return now }, log.New(io.Discard, "", 0))
+	ntfy := &recordingNotifier{err: errors.New("502 Bad Gateway")}
+	channel := queue.Channel("ntfy", ntfy)
+	ctx := context.Background()
+
+	err := channel.Notify(ctx, Event{Title: "Low battery"})
+	require.Nil(t, err)
+
+	// WHEN retries run well after each is due
+	for range 5 {
+		now = now.Add(time.Hour)
+		err = queue.RetryDue(ctx)
+		require.Nil(t, err)
+	}
+
+	// THEN it's tried three times in all, then kept as failed.
+	require.Len(t, ntfy.sent(), 3)
+	queued, err := queue.List(ctx)
+	require.Nil(t, err)
+	require.Len(t, queued, 1)
+	require.Equal(t, QueueFailed, queued[0].Status)
+	require.Equal(t, 3, queued[0].Attempts)
+	require.Equal(t, "502 Bad Gateway", queued[0].LastError)
+}
+
+func TestQueueUnknownChannel(t *testing.T) {
+	// GIVEN a notification queued for a channel that's since been removed
+	store := &memQueueStore{}
+	now := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	_, err := store.AddQueuedNotification(context.Background(), QueuedNotification{
+		Channel: "oldhook", Status: QueuePending, Attempts: 1, NextAttempt: now,
+	})
+	require.Nil(t, err)
+	queue := NewQueue(store, Backoff{Initial: time.Minute, Max: time.Hour, MaxAttempts: 5}, func() time.Time { return now }, log.New(io.Discard, "", 0))
+
+	// WHEN retries are run
+	err = queue.RetryDue(context.Background())
+	require.Nil(t, err)
+
+	// THEN it's given up on straight away.
+	require.Equal(t, QueueFailed, store.queued[0].Status)
+	require.Equal(t, "no channel called oldhook", store.queued[0].LastError)
+}
+
+func TestQueueKeepsGoingAfterAStoreError(t *testing.T) {
+	// GIVEN two due notifications, the first of which can't be saved
+	store := &memQueueStore{failID: 1}
+	now := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	for range 2 {
+		_, err := store.AddQueuedNotification(ctx, QueuedNotification{Channel: "email", Status: QueuePending, Attempts: 1, NextAttempt: now})
+		require.Nil(t, err)
+	}
+	queue := NewQueue(store, Backoff{Initial: time.Minute, Max: time.Hour, MaxAttempts: 5}, func() time.Time { return now }, log.New(io.Discard, "", 0))
+	email := &recordingNotifier{err: errors.New("connection refused")}
+	queue.Channel("email", email)
+
+	// WHEN retries are run
+	err := queue.RetryDue(ctx)
+
+	// THEN the error is reported, but the second is still tried and saved.
+	require.ErrorContains(t, err, "updating queued notification 1")
+	require.Len(t, email.sent(), 2)
+	require.Equal(t, 2, store.queued[1].Attempts)
+}
+
+func TestQueueRetriesRespectQuietHours(t *testing.T) {
+	// GIVEN email that's down, quiet from 22:00, behind quiet hours and a
+	// queue (in that order, as main sets it up)
+	store := &memQueueStore{}
+	now := time.Date(2025, 9, 1, 21, 59, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	queue := NewQueue(store, Backoff{Initial: time.Minute, Max: time.Hour, MaxAttempts: 5}, clock, log.New(io.Discard, "", 0))
+	quiet := NewQuietHours(Schedule{Location: time.UTC, Periods: []QuietPeriod{{Start: 22 * time.Hour, End: 7 * time.Hour}}}, store, clock, log.New(io.Discard, "", 0))
+	email := &recordingNotifier{err: errors.New("connection refused")}
+	channel := queue.Channel("email", quiet.Channel("email", email))
+	ctx := context.Background()
+
+	// WHEN a notification fails just before quiet hours, and comes due for a
+	// retry during them
+	err := channel.Notify(ctx, Event{Title: "Low battery"})
+	require.Nil(t, err)
+	now = now.Add(2 * time.Minute)
+	email.mu.Lock()
+	email.err = nil
+	email.mu.Unlock()
+	err = queue.RetryDue(ctx)
+	require.Nil(t, err)
+
+	// THEN it isn't sent, but held back for the morning.
+	require.Len(t, email.sent(), 1)
+	require.Len(t, store.queued, 1)
+	require.Equal(t, QueueSuppressed, store.queued[0].Status)
+}
+
+func TestQueuePurge(t *testing.T) {
+	// GIVEN failed, held back and pending notifications, old and new
+	store := &memQueueStore{}
+	now := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	for _, qn := range []QueuedNotification{
+		{Status: QueueFailed, Queued: now.Add(-40 * 24 * time.Hour)},
+		{Status: QueueSuppressed, Queued: now.Add(-40 * 24 * time.Hour)},
+		{Status: QueuePending, Queued: now.Add(-40 * 24 * time.Hour)},
+		{Status: QueueFailed, Queued: now.Add(-time.Hour)},
+	} {
+		_, err := store.AddQueuedNotification(ctx, qn)
+		require.Nil(t, err)
+	}
+	queue := NewQueue(store, Backoff{Initial: time.Minute, Max: time.Hour, MaxAttempts: 5}, func() time.Time { return now }, log.New(io.Discard, "", 0))
+
+	// WHEN those over 30 days old are purged
+	err := queue.Purge(ctx, 30*24*time.Hour)
+	require.Nil(t, err)
+
+	// THEN the old failed and held back ones are gone, and the rest kept.
+	require.Len(t, store.queued, 2)
+	require.Equal(t, QueuePending, store.queued[0].Status)
+	require.Equal(t, now.Add(-time.Hour), store.queued[1].Queued)
+}
@@ -0,0 +1,242 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QueueSuppressed is the status of an event held back by quiet hours, waiting
+// to be summarised.
+const QueueSuppressed = "suppressed"
+
+// EventSummary is the kind of event that sums up what was held back during
+// quiet hours. It's sent straight to the channel, so can't be routed.
+const EventSummary = "summary"
+
+// QuietPeriod is a time of day when some events aren't sent to some channels.
+// Empty Days, Events or Channels match anything.
+type QuietPeriod struct {
+	Days     []time.Weekday // The day the period starts on
+	Start    time.Duration  // Since midnight
+	End      time.Duration  // Since midnight. Before Start if it runs overnight; the same for all day.
+	Events   []string
+	Channels []string
+}
+
+// covers says if the period is in effect at the time of day tod on weekday day.
+func (p QuietPeriod) covers(day time.Weekday, tod time.Duration) bool {
+	onDay := func(d time.Weekday) bool { return len(p.Days) == 0 || slices.Contains(p.Days, d) }
+
+	switch {
+	case p.Start == p.End:
+		return onDay(day)
+	case p.Start < p.End:
+		return onDay(day) && tod >= p.Start && tod < p.End
+	default: // Overnight, so it might have started yesterday
+		return (onDay(day) && tod >= p.Start) || (onDay((day+6)%7) && tod < p.End)
+	}
+}
+
+// Schedule is when it's quiet, in a time zone.
+type Schedule struct {
+	Location *time.Location
+	Periods  []QuietPeriod
+}
+
+// IsQuiet says if the event shouldn't be sent to the channel at t.
+func (s Schedule) IsQuiet(t time.Time, channel string, e Event) bool {
+	local := t.In(s.Location)
+	tod := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute + time.Duration(local.Second())*time.Second
+
+	for _, p := range s.Periods {
+		if (len(p.Events) == 0 || slices.Contains(p.Events, e.Kind)) &&
+			(len(p.Channels) == 0 || slices.Contains(p.Channels, channel)) &&
+			p.covers(local.Weekday(), tod) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// QuietHours holds back events during quiet hours, and sums them up for each
+// channel when its quiet hours are over. Held back events are kept in the
+// QueueStore, so a restart doesn't lose them.
+type QuietHours struct {
+	schedule Schedule
+	store    QueueStore
+	now      func() time.Time
+	logger   *log.Logger
+
+	mu       sync.Mutex
+	channels map[string]Notifier
+}
+
+func NewQuietHours(schedule Schedule, store QueueStore, now func() time.Time, logger *log.Logger) *QuietHours {
+	return &QuietHours{
+		schedule: schedule,
+		store:    store,
+		now:      now,
+		logger:   logger,
+		channels: make(map[string]Notifier),
+	}
+}
+
+type quietChannel struct {
+	qh   *QuietHours
+	name string
+	n    Notifier
+}
+
+// Channel returns n with events held back during the channel's quiet hours.
+// Summaries are sent through n too; those that fail stay held back, to be
+// tried again next time.
+func (qh *QuietHours) Channel(name string, n Notifier) Notifier {
+	qh.mu.Lock()
+	qh.channels[name] = n
+	qh.mu.Unlock()
+
+	return quietChannel{qh: qh, name: name, n: n}
+}
+
+func (qc quietChannel) Notify(ctx context.Context, e Event) error {
+	now := qc.qh.now()
+	if !qc.qh.schedule.IsQuiet(now, qc.name, e) {
+		return qc.n.Notify(ctx, e)
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), storeTimeout)
+	defer cancel()
+
+	_, err := qc.qh.store.AddQueuedNotification(ctx, QueuedNotification{
+		Channel: qc.name,
+		Event:   e,
+		Status:  QueueSuppressed,
+		Queued:  now,
+	})
+	if err != nil {
+		return fmt.Errorf("holding back for quiet hours: %w", err)
+	}
+
+	qc.qh.logger.Printf("Notification %q to %s held back for quiet hours", e.Title, qc.name)
+
+	return nil
+}
+
+// SummariseDue sends each channel whose quiet hours are over what was held
+// back from it - the event itself if there was only one, otherwise a summary.
+// A channel that fails to take its summary, or a store error, doesn't hold up
+// the rest; what wasn't sent stays held back for next time.
+func (qh *QuietHours) SummariseDue(ctx context.Context) error {
+	// Held back notifications have no next attempt, so they're all "due".
+	now := qh.now()
+	queued, err := qh.store.GetDueNotifications(ctx, QueueSuppressed, now)
+	if err != nil {
+		return fmt.Errorf("getting held back notifications: %w", err)
+	}
+
+	due := make(map[string][]QueuedNotification)
+	var channels []string
+	for _, qn := range queued {
+		if qh.schedule.IsQuiet(now, qn.Channel, qn.Event) {
+			continue
+		}
+		if _, ok := due[qn.Channel]; !ok {
+			channels = append(channels, qn.Channel)
+		}
+		due[qn.Channel] = append(due[qn.Channel], qn)
+	}
+
+	var errs []error
+	for _, name := range channels {
+		held := due[name]
+
+		qh.mu.Lock()
+		n, ok := qh.channels[name]
+		qh.mu.Unlock()
+
+		if !ok {
+			// The channel's gone from the config. Keep them where they can be
+			// seen.
+			for _, qn := range held {
+				qn.Status = QueueFailed
+				qn.LastError = "no channel called " + name
+				err = qh.store.UpdateQueuedNotification(ctx, qn)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("updating held back notification %d: %w", qn.ID, err))
+				}
+			}
+			continue
+		}
+
+		e := held[0].Event
+		if len(held) > 1 {
+			e = qh.summary(held)
+		}
+
+		err = n.Notify(ctx, e)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sending quiet hours summary to %s: %w", name, err))
+			continue
+		}
+		qh.logger.Printf("Sent %d notifications held back from %s for quiet hours", len(held), name)
+
+		for _, qn := range held {
+			err = qh.store.DeleteQueuedNotification(ctx, qn.ID)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("removing held back notification %d: %w", qn.ID, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// summary is an event listing the held back events, as severe as the worst of
+// them. It's about a tag only if they all were.
+func (qh *QuietHours) summary(held []QueuedNotification) Event {
+	e := Event{
+		Kind:  EventSummary,
+		Title: Title(fmt.Sprintf("%d notifications during quiet hours", len(held))),
+		SerNo: held[0].Event.SerNo,
+		Tag:   held[0].Event.Tag,
+		Time:  qh.now(),
+	}
+
+	lines := make([]string, 0, len(held))
+	for _, qn := range held {
+		e.Severity = max(e.Severity, qn.Event.Severity)
+		if qn.Event.SerNo != e.SerNo {
+			e.SerNo, e.Tag = 0, ""
+		}
+		lines = append(lines, qn.Queued.In(qh.schedule.Location).Format("Mon 15:04")+" "+string(qn.Event.Title))
+	}
+	e.Message = Message(strings.Join(lines, "\n"))
+
+	return e
+}
+
+// Run sends summaries every interval until ctx is done. Errors are logged and
+// tried again next time.
+func (qh *QuietHours) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := qh.SummariseDue(ctx)
+			if err != nil {
+				qh.logger.Printf("Error summarising quiet hours: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduleIsQuiet(t *testing.T) {
+	sydney, err := time.LoadLocation("Australia/Sydney")
+	require.Nil(t, err)
+
+	// Battery alerts are quiet overnight everywhere; nothing goes to email on
+	// Sunday mornings.
+	schedule := Schedule{Location: sydney, Periods: []QuietPeriod{
+		{Start: 22 * time.Hour, End: 8 * time.Hour, Events: []string{EventLowBattery}},
+		{Days: []time.Weekday{time.Sunday}, Start: 6 * time.Hour, End: 12 * time.Hour, Channels: []string{"email"}},
+	}}
+
+	lowBattery := Event{Kind: EventLowBattery}
+	leave := Event{Kind: EventLeave}
+
+	for _, tc := range []struct {
+		description string
+		when        string // Sydney time. 2025-09-06 is a Saturday.
+		channel     string
+		event       Event
+		want        bool
+	}{
+		{"battery in the evening", "2025-09-06 21:59:59", "ntfy", lowBattery, false},
+		{"battery at night", "2025-09-06 22:00:00", "ntfy", lowBattery, true},
+		{"battery after midnight", "2025-09-07 03:00:00", "ntfy", lowBattery, true},
+		{"battery in the morning", "2025-09-07 08:00:00", "ntfy", lowBattery, false},
+		{"zone alert at night", "2025-09-07 03:00:00", "ntfy", leave, false},
+		{"email on Sunday morning", "2025-09-07 09:00:00", "email", leave, true},
+		{"ntfy on Sunday morning", "2025-09-07 09:00:00", "ntfy", leave, false},
+		{"email on Saturday morning", "2025-09-06 09:00:00", "email", leave, false},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			when, err := time.ParseInLocation(time.DateTime, tc.when, sydney)
+			require.Nil(t, err)
+
+			// Asked in UTC, so the time zone has to be taken into account.
+			require.Equal(t, tc.want, schedule.IsQuiet(when.UTC(), tc.channel, tc.event))
+		})
+	}
+}
+
+func TestScheduleOvernightDays(t *testing.T) {
+	// GIVEN a period that starts on Friday nights only
+	schedule := Schedule{Location: time.UTC, Periods: []QuietPeriod{
+		{Days: []time.Weekday{time.Friday}, Start: 23 * time.Hour, End: 9 * time.Hour},
+	}}
+
+	// THEN it carries on into Saturday morning, but not Friday morning.
+	require.True(t, schedule.IsQuiet(time.Date(2025, 9, 6, 8, 0, 0, 0, time.UTC), "ntfy", Event{}))
+	require.False(t, schedule.IsQuiet(time.Date(2025, 9, 5, 8, 0, 0, 0, time.UTC), "ntfy", Event{}))
+}
+
+func TestQuietHoursSummarises(t *testing.T) {
+	// GIVEN ntfy and email, with battery alerts quiet on ntfy from 10 pm to 8 am
+	store := &memQueueStore{}
+	now := time.Date(2025, 9, 6, 23, 0, 0, 0, time.UTC)
+	quiet := NewQuietHours(Schedule{Location: time.UTC, Periods: []QuietPeriod{
+		{Start: 22 * time.Hour, End: 8 * time.Hour, Events: []string{EventLowBattery, EventCriticalBattery}, Channels: []string{"ntfy"}},
+	}}, store, func() time.Time { return now }, log.New(io.Discard, "", 0))
+	ntfy, email := &recordingNotifier{}, &recordingNotifier{}
+	ntfyChannel, emailChannel := quiet.Channel("ntfy", ntfy), quiet.Channel("email", email)
+	ctx := context.Background()
+
+	// WHEN two battery alerts come in overnight
+	low := Event{Kind: EventLowBattery, Severity: SeverityWarning, Title: "RUEGER's battery low", SerNo: 810095, Tag: "Rueger"}
+	critical := Event{Kind: EventCriticalBattery, Severity: SeverityCritical, Title: "RUEGER's battery critical", SerNo: 810095, Tag: "Rueger"}
+	for _, e := range []Event{low, critical} {
+		require.Nil(t, ntfyChannel.Notify(ctx, e))
+		require.Nil(t, emailChannel.Notify(ctx, e))
+		now = now.Add(2 * time.Hour)
+	}
+
+	// THEN email gets them, but ntfy doesn't yet.
+	require.Len(t, email.sent(), 2)
+	require.Empty(t, ntfy.sent())
+
+	err := quiet.SummariseDue(ctx)
+	require.Nil(t, err)
+	require.Empty(t, ntfy.sent())
+
+	// WHEN quiet hours are over
+	now = time.Date(2025, 9, 7, 8, 0, 0, 0, time.UTC)
+	err = quiet.SummariseDue(ctx)
+	require.Nil(t, err)
+
+	// THEN ntfy gets one summary, as bad as the worst of them, and nothing's
+	// left held back.
+	require.Equal(t, []Title{"2 notifications during quiet hours"}, ntfy.sent())
+	require.Empty(t, store.queued)
+
+	summary := quiet.summary([]QueuedNotification{
+		{Event: low, Queued: time.Date(2025, 9, 6, 23, 0, 0, 0, time.UTC)},
+		{Event: critical, Queued: time.Date(2025, 9, 7, 1, 0, 0, 0, time.UTC)},
+	})
+	require.Equal(t, Event{
+		Kind:     EventSummary,
+		Severity: SeverityCritical,
+		Title:    "2 notifications during quiet hours",
+		Message:  "Sat 23:00 RUEGER's battery low\nSun 01:00 RUEGER's battery critical",
+		SerNo:    810095,
+		Tag:      "Rueger",
+		Time:     now,
+	}, summary)
+}
+
+func TestQuietHoursSummaryFailureDoesntHoldUpOtherChannels(t *testing.T) {
+	// GIVEN ntfy and email both quiet overnight, each with one held back
+	store := &memQueueStore{}
+	now := time.Date(2025, 9, 6, 23, 0, 0, 0, time.UTC)
+	quiet := NewQuietHours(Schedule{Location: time.UTC, Periods: []QuietPeriod{
+		{Start: 22 * time.Hour, End: 8 * time.Hour},
+	}}, store, func() time.Time { return now }, log.New(io.Discard, "", 0))
+	ntfy, email := &recordingNotifier{err: errors.New("ntfy is down")}, &recordingNotifier{}
+	ctx := context.Background()
+
+	e := Event{Kind: EventNewBattery, Title: "New battery for RUEGER detected"}
+	require.Nil(t, quiet.Channel("ntfy", ntfy).Notify(ctx, e))
+	require.Nil(t, quiet.Channel("email", email).Notify(ctx, e))
+
+	// WHEN quiet hours are over, but ntfy fails to take it
+	now = now.Add(9 * time.Hour)
+	err := quiet.SummariseDue(ctx)
+
+	// THEN the error is returned, but email still gets its notification, and
+	// only ntfy's is left held back.
+	require.ErrorContains(t, err, "ntfy is down")
+	require.Equal(t, []Title{"New battery for RUEGER detected"}, email.sent())
+	require.Len(t, store.queued, 1)
+	require.Equal(t, "ntfy", store.queued[0].Channel)
+	require.Equal(t, QueueSuppressed, store.queued[0].Status)
+}
+
+func TestQuietHoursSendsLoneEventAsIs(t *testing.T) {
+	// GIVEN one event held back overnight
+	store := &memQueueStore{}
+	now := time.Date(2025, 9, 6, 23, 0, 0, 0, time.UTC)
+	quiet := NewQuietHours(Schedule{Location: time.UTC, Periods: []QuietPeriod{
+		{Start: 22 * time.Hour, End: 8 * time.Hour},
+	}}, store, func() time.Time { return now }, log.New(io.Discard, "", 0))
+	ntfy := &recordingNotifier{}
+	channel := quiet.Channel("ntfy", ntfy)
+
+	err := channel.Notify(context.Background(), Event{Kind: EventNewBattery, Title: "New battery for RUEGER detected"})
+	require.Nil(t, err)
+	require.Equal(t, QueueSuppressed, store.queued[0].Status)
+
+	// WHEN quiet hours are over
+	now = now.Add(9 * time.Hour)
+	err = quiet.SummariseDue(context.Background())
+	require.Nil(t, err)
+
+	// THEN it's sent as it was.
+	require.Equal(t, []Title{"New battery for RUEGER detected"}, ntfy.sent())
+}
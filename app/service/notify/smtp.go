@@ -0,0 +1,309 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// SMTP connection security.
+const (
+	SMTPStartTLS = "starttls" // Plain connection upgraded with STARTTLS (usually port 587)
+	SMTPTLS      = "tls"      // TLS from the start (usually port 465)
+	SMTPNone     = "none"     // No TLS at all. Only for local relays.
+)
+
+// SMTPConfig is how to send email, and who to.
+type SMTPConfig struct {
+	Host       string
+	Port       int
+	Security   string // SMTPStartTLS, SMTPTLS or SMTPNone
+	Username   string // No auth if empty
+	Password   string
+	From       string
+	To         []string
+	CurrentURL string      // The current locations map page, linked to in the body
+	TLSConfig  *tls.Config // nil verifies the server's certificate against Host
+}
+
+type SMTP struct {
+	cfg    SMTPConfig
+	now    func() time.Time
+	logger *log.Logger
+
+	// The bare addresses for MAIL FROM and RCPT TO. From and To can have
+	// names, which only go in the headers.
+	envelopeFrom string
+	envelopeTo   []string
+}
+
+// NewSMTPNotifier returns a notifier that emails each notification to all the
+// recipients, as plain text and HTML. Problems after the server has taken an
+// email are logged rather than returned, so it isn't sent again.
+func NewSMTPNotifier(cfg SMTPConfig, logger *log.Logger) Notifier {
+	if cfg.TLSConfig == nil {
+		cfg.TLSConfig = &tls.Config{ServerName: cfg.Host, MinVersion: tls.VersionTLS12}
+	}
+
+	s := SMTP{cfg: cfg, now: time.Now, logger: logger, envelopeFrom: envelopeAddress(cfg.From)}
+	for _, to := range cfg.To {
+		s.envelopeTo = append(s.envelopeTo, envelopeAddress(to))
+	}
+
+	return s
+}
+
+// envelopeAddress is the bare address in an address like "Dog Tags
+// <tags@example.com>". One that doesn't parse (the config checks they do) is
+// left for the server to judge.
+func envelopeAddress(addr string) string {
+	a, err := mail.ParseAddress(addr)
+	if err != nil {
+		return addr
+	}
+
+	return a.Address
+}
+
+// messageID makes a unique Message-ID, at the From address's domain (or the
+// server's, if From doesn't parse).
+func (s SMTP) messageID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("error making Message-ID: %w", err)
+	}
+
+	domain := s.cfg.Host
+	if addr, err := mail.ParseAddress(s.cfg.From); err == nil {
+		if _, d, ok := strings.Cut(addr.Address, "@"); ok {
+			domain = d
+		}
+	}
+
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">", nil
+}
+
+// emailData is what the email body templates use.
+type emailData struct {
+	Event      Event
+	When       string // The event's time, for people
+	CurrentURL string
+	AckURL     string // Empty if the event doesn't need acknowledging
+}
+
+var emailTextTemplate = template.Must(template.New("text").Parse(`{{.Event.Title}}
+
+{{if .Event.Tag}}Dog: {{.Event.Tag}}
+{{end}}{{.Event.Message}}
+{{if .Event.Zone}}Boundary: {{.Event.Zone}}
+{{end}}{{if .Event.BatteryVoltage}}Battery: {{printf "%.3f" .Event.BatteryVoltage}} V
+{{end}}{{if .Event.HasPosition}}Position: {{.Event.Latitude}}, {{.Event.Longitude}}
+Map: {{.Event.MapURL}}
+{{end}}{{if .When}}When: {{.When}}
+{{end}}{{if .AckURL}}
+Acknowledge: {{.AckURL}}
+{{end}}{{if .CurrentURL}}
+Where all the dogs are now: {{.CurrentURL}}
+{{end}}`))
+
+var emailHTMLTemplate = htmltemplate.Must(htmltemplate.New("html").Parse(`<!DOCTYPE html>
+<html>
+<body>
+<h2{{if eq .Event.Severity.String "critical"}} style="color: #b00000"{{end}}>{{.Event.Title}}</h2>
+{{if .Event.Tag}}<p>Dog: <b>{{.Event.Tag}}</b></p>
+{{end}}<p>{{.Event.Message}}</p>
+{{if .Event.Zone}}<p>Boundary: {{.Event.Zone}}</p>
+{{end}}{{if .Event.BatteryVoltage}}<p>Battery: {{printf "%.3f" .Event.BatteryVoltage}} V</p>
+{{end}}{{if .Event.HasPosition}}<p>Position: <a href="{{.Event.MapURL}}">{{.Event.Latitude}}, {{.Event.Longitude}}</a></p>
+{{end}}{{if .When}}<p>When: {{.When}}</p>
+{{end}}{{if .AckURL}}<p><a href="{{.AckURL}}"><b>Acknowledge</b></a></p>
+{{end}}{{if .CurrentURL}}<p><a href="{{.CurrentURL}}">Where all the dogs are now</a></p>
+{{end}}</body>
+</html>
+`))
+
+// message builds the whole email, headers and all.
+func (s SMTP) message(e Event) ([]byte, error) {
+	data := emailData{
+		Event:      e,
+		CurrentURL: s.cfg.CurrentURL,
+	}
+	if e.AckURL != "" {
+		data.AckURL = e.AckURL + "?by=email"
+	}
+	if !e.Time.IsZero() {
+		data.When = e.Time.Local().Format("Mon 2 Jan 2006 15:04:05")
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	for _, part := range []struct {
+		contentType string
+		execute     func(*bytes.Buffer) error
+	}{
+		{"text/plain; charset=utf-8", func(b *bytes.Buffer) error { return emailTextTemplate.Execute(b, data) }},
+		{"text/html; charset=utf-8", func(b *bytes.Buffer) error {
+			if e.HTML != "" {
+				_, err := b.WriteString(e.HTML)
+				return err
+			}
+			return emailHTMLTemplate.Execute(b, data)
+		}},
+	} {
+		var rendered bytes.Buffer
+		err := part.execute(&rendered)
+		if err != nil {
+			return nil, fmt.Errorf("error rendering email body: %w", err)
+		}
+
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(pw)
+		_, err = qp.Write(rendered.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		err = qp.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := mw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := s.messageID()
+	if err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	for _, h := range [][2]string{
+		{"From", s.cfg.From},
+		{"To", strings.Join(s.cfg.To, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", string(e.Title))},
+		{"Date", s.now().Format(time.RFC1123Z)},
+		{"Message-ID", id},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", `multipart/alternative; boundary="` + mw.Boundary() + `"`},
+	} {
+		fmt.Fprintf(&msg, "%s: %s\r\n", h[0], h[1])
+	}
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+
+	return msg.Bytes(), nil
+}
+
+// dial connects to the server, with TLS from the start if that's what it
+// wants.
+func (s SMTP) dial(ctx context.Context) (net.Conn, error) {
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+
+	if s.cfg.Security == SMTPTLS {
+		d := tls.Dialer{Config: s.cfg.TLSConfig}
+		return d.DialContext(ctx, "tcp", addr)
+	}
+
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", addr)
+}
+
+func (s SMTP) Notify(ctx context.Context, e Event) error {
+	msg, err := s.message(e)
+	if err != nil {
+		return err
+	}
+
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return fmt.Errorf("error connecting to SMTP server %s: %w", s.cfg.Host, err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline) //nolint:errcheck // the conversation fails anyway if it can't be set
+	}
+
+	c, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		return fmt.Errorf("error starting SMTP conversation with %s: %w", s.cfg.Host, err)
+	}
+	defer c.Close()
+
+	if s.cfg.Security == SMTPStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("SMTP server " + s.cfg.Host + " doesn't support STARTTLS")
+		}
+		err = c.StartTLS(s.cfg.TLSConfig)
+		if err != nil {
+			return fmt.Errorf("error starting TLS with %s: %w", s.cfg.Host, err)
+		}
+	}
+
+	if s.cfg.Username != "" {
+		err = c.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host))
+		if err != nil {
+			return fmt.Errorf("error authenticating with %s: %w", s.cfg.Host, err)
+		}
+	}
+
+	err = c.Mail(s.envelopeFrom)
+	if err != nil {
+		return fmt.Errorf("error sending MAIL FROM to %s: %w", s.cfg.Host, err)
+	}
+	for _, to := range s.envelopeTo {
+		err = c.Rcpt(to)
+		if err != nil {
+			return fmt.Errorf("error sending RCPT TO %s to %s: %w", to, s.cfg.Host, err)
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("error starting DATA with %s: %w", s.cfg.Host, err)
+	}
+	_, err = w.Write(msg)
+	if err != nil {
+		return fmt.Errorf("error sending email to %s: %w", s.cfg.Host, err)
+	}
+	err = w.Close()
+	if err != nil {
+		return fmt.Errorf("error sending email to %s: %w", s.cfg.Host, err)
+	}
+
+	// The server has the email now. If it won't say goodbye properly, that's
+	// not worth sending it again for.
+	err = c.Quit()
+	if err != nil {
+		s.logger.Printf("Email sent, but error quitting SMTP conversation with %s: %v", s.cfg.Host, err)
+	}
+
+	return nil
+}
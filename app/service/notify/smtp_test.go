@@ -0,0 +1,376 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type receivedMail struct {
+	from string
+	to   []string
+	auth string // Decoded AUTH PLAIN response
+	tls  bool   // Whether it came over TLS
+	data string
+}
+
+// fakeSMTPServer speaks just enough SMTP for net/smtp to send through it.
+type fakeSMTPServer struct {
+	listener      net.Listener
+	tlsConfig     *tls.Config
+	implicitTLS   bool
+	offerStartTLS bool
+	failQuit      bool // Drop the connection instead of answering QUIT
+
+	mu    sync.Mutex
+	mails []receivedMail
+}
+
+// testCertificate borrows httptest's certificate (good for 127.0.0.1), and
+// returns it with a pool that trusts it.
+func testCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+
+	return srv.TLS.Certificates[0], pool
+}
+
+func newFakeSMTPServer(t *testing.T, implicitTLS, offerStartTLS bool) (*fakeSMTPServer, SMTPConfig) {
+	t.Helper()
+
+	cert, pool := testCertificate(t)
+	s := &fakeSMTPServer{
+		tlsConfig:     &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12},
+		implicitTLS:   implicitTLS,
+		offerStartTLS: offerStartTLS,
+	}
+
+	var err error
+	if implicitTLS {
+		s.listener, err = tls.Listen("tcp", "127.0.0.1:0", s.tlsConfig)
+	} else {
+		s.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	require.Nil(t, err)
+	t.Cleanup(func() { s.listener.Close() })
+
+	go func() {
+		for {
+			conn, err := s.listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	cfg := SMTPConfig{
+		Host:      "127.0.0.1",
+		Port:      s.listener.Addr().(*net.TCPAddr).Port,
+		TLSConfig: &tls.Config{RootCAs: pool, ServerName: "127.0.0.1", MinVersion: tls.VersionTLS12},
+	}
+
+	return s, cfg
+}
+
+func (s *fakeSMTPServer) received() []receivedMail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.mails
+}
+
+func (s *fakeSMTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	isTLS := s.implicitTLS
+	tp := newTextConn(conn)
+	tp.reply("220 fake ESMTP")
+
+	var m receivedMail
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			tp.reply("250-fake")
+			if s.offerStartTLS && !isTLS {
+				tp.reply("250-STARTTLS")
+			}
+			tp.reply("250 AUTH PLAIN")
+		case "STARTTLS":
+			tp.reply("220 go ahead")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn, isTLS = tlsConn, true
+			tp = newTextConn(conn)
+		case "AUTH":
+			_, encoded, _ := strings.Cut(arg, " ")
+			decoded, _ := base64.StdEncoding.DecodeString(encoded)
+			m.auth = string(decoded)
+			tp.reply("235 ok")
+		case "MAIL":
+			m.from = strings.TrimPrefix(arg, "FROM:")
+			tp.reply("250 ok")
+		case "RCPT":
+			m.to = append(m.to, strings.TrimPrefix(arg, "TO:"))
+			tp.reply("250 ok")
+		case "DATA":
+			tp.reply("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			m.data, m.tls = string(data), isTLS
+			s.mu.Lock()
+			s.mails = append(s.mails, m)
+			s.mu.Unlock()
+			m = receivedMail{}
+			tp.reply("250 ok")
+		case "QUIT":
+			if s.failQuit {
+				return
+			}
+			tp.reply("221 bye")
+			return
+		default:
+			tp.reply("502 not implemented")
+		}
+	}
+}
+
+func TestSMTPStartTLS(t *testing.T) {
+	// GIVEN a server offering STARTTLS, and a notifier using it, with auth
+	server, cfg := newFakeSMTPServer(t, false, true)
+	cfg.Security = SMTPStartTLS
+	cfg.Username, cfg.Password = "dogs", "secret"
+	cfg.From = "tags@example.com"
+	cfg.To = []string{"a@example.com", "b@example.com"}
+	cfg.CurrentURL = "https://tags.example.com/current"
+	n := NewSMTPNotifier(cfg, log.New(io.Discard, "", 0))
+
+	// WHEN a zone notification is sent
+	err := n.Notify(context.Background(), Event{
+		Kind:        EventLeave,
+		Severity:    SeverityCritical,
+		Title:       "RUEGER is off the property",
+		Message:     "Last seen near the house",
+		Tag:         "Rueger",
+		HasPosition: true,
+		Latitude:    -31.5,
+		Longitude:   152.6,
+		Zone:        "Property outline",
+		Time:        time.Date(2025, 9, 1, 12, 0, 0, 0, time.Local),
+		AckURL:      "https://tags.example.com/ack/abc123",
+	})
+	require.Nil(t, err)
+
+	// THEN it's sent over TLS, authenticated, to everyone
+	mails := server.received()
+	require.Len(t, mails, 1)
+	require.True(t, mails[0].tls)
+	require.Equal(t, "\x00dogs\x00secret", mails[0].auth)
+	require.Equal(t, "<tags@example.com>", mails[0].from)
+	require.Equal(t, []string{"<a@example.com>", "<b@example.com>"}, mails[0].to)
+
+	// AND it has plain and HTML parts with the dog, zone text, position and
+	// links.
+	msg, err := mail.ReadMessage(strings.NewReader(mails[0].data))
+	require.Nil(t, err)
+	require.Equal(t, "RUEGER is off the property", msg.Header.Get("Subject"))
+	require.Equal(t, "a@example.com, b@example.com", msg.Header.Get("To"))
+	require.Regexp(t, `^<[0-9a-f]{32}@example\.com>$`, msg.Header.Get("Message-ID"))
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.Nil(t, err)
+	require.Equal(t, "multipart/alternative", mediaType)
+
+	parts := map[string]string{}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+		body, err := io.ReadAll(p)
+		require.Nil(t, err)
+		parts[p.Header.Get("Content-Type")] = string(body)
+	}
+	require.Len(t, parts, 2)
+
+	for _, body := range parts {
+		require.Contains(t, body, "Rueger")
+		require.Contains(t, body, "Last seen near the house")
+		require.Contains(t, body, "-31.5, 152.6")
+		require.Contains(t, body, "https://tags.example.com/current")
+		require.Contains(t, body, "https://www.google.com/maps/search/?api=1")
+		require.Contains(t, body, "Boundary: Property outline")
+		require.Contains(t, body, "Mon 1 Sep 2025 12:00:00")
+		require.Contains(t, body, "https://tags.example.com/ack/abc123?by=email")
+	}
+	require.Contains(t, parts["text/html; charset=utf-8"], `<a href="https://tags.example.com/current">`)
+}
+
+func TestSMTPImplicitTLS(t *testing.T) {
+	// GIVEN a server that's TLS from the start, without auth
+	server, cfg := newFakeSMTPServer(t, true, false)
+	cfg.Security = SMTPTLS
+	cfg.From = "tags@example.com"
+	cfg.To = []string{"a@example.com"}
+	n := NewSMTPNotifier(cfg, log.New(io.Discard, "", 0))
+
+	// WHEN a notification without details is sent
+	err := n.Notify(context.Background(), Event{Kind: EventTest, Title: "Test notification", Message: "This is a test notification."})
+	require.Nil(t, err)
+
+	// THEN it gets there.
+	mails := server.received()
+	require.Len(t, mails, 1)
+	require.True(t, mails[0].tls)
+	require.Empty(t, mails[0].auth)
+	require.Contains(t, mails[0].data, "This is a test notification.")
+}
+
+func TestSMTPAddressesWithNames(t *testing.T) {
+	// GIVEN From and To addresses with names
+	server, cfg := newFakeSMTPServer(t, true, false)
+	cfg.Security = SMTPTLS
+	cfg.From = "Dog Tags <tags@example.com>"
+	cfg.To = []string{`"Smith, Jo" <jo@example.com>`, "b@example.com"}
+	n := NewSMTPNotifier(cfg, log.New(io.Discard, "", 0))
+
+	// WHEN a notification is sent
+	err := n.Notify(context.Background(), Event{Title: "t", Message: "m"})
+	require.Nil(t, err)
+
+	// THEN the envelope has just the addresses
+	mails := server.received()
+	require.Len(t, mails, 1)
+	require.Equal(t, "<tags@example.com>", mails[0].from)
+	require.Equal(t, []string{"<jo@example.com>", "<b@example.com>"}, mails[0].to)
+
+	// AND the headers have the names.
+	msg, err := mail.ReadMessage(strings.NewReader(mails[0].data))
+	require.Nil(t, err)
+	from, err := msg.Header.AddressList("From")
+	require.Nil(t, err)
+	require.Equal(t, []*mail.Address{{Name: "Dog Tags", Address: "tags@example.com"}}, from)
+	to, err := msg.Header.AddressList("To")
+	require.Nil(t, err)
+	require.Equal(t, []*mail.Address{{Name: "Smith, Jo", Address: "jo@example.com"}, {Address: "b@example.com"}}, to)
+}
+
+func TestSMTPUsesEventHTML(t *testing.T) {
+	// GIVEN an event with its own HTML, e.g. a digest report
+	server, cfg := newFakeSMTPServer(t, true, false)
+	cfg.Security = SMTPTLS
+	cfg.From = "tags@example.com"
+	cfg.To = []string{"a@example.com"}
+	n := NewSMTPNotifier(cfg, log.New(io.Discard, "", 0))
+
+	// WHEN it's sent
+	err := n.Notify(context.Background(), Event{Kind: EventDigest, Title: "Rueger's day", Message: "Distance: 3.2 km", HTML: "<p>The <b>report</b></p>"})
+	require.Nil(t, err)
+
+	// THEN the HTML part is that, and the text part the message.
+	msg, err := mail.ReadMessage(strings.NewReader(server.received()[0].data))
+	require.Nil(t, err)
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.Nil(t, err)
+
+	parts := map[string]string{}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+		body, err := io.ReadAll(p)
+		require.Nil(t, err)
+		parts[p.Header.Get("Content-Type")] = string(body)
+	}
+	require.Equal(t, "<p>The <b>report</b></p>", parts["text/html; charset=utf-8"])
+	require.Contains(t, parts["text/plain; charset=utf-8"], "Distance: 3.2 km")
+}
+
+func TestSMTPQuitErrorAfterSending(t *testing.T) {
+	// GIVEN a server that takes the email, then hangs up on QUIT
+	server, cfg := newFakeSMTPServer(t, true, false)
+	server.failQuit = true
+	cfg.Security = SMTPTLS
+	cfg.From = "tags@example.com"
+	cfg.To = []string{"a@example.com"}
+	var logged bytes.Buffer
+	n := NewSMTPNotifier(cfg, log.New(&logged, "", 0))
+
+	// WHEN a notification is sent
+	err := n.Notify(context.Background(), Event{Title: "t", Message: "m"})
+
+	// THEN it's sent, so it's not an error (and won't be sent again), but the
+	// problem is logged.
+	require.Nil(t, err)
+	require.Len(t, server.received(), 1)
+	require.Contains(t, logged.String(), "error quitting SMTP conversation")
+}
+
+func TestSMTPErrors(t *testing.T) {
+	// A server that doesn't offer STARTTLS isn't sent to in the clear.
+	server, cfg := newFakeSMTPServer(t, false, false)
+	cfg.Security = SMTPStartTLS
+	cfg.From = "tags@example.com"
+	cfg.To = []string{"a@example.com"}
+
+	err := NewSMTPNotifier(cfg, log.New(io.Discard, "", 0)).Notify(context.Background(), Event{Title: "t", Message: "m"})
+	require.ErrorContains(t, err, "doesn't support STARTTLS")
+	require.Empty(t, server.received())
+
+	// A server that isn't there is an error, within the context's time.
+	cfg.Port = 1
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err = NewSMTPNotifier(cfg, log.New(io.Discard, "", 0)).Notify(ctx, Event{Title: "t", Message: "m"})
+	require.ErrorContains(t, err, "error connecting")
+}
+
+// textConn is a textproto.Conn with a reply helper for the fake server.
+type textConn struct {
+	*textproto.Conn
+}
+
+func newTextConn(conn net.Conn) textConn {
+	return textConn{textproto.NewConn(conn)}
+}
+
+func (c textConn) reply(line string) {
+	_ = c.PrintfLine("%s", line) //nolint:errcheck // the client notices
+}
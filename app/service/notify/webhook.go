@@ -0,0 +1,164 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+// SignatureHeader is the header a signed webhook's HMAC-SHA256 signature of
+// the body goes in, as "sha256=<hex>".
+const SignatureHeader = "X-Signature-256"
+
+// DefaultWebhookTemplate is the body sent when a webhook doesn't have its own
+// template.
+const DefaultWebhookTemplate = `{"title": {{json .Title}}, "message": {{json .Message}}, "event": {{json .Event}}, "severity": {{json .Severity}}, ` +
+	`"serNo": {{.SerNo}}, "tag": {{json .Tag}}, ` +
+	`"latitude": {{if .HasPosition}}{{.Latitude}}{{else}}null{{end}}, "longitude": {{if .HasPosition}}{{.Longitude}}{{else}}null{{end}}, ` +
+	`"zone": {{json .Zone}}, "batteryVoltage": {{if .BatteryVoltage}}{{.BatteryVoltage}}{{else}}null{{end}}, "time": {{json .Time}}, ` +
+	`"ackURL": {{if .AckURL}}{{json .AckURL}}{{else}}null{{end}}}`
+
+// WebhookData is what webhook body templates can use. It's the Event, with
+// things in the forms most useful in a payload.
+type WebhookData struct {
+	Title          string
+	Message        string
+	Event          string // The kind of event
+	Severity       string // info, warning or critical
+	SerNo          int
+	Tag            string
+	HasPosition    bool
+	Latitude       float64
+	Longitude      float64
+	MapURL         string
+	Zone           string
+	BatteryVoltage float64
+	Time           string // RFC 3339
+	AckURL         string // Empty if the event doesn't need acknowledging
+}
+
+// WebhookConfig is how to call a webhook.
+type WebhookConfig struct {
+	URL         string
+	ContentType string            // Defaults to application/json
+	Template    string            // Defaults to DefaultWebhookTemplate
+	Headers     map[string]string // Sent with every request
+	Secret      string            // If set, the body is signed with it
+}
+
+type Webhook struct {
+	url         string
+	contentType string
+	body        *template.Template
+	headers     map[string]string
+	secret      []byte
+	client      *http.Client
+}
+
+// webhookFuncs are the extra functions webhook templates can use. json makes
+// a value safe to put in a JSON payload. (urlquery, for form payloads, is
+// built in.)
+var webhookFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// NewWebhookNotifier returns a notifier that POSTs the rendered template to
+// a URL. The template is checked here, so mistakes show up at startup.
+func NewWebhookNotifier(cfg WebhookConfig) (Notifier, error) {
+	if cfg.ContentType == "" {
+		cfg.ContentType = "application/json"
+	}
+	if cfg.Template == "" {
+		cfg.Template = DefaultWebhookTemplate
+	}
+
+	body, err := template.New("webhook").Funcs(webhookFuncs).Option("missingkey=error").Parse(cfg.Template)
+	if err != nil {
+		return nil, fmt.Errorf("parsing webhook template for %s: %w", cfg.URL, err)
+	}
+
+	err = body.Execute(&bytes.Buffer{}, WebhookData{})
+	if err != nil {
+		return nil, fmt.Errorf("trying webhook template for %s: %w", cfg.URL, err)
+	}
+
+	return Webhook{
+		url:         cfg.URL,
+		contentType: cfg.ContentType,
+		body:        body,
+		headers:     cfg.Headers,
+		secret:      []byte(cfg.Secret),
+		client:      &http.Client{Timeout: 15 * time.Second},
+	}, nil
+}
+
+// Sign returns the signature of body with secret, as sent in SignatureHeader.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (wh Webhook) Notify(ctx context.Context, e Event) error {
+	var ackURL string
+	if e.AckURL != "" {
+		ackURL = e.AckURL + "?by=webhook"
+	}
+
+	var body bytes.Buffer
+	err := wh.body.Execute(&body, WebhookData{
+		Title:          string(e.Title),
+		Message:        string(e.Message),
+		Event:          e.Kind,
+		Severity:       e.Severity.String(),
+		SerNo:          e.SerNo,
+		Tag:            e.Tag,
+		HasPosition:    e.HasPosition,
+		Latitude:       e.Latitude,
+		Longitude:      e.Longitude,
+		MapURL:         e.MapURL(),
+		Zone:           e.Zone,
+		BatteryVoltage: e.BatteryVoltage,
+		Time:           e.Time.UTC().Format(time.RFC3339),
+		AckURL:         ackURL,
+	})
+	if err != nil {
+		return fmt.Errorf("error rendering webhook body for %s: %w", wh.url, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.url, bytes.NewReader(body.Bytes()))
+	if err != nil {
+		return fmt.Errorf("error while making http POST request to %s: %w", wh.url, err)
+	}
+
+	req.Header.Set("Content-Type", wh.contentType)
+	for k, v := range wh.headers {
+		req.Header.Set(k, v)
+	}
+	if len(wh.secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(wh.secret, body.Bytes()))
+	}
+
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error while sending request to %s: %w", wh.url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("error returned in response from %s: %d", wh.url, resp.StatusCode)
+	}
+
+	return nil
+}
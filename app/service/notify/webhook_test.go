@@ -0,0 +1,133 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// newWebhookServer records what it's sent, and replies with status.
+func newWebhookServer(t *testing.T, status int) (*httptest.Server, *[]receivedRequest) {
+	t.Helper()
+
+	var received []receivedRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.Nil(t, err)
+		received = append(received, receivedRequest{header: r.Header, body: body})
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &received
+}
+
+func newTestWebhook(t *testing.T, cfg WebhookConfig) Notifier {
+	t.Helper()
+
+	n, err := NewWebhookNotifier(cfg)
+	require.Nil(t, err)
+
+	return n
+}
+
+func TestWebhookDefaultTemplate(t *testing.T) {
+	// GIVEN a webhook with the default template, and a zone event
+	srv, received := newWebhookServer(t, http.StatusOK)
+	wh := newTestWebhook(t, WebhookConfig{URL: srv.URL})
+
+	// WHEN it's sent
+	err := wh.Notify(context.Background(), Event{
+		Kind:        EventLeave,
+		Severity:    SeverityCritical,
+		Title:       `RUEGER has left "the property"`,
+		Message:     "Last seen near the house",
+		SerNo:       810095,
+		Tag:         "Rueger",
+		HasPosition: true,
+		Latitude:    -31.5,
+		Longitude:   152.6,
+		Zone:        "the property",
+		Time:        time.Date(2025, 9, 1, 22, 0, 0, 0, time.FixedZone("AEST", 10*60*60)),
+		AckURL:      "https://tags.example.com/ack/abc123",
+	})
+	require.Nil(t, err)
+
+	// THEN the body is JSON with everything in it, quoting and all
+	require.Len(t, *received, 1)
+	require.Equal(t, "application/json", (*received)[0].header.Get("Content-Type"))
+
+	var got map[string]any
+	err = json.Unmarshal((*received)[0].body, &got)
+	require.Nil(t, err)
+	require.Equal(t, map[string]any{
+		"title":          `RUEGER has left "the property"`,
+		"message":        "Last seen near the house",
+		"event":          "leave",
+		"severity":       "critical",
+		"serNo":          810095.0,
+		"tag":            "Rueger",
+		"latitude":       -31.5,
+		"longitude":      152.6,
+		"zone":           "the property",
+		"batteryVoltage": nil,
+		"time":           "2025-09-01T12:00:00Z",
+		"ackURL":         "https://tags.example.com/ack/abc123?by=webhook",
+	}, got)
+
+	// AND it isn't signed.
+	require.Empty(t, (*received)[0].header.Get(SignatureHeader))
+}
+
+func TestWebhookFormTemplateHeadersAndSigning(t *testing.T) {
+	// GIVEN a webhook with a form template, custom headers and a secret
+	srv, received := newWebhookServer(t, http.StatusNoContent)
+	wh := newTestWebhook(t, WebhookConfig{
+		URL:         srv.URL,
+		ContentType: "application/x-www-form-urlencoded",
+		Template:    "text={{urlquery .Title}}&tag={{urlquery .Tag}}",
+		Headers:     map[string]string{"Authorization": "Bearer abc"},
+		Secret:      "shh",
+	})
+
+	// WHEN an event with just a title and message is sent
+	err := wh.Notify(context.Background(), Event{Title: "Test & title", Message: "msg"})
+	require.Nil(t, err)
+
+	// THEN the body is the rendered form
+	require.Len(t, *received, 1)
+	r := (*received)[0]
+	require.Equal(t, "text=Test+%26+title&tag=", string(r.body))
+	require.Equal(t, "application/x-www-form-urlencoded", r.header.Get("Content-Type"))
+	require.Equal(t, "Bearer abc", r.header.Get("Authorization"))
+
+	// AND it's signed.
+	require.Equal(t, Sign([]byte("shh"), r.body), r.header.Get(SignatureHeader))
+	require.Equal(t, "sha256=", r.header.Get(SignatureHeader)[:7])
+}
+
+func TestWebhookErrors(t *testing.T) {
+	// A template with a mistake is caught when the notifier is made.
+	_, err := NewWebhookNotifier(WebhookConfig{URL: "http://example.com", Template: "{{.Dog}}"})
+	require.ErrorContains(t, err, "trying webhook template")
+
+	_, err = NewWebhookNotifier(WebhookConfig{URL: "http://example.com", Template: "{{"})
+	require.ErrorContains(t, err, "parsing webhook template")
+
+	// A failure response is an error.
+	srv, _ := newWebhookServer(t, http.StatusInternalServerError)
+	wh := newTestWebhook(t, WebhookConfig{URL: srv.URL})
+	err = wh.Notify(context.Background(), Event{Title: "t", Message: "m"})
+	require.ErrorContains(t, err, "500")
+}
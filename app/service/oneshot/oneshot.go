@@ -1,5 +1,13 @@
 package oneshot
 
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+)
+
 type Config struct {
 	SetIf   bool
 	OnSet   func() error
@@ -7,20 +15,93 @@ type Config struct {
 	OnReset func() error
 }
 
+// State is where an event is at, and when it last changed.
+type State struct {
+	Set       bool
+	LastSet   time.Time
+	LastReset time.Time
+}
+
+// Store persists event states, so they survive restarts.
+type Store interface {
+	GetOneShotStates(context.Context) (map[string]State, error)
+	SaveOneShotState(context.Context, string, State) error
+}
+
 type OneShot struct {
-	storage map[string]bool
+	mu      *sync.Mutex // Guards storage and events, not the actions
+	storage map[string]State
+	events  map[string]*sync.Mutex // One per event, held while its actions run
+	store   Store                  // nil means state is only kept in memory
+	now     func() time.Time
 }
 
+// NewOneShot returns a OneShot that keeps its state in memory only.
 func NewOneShot() OneShot {
 	return OneShot{
-		storage: make(map[string]bool),
+		mu:      &sync.Mutex{},
+		storage: make(map[string]State),
+		events:  make(map[string]*sync.Mutex),
+		now:     time.Now,
 	}
 }
 
+// NewPersistentOneShot returns a OneShot that starts with the state in the
+// store, and saves every change back to it.
+func NewPersistentOneShot(ctx context.Context, store Store, now func() time.Time) (OneShot, error) {
+	states, err := store.GetOneShotStates(ctx)
+	if err != nil {
+		return OneShot{}, fmt.Errorf("loading one-shot states: %w", err)
+	}
+
+	if states == nil {
+		states = make(map[string]State)
+	}
+
+	return OneShot{
+		mu:      &sync.Mutex{},
+		storage: states,
+		events:  make(map[string]*sync.Mutex),
+		store:   store,
+		now:     now,
+	}, nil
+}
+
+// States returns a copy of every event's state.
+func (o OneShot) States() map[string]State {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return maps.Clone(o.storage)
+}
+
+// eventLock returns the lock for one event, so its actions (which are
+// usually network calls) only hold up the same event, not every other one.
+func (o OneShot) eventLock(event string) *sync.Mutex {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	l, ok := o.events[event]
+	if !ok {
+		l = &sync.Mutex{}
+		o.events[event] = l
+	}
+
+	return l
+}
+
 func (o OneShot) SetReset(event string, config Config) error {
+	l := o.eventLock(event)
+	l.Lock()
+	defer l.Unlock()
+
 	var err error
 
-	if !o.storage[event] && config.SetIf {
+	o.mu.Lock()
+	state := o.storage[event]
+	o.mu.Unlock()
+
+	if !state.Set && config.SetIf {
 		if config.OnSet != nil {
 			err = config.OnSet()
 		}
@@ -28,10 +109,15 @@ func (o OneShot) SetReset(event string, config Config) error {
 			return err
 		}
 
-		o.storage[event] = true
+		state.Set = true
+		state.LastSet = o.now()
+		err = o.save(event, state)
+		if err != nil {
+			return err
+		}
 	}
 
-	if o.storage[event] && config.ResetIf {
+	if state.Set && config.ResetIf {
 		if config.OnReset != nil {
 			err = config.OnReset()
 		}
@@ -39,7 +125,34 @@ func (o OneShot) SetReset(event string, config Config) error {
 			return err
 		}
 
-		o.storage[event] = false
+		state.Set = false
+		state.LastReset = o.now()
+		err = o.save(event, state)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// save updates the in-memory state, then the store's. The in-memory state
+// is updated even if the store fails, because the action has already run.
+func (o OneShot) save(event string, state State) error {
+	o.mu.Lock()
+	o.storage[event] = state
+	o.mu.Unlock()
+
+	if o.store == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := o.store.SaveOneShotState(ctx, event, state)
+	if err != nil {
+		return fmt.Errorf("saving state of %s: %w", event, err)
 	}
 
 	return nil
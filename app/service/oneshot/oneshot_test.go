@@ -3,6 +3,7 @@ package oneshot
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -316,3 +317,34 @@ func TestEventsDontInterfere(t *testing.T) {
 	require.Equal(t, 2, setActionCount)
 	require.Equal(t, 0, resetActionCount)
 }
+
+func TestSlowActionDoesntHoldUpOtherEvents(t *testing.T) {
+	// GIVEN an event whose action is stuck (e.g. a slow network)
+	uut := NewOneShot()
+	release := make(chan struct{})
+	defer close(release)
+	stuck := make(chan struct{})
+	go func() {
+		_ = uut.SetReset("slow", Config{SetIf: true, OnSet: func() error {
+			close(stuck)
+			<-release
+			return nil
+		}})
+	}()
+	<-stuck
+
+	// WHEN another event is set
+	done := make(chan error)
+	go func() {
+		done <- uut.SetReset("fast", Config{SetIf: true})
+	}()
+
+	// THEN it goes ahead, and the states can still be read.
+	select {
+	case err := <-done:
+		require.Nil(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("SetReset of another event waited for the slow action")
+	}
+	require.True(t, uut.States()["fast"].Set)
+}
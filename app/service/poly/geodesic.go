@@ -0,0 +1,133 @@
+package poly
+
+import "math"
+
+// Spherical geometry for lng/lat points (X is longitude, Y is latitude, in
+// degrees), from https://www.movable-type.co.uk/scripts/latlong.html. The
+// Earth isn't quite a sphere, but it's within 0.5%, which is plenty for
+// "how far is the dog from the fence".
+
+// EarthRadius is the mean radius of the Earth, in metres.
+const EarthRadius = 6371008.8
+
+func toRadians(deg float64) float64 { return deg * math.Pi / 180 }
+func toDegrees(rad float64) float64 { return rad * 180 / math.Pi }
+
+// angularDistance is the great circle distance between two points, in radians.
+func angularDistance(a, b Point) float64 {
+	lat1, lat2 := toRadians(a.Y), toRadians(b.Y)
+	dLat := lat2 - lat1
+	dLng := toRadians(b.X - a.X)
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+
+	return 2 * math.Atan2(math.Sqrt(h), math.Sqrt(1-h))
+}
+
+// bearingRadians is the initial bearing from a to b, in radians.
+func bearingRadians(a, b Point) float64 {
+	lat1, lat2 := toRadians(a.Y), toRadians(b.Y)
+	dLng := toRadians(b.X - a.X)
+
+	y := math.Sin(dLng) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(dLng)
+
+	return math.Atan2(y, x)
+}
+
+// Distance is the great circle distance between two lng/lat points, in
+// metres.
+func Distance(a, b Point) float64 {
+	return angularDistance(a, b) * EarthRadius
+}
+
+// Bearing is the initial bearing from one lng/lat point to another, in
+// degrees clockwise from north (0-360).
+func Bearing(from, to Point) float64 {
+	return math.Mod(toDegrees(bearingRadians(from, to))+360, 360)
+}
+
+// destination is the point the angular distance d (radians) from start, going
+// at the bearing (radians).
+func destination(start Point, bearing, d float64) Point {
+	lat1, lng1 := toRadians(start.Y), toRadians(start.X)
+
+	lat2 := math.Asin(math.Sin(lat1)*math.Cos(d) + math.Cos(lat1)*math.Sin(d)*math.Cos(bearing))
+	lng2 := lng1 + math.Atan2(math.Sin(bearing)*math.Sin(d)*math.Cos(lat1), math.Cos(d)-math.Sin(lat1)*math.Sin(lat2))
+
+	return Point{X: math.Mod(toDegrees(lng2)+540, 360) - 180, Y: toDegrees(lat2)}
+}
+
+// onEdgeTolerance is how close to an edge (metres) counts as on it.
+const onEdgeTolerance = 0.001
+
+// Nearest is the closest point on an edge to some point p.
+type Nearest struct {
+	Point    Point   // On the edge
+	Distance float64 // From p, in metres
+	Bearing  float64 // From p towards Point, in degrees clockwise from north. 0 if p is on the edge.
+}
+
+// nearestOnSegment finds the point on the great circle segment from a to b
+// closest to p.
+func nearestOnSegment(a, b, p Point) Point {
+	d12 := angularDistance(a, b)
+	if d12 == 0 {
+		return a
+	}
+
+	d13 := angularDistance(a, p)
+	bearing12 := bearingRadians(a, b)
+	bearing13 := bearingRadians(a, p)
+
+	// p is behind a
+	if math.Cos(bearing13-bearing12) <= 0 {
+		return a
+	}
+
+	// How far along the segment (from a) p is abeam.
+	crossTrack := math.Asin(math.Sin(d13) * math.Sin(bearing13-bearing12))
+	alongTrack := math.Acos(math.Max(-1, math.Min(1, math.Cos(d13)/math.Cos(crossTrack))))
+
+	// p is past b
+	if alongTrack >= d12 {
+		return b
+	}
+
+	return destination(a, bearing12, alongTrack)
+}
+
+// NearestOnRing finds the point on the edge of a lng/lat polygon nearest to
+// p, whether p is inside or outside it. The distance is +Inf for an empty
+// polygon.
+func NearestOnRing(ring []Point, p Point) Nearest {
+	best := Nearest{Distance: math.Inf(1)}
+
+	n := len(ring)
+	for i := range n {
+		a, b := ring[i], ring[(i+1)%n]
+		np := nearestOnSegment(a, b, p)
+
+		d := Distance(p, np)
+		if d < best.Distance {
+			best = Nearest{Point: np, Distance: d}
+		}
+	}
+
+	// On the edge (allowing for rounding), there's no bearing to speak of.
+	if best.Distance > onEdgeTolerance && !math.IsInf(best.Distance, 1) {
+		best.Bearing = Bearing(p, best.Point)
+	}
+
+	return best
+}
+
+// AngleBetween is the difference between two bearings, in degrees (0-180).
+func AngleBetween(a, b float64) float64 {
+	d := math.Mod(math.Abs(a-b), 360)
+	if d > 180 {
+		d = 360 - d
+	}
+
+	return d
+}
@@ -0,0 +1,108 @@
+package poly
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"testing/quick"
+
+	"github.com/stretchr/testify/require"
+)
+
+// metresPerDegree is the length of a degree along a great circle.
+const metresPerDegree = EarthRadius * math.Pi / 180
+
+func TestDistanceAndBearing(t *testing.T) {
+	require.InDelta(t, metresPerDegree, Distance(Point{X: 0, Y: 0}, Point{X: 0, Y: 1}), 0.001)
+	require.InDelta(t, metresPerDegree, Distance(Point{X: 0, Y: 0}, Point{X: 1, Y: 0}), 0.001)
+	// A degree of longitude is shorter away from the equator.
+	require.InDelta(t, metresPerDegree*math.Cos(toRadians(60)), Distance(Point{X: 0, Y: 60}, Point{X: 1, Y: 60}), 10)
+
+	require.InDelta(t, 0, Bearing(Point{X: 0, Y: 0}, Point{X: 0, Y: 1}), 1e-9)
+	require.InDelta(t, 90, Bearing(Point{X: 0, Y: 0}, Point{X: 1, Y: 0}), 1e-9)
+	require.InDelta(t, 180, Bearing(Point{X: 0, Y: 1}, Point{X: 0, Y: 0}), 1e-9)
+	require.InDelta(t, 270, Bearing(Point{X: 1, Y: 0}, Point{X: 0, Y: 0}), 1e-9)
+	// Across the antimeridian is east, not the long way round.
+	require.InDelta(t, 90, Bearing(Point{X: 179.5, Y: 0}, Point{X: -179.5, Y: 0}), 1e-9)
+}
+
+func TestNearestOnRing(t *testing.T) {
+	// A small square (about 111 m a side) on the equator.
+	square := []Point{{0, 0}, {0.001, 0}, {0.001, 0.001}, {0, 0.001}, {0, 0}}
+	side := 0.001 * metresPerDegree
+
+	for _, tc := range []struct {
+		description  string
+		p            Point
+		wantPoint    Point
+		wantDistance float64
+		wantBearing  float64
+	}{
+		{"inside, nearest the south edge", Point{0.0005, 0.0002}, Point{0.0005, 0}, 0.2 * side, 180},
+		{"inside, nearest the east edge", Point{0.0009, 0.0005}, Point{0.001, 0.0005}, 0.1 * side, 90},
+		{"outside, to the west", Point{-0.0005, 0.0005}, Point{0, 0.0005}, 0.5 * side, 90},
+		{"outside, past a corner", Point{0.002, 0.002}, Point{0.001, 0.001}, math.Sqrt2 * side, 225},
+		{"on an edge", Point{0.0005, 0.001}, Point{0.0005, 0.001}, 0, 0},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			got := NearestOnRing(square, tc.p)
+			require.InDelta(t, tc.wantPoint.X, got.Point.X, 1e-9)
+			require.InDelta(t, tc.wantPoint.Y, got.Point.Y, 1e-9)
+			require.InDelta(t, tc.wantDistance, got.Distance, 0.01)
+			require.InDelta(t, tc.wantBearing, got.Bearing, 0.01)
+		})
+	}
+
+	require.True(t, math.IsInf(NearestOnRing(nil, Point{}).Distance, 1))
+}
+
+func TestNearestOnRingAntimeridian(t *testing.T) {
+	edge := []Point{{179.999, 0}, {-179.999, 0}}
+
+	got := NearestOnRing(edge, Point{X: 180, Y: 0.001})
+	require.InDelta(t, 0.001*metresPerDegree, got.Distance, 0.01)
+	require.InDelta(t, 180, got.Bearing, 0.01)
+}
+
+func TestNearestOnRingIsNearest(t *testing.T) {
+	err := quick.Check(func(seed int64) bool {
+		r := rand.New(rand.NewSource(seed)) //nolint:gosec // test data
+
+		// A random paddock-sized polygon somewhere, and a point near it.
+		lng, lat := r.Float64()*360-180, r.Float64()*160-80
+		ring := make([]Point, 3+r.Intn(6))
+		for i := range ring {
+			ring[i] = Point{X: lng + r.Float64()*0.01, Y: lat + r.Float64()*0.01}
+		}
+		p := Point{X: lng - 0.005 + r.Float64()*0.02, Y: lat - 0.005 + r.Float64()*0.02}
+
+		got := NearestOnRing(ring, p)
+
+		// The distance is to the point found...
+		if math.Abs(got.Distance-Distance(p, got.Point)) > 1e-6 {
+			return false
+		}
+
+		// ...and nothing on the (great circle) edges is nearer.
+		for i, a := range ring {
+			b := ring[(i+1)%len(ring)]
+			for step := 0.0; step <= 1; step += 0.05 {
+				onEdge := destination(a, bearingRadians(a, b), step*angularDistance(a, b))
+				if Distance(p, onEdge) < got.Distance-0.01 {
+					t.Logf("ring %v, p %v: %v is nearer than %v", ring, p, onEdge, got)
+					return false
+				}
+			}
+		}
+
+		return true
+	}, quickConfig)
+	require.Nil(t, err)
+}
+
+func TestAngleBetween(t *testing.T) {
+	require.InDelta(t, 20, AngleBetween(350, 10), 1e-9)
+	require.InDelta(t, 20, AngleBetween(10, 350), 1e-9)
+	require.InDelta(t, 180, AngleBetween(90, 270), 1e-9)
+	require.InDelta(t, 0, AngleBetween(45, 405), 1e-9)
+}
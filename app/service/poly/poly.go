@@ -1,97 +1,145 @@
 package poly
 
-// from: https://www.geeksforgeeks.org/how-to-check-if-a-given-point-lies-inside-a-polygon/
+// Winding number point-in-polygon test, after Dan Sunday's "Inclusion of a
+// Point in a Polygon" (geomalgorithms.com). Unlike casting a ray and counting
+// intersections, it doesn't miscount when the point lines up with a vertex or
+// a horizontal edge.
 
+// Point is a planar point. In the lng/lat functions, X is longitude and Y is
+// latitude, in degrees.
 type Point struct {
 	X, Y float64
 }
 
-type line struct {
-	p1, p2 Point
+// location is where a point is relative to a polygon.
+type location int
+
+const (
+	outside location = iota
+	onBoundary
+	inside
+)
+
+// isLeft is > 0 if p is left of the line through a and b, < 0 if it's right,
+// and 0 if it's on the line.
+func isLeft(a, b, p Point) float64 {
+	return (b.X-a.X)*(p.Y-a.Y) - (p.X-a.X)*(b.Y-a.Y)
 }
 
-// onLine checks if a point is on a line.
-func onLine(l line, p Point) bool {
-	return p.X <= max(l.p1.X, l.p2.X) &&
-		p.X >= min(l.p1.X, l.p2.X) &&
-		p.Y <= max(l.p1.Y, l.p2.Y) &&
-		p.Y >= min(l.p1.Y, l.p2.Y)
+// isOnSegment says if p is on the segment from a to b.
+func isOnSegment(a, b, p Point) bool {
+	return isLeft(a, b, p) == 0 &&
+		p.X >= min(a.X, b.X) && p.X <= max(a.X, b.X) &&
+		p.Y >= min(a.Y, b.Y) && p.Y <= max(a.Y, b.Y)
 }
 
-// direction calculates the turn direction of the sequence of 3 points.
-func direction(a, b, c Point) int {
-	val := (b.Y-a.Y)*(c.X-b.X) - (b.X-a.X)*(c.Y-b.Y)
-	if val == 0 {
-		return 0 // Co-linear
-	} else if val < 0 {
-		return 2 // Anti-clockwise direction
+// locate finds where p is relative to the polygon. The polygon can be closed
+// (last point the same as the first) or not, and go either way round.
+func locate(poly []Point, p Point) location {
+	n := len(poly)
+	if n < 3 {
+		return outside // Not a polygon
 	}
-	return 1 // Clockwise direction
-}
 
-// isIntersect checks if two lines intersect.
-func isIntersect(l1, l2 line) bool {
-	dir1 := direction(l1.p1, l1.p2, l2.p1)
-	dir2 := direction(l1.p1, l1.p2, l2.p2)
-	dir3 := direction(l2.p1, l2.p2, l1.p1)
-	dir4 := direction(l2.p1, l2.p2, l1.p2)
+	winding := 0
+	for i := range n {
+		a, b := poly[i], poly[(i+1)%n]
+
+		if isOnSegment(a, b, p) {
+			return onBoundary
+		}
 
-	// When intersecting
-	if dir1 != dir2 && dir3 != dir4 {
-		return true
+		// Edges include their lower end and exclude their upper end, so a
+		// vertex level with p is only counted once.
+		if a.Y <= p.Y {
+			if b.Y > p.Y && isLeft(a, b, p) > 0 {
+				winding++ // Upward crossing, p is left of the edge
+			}
+		} else {
+			if b.Y <= p.Y && isLeft(a, b, p) < 0 {
+				winding-- // Downward crossing, p is right of the edge
+			}
+		}
 	}
 
-	if dir1 == 0 && onLine(l1, l2.p1) ||
-		dir2 == 0 && onLine(l1, l2.p2) ||
-		dir3 == 0 && onLine(l2, l1.p1) ||
-		dir4 == 0 && onLine(l2, l1.p2) {
-		return true
+	if winding != 0 {
+		return inside
 	}
 
-	return false
+	return outside
 }
 
-// isInside checks if a point is inside a polygon.
+// IsInside checks if a point is inside a polygon. Points on the edge count as
+// inside.
 func IsInside(poly []Point, p Point) bool {
-	n := len(poly)
-	if n < 3 {
-		return false // Not a polygon
-	}
+	return locate(poly, p) != outside
+}
 
-	// Create a point at infinity, y is same as point p
-	exline := line{p, Point{9999, p.Y}}
-	count := 0
-	i := 0
-	for {
-		// Forming a line/side from two consecutive points of poly
-		side := line{poly[i], poly[(i+1)%n]}
-		if isIntersect(side, exline) {
-			if direction(side.p1, p, side.p2) == 0 {
-				return onLine(side, p)
+// unwrap returns the polygon with longitudes shifted by multiples of 360 so
+// that no edge is more than 180 degrees long - an edge from 179 to -179 goes
+// the short way, across the antimeridian.
+func unwrap(poly []Point) []Point {
+	unwrapped := make([]Point, len(poly))
+	for i, p := range poly {
+		if i > 0 {
+			prev := unwrapped[i-1].X
+			for p.X-prev > 180 {
+				p.X -= 360
+			}
+			for p.X-prev < -180 {
+				p.X += 360
 			}
-			count++
-		}
-		i = (i + 1) % n
-		if i == 0 {
-			break
 		}
+		unwrapped[i] = p
 	}
 
-	// When count is odd
-	return count&1 != 0
+	return unwrapped
 }
 
-// Helper functions: max and min.
-func max(a, b float64) float64 { //nolint:all // I don't care that this overrides built-in max.
-	if a > b {
-		return a
+// locateLngLat is locate for lng/lat polygons that might cross the
+// antimeridian.
+func locateLngLat(poly []Point, p Point) location {
+	unwrapped := unwrap(poly)
+
+	best := outside
+	for _, shift := range []float64{0, -360, 360} {
+		loc := locate(unwrapped, Point{X: p.X + shift, Y: p.Y})
+		if loc > best {
+			best = loc
+		}
 	}
-	return b
+
+	return best
+}
+
+// IsInsideLngLat checks if a lng/lat point is inside a lng/lat polygon. Edges
+// are taken to be the shorter way round in longitude, so polygons can cross
+// the antimeridian. Edges are straight lines in lng/lat rather than great
+// circles, which for zones a few kilometres across is out by millimetres.
+// Polygons around a pole aren't supported.
+func IsInsideLngLat(poly []Point, p Point) bool {
+	return locateLngLat(poly, p) != outside
 }
 
-func min(a, b float64) float64 { //nolint:all // I don't care that this overrides built-in min.
-	if a < b {
-		return a
+// Polygon is a lng/lat polygon with holes cut out of it.
+type Polygon struct {
+	Outer []Point
+	Holes [][]Point
+}
+
+// Contains says if a lng/lat point is inside the polygon and not in any of
+// its holes. Points on the outer edge or on the edge of a hole count as
+// inside.
+func (pg Polygon) Contains(p Point) bool {
+	if locateLngLat(pg.Outer, p) == outside {
+		return false
+	}
+
+	for _, hole := range pg.Holes {
+		if locateLngLat(hole, p) == inside {
+			return false
+		}
 	}
-	return b
+
+	return true
 }
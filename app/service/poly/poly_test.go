@@ -0,0 +1,266 @@
+package poly
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+	"testing/quick"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsInside(t *testing.T) {
+	poly := []Point{{X: 0, Y: 0}, {X: 10, Y: 3}, {X: 10, Y: 10}, {X: 0, Y: 10}}
+
+	for _, tc := range []struct {
+		description string
+		p           Point
+		want        bool
+	}{
+		{"inside", Point{X: 5, Y: 5}, true},
+		{"outside", Point{X: 15, Y: 5}, false},
+		// The ray-casting version got this wrong: the ray went through the
+		// (10,3) vertex and was counted twice.
+		{"level with a vertex", Point{X: 8, Y: 3}, true},
+		{"level with a vertex, outside", Point{X: 12, Y: 3}, false},
+		{"level with a horizontal edge, outside", Point{X: -5, Y: 10}, false},
+		{"on a vertex", Point{X: 10, Y: 3}, true},
+		{"on an edge", Point{X: 5, Y: 10}, true},
+		{"on a sloping edge", Point{X: 5, Y: 1.5}, true},
+		{"past the end of an edge, in line with it", Point{X: 0, Y: 11}, false},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			require.Equal(t, tc.want, IsInside(poly, tc.p))
+		})
+	}
+
+	require.False(t, IsInside(poly[:2], Point{X: 5, Y: 1.5}), "not a polygon")
+}
+
+func TestIsInsideCollinearVertices(t *testing.T) {
+	// A square with extra vertices along its edges and a repeated closing
+	// vertex, like KML files have.
+	poly := []Point{{0, 0}, {5, 0}, {10, 0}, {10, 5}, {10, 10}, {5, 10}, {0, 10}, {0, 5}, {0, 0}}
+
+	require.True(t, IsInside(poly, Point{5, 5}))
+	require.True(t, IsInside(poly, Point{5, 0}))
+	require.False(t, IsInside(poly, Point{-5, 5}))
+	require.False(t, IsInside(poly, Point{15, 0}))
+}
+
+func TestIsInsideLngLat(t *testing.T) {
+	// Across the antimeridian, near Fiji.
+	poly := []Point{{X: 178, Y: -20}, {X: -178, Y: -20}, {X: -178, Y: -15}, {X: 178, Y: -15}}
+
+	require.True(t, IsInsideLngLat(poly, Point{X: 179, Y: -17}))
+	require.True(t, IsInsideLngLat(poly, Point{X: -179, Y: -17}))
+	require.True(t, IsInsideLngLat(poly, Point{X: 180, Y: -17}))
+	require.True(t, IsInsideLngLat(poly, Point{X: -180, Y: -17}))
+	require.False(t, IsInsideLngLat(poly, Point{X: 0, Y: -17}))
+	require.False(t, IsInsideLngLat(poly, Point{X: 177, Y: -17}))
+
+	// Planar, it's the long way round the world.
+	require.False(t, IsInside(poly, Point{X: 179, Y: -17}))
+	require.True(t, IsInside(poly, Point{X: 0, Y: -17}))
+}
+
+func TestPolygonContains(t *testing.T) {
+	pg := Polygon{
+		Outer: []Point{{0, 0}, {10, 0}, {10, 10}, {0, 10}},
+		Holes: [][]Point{{{4, 4}, {6, 4}, {6, 6}, {4, 6}}},
+	}
+
+	require.True(t, pg.Contains(Point{2, 2}))
+	require.True(t, pg.Contains(Point{0, 5}), "on the outer edge")
+	require.False(t, pg.Contains(Point{5, 5}), "in the hole")
+	require.True(t, pg.Contains(Point{4, 5}), "on the hole's edge")
+	require.False(t, pg.Contains(Point{11, 5}))
+}
+
+// monotone is an x-monotone polygon: for each of the increasing xs, the
+// boundary is at lower[i] below and upper[i] above. It's a simple polygon whose
+// inside is easy to work out independently of the winding number.
+type monotone struct {
+	xs, lower, upper []float64
+}
+
+// randomMonotone makes a random monotone polygon on an integer grid, so lots of
+// points line up with vertices and edges - the hard cases.
+func randomMonotone(r *rand.Rand) monotone {
+	n := 2 + r.Intn(8)
+
+	var m monotone
+	x := float64(r.Intn(5))
+	for range n {
+		m.xs = append(m.xs, x)
+		x += float64(1 + r.Intn(4))
+
+		lower := float64(r.Intn(10))
+		m.lower = append(m.lower, lower)
+		m.upper = append(m.upper, lower+float64(1+r.Intn(10)))
+	}
+
+	return m
+}
+
+// ring is the polygon's vertices: along the top left to right, then along the
+// bottom right to left.
+func (m monotone) ring() []Point {
+	var ring []Point
+	for i := range m.xs {
+		ring = append(ring, Point{m.xs[i], m.upper[i]})
+	}
+	for i := len(m.xs) - 1; i >= 0; i-- {
+		ring = append(ring, Point{m.xs[i], m.lower[i]})
+	}
+
+	return ring
+}
+
+// contains is the reference implementation: find the column p is in, and
+// check it's between the lower and upper edges there. Edges count as inside.
+// Coordinates are small halves, so the arithmetic is exact.
+func (m monotone) contains(p Point) bool {
+	last := len(m.xs) - 1
+	if p.X < m.xs[0] || p.X > m.xs[last] {
+		return false
+	}
+	if p.X == m.xs[last] {
+		return p.Y >= m.lower[last] && p.Y <= m.upper[last]
+	}
+
+	i := 0
+	for m.xs[i+1] <= p.X {
+		i++
+	}
+
+	// Is p on or above the lower edge, and on or below the upper edge?
+	dx := m.xs[i+1] - m.xs[i]
+	px := p.X - m.xs[i]
+	aboveLower := (p.Y-m.lower[i])*dx >= (m.lower[i+1]-m.lower[i])*px
+	belowUpper := (p.Y-m.upper[i])*dx <= (m.upper[i+1]-m.upper[i])*px
+
+	return aboveLower && belowUpper
+}
+
+// randomPoint is on the half grid, in or around the polygon.
+func randomPoint(r *rand.Rand, m monotone) Point {
+	return Point{
+		X: m.xs[0] - 2 + float64(r.Intn(int(2*(m.xs[len(m.xs)-1]-m.xs[0]+4)+1)))/2,
+		Y: float64(r.Intn(2*25)-4) / 2,
+	}
+}
+
+var quickConfig = &quick.Config{MaxCount: 2000, Rand: rand.New(rand.NewSource(1))} //nolint:gosec // repeatable, not secure
+
+func TestIsInsideMatchesReference(t *testing.T) {
+	err := quick.Check(func(seed int64) bool {
+		r := rand.New(rand.NewSource(seed)) //nolint:gosec // test data
+		m := randomMonotone(r)
+		ring := m.ring()
+
+		for range 50 {
+			p := randomPoint(r, m)
+			if IsInside(ring, p) != m.contains(p) {
+				t.Logf("polygon %v, point %v: got %v, want %v", ring, p, IsInside(ring, p), m.contains(p))
+				return false
+			}
+		}
+
+		return true
+	}, quickConfig)
+	require.Nil(t, err)
+}
+
+func TestIsInsideVerticesAndEdges(t *testing.T) {
+	err := quick.Check(func(seed int64) bool {
+		r := rand.New(rand.NewSource(seed)) //nolint:gosec // test data
+		ring := randomMonotone(r).ring()
+
+		for i, a := range ring {
+			b := ring[(i+1)%len(ring)]
+			mid := Point{(a.X + b.X) / 2, (a.Y + b.Y) / 2}
+			if !IsInside(ring, a) || !IsInside(ring, mid) {
+				t.Logf("polygon %v: vertex %v or midpoint %v not inside", ring, a, mid)
+				return false
+			}
+		}
+
+		return true
+	}, quickConfig)
+	require.Nil(t, err)
+}
+
+func TestIsInsideDoesntDependOnVertexOrder(t *testing.T) {
+	err := quick.Check(func(seed int64) bool {
+		r := rand.New(rand.NewSource(seed)) //nolint:gosec // test data
+		m := randomMonotone(r)
+		ring := m.ring()
+
+		// Starting somewhere else, going the other way round, closed, and
+		// turned on its side (swapping X and Y) all give the same answers.
+		start := r.Intn(len(ring))
+		rotated := append(slices.Clone(ring[start:]), ring[:start]...)
+		reversed := slices.Clone(ring)
+		slices.Reverse(reversed)
+		closed := append(slices.Clone(ring), ring[0])
+		transposed := make([]Point, len(ring))
+		for i, v := range ring {
+			transposed[i] = Point{v.Y, v.X}
+		}
+
+		for range 50 {
+			p := randomPoint(r, m)
+			want := IsInside(ring, p)
+			if IsInside(rotated, p) != want ||
+				IsInside(reversed, p) != want ||
+				IsInside(closed, p) != want ||
+				IsInside(transposed, Point{p.Y, p.X}) != want {
+				t.Logf("polygon %v, point %v: variants disagree", ring, p)
+				return false
+			}
+		}
+
+		return true
+	}, quickConfig)
+	require.Nil(t, err)
+}
+
+func TestIsInsideLngLatAnywhereOnEarth(t *testing.T) {
+	// wrap puts a longitude in [-180, 180).
+	wrap := func(lng float64) float64 {
+		for lng >= 180 {
+			lng -= 360
+		}
+		for lng < -180 {
+			lng += 360
+		}
+		return lng
+	}
+
+	err := quick.Check(func(seed int64) bool {
+		r := rand.New(rand.NewSource(seed)) //nolint:gosec // test data
+		m := randomMonotone(r)
+		ring := m.ring()
+
+		// Move the polygon to a random longitude, maybe across the
+		// antimeridian.
+		shift := float64(r.Intn(360) - 180)
+		moved := make([]Point, len(ring))
+		for i, v := range ring {
+			moved[i] = Point{wrap(v.X + shift), v.Y}
+		}
+
+		for range 50 {
+			p := randomPoint(r, m)
+			movedP := Point{wrap(p.X + shift), p.Y}
+			if IsInsideLngLat(moved, movedP) != m.contains(p) {
+				t.Logf("polygon %v, point %v: got %v, want %v", moved, movedP, IsInsideLngLat(moved, movedP), m.contains(p))
+				return false
+			}
+		}
+
+		return true
+	}, quickConfig)
+	require.Nil(t, err)
+}
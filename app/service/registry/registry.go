@@ -0,0 +1,201 @@
+// Package registry keeps the list of known tags, so the rest of the service can
+// turn serial numbers into dog names without going to the database every time.
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bitwombat/gps-tags/model"
+)
+
+// ErrUnknownTag is returned when changing a tag that isn't in the registry.
+var ErrUnknownTag = errors.New("unknown tag")
+
+// Storer is where the registry's tags are persisted.
+type Storer interface {
+	GetTags(context.Context) ([]model.Tag, error)
+	AddTag(context.Context, model.Tag) error
+	UpdateTag(context.Context, model.Tag) error
+	GetPendingTags(context.Context) ([]model.PendingTag, error)
+	UpsertPendingTag(context.Context, model.PendingTag) error
+	PromotePendingTag(context.Context, model.Tag) error
+}
+
+type Registry struct {
+	storer Storer
+	mu     sync.RWMutex
+	tags   map[int]model.Tag
+}
+
+func New(storer Storer) *Registry {
+	return &Registry{
+		storer: storer,
+		tags:   make(map[int]model.Tag),
+	}
+}
+
+// Load (re)reads all tags from storage.
+func (r *Registry) Load(ctx context.Context) error {
+	tags, err := r.storer.GetTags(ctx)
+	if err != nil {
+		return fmt.Errorf("loading tags: %w", err)
+	}
+
+	m := make(map[int]model.Tag, len(tags))
+	for _, t := range tags {
+		m[t.SerNo] = t
+	}
+
+	r.mu.Lock()
+	r.tags = m
+	r.mu.Unlock()
+
+	return nil
+}
+
+// Lookup returns the tag with the serial number, whether it's retired or not.
+func (r *Registry) Lookup(serNo int) (model.Tag, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	t, ok := r.tags[serNo]
+
+	return t, ok
+}
+
+// Name returns the display name of the tag, or "" if it's unknown.
+func (r *Registry) Name(serNo int) string {
+	t, _ := r.Lookup(serNo)
+
+	return t.Name
+}
+
+// UpperName is Name, shouted. Used in notifications.
+func (r *Registry) UpperName(serNo int) string {
+	return strings.ToUpper(r.Name(serNo))
+}
+
+// All returns every tag, ordered by serial number.
+func (r *Registry) All() []model.Tag {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tags := make([]model.Tag, 0, len(r.tags))
+	for _, t := range r.tags {
+		tags = append(tags, t)
+	}
+
+	slices.SortFunc(tags, func(a, b model.Tag) int { return a.SerNo - b.SerNo })
+
+	return tags
+}
+
+// Active returns the tags that haven't been retired, ordered by serial number.
+func (r *Registry) Active() []model.Tag {
+	return slices.DeleteFunc(r.All(), func(t model.Tag) bool { return !t.Active })
+}
+
+// Add stores a new, active tag. The icon defaults to the first letter of the
+// name.
+func (r *Registry) Add(ctx context.Context, t model.Tag) error {
+	if t.Name == "" {
+		return fmt.Errorf("tag %d needs a name", t.SerNo)
+	}
+
+	if t.Icon == "" {
+		t.Icon = defaultIcon(t.Name)
+	}
+	t.Active = true
+
+	err := r.storer.AddTag(ctx, t)
+	if err != nil {
+		return err
+	}
+
+	return r.Load(ctx)
+}
+
+// Update replaces the stored details of an existing tag.
+func (r *Registry) Update(ctx context.Context, t model.Tag) error {
+	if t.Name == "" {
+		return fmt.Errorf("tag %d needs a name", t.SerNo)
+	}
+
+	if _, ok := r.Lookup(t.SerNo); !ok {
+		return fmt.Errorf("%w: %d", ErrUnknownTag, t.SerNo)
+	}
+
+	err := r.storer.UpdateTag(ctx, t)
+	if err != nil {
+		return err
+	}
+
+	return r.Load(ctx)
+}
+
+// Rename changes a tag's display name.
+func (r *Registry) Rename(ctx context.Context, serNo int, name string) error {
+	t, ok := r.Lookup(serNo)
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrUnknownTag, serNo)
+	}
+
+	t.Name = name
+
+	return r.Update(ctx, t)
+}
+
+// Retire takes a tag off the maps. Its history stays in the database.
+func (r *Registry) Retire(ctx context.Context, serNo int) error {
+	t, ok := r.Lookup(serNo)
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrUnknownTag, serNo)
+	}
+
+	t.Active = false
+
+	return r.Update(ctx, t)
+}
+
+// RecordPending notes an upload from a tag that isn't in the registry, so it
+// can be named later.
+func (r *Registry) RecordPending(ctx context.Context, p model.PendingTag) error {
+	return r.storer.UpsertPendingTag(ctx, p)
+}
+
+// Pending returns the tags that have uploaded but haven't been named yet.
+func (r *Registry) Pending(ctx context.Context) ([]model.PendingTag, error) {
+	return r.storer.GetPendingTags(ctx)
+}
+
+// Promote turns a pending tag into an active, named one.
+func (r *Registry) Promote(ctx context.Context, t model.Tag) error {
+	if t.Name == "" {
+		return fmt.Errorf("tag %d needs a name", t.SerNo)
+	}
+
+	if t.Icon == "" {
+		t.Icon = defaultIcon(t.Name)
+	}
+	t.Active = true
+
+	err := r.storer.PromotePendingTag(ctx, t)
+	if err != nil {
+		return err
+	}
+
+	return r.Load(ctx)
+}
+
+// defaultIcon is the first letter of a tag's name, capitalised.
+func defaultIcon(name string) string {
+	r, _ := utf8.DecodeRuneInString(name)
+	return string(unicode.ToUpper(r))
+}
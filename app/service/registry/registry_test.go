@@ -0,0 +1,160 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bitwombat/gps-tags/model"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStorer struct {
+	tags    map[int]model.Tag
+	pending map[int]model.PendingTag
+}
+
+func (s *fakeStorer) GetTags(_ context.Context) ([]model.Tag, error) {
+	var tags []model.Tag
+	for _, t := range s.tags {
+		tags = append(tags, t)
+	}
+	return tags, nil
+}
+
+func (s *fakeStorer) AddTag(_ context.Context, t model.Tag) error {
+	s.tags[t.SerNo] = t
+	return nil
+}
+
+func (s *fakeStorer) UpdateTag(_ context.Context, t model.Tag) error {
+	s.tags[t.SerNo] = t
+	return nil
+}
+
+func (s *fakeStorer) GetPendingTags(_ context.Context) ([]model.PendingTag, error) {
+	var pending []model.PendingTag
+	for _, p := range s.pending {
+		pending = append(pending, p)
+	}
+	return pending, nil
+}
+
+func (s *fakeStorer) UpsertPendingTag(_ context.Context, p model.PendingTag) error {
+	s.pending[p.SerNo] = p
+	return nil
+}
+
+func (s *fakeStorer) PromotePendingTag(_ context.Context, t model.Tag) error {
+	if _, ok := s.pending[t.SerNo]; !ok {
+		return errors.New("not pending")
+	}
+	delete(s.pending, t.SerNo)
+	s.tags[t.SerNo] = t
+	return nil
+}
+
+func TestRegistry(t *testing.T) {
+	ctx := context.Background()
+	storer := &fakeStorer{tags: map[int]model.Tag{
+		810243: {SerNo: 810243, Name: "Charlie", Active: true},
+		810095: {SerNo: 810095, Name: "Rueger", Active: true},
+	}, pending: map[int]model.PendingTag{}}
+
+	r := New(storer)
+	require.Nil(t, r.Load(ctx))
+
+	require.Equal(t, "Rueger", r.Name(810095))
+	require.Equal(t, "RUEGER", r.UpperName(810095))
+	require.Equal(t, "", r.Name(1))
+
+	t.Run("add defaults the icon and makes the tag active", func(t *testing.T) {
+		err := r.Add(ctx, model.Tag{SerNo: 810300, Name: "tucker"})
+		require.Nil(t, err)
+
+		tag, ok := r.Lookup(810300)
+		require.True(t, ok)
+		require.Equal(t, "T", tag.Icon)
+		require.True(t, tag.Active)
+		require.Equal(t, tag, storer.tags[810300])
+	})
+
+	t.Run("the default icon is a whole letter", func(t *testing.T) {
+		err := r.Add(ctx, model.Tag{SerNo: 810302, Name: "émile"})
+		require.Nil(t, err)
+
+		tag, _ := r.Lookup(810302)
+		require.Equal(t, "É", tag.Icon)
+	})
+
+	t.Run("add needs a name", func(t *testing.T) {
+		err := r.Add(ctx, model.Tag{SerNo: 810301})
+		require.NotNil(t, err)
+	})
+
+	t.Run("rename", func(t *testing.T) {
+		err := r.Rename(ctx, 810300, "Tucker")
+		require.Nil(t, err)
+		require.Equal(t, "Tucker", r.Name(810300))
+	})
+
+	t.Run("retired tags are known but not active", func(t *testing.T) {
+		err := r.Retire(ctx, 810243)
+		require.Nil(t, err)
+
+		require.Equal(t, "Charlie", r.Name(810243))
+
+		var active []int
+		for _, tag := range r.Active() {
+			active = append(active, tag.SerNo)
+		}
+		require.Equal(t, []int{810095, 810300, 810302}, active)
+		require.Len(t, r.All(), 4)
+	})
+
+	t.Run("pending tags can be promoted", func(t *testing.T) {
+		err := r.RecordPending(ctx, model.PendingTag{SerNo: 810400, IMEI: "1234"})
+		require.Nil(t, err)
+
+		_, ok := r.Lookup(810400)
+		require.False(t, ok, "pending tags aren't known tags")
+
+		err = r.Promote(ctx, model.Tag{SerNo: 810400, Name: "Blue"})
+		require.Nil(t, err)
+
+		tag, ok := r.Lookup(810400)
+		require.True(t, ok)
+		require.True(t, tag.Active)
+		require.Equal(t, "B", tag.Icon)
+
+		pending, err := r.Pending(ctx)
+		require.Nil(t, err)
+		require.Empty(t, pending)
+	})
+
+	t.Run("changing an unknown tag", func(t *testing.T) {
+		err := r.Retire(ctx, 1)
+		require.ErrorIs(t, err, ErrUnknownTag)
+	})
+}
+
+func TestRegistryLoadSeesOtherWriters(t *testing.T) {
+	// GIVEN the service's registry, and the CLI's on the same database
+	ctx := context.Background()
+	storer := &fakeStorer{tags: map[int]model.Tag{
+		810095: {SerNo: 810095, Name: "Rueger", Active: true},
+	}, pending: map[int]model.PendingTag{}}
+	service, cli := New(storer), New(storer)
+	require.Nil(t, service.Load(ctx))
+	require.Nil(t, cli.Load(ctx))
+
+	// WHEN the CLI adds and retires tags
+	require.Nil(t, cli.Add(ctx, model.Tag{SerNo: 810300, Name: "Tucker"}))
+	require.Nil(t, cli.Retire(ctx, 810095))
+
+	// THEN the service sees them once it loads again.
+	require.Equal(t, "", service.Name(810300))
+	require.Nil(t, service.Load(ctx))
+	require.Equal(t, "Tucker", service.Name(810300))
+	require.Equal(t, []model.Tag{storer.tags[810300]}, service.Active())
+}
@@ -6,8 +6,10 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/bitwombat/gps-tags/migrations"
 	"github.com/bitwombat/gps-tags/model"
 	"github.com/google/uuid"
+	"maragu.dev/migrate"
 	_ "modernc.org/sqlite" // library code isn't used directly
 )
 
@@ -71,71 +73,149 @@ func NewSQLiteStorer(dataSourceName string) (SqliteStorer, error) {
 	return ss, nil
 }
 
-func (s SqliteStorer) WriteTx(ctx context.Context, tx model.TagTx) (string, error) {
-	txID := uuid.NewString() // Not unmarshalling $oid for no real reason. Zero trust that it's unique this way.
+// Migrate brings the database schema up to date.
+func (s SqliteStorer) Migrate(ctx context.Context) error {
+	err := migrate.Up(ctx, s.db, migrations.FS)
+	if err != nil {
+		return fmt.Errorf("migrating database: %w", err)
+	}
+
+	return nil
+}
 
-	_, err := s.db.ExecContext(ctx, "INSERT INTO tx (ID, ProdID, Fw, SerNo, IMEI, ICCID) VALUES (?, ?, ?, ?, ?, ?);", txID, tx.ProdID, tx.Fw, tx.SerNo, tx.IMEI, tx.ICCID)
+// WriteTx stores a transmission and all its readings in one database
+// transaction, so it's either all written or not at all. Records already
+// stored (same SerNo, SeqNo and DeviceUTC, as happens when the device retries
+// an upload) are skipped. If every record is a duplicate, nothing is written
+// and the result's TxID is empty.
+func (s SqliteStorer) WriteTx(ctx context.Context, tx model.TagTx) (WriteResult, error) {
+	dbTx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return "", err
+		return WriteResult{}, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer dbTx.Rollback() //nolint:errcheck // no-op after commit
+
+	var result WriteResult
+
+	// A record can be repeated within one upload, as well as across uploads.
+	type recordKey struct {
+		seqNo     int
+		deviceUTC int64
 	}
+	seen := make(map[recordKey]bool)
 
+	var newRecords []model.Record
 	for _, r := range tx.Records {
-		rID, err := insertRecord(ctx, r, s.db, txID)
+		key := recordKey{r.SeqNo, r.DateUTC.T.UnixNano()}
+		if seen[key] {
+			result.Duplicates++
+			continue
+		}
+		seen[key] = true
+
+		dup, err := isDuplicateRecord(ctx, dbTx, tx.SerNo, r)
 		if err != nil {
-			return "", err
+			return WriteResult{}, err
+		}
+		if dup {
+			result.Duplicates++
+			continue
+		}
+		newRecords = append(newRecords, r)
+	}
+
+	if len(newRecords) == 0 {
+		return result, nil
+	}
+
+	txID := uuid.NewString() // Not unmarshalling $oid for no real reason. Zero trust that it's unique this way.
+
+	_, err = dbTx.ExecContext(ctx, "INSERT INTO tx (ID, ProdID, Fw, SerNo, IMEI, ICCID) VALUES (?, ?, ?, ?, ?, ?);", txID, tx.ProdID, tx.Fw, tx.SerNo, tx.IMEI, tx.ICCID)
+	if err != nil {
+		return WriteResult{}, err
+	}
+
+	for _, r := range newRecords {
+		rID, err := insertRecord(ctx, r, dbTx, txID)
+		if err != nil {
+			return WriteResult{}, err
 		}
 		if r.GPSReading != nil {
-			err := insertGPSReading(ctx, *r.GPSReading, s.db, rID)
+			err := insertGPSReading(ctx, *r.GPSReading, dbTx, rID)
 			if err != nil {
-				return "", err
+				return WriteResult{}, err
 			}
 		}
 		if r.GPIOReading != nil {
-			err := insertGPIOReading(ctx, *r.GPIOReading, s.db, rID)
+			err := insertGPIOReading(ctx, *r.GPIOReading, dbTx, rID)
 			if err != nil {
-				return "", err
+				return WriteResult{}, err
 			}
 		}
 		if r.AnalogueReading != nil {
-			err := insertAnalogueReading(ctx, *r.AnalogueReading, s.db, rID)
+			err := insertAnalogueReading(ctx, *r.AnalogueReading, dbTx, rID)
 			if err != nil {
-				return "", err
+				return WriteResult{}, err
 			}
 		}
 		if r.TripTypeReading != nil {
-			err := insertTripTypeReading(ctx, *r.TripTypeReading, s.db, rID)
+			err := insertTripTypeReading(ctx, *r.TripTypeReading, dbTx, rID)
 			if err != nil {
-				return "", err
+				return WriteResult{}, err
 			}
 		}
 	}
-	return txID, nil
+
+	err = dbTx.Commit()
+	if err != nil {
+		return WriteResult{}, fmt.Errorf("error committing transmission: %w", err)
+	}
+
+	result.TxID = txID
+	result.New = len(newRecords)
+
+	return result, nil
 }
 
-func insertRecord(ctx context.Context, r model.Record, db *sql.DB, txID string) (string, error) {
+func isDuplicateRecord(ctx context.Context, dbTx *sql.Tx, serNo int, r model.Record) (bool, error) {
+	var exists bool
+	err := dbTx.QueryRowContext(ctx, `
+SELECT EXISTS (
+    SELECT 1 FROM record
+    JOIN tx ON tx.ID = record.TxID
+    WHERE tx.SerNo = ? AND record.SeqNo = ? AND record.DeviceUTC = ?
+);`, serNo, r.SeqNo, r.DateUTC).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("error checking for duplicate record %d: %w", r.SeqNo, err)
+	}
+
+	return exists, nil
+}
+
+func insertRecord(ctx context.Context, r model.Record, dbTx *sql.Tx, txID string) (string, error) {
 	rID := uuid.NewString()
-	_, err := db.ExecContext(ctx, `INSERT INTO record (ID, TxID, DeviceUTC, SeqNo, Reason) VALUES (?, ?, ?, ?, ?);`, rID, txID, r.DateUTC, r.SeqNo, r.Reason)
+	_, err := dbTx.ExecContext(ctx, `INSERT INTO record (ID, TxID, DeviceUTC, SeqNo, Reason) VALUES (?, ?, ?, ?, ?);`, rID, txID, r.DateUTC, r.SeqNo, r.Reason)
 
 	return rID, err
 }
 
-func insertGPSReading(ctx context.Context, g model.GPSReading, db *sql.DB, recordID string) error {
-	_, err := db.ExecContext(ctx, `INSERT INTO gpsReading (RecordID, Spd, SpdAcc, Head, GpsStat, GpsUTC, Lat, Lng, Alt, PosAcc, PDOP) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`, recordID, g.Spd, g.SpdAcc, g.Head, g.GpsStat, g.GpsUTC, g.Lat, g.Long, g.Alt, g.PosAcc, g.PDOP)
+func insertGPSReading(ctx context.Context, g model.GPSReading, dbTx *sql.Tx, recordID string) error {
+	_, err := dbTx.ExecContext(ctx, `INSERT INTO gpsReading (RecordID, Spd, SpdAcc, Head, GpsStat, GpsUTC, Lat, Lng, Alt, PosAcc, PDOP) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`, recordID, g.Spd, g.SpdAcc, g.Head, g.GpsStat, g.GpsUTC, g.Lat, g.Long, g.Alt, g.PosAcc, g.PDOP)
 	return err
 }
 
-func insertGPIOReading(ctx context.Context, g model.GPIOReading, db *sql.DB, recordID string) error {
-	_, err := db.ExecContext(ctx, `INSERT INTO gpioReading (RecordID, DIn, DOut, DevStat) VALUES (?, ?, ?, ?);`, recordID, g.DIn, g.DOut, g.DevStat)
+func insertGPIOReading(ctx context.Context, g model.GPIOReading, dbTx *sql.Tx, recordID string) error {
+	_, err := dbTx.ExecContext(ctx, `INSERT INTO gpioReading (RecordID, DIn, DOut, DevStat) VALUES (?, ?, ?, ?);`, recordID, g.DIn, g.DOut, g.DevStat)
 	return err
 }
 
-func insertAnalogueReading(ctx context.Context, a model.AnalogueReading, db *sql.DB, recordID string) error {
-	_, err := db.ExecContext(ctx, `INSERT INTO analogueReading (RecordID, InternalBatteryVoltage, Temperature, LastGSMCQ, LoadedVoltage) VALUES (?, ?, ?, ?, ?);`, recordID, a.InternalBatteryVoltage, a.Temperature, a.LastGSMCQ, a.LoadedVoltage)
+func insertAnalogueReading(ctx context.Context, a model.AnalogueReading, dbTx *sql.Tx, recordID string) error {
+	_, err := dbTx.ExecContext(ctx, `INSERT INTO analogueReading (RecordID, InternalBatteryVoltage, Temperature, LastGSMCQ, LoadedVoltage) VALUES (?, ?, ?, ?, ?);`, recordID, a.InternalBatteryVoltage, a.Temperature, a.LastGSMCQ, a.LoadedVoltage)
 	return err
 }
 
-func insertTripTypeReading(ctx context.Context, t model.TripTypeReading, db *sql.DB, recordID string) error {
-	_, err := db.ExecContext(ctx, `INSERT INTO tripTypeReading (RecordID, Tt, Trim) VALUES (?, ?, ?);`, recordID, t.Tt, t.Trim)
+func insertTripTypeReading(ctx context.Context, t model.TripTypeReading, dbTx *sql.Tx, recordID string) error {
+	_, err := dbTx.ExecContext(ctx, `INSERT INTO tripTypeReading (RecordID, Tt, Trim) VALUES (?, ?, ?);`, recordID, t.Tt, t.Trim)
 	return err
 }
 
@@ -214,8 +294,7 @@ FROM
 WHERE
     rn = 1
 ORDER BY
-    DeviceUTC DESC
-LIMIT 5;
+    DeviceUTC DESC;
 `
 
 	ss := make(Statuses)
@@ -275,69 +354,3 @@ LIMIT 5;
 
 	return ss, nil
 }
-
-func (s SqliteStorer) GetLastNCoords(ctx context.Context, n int) (Coords, error) {
-	type pointRecordDAO struct {
-		SerNo     sql.NullInt32
-		SeqNo     sql.NullInt32
-		Latitude  sql.NullFloat64
-		Longitude sql.NullFloat64
-	}
-
-	query := `
-SELECT SerNo, SeqNo, Lat, Lng
-FROM (
-SELECT tx.SerNo,
-           record.SeqNo,
-           gpsReading.Lat,
-           gpsReading.Lng,
-           ROW_NUMBER() OVER (PARTITION BY tx.SerNo, gpsUTC ORDER BY record.SeqNo DESC) as rn,
-           DENSE_RANK() OVER (PARTITION BY tx.SerNo ORDER BY gpsUTC DESC) as time_rank
-    FROM tx
-    JOIN record ON record.TxID = tx.ID
-    JOIN gpsReading ON gpsReading.RecordID = record.ID
-    WHERE gpsReading.GpsStat & 4 = 0
-)
-WHERE rn = 1 AND time_rank <= ?;
-;
-`
-
-	rows, err := s.db.QueryContext(ctx, query, n)
-	if err != nil {
-		return Coords{}, fmt.Errorf("error querying database for last N coordinates: %w", err)
-	}
-	defer rows.Close()
-
-	ppr := make(Coords)
-
-	for rows.Next() {
-		var prDAO pointRecordDAO
-		err := rows.Scan(
-			&prDAO.SerNo,
-			&prDAO.SeqNo,
-			&prDAO.Latitude,
-			&prDAO.Longitude,
-		)
-		if err != nil {
-			return Coords{}, fmt.Errorf("error scanning row: %w", err)
-		}
-		if !prDAO.SeqNo.Valid {
-			return Coords{}, errors.New("SeqNo in record is NULL")
-		}
-		if !prDAO.Latitude.Valid || !prDAO.Longitude.Valid {
-			return Coords{}, fmt.Errorf("one of the fields of database row for SeqNo %v is NULL", prDAO.SeqNo.Int32)
-		}
-
-		ppr[prDAO.SerNo.Int32] = append(ppr[prDAO.SerNo.Int32], Coord{
-			Latitude:  prDAO.Latitude.Float64,
-			Longitude: prDAO.Longitude.Float64,
-		})
-	}
-
-	err = rows.Err()
-	if err != nil {
-		return Coords{}, fmt.Errorf("error after scanning rows: %w", err)
-	}
-
-	return ppr, nil
-}
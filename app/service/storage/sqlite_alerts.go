@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bitwombat/gps-tags/model"
+	"github.com/bitwombat/gps-tags/notify"
+)
+
+// AddAlert stores a newly raised alert, and returns its ID.
+func (s SqliteStorer) AddAlert(ctx context.Context, alert notify.Alert) (int64, error) {
+	event, err := json.Marshal(alert.Event)
+	if err != nil {
+		return 0, fmt.Errorf("error encoding alert event: %w", err)
+	}
+
+	res, err := s.db.ExecContext(ctx, `
+INSERT INTO alert (Token, Event, Raised, Reminders, NextReminder, Escalated, Closed)
+VALUES (?, ?, ?, ?, ?, ?, ?);`,
+		alert.Token, string(event), model.Time{T: alert.Raised}, alert.Reminders, model.Time{T: alert.NextReminder},
+		alert.Escalated, closedValue(alert.Closed))
+	if err != nil {
+		return 0, fmt.Errorf("error inserting alert: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error getting alert ID: %w", err)
+	}
+
+	return id, nil
+}
+
+// closedValue is NULL for an open alert.
+func closedValue(closed time.Time) any {
+	if closed.IsZero() {
+		return nil
+	}
+
+	return model.Time{T: closed}
+}
+
+// UpdateAlert saves an alert's reminders, escalation and closing. Returns
+// ErrNotFound if there's no such alert.
+func (s SqliteStorer) UpdateAlert(ctx context.Context, alert notify.Alert) error {
+	res, err := s.db.ExecContext(ctx, `
+UPDATE alert SET Reminders = ?, NextReminder = ?, Escalated = ?, Closed = ? WHERE ID = ?;`,
+		alert.Reminders, model.Time{T: alert.NextReminder}, alert.Escalated, closedValue(alert.Closed), alert.ID)
+	if err != nil {
+		return fmt.Errorf("error updating alert %d: %w", alert.ID, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("alert %d: %w", alert.ID, ErrNotFound)
+	}
+
+	return nil
+}
+
+// AddAlertAudit adds to an alert's audit trail.
+func (s SqliteStorer) AddAlertAudit(ctx context.Context, alertID int64, entry notify.AlertAudit) error {
+	_, err := s.db.ExecContext(ctx, `
+INSERT INTO alertAudit (AlertID, Time, Action, By, Detail) VALUES (?, ?, ?, ?, ?);`,
+		alertID, model.Time{T: entry.Time}, entry.Action, entry.By, entry.Detail)
+	if err != nil {
+		return fmt.Errorf("error auditing alert %d: %w", alertID, err)
+	}
+
+	return nil
+}
+
+const alertColumns = `ID, Token, Event, Raised, Reminders, NextReminder, Escalated, Closed`
+
+func scanAlerts(rows *sql.Rows) ([]notify.Alert, error) {
+	var alerts []notify.Alert
+
+	for rows.Next() {
+		var a notify.Alert
+		var event string
+		var raised, nextReminder, closed model.Time
+		err := rows.Scan(&a.ID, &a.Token, &event, &raised, &a.Reminders, &nextReminder, &a.Escalated, &closed)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+
+		err = json.Unmarshal([]byte(event), &a.Event)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding alert %d event: %w", a.ID, err)
+		}
+		a.Raised, a.NextReminder, a.Closed = raised.T, nextReminder.T, closed.T
+
+		alerts = append(alerts, a)
+	}
+
+	err := rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error after scanning rows: %w", err)
+	}
+
+	return alerts, nil
+}
+
+// GetOpenAlerts returns the alerts that haven't been acknowledged or resolved,
+// oldest first, without their audit trails.
+func (s SqliteStorer) GetOpenAlerts(ctx context.Context) ([]notify.Alert, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+alertColumns+` FROM alert WHERE Closed IS NULL ORDER BY ID;`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database for open alerts: %w", err)
+	}
+	defer rows.Close()
+
+	return scanAlerts(rows)
+}
+
+// GetAlertByToken returns the alert with the token, with its audit trail, or
+// ErrNotFound if there isn't one.
+func (s SqliteStorer) GetAlertByToken(ctx context.Context, token string) (notify.Alert, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+alertColumns+` FROM alert WHERE Token = ?;`, token)
+	if err != nil {
+		return notify.Alert{}, fmt.Errorf("error querying database for alert: %w", err)
+	}
+	defer rows.Close()
+
+	alerts, err := scanAlerts(rows)
+	if err != nil {
+		return notify.Alert{}, err
+	}
+	if len(alerts) == 0 {
+		return notify.Alert{}, ErrNotFound
+	}
+
+	err = s.addAudits(ctx, alerts)
+	if err != nil {
+		return notify.Alert{}, err
+	}
+
+	return alerts[0], nil
+}
+
+// GetAlerts returns the alerts raised since a time, newest first, with their
+// audit trails.
+func (s SqliteStorer) GetAlerts(ctx context.Context, since time.Time) ([]notify.Alert, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+alertColumns+` FROM alert WHERE Raised >= ? ORDER BY Raised DESC, ID DESC;`,
+		model.Time{T: since})
+	if err != nil {
+		return nil, fmt.Errorf("error querying database for alerts: %w", err)
+	}
+	defer rows.Close()
+
+	alerts, err := scanAlerts(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.addAudits(ctx, alerts)
+	if err != nil {
+		return nil, err
+	}
+
+	return alerts, nil
+}
+
+// addAudits fills in the alerts' audit trails, oldest entry first.
+func (s SqliteStorer) addAudits(ctx context.Context, alerts []notify.Alert) error {
+	for i := range alerts {
+		rows, err := s.db.QueryContext(ctx, `
+SELECT Time, Action, By, Detail FROM alertAudit WHERE AlertID = ? ORDER BY ID;`, alerts[i].ID)
+		if err != nil {
+			return fmt.Errorf("error querying database for alert %d audit: %w", alerts[i].ID, err)
+		}
+
+		for rows.Next() {
+			var entry notify.AlertAudit
+			var t model.Time
+			err = rows.Scan(&t, &entry.Action, &entry.By, &entry.Detail)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("error scanning row: %w", err)
+			}
+			entry.Time = t.T
+			alerts[i].Audit = append(alerts[i].Audit, entry)
+		}
+
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return fmt.Errorf("error after scanning rows: %w", err)
+		}
+	}
+
+	return nil
+}
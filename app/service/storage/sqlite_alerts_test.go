@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bitwombat/gps-tags/notify"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlerts(t *testing.T) {
+	// GIVEN a freshly migrated database
+	storer := newMigratedStorer(t)
+	ctx := context.Background()
+
+	open, err := storer.GetOpenAlerts(ctx)
+	require.Nil(t, err)
+	require.Empty(t, open)
+
+	// WHEN two alerts are raised, and the first reminded about and
+	// acknowledged
+	leave := notify.Alert{
+		Token:        "abc123",
+		Event:        notify.Event{Kind: notify.EventLeave, Severity: notify.SeverityCritical, Title: "RUEGER has left the property", SerNo: 810095, Zone: "the property"},
+		Raised:       timeFrom("2025-09-01 12:00:00"),
+		NextReminder: timeFrom("2025-09-01 12:05:00"),
+	}
+	leave.ID, err = storer.AddAlert(ctx, leave)
+	require.Nil(t, err)
+	raised := notify.AlertAudit{Time: leave.Raised, Action: notify.AlertRaised, Detail: "RUEGER has left the property"}
+	require.Nil(t, storer.AddAlertAudit(ctx, leave.ID, raised))
+
+	battery := notify.Alert{
+		Token:        "def456",
+		Event:        notify.Event{Kind: notify.EventCriticalBattery, Title: "RUEGER's battery critical"},
+		Raised:       timeFrom("2025-09-01 13:00:00"),
+		NextReminder: timeFrom("2025-09-01 13:05:00"),
+	}
+	battery.ID, err = storer.AddAlert(ctx, battery)
+	require.Nil(t, err)
+
+	leave.Reminders, leave.Escalated, leave.NextReminder = 1, true, timeFrom("2025-09-01 12:15:00")
+	require.Nil(t, storer.UpdateAlert(ctx, leave))
+	leave.Closed = timeFrom("2025-09-01 12:07:00")
+	require.Nil(t, storer.UpdateAlert(ctx, leave))
+	acked := notify.AlertAudit{Time: leave.Closed, Action: notify.AlertAcknowledged, By: "ntfy", Detail: "from 203.0.113.9"}
+	require.Nil(t, storer.AddAlertAudit(ctx, leave.ID, acked))
+
+	// THEN only the second is open.
+	open, err = storer.GetOpenAlerts(ctx)
+	require.Nil(t, err)
+	require.Equal(t, []notify.Alert{battery}, open)
+
+	// AND the first can be got by its token, with its audit trail.
+	got, err := storer.GetAlertByToken(ctx, "abc123")
+	require.Nil(t, err)
+	leave.Audit = []notify.AlertAudit{raised, acked}
+	require.Equal(t, leave, got)
+
+	// AND both are listed, newest first.
+	all, err := storer.GetAlerts(ctx, timeFrom("2025-09-01 00:00:00"))
+	require.Nil(t, err)
+	require.Equal(t, []notify.Alert{battery, leave}, all)
+
+	all, err = storer.GetAlerts(ctx, timeFrom("2025-09-01 12:30:00"))
+	require.Nil(t, err)
+	require.Equal(t, []notify.Alert{battery}, all)
+
+	// AND unknown tokens aren't found.
+	_, err = storer.GetAlertByToken(ctx, "nope")
+	require.True(t, errors.Is(err, ErrNotFound))
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bitwombat/gps-tags/model"
+)
+
+// GetFixesBetween returns a tag's valid GPS fixes from one time up to
+// another, oldest first. A fix uploaded more than once is only returned once.
+func (s SqliteStorer) GetFixesBetween(ctx context.Context, serNo int, from, to time.Time) ([]Fix, error) {
+	track, err := s.GetTrack(ctx, serNo, from, to, AnyValidFix, Page{})
+	if err != nil {
+		return nil, err
+	}
+
+	fixes := make([]Fix, 0, len(track))
+	for _, p := range track {
+		fixes = append(fixes, Fix{GpsUTC: p.GpsUTC, Latitude: p.Latitude, Longitude: p.Longitude})
+	}
+
+	return fixes, nil
+}
+
+// GetBatteryReadings returns a tag's battery voltages from one time up to
+// another, oldest first.
+func (s SqliteStorer) GetBatteryReadings(ctx context.Context, serNo int, from, to time.Time) ([]BatteryReading, error) {
+	return s.GetBatteryHistory(ctx, serNo, from, to, Page{})
+}
+
+// GetCheckIns returns the times of a tag's records from one time up to
+// another, oldest first.
+func (s SqliteStorer) GetCheckIns(ctx context.Context, serNo int, from, to time.Time) ([]time.Time, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT DISTINCT record.DeviceUTC
+FROM tx
+JOIN record ON record.TxID = tx.ID
+WHERE tx.SerNo = ? AND record.DeviceUTC >= ? AND record.DeviceUTC < ?
+ORDER BY record.DeviceUTC;`,
+		serNo, model.Time{T: from}, model.Time{T: to})
+	if err != nil {
+		return nil, fmt.Errorf("error querying database for check-ins: %w", err)
+	}
+	defer rows.Close()
+
+	var checkIns []time.Time
+
+	for rows.Next() {
+		var deviceUTC model.Time
+		err := rows.Scan(&deviceUTC)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		checkIns = append(checkIns, deviceUTC.T)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error after scanning rows: %w", err)
+	}
+
+	return checkIns, nil
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bitwombat/gps-tags/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDigestQueries(t *testing.T) {
+	// GIVEN a day of records for a tag, one sent twice, and one for another
+	// tag
+	storer := newMigratedStorer(t)
+	ctx := context.Background()
+
+	record := func(seqNo int, ts string, lat float64, millivolts int) model.Record {
+		return model.Record{
+			SeqNo:           seqNo,
+			DateUTC:         model.Time{T: timeFrom(ts)},
+			GPSReading:      &model.GPSReading{GpsUTC: model.Time{T: timeFrom(ts)}, Lat: lat, Long: lat + 1},
+			AnalogueReading: &model.AnalogueReading{InternalBatteryVoltage: millivolts},
+		}
+	}
+	_, err := storer.WriteTx(ctx, model.TagTx{SerNo: 810095, Records: []model.Record{
+		record(1, "2025-08-31 23:50:00", 10, 4100),
+		record(2, "2025-09-01 00:00:00", 20, 4090),
+		record(3, "2025-09-01 12:00:00", 30, 4050),
+		record(4, "2025-09-02 00:00:00", 40, 4000),
+	}})
+	require.Nil(t, err)
+	_, err = storer.WriteTx(ctx, model.TagTx{SerNo: 810095, Records: []model.Record{
+		record(3, "2025-09-01 12:00:00", 30, 4050),
+	}})
+	require.Nil(t, err)
+	_, err = storer.WriteTx(ctx, model.TagTx{SerNo: 810243, Records: []model.Record{
+		record(1, "2025-09-01 06:00:00", 50, 3900),
+	}})
+	require.Nil(t, err)
+
+	from, to := timeFrom("2025-09-01 00:00:00"), timeFrom("2025-09-02 00:00:00")
+
+	// WHEN the day's fixes, battery readings and check-ins are got
+	fixes, err := storer.GetFixesBetween(ctx, 810095, from, to)
+	require.Nil(t, err)
+	readings, err := storer.GetBatteryReadings(ctx, 810095, from, to)
+	require.Nil(t, err)
+	checkIns, err := storer.GetCheckIns(ctx, 810095, from, to)
+	require.Nil(t, err)
+
+	// THEN only that tag's, from the start of the day up to the start of the
+	// next, once each.
+	require.Equal(t, []Fix{
+		{GpsUTC: timeFrom("2025-09-01 00:00:00"), Latitude: 20, Longitude: 21},
+		{GpsUTC: timeFrom("2025-09-01 12:00:00"), Latitude: 30, Longitude: 31},
+	}, fixes)
+	require.Equal(t, []BatteryReading{
+		{DeviceUTC: timeFrom("2025-09-01 00:00:00"), Volts: 4.09},
+		{DeviceUTC: timeFrom("2025-09-01 12:00:00"), Volts: 4.05},
+	}, readings)
+	require.Equal(t, []time.Time{timeFrom("2025-09-01 00:00:00"), timeFrom("2025-09-01 12:00:00")}, checkIns)
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bitwombat/gps-tags/model"
+)
+
+// GetLastSeen returns when each tag that's ever uploaded last checked in, and
+// its latest valid fix, in serial number order.
+func (s SqliteStorer) GetLastSeen(ctx context.Context) ([]LastSeen, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT tx.SerNo, MAX(record.DeviceUTC)
+FROM tx
+JOIN record ON record.TxID = tx.ID
+GROUP BY tx.SerNo
+ORDER BY tx.SerNo;`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database for last check-ins: %w", err)
+	}
+	defer rows.Close()
+
+	var lastSeen []LastSeen
+	bySerNo := make(map[int]int) // Index into lastSeen
+
+	for rows.Next() {
+		var deviceUTC model.Time
+		var ls LastSeen
+		err := rows.Scan(&ls.SerNo, &deviceUTC)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		ls.DeviceUTC = deviceUTC.T
+		bySerNo[ls.SerNo] = len(lastSeen)
+		lastSeen = append(lastSeen, ls)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error after scanning rows: %w", err)
+	}
+
+	// SQLite takes the bare columns from the row with the MAX.
+	rows, err = s.db.QueryContext(ctx, `
+SELECT tx.SerNo, MAX(gpsReading.GpsUTC), gpsReading.Lat, gpsReading.Lng
+FROM tx
+JOIN record ON record.TxID = tx.ID
+JOIN gpsReading ON gpsReading.RecordID = record.ID
+WHERE gpsReading.GpsStat & ? = 0
+GROUP BY tx.SerNo;`,
+		AnyValidFix.GpsStatMask)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database for last fixes: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var serNo int
+		var gpsUTC model.Time
+		var f Fix
+		err := rows.Scan(&serNo, &gpsUTC, &f.Latitude, &f.Longitude)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		f.GpsUTC = gpsUTC.T
+
+		i, ok := bySerNo[serNo]
+		if !ok {
+			continue
+		}
+		lastSeen[i].HasFix, lastSeen[i].Fix = true, f
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error after scanning rows: %w", err)
+	}
+
+	return lastSeen, nil
+}
@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bitwombat/gps-tags/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetLastSeen(t *testing.T) {
+	// GIVEN a tag whose latest record has no fix, and one that's never had one
+	storer := newMigratedStorer(t)
+	ctx := context.Background()
+
+	_, err := storer.WriteTx(ctx, model.TagTx{SerNo: 810095, Records: []model.Record{
+		{
+			SeqNo:      1,
+			DateUTC:    model.Time{T: timeFrom("2025-09-01 11:00:00")},
+			GPSReading: &model.GPSReading{GpsUTC: model.Time{T: timeFrom("2025-09-01 11:00:00")}, Lat: -31.5, Long: 152.6},
+		},
+		{
+			SeqNo:      2,
+			DateUTC:    model.Time{T: timeFrom("2025-09-01 12:00:00")},
+			GPSReading: &model.GPSReading{GpsUTC: model.Time{T: timeFrom("2025-09-01 12:00:00")}, Lat: -30, Long: 150, GpsStat: 4},
+		},
+	}})
+	require.Nil(t, err)
+	_, err = storer.WriteTx(ctx, model.TagTx{SerNo: 810243, Records: []model.Record{
+		{SeqNo: 1, DateUTC: model.Time{T: timeFrom("2025-09-01 10:00:00")}},
+	}})
+	require.Nil(t, err)
+
+	// WHEN they're got
+	got, err := storer.GetLastSeen(ctx)
+	require.Nil(t, err)
+
+	// THEN each has its last check-in, and the first its last good fix.
+	require.Equal(t, []LastSeen{
+		{
+			SerNo:     810095,
+			DeviceUTC: timeFrom("2025-09-01 12:00:00"),
+			HasFix:    true,
+			Fix:       Fix{GpsUTC: timeFrom("2025-09-01 11:00:00"), Latitude: -31.5, Longitude: 152.6},
+		},
+		{SerNo: 810243, DeviceUTC: timeFrom("2025-09-01 10:00:00")},
+	}, got)
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bitwombat/gps-tags/model"
+	"github.com/bitwombat/gps-tags/notify"
+)
+
+// AddQueuedNotification stores a notification waiting to be retried, and
+// returns its ID.
+func (s SqliteStorer) AddQueuedNotification(ctx context.Context, qn notify.QueuedNotification) (int64, error) {
+	event, err := json.Marshal(qn.Event)
+	if err != nil {
+		return 0, fmt.Errorf("error encoding queued event: %w", err)
+	}
+
+	res, err := s.db.ExecContext(ctx, `
+INSERT INTO notificationQueue (Channel, Event, Status, Attempts, LastError, Queued, NextAttempt)
+VALUES (?, ?, ?, ?, ?, ?, ?);`,
+		qn.Channel, string(event), qn.Status, qn.Attempts, qn.LastError, model.Time{T: qn.Queued}, model.Time{T: qn.NextAttempt})
+	if err != nil {
+		return 0, fmt.Errorf("error inserting queued notification: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error getting queued notification ID: %w", err)
+	}
+
+	return id, nil
+}
+
+// UpdateQueuedNotification saves how a retry went. Returns ErrNotFound if
+// the notification isn't queued.
+func (s SqliteStorer) UpdateQueuedNotification(ctx context.Context, qn notify.QueuedNotification) error {
+	res, err := s.db.ExecContext(ctx, `
+UPDATE notificationQueue SET Status = ?, Attempts = ?, LastError = ?, NextAttempt = ? WHERE ID = ?;`,
+		qn.Status, qn.Attempts, qn.LastError, model.Time{T: qn.NextAttempt}, qn.ID)
+	if err != nil {
+		return fmt.Errorf("error updating queued notification %d: %w", qn.ID, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("queued notification %d: %w", qn.ID, ErrNotFound)
+	}
+
+	return nil
+}
+
+// DeleteQueuedNotification removes a notification from the queue.
+func (s SqliteStorer) DeleteQueuedNotification(ctx context.Context, id int64) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM notificationQueue WHERE ID = ?;`, id)
+	if err != nil {
+		return fmt.Errorf("error deleting queued notification %d: %w", id, err)
+	}
+
+	return nil
+}
+
+// GetQueuedNotifications returns every queued notification, oldest first.
+func (s SqliteStorer) GetQueuedNotifications(ctx context.Context) ([]notify.QueuedNotification, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT ID, Channel, Event, Status, Attempts, LastError, Queued, NextAttempt
+FROM notificationQueue ORDER BY ID;`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database for queued notifications: %w", err)
+	}
+
+	return scanQueuedNotifications(rows)
+}
+
+// GetDueNotifications returns the queued notifications with the status that
+// are due by now, oldest first.
+func (s SqliteStorer) GetDueNotifications(ctx context.Context, status string, now time.Time) ([]notify.QueuedNotification, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT ID, Channel, Event, Status, Attempts, LastError, Queued, NextAttempt
+FROM notificationQueue WHERE Status = ? AND NextAttempt <= ? ORDER BY ID;`,
+		status, model.Time{T: now})
+	if err != nil {
+		return nil, fmt.Errorf("error querying database for due notifications: %w", err)
+	}
+
+	return scanQueuedNotifications(rows)
+}
+
+// PurgeQueuedNotifications deletes failed and held back notifications queued
+// before the time. Pending ones are left to run out of attempts.
+func (s SqliteStorer) PurgeQueuedNotifications(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM notificationQueue WHERE Status IN (?, ?) AND Queued < ?;`,
+		notify.QueueFailed, notify.QueueSuppressed, model.Time{T: before})
+	if err != nil {
+		return 0, fmt.Errorf("error purging queued notifications: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	return n, nil
+}
+
+func scanQueuedNotifications(rows *sql.Rows) ([]notify.QueuedNotification, error) {
+	defer rows.Close()
+
+	var queued []notify.QueuedNotification
+
+	for rows.Next() {
+		var qn notify.QueuedNotification
+		var event string
+		var q, next model.Time
+		err := rows.Scan(&qn.ID, &qn.Channel, &event, &qn.Status, &qn.Attempts, &qn.LastError, &q, &next)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+
+		err = json.Unmarshal([]byte(event), &qn.Event)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding queued event %d: %w", qn.ID, err)
+		}
+		qn.Queued, qn.NextAttempt = q.T, next.T
+
+		queued = append(queued, qn)
+	}
+
+	err := rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error after scanning rows: %w", err)
+	}
+
+	return queued, nil
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bitwombat/gps-tags/notify"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationQueue(t *testing.T) {
+	// GIVEN a freshly migrated database
+	storer := newMigratedStorer(t)
+	ctx := context.Background()
+
+	queued, err := storer.GetQueuedNotifications(ctx)
+	require.Nil(t, err)
+	require.Empty(t, queued)
+
+	// WHEN two notifications are queued, and the first retried and given up on
+	leave := notify.QueuedNotification{
+		Channel: "email",
+		Event: notify.Event{
+			Kind:        notify.EventLeave,
+			Severity:    notify.SeverityCritical,
+			Title:       "RUEGER has left the property",
+			SerNo:       810095,
+			Tag:         "Rueger",
+			HasPosition: true,
+			Latitude:    -31.4577,
+			Longitude:   152.6410,
+			Time:        timeFrom("2025-09-01 12:00:00"),
+		},
+		Status:      notify.QueuePending,
+		Attempts:    1,
+		LastError:   "connection refused",
+		Queued:      timeFrom("2025-09-01 12:00:05"),
+		NextAttempt: timeFrom("2025-09-01 12:01:05"),
+	}
+	leave.ID, err = storer.AddQueuedNotification(ctx, leave)
+	require.Nil(t, err)
+
+	battery := notify.QueuedNotification{
+		Channel:     "ntfy",
+		Event:       notify.Event{Kind: notify.EventLowBattery, Title: "Low battery"},
+		Status:      notify.QueuePending,
+		Attempts:    1,
+		Queued:      timeFrom("2025-09-01 12:05:00"),
+		NextAttempt: timeFrom("2025-09-01 12:06:00"),
+	}
+	battery.ID, err = storer.AddQueuedNotification(ctx, battery)
+	require.Nil(t, err)
+
+	leave.Status = notify.QueueFailed
+	leave.Attempts = 2
+	leave.LastError = "timeout"
+	err = storer.UpdateQueuedNotification(ctx, leave)
+	require.Nil(t, err)
+
+	// THEN both come back, oldest first, with the update and the event intact.
+	queued, err = storer.GetQueuedNotifications(ctx)
+	require.Nil(t, err)
+	require.Equal(t, []notify.QueuedNotification{leave, battery}, queued)
+
+	// WHEN the second is deleted
+	err = storer.DeleteQueuedNotification(ctx, battery.ID)
+	require.Nil(t, err)
+
+	// THEN only the first is left.
+	queued, err = storer.GetQueuedNotifications(ctx)
+	require.Nil(t, err)
+	require.Equal(t, []notify.QueuedNotification{leave}, queued)
+
+	// AND updating the deleted one says it's not there.
+	err = storer.UpdateQueuedNotification(ctx, battery)
+	require.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestDueAndPurgedNotifications(t *testing.T) {
+	// GIVEN a pending notification due at 12:01, one held back for quiet
+	// hours, and one failed long ago
+	storer := newMigratedStorer(t)
+	ctx := context.Background()
+
+	var queued []notify.QueuedNotification
+	for _, qn := range []notify.QueuedNotification{
+		{Channel: "ntfy", Status: notify.QueuePending, Attempts: 1, Queued: timeFrom("2025-09-01 12:00:00"), NextAttempt: timeFrom("2025-09-01 12:01:00")},
+		{Channel: "email", Status: notify.QueueSuppressed, Queued: timeFrom("2025-09-01 11:00:00")},
+		{Channel: "email", Status: notify.QueueFailed, Attempts: 10, Queued: timeFrom("2025-07-01 12:00:00"), NextAttempt: timeFrom("2025-07-01 12:00:00")},
+	} {
+		var err error
+		qn.ID, err = storer.AddQueuedNotification(ctx, qn)
+		require.Nil(t, err)
+		queued = append(queued, qn)
+	}
+
+	for _, tc := range []struct {
+		status string
+		now    string
+		want   []notify.QueuedNotification
+	}{
+		{notify.QueuePending, "2025-09-01 12:00:30", nil},
+		{notify.QueuePending, "2025-09-01 12:01:00", queued[:1]},
+		{notify.QueueSuppressed, "2025-09-01 12:00:00", queued[1:2]},
+	} {
+		// WHEN the due ones with a status are asked for
+		got, err := storer.GetDueNotifications(ctx, tc.status, timeFrom(tc.now))
+		require.Nil(t, err)
+
+		// THEN only those are returned.
+		require.Equal(t, tc.want, got, "%s at %s", tc.status, tc.now)
+	}
+
+	// WHEN everything queued before August is purged
+	n, err := storer.PurgeQueuedNotifications(ctx, timeFrom("2025-08-01 00:00:00"))
+	require.Nil(t, err)
+
+	// THEN just the old failed one goes.
+	require.Equal(t, int64(1), n)
+	got, err := storer.GetQueuedNotifications(ctx)
+	require.Nil(t, err)
+	require.Equal(t, queued[:2], got)
+}
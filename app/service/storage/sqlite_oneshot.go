@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bitwombat/gps-tags/model"
+	"github.com/bitwombat/gps-tags/oneshot"
+)
+
+// GetOneShotStates returns the state of every one-shot event, keyed by event.
+func (s SqliteStorer) GetOneShotStates(ctx context.Context) (map[string]oneshot.State, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT Event, IsSet, LastSet, LastReset FROM oneShotState;`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database for one-shot states: %w", err)
+	}
+	defer rows.Close()
+
+	states := make(map[string]oneshot.State)
+
+	for rows.Next() {
+		var event string
+		var isSet bool
+		var lastSet, lastReset model.Time
+		err := rows.Scan(&event, &isSet, &lastSet, &lastReset)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		states[event] = oneshot.State{
+			Set:       isSet,
+			LastSet:   lastSet.T,
+			LastReset: lastReset.T,
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error after scanning rows: %w", err)
+	}
+
+	return states, nil
+}
+
+// SaveOneShotState stores the state of one event, replacing what was there.
+func (s SqliteStorer) SaveOneShotState(ctx context.Context, event string, state oneshot.State) error {
+	_, err := s.db.ExecContext(ctx, `
+INSERT INTO oneShotState (Event, IsSet, LastSet, LastReset) VALUES (?, ?, ?, ?)
+ON CONFLICT (Event) DO UPDATE SET
+    IsSet = excluded.IsSet,
+    LastSet = excluded.LastSet,
+    LastReset = excluded.LastReset;`,
+		event, state.Set, model.Time{T: state.LastSet}, model.Time{T: state.LastReset})
+	if err != nil {
+		return fmt.Errorf("error saving one-shot state for %s: %w", event, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bitwombat/gps-tags/migrations"
+	"github.com/bitwombat/gps-tags/oneshot"
+	"github.com/stretchr/testify/require"
+	"maragu.dev/migrate"
+)
+
+func TestOneShotStates(t *testing.T) {
+	// GIVEN a freshly migrated database
+	storer := newMigratedStorer(t)
+	ctx := context.Background()
+
+	states, err := storer.GetOneShotStates(ctx)
+	require.Nil(t, err)
+	require.Empty(t, states)
+
+	// WHEN an event is set, and later reset
+	set := oneshot.State{Set: true, LastSet: timeFrom("2025-09-01 12:00:00")}
+	err = storer.SaveOneShotState(ctx, "810095/outside/Property", set)
+	require.Nil(t, err)
+
+	reset := oneshot.State{Set: false, LastSet: set.LastSet, LastReset: timeFrom("2025-09-01 13:00:00")}
+	err = storer.SaveOneShotState(ctx, "810095/outside/Property", reset)
+	require.Nil(t, err)
+
+	// THEN the latest state comes back.
+	states, err = storer.GetOneShotStates(ctx)
+	require.Nil(t, err)
+	require.Equal(t, map[string]oneshot.State{"810095/outside/Property": reset}, states)
+}
+
+func TestPersistentOneShot(t *testing.T) {
+	// GIVEN a one-shot backed by the database, that has fired
+	storer := newMigratedStorer(t)
+	ctx := context.Background()
+	now := func() time.Time { return timeFrom("2025-09-01 12:00:00") }
+
+	var fired int
+	onSet := func() error { fired++; return nil }
+
+	oneShot, err := oneshot.NewPersistentOneShot(ctx, storer, now)
+	require.Nil(t, err)
+	err = oneShot.SetReset("810095/outside/Property", oneshot.Config{SetIf: true, OnSet: onSet})
+	require.Nil(t, err)
+	require.Equal(t, 1, fired)
+
+	// WHEN the service restarts
+	restarted, err := oneshot.NewPersistentOneShot(ctx, storer, now)
+	require.Nil(t, err)
+
+	// THEN the event doesn't fire again
+	err = restarted.SetReset("810095/outside/Property", oneshot.Config{SetIf: true, OnSet: onSet})
+	require.Nil(t, err)
+	require.Equal(t, 1, fired)
+
+	// AND when it was set is remembered.
+	require.Equal(t, oneshot.State{Set: true, LastSet: now()}, restarted.States()["810095/outside/Property"])
+}
+
+func TestOneShotStatesRekeyedBySerNo(t *testing.T) {
+	// GIVEN states saved under tag names, including one for a name the tag
+	// doesn't have any more
+	storer, err := NewSQLiteStorer(":memory:")
+	require.Nil(t, err)
+	ctx := context.Background()
+
+	err = migrate.To(ctx, storer.db, migrations.FS, "1792240494-notificationqueue-due")
+	require.Nil(t, err)
+
+	set := oneshot.State{Set: true, LastSet: timeFrom("2025-09-01 12:00:00")}
+	for _, event := range []string{"RUEGERoutside Safe zone", "RUEGERapproaching Property", "CHARLIElowBattery", "CHARLIEsilent", "BLUEYoutside Property"} {
+		err = storer.SaveOneShotState(ctx, event, set)
+		require.Nil(t, err)
+	}
+
+	// WHEN the database is brought up to date
+	err = storer.Migrate(ctx)
+	require.Nil(t, err)
+
+	// THEN they're kept under serial numbers, and the orphan is gone.
+	states, err := storer.GetOneShotStates(ctx)
+	require.Nil(t, err)
+	require.Equal(t, map[string]oneshot.State{
+		"810095/outside/Safe zone":    set,
+		"810095/approaching/Property": set,
+		"810243/lowBattery":           set,
+		"810243/silent":               set,
+	}, states)
+}
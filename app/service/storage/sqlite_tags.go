@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/bitwombat/gps-tags/model"
+)
+
+// GetTags returns every tag in the registry, retired or not, ordered by serial
+// number.
+func (s SqliteStorer) GetTags(ctx context.Context) ([]model.Tag, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT SerNo, Name, Colour, Icon, Imei, Iccid, Active FROM tags ORDER BY SerNo;`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database for tags: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []model.Tag
+
+	for rows.Next() {
+		var t model.Tag
+		err := rows.Scan(&t.SerNo, &t.Name, &t.Colour, &t.Icon, &t.IMEI, &t.ICCID, &t.Active)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		tags = append(tags, t)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error after scanning rows: %w", err)
+	}
+
+	return tags, nil
+}
+
+// AddTag puts a new tag in the registry. Returns ErrExists if the serial
+// number is already there.
+func (s SqliteStorer) AddTag(ctx context.Context, t model.Tag) error {
+	result, err := s.db.ExecContext(ctx, `INSERT INTO tags (SerNo, Name, Colour, Icon, Imei, Iccid, Active) VALUES (?, ?, ?, ?, ?, ?, ?) ON CONFLICT (SerNo) DO NOTHING;`,
+		t.SerNo, t.Name, t.Colour, t.Icon, t.IMEI, t.ICCID, t.Active)
+	if err != nil {
+		return fmt.Errorf("error inserting tag %d: %w", t.SerNo, err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("tag %d: %w", t.SerNo, ErrExists)
+	}
+
+	return nil
+}
+
+// UpdateTag overwrites everything about the tag with the same serial number.
+// Returns ErrNotFound if there is no such tag.
+func (s SqliteStorer) UpdateTag(ctx context.Context, t model.Tag) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE tags SET Name = ?, Colour = ?, Icon = ?, Imei = ?, Iccid = ?, Active = ? WHERE SerNo = ?;`,
+		t.Name, t.Colour, t.Icon, t.IMEI, t.ICCID, t.Active, t.SerNo)
+	if err != nil {
+		return fmt.Errorf("error updating tag %d: %w", t.SerNo, err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("tag %d: %w", t.SerNo, ErrNotFound)
+	}
+
+	return nil
+}
+
+// GetPendingTags returns the tags waiting to be named, most recently seen
+// first.
+func (s SqliteStorer) GetPendingTags(ctx context.Context) ([]model.PendingTag, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT SerNo, Imei, Iccid, Fw, FirstSeen, LastSeen, Uploads FROM pendingTags ORDER BY LastSeen DESC;`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database for pending tags: %w", err)
+	}
+	defer rows.Close()
+
+	var pending []model.PendingTag
+
+	for rows.Next() {
+		var p model.PendingTag
+		var firstSeen, lastSeen model.Time
+		err := rows.Scan(&p.SerNo, &p.IMEI, &p.ICCID, &p.Fw, &firstSeen, &lastSeen, &p.Uploads)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		p.FirstSeen = firstSeen.T
+		p.LastSeen = lastSeen.T
+		pending = append(pending, p)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error after scanning rows: %w", err)
+	}
+
+	return pending, nil
+}
+
+// UpsertPendingTag records an upload from an unknown tag. The first time, the
+// tag is added. After that, its details and last seen time are updated, and
+// its upload count goes up.
+func (s SqliteStorer) UpsertPendingTag(ctx context.Context, p model.PendingTag) error {
+	_, err := s.db.ExecContext(ctx, `
+INSERT INTO pendingTags (SerNo, Imei, Iccid, Fw, FirstSeen, LastSeen, Uploads) VALUES (?, ?, ?, ?, ?, ?, 1)
+ON CONFLICT (SerNo) DO UPDATE SET
+    Imei = excluded.Imei,
+    Iccid = excluded.Iccid,
+    Fw = excluded.Fw,
+    LastSeen = excluded.LastSeen,
+    Uploads = Uploads + 1;`,
+		p.SerNo, p.IMEI, p.ICCID, p.Fw, model.Time{T: p.LastSeen}, model.Time{T: p.LastSeen})
+	if err != nil {
+		return fmt.Errorf("error upserting pending tag %d: %w", p.SerNo, err)
+	}
+
+	return nil
+}
+
+// PromotePendingTag moves a pending tag into the registry as t. The pending
+// tag's IMEI and ICCID are kept. Returns ErrNotFound if the tag isn't pending,
+// and ErrExists (leaving it pending) if its serial number is already taken.
+func (s SqliteStorer) PromotePendingTag(ctx context.Context, t model.Tag) error {
+	dbTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer dbTx.Rollback() //nolint:errcheck // no-op after commit
+
+	err = dbTx.QueryRowContext(ctx, `DELETE FROM pendingTags WHERE SerNo = ? RETURNING Imei, Iccid;`, t.SerNo).Scan(&t.IMEI, &t.ICCID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("pending tag %d: %w", t.SerNo, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("error removing pending tag %d: %w", t.SerNo, err)
+	}
+
+	result, err := dbTx.ExecContext(ctx, `INSERT INTO tags (SerNo, Name, Colour, Icon, Imei, Iccid, Active) VALUES (?, ?, ?, ?, ?, ?, ?) ON CONFLICT (SerNo) DO NOTHING;`,
+		t.SerNo, t.Name, t.Colour, t.Icon, t.IMEI, t.ICCID, t.Active)
+	if err != nil {
+		return fmt.Errorf("error inserting tag %d: %w", t.SerNo, err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("tag %d: %w", t.SerNo, ErrExists)
+	}
+
+	err = dbTx.Commit()
+	if err != nil {
+		return fmt.Errorf("error committing promotion of tag %d: %w", t.SerNo, err)
+	}
+
+	return nil
+}
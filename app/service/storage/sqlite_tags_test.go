@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bitwombat/gps-tags/model"
+	"github.com/stretchr/testify/require"
+)
+
+func newMigratedStorer(t *testing.T) SqliteStorer {
+	t.Helper()
+
+	storer, err := NewSQLiteStorer(":memory:")
+	require.Nil(t, err)
+
+	err = storer.Migrate(context.Background())
+	require.Nil(t, err)
+
+	return storer
+}
+
+func TestTags(t *testing.T) {
+	// GIVEN a freshly migrated database
+	storer := newMigratedStorer(t)
+	ctx := context.Background()
+
+	// THEN the tags that used to be hard-coded are there.
+	tags, err := storer.GetTags(ctx)
+	require.Nil(t, err)
+	require.Len(t, tags, 2)
+	require.Equal(t, model.Tag{SerNo: 810095, Name: "Rueger", Colour: "purple", Icon: "R", Active: true}, tags[0])
+	require.Equal(t, "Charlie", tags[1].Name)
+
+	// WHEN we add a tag
+	newTag := model.Tag{SerNo: 810300, Name: "Tucker", Colour: "green", Icon: "T", IMEI: "1234", ICCID: "5678", Active: true}
+	err = storer.AddTag(ctx, newTag)
+	require.Nil(t, err)
+
+	// THEN it can't be added twice
+	err = storer.AddTag(ctx, newTag)
+	require.ErrorIs(t, err, ErrExists)
+
+	// WHEN we retire it
+	newTag.Active = false
+	err = storer.UpdateTag(ctx, newTag)
+	require.Nil(t, err)
+
+	// THEN it comes back retired, in serial number order
+	tags, err = storer.GetTags(ctx)
+	require.Nil(t, err)
+	require.Len(t, tags, 3)
+	require.Equal(t, newTag, tags[2])
+
+	// AND updating a tag that isn't there is a not found error.
+	err = storer.UpdateTag(ctx, model.Tag{SerNo: 1, Name: "Nobody"})
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestPendingTags(t *testing.T) {
+	// GIVEN a freshly migrated database
+	storer := newMigratedStorer(t)
+	ctx := context.Background()
+
+	// WHEN an unknown tag uploads twice
+	err := storer.UpsertPendingTag(ctx, model.PendingTag{SerNo: 810400, IMEI: "1", ICCID: "2", Fw: "97.2.1.11", LastSeen: timeFrom("2025-09-01 12:00:00")})
+	require.Nil(t, err)
+	err = storer.UpsertPendingTag(ctx, model.PendingTag{SerNo: 810400, IMEI: "1", ICCID: "2", Fw: "97.2.1.12", LastSeen: timeFrom("2025-09-01 12:10:00")})
+	require.Nil(t, err)
+
+	// THEN it's pending once, with both uploads counted.
+	pending, err := storer.GetPendingTags(ctx)
+	require.Nil(t, err)
+	require.Len(t, pending, 1)
+	require.Equal(t, model.PendingTag{
+		SerNo:     810400,
+		IMEI:      "1",
+		ICCID:     "2",
+		Fw:        "97.2.1.12",
+		FirstSeen: timeFrom("2025-09-01 12:00:00"),
+		LastSeen:  timeFrom("2025-09-01 12:10:00"),
+		Uploads:   2,
+	}, pending[0])
+
+	// WHEN it's promoted
+	err = storer.PromotePendingTag(ctx, model.Tag{SerNo: 810400, Name: "Blue", Active: true})
+	require.Nil(t, err)
+
+	// THEN it's a real tag, keeping its IMEI and ICCID, and no longer pending.
+	tags, err := storer.GetTags(ctx)
+	require.Nil(t, err)
+	require.Equal(t, model.Tag{SerNo: 810400, Name: "Blue", IMEI: "1", ICCID: "2", Active: true}, tags[2])
+
+	pending, err = storer.GetPendingTags(ctx)
+	require.Nil(t, err)
+	require.Empty(t, pending)
+
+	// AND it can't be promoted again.
+	err = storer.PromotePendingTag(ctx, model.Tag{SerNo: 810400, Name: "Blue", Active: true})
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// WHEN a tag that's already registered is pending too
+	err = storer.UpsertPendingTag(ctx, model.PendingTag{SerNo: 810095, LastSeen: timeFrom("2025-09-01 12:20:00")})
+	require.Nil(t, err)
+
+	// THEN it can't be promoted over the registered one, and stays pending.
+	err = storer.PromotePendingTag(ctx, model.Tag{SerNo: 810095, Name: "Imposter", Active: true})
+	require.ErrorIs(t, err, ErrExists)
+
+	tags, err = storer.GetTags(ctx)
+	require.Nil(t, err)
+	require.Equal(t, "Rueger", tags[0].Name)
+
+	pending, err = storer.GetPendingTags(ctx)
+	require.Nil(t, err)
+	require.Len(t, pending, 1)
+}
@@ -3,9 +3,7 @@ package storage
 import (
 	"context"
 	"fmt"
-	"maps"
 	"os"
-	"slices"
 	"testing"
 	"time"
 
@@ -185,7 +183,7 @@ var nSamples = []model.TagTx{
 			{
 				SeqNo: 1,
 				GPSReading: &model.GPSReading{
-					GpsUTC: model.Time{timeFrom("2025-09-01 12:00:00")},
+					GpsUTC: model.Time{T: timeFrom("2025-09-01 12:00:00")},
 					Lat:    100,
 					Long:   101,
 				},
@@ -193,7 +191,7 @@ var nSamples = []model.TagTx{
 			{
 				SeqNo: 2,
 				GPSReading: &model.GPSReading{
-					GpsUTC: model.Time{timeFrom("2025-09-01 12:00:01")},
+					GpsUTC: model.Time{T: timeFrom("2025-09-01 12:00:01")},
 					Lat:    102,
 					Long:   103,
 				},
@@ -201,7 +199,7 @@ var nSamples = []model.TagTx{
 			{
 				SeqNo: 3,
 				GPSReading: &model.GPSReading{
-					GpsUTC: model.Time{timeFrom("2025-09-01 12:00:02")},
+					GpsUTC: model.Time{T: timeFrom("2025-09-01 12:00:02")},
 					Lat:    104,
 					Long:   105,
 				},
@@ -209,7 +207,7 @@ var nSamples = []model.TagTx{
 			{
 				SeqNo: 4,
 				GPSReading: &model.GPSReading{
-					GpsUTC: model.Time{timeFrom("2025-09-01 12:00:03")},
+					GpsUTC: model.Time{T: timeFrom("2025-09-01 12:00:03")},
 					Lat:    106,
 					Long:   107,
 				},
@@ -217,7 +215,7 @@ var nSamples = []model.TagTx{
 			{
 				SeqNo: 5,
 				GPSReading: &model.GPSReading{
-					GpsUTC: model.Time{timeFrom("2025-09-01 12:00:04")},
+					GpsUTC: model.Time{T: timeFrom("2025-09-01 12:00:04")},
 					Lat:    108,
 					Long:   109,
 				},
@@ -230,7 +228,7 @@ var nSamples = []model.TagTx{
 			{
 				SeqNo: 2,
 				GPSReading: &model.GPSReading{
-					GpsUTC: model.Time{timeFrom("2025-09-01 12:00:05")},
+					GpsUTC: model.Time{T: timeFrom("2025-09-01 12:00:05")},
 					Lat:    110,
 					Long:   111,
 				},
@@ -238,7 +236,7 @@ var nSamples = []model.TagTx{
 			{
 				SeqNo: 4,
 				GPSReading: &model.GPSReading{
-					GpsUTC: model.Time{timeFrom("2025-09-01 12:00:06")},
+					GpsUTC: model.Time{T: timeFrom("2025-09-01 12:00:06")},
 					Lat:    112,
 					Long:   113,
 				},
@@ -246,7 +244,7 @@ var nSamples = []model.TagTx{
 			{
 				SeqNo: 6,
 				GPSReading: &model.GPSReading{
-					GpsUTC: model.Time{timeFrom("2025-09-01 12:00:07")},
+					GpsUTC: model.Time{T: timeFrom("2025-09-01 12:00:07")},
 					Lat:    114,
 					Long:   115,
 				},
@@ -254,7 +252,7 @@ var nSamples = []model.TagTx{
 			{
 				SeqNo: 8,
 				GPSReading: &model.GPSReading{
-					GpsUTC: model.Time{timeFrom("2025-09-01 12:00:08")},
+					GpsUTC: model.Time{T: timeFrom("2025-09-01 12:00:08")},
 					Lat:    116,
 					Long:   117,
 				},
@@ -262,7 +260,7 @@ var nSamples = []model.TagTx{
 			{
 				SeqNo: 10,
 				GPSReading: &model.GPSReading{
-					GpsUTC: model.Time{timeFrom("2025-09-01 12:00:09")},
+					GpsUTC: model.Time{T: timeFrom("2025-09-01 12:00:09")},
 					Lat:    118,
 					Long:   119,
 				},
@@ -281,12 +279,12 @@ func TestGetLatestStatus(t *testing.T) {
 	err = migrate.Up(context.Background(), storer.db, migrations)
 	require.Nil(t, err)
 
-	txID, err := storer.WriteTx(context.Background(), sampleTx1)
+	wr, err := storer.WriteTx(context.Background(), sampleTx1)
 	require.Nil(t, err)
-	require.NotEmpty(t, txID)
-	txID, err = storer.WriteTx(context.Background(), sampleTx2)
+	require.NotEmpty(t, wr.TxID)
+	wr, err = storer.WriteTx(context.Background(), sampleTx2)
 	require.Nil(t, err)
-	require.NotEmpty(t, txID)
+	require.NotEmpty(t, wr.TxID)
 
 	// WHEN we get the latest status for all tags.
 	result, err := storer.GetLastStatuses(context.Background())
@@ -316,7 +314,45 @@ func TestGetLatestStatus(t *testing.T) {
 	}
 }
 
-func TestGetLastNCoords(t *testing.T) {
+func TestGetLatestStatusManyTags(t *testing.T) {
+	// GIVEN six dogs' tags, and a pending tag that's uploaded since they all
+	// last did
+	storer, err := NewSQLiteStorer(":memory:")
+	require.Nil(t, err)
+
+	err = migrate.Up(context.Background(), storer.db, os.DirFS("../migrations"))
+	require.Nil(t, err)
+
+	upload := func(serNo int, deviceUTC string) {
+		tx := sampleTx1
+		tx.SerNo = serNo
+		tx.Records = []model.Record{sampleTx1.Records[0]}
+		tx.Records[0].DateUTC = timeFromString(deviceUTC)
+		_, err := storer.WriteTx(context.Background(), tx)
+		require.Nil(t, err)
+	}
+
+	for i := range 6 {
+		serNo := 810001 + i
+		err = storer.AddTag(context.Background(), model.Tag{SerNo: serNo, Name: fmt.Sprintf("Dog %d", i), Active: true})
+		require.Nil(t, err)
+		upload(serNo, fmt.Sprintf("2025-09-01 12:0%d:00", i))
+	}
+
+	err = storer.UpsertPendingTag(context.Background(), model.PendingTag{SerNo: 999999, LastSeen: timeFrom("2025-09-01 13:00:00")})
+	require.Nil(t, err)
+	upload(999999, "2025-09-01 13:00:00")
+
+	// WHEN we get the latest status for all tags
+	result, err := storer.GetLastStatuses(context.Background())
+	require.Nil(t, err)
+
+	// THEN every tag has one, including the dog that's been quietest.
+	require.Len(t, result, 7)
+	require.Contains(t, result, int32(810001))
+}
+
+func TestGetTrack(t *testing.T) {
 	// GIVEN commits with multiple records and for multiple tags.
 	storer, err := NewSQLiteStorer(":memory:")
 	require.Nil(t, err)
@@ -327,34 +363,115 @@ func TestGetLastNCoords(t *testing.T) {
 	require.Nil(t, err)
 
 	for _, r := range nSamples {
-		txID, err := storer.WriteTx(context.Background(), r)
+		wr, err := storer.WriteTx(context.Background(), r)
 		require.Nil(t, err)
-		require.NotEmpty(t, txID)
+		require.NotEmpty(t, wr.TxID)
 	}
 
-	// WHEN we get the last 3 coordinates for all tags.
-	result, err := storer.GetLastNCoords(context.Background(), 3)
+	// WHEN we get the last 3 seconds of one tag's track.
+	result, err := storer.GetTrack(context.Background(), 810095,
+		timeFrom("2025-09-01 12:00:02"), timeFrom("2025-09-01 12:00:05"), AnyValidFix, Page{})
 	require.Nil(t, err)
-	require.Len(t, result, 2, "length of result array")
 
-	// THEN we get the latest coordinate's values for both known tags.
-	require.Equal(t, len(result), 2, "number of tags/keys")
-
-	keys := slices.Collect(maps.Keys(result))
-	slices.Sort(keys)
-	require.Equal(t, keys, []int32{810095, 810243}, "tag values")
-
-	require.Equal(t, 104.0, result[810095][0].Latitude)
-	require.Equal(t, 105.0, result[810095][0].Longitude)
-	require.Equal(t, 106.0, result[810095][1].Latitude)
-	require.Equal(t, 107.0, result[810095][1].Longitude)
-	require.Equal(t, 108.0, result[810095][2].Latitude)
-	require.Equal(t, 109.0, result[810095][2].Longitude)
-
-	require.Equal(t, 114.0, result[810243][0].Latitude)
-	require.Equal(t, 115.0, result[810243][0].Longitude)
-	require.Equal(t, 116.0, result[810243][1].Latitude)
-	require.Equal(t, 117.0, result[810243][1].Longitude)
-	require.Equal(t, 118.0, result[810243][2].Latitude)
-	require.Equal(t, 119.0, result[810243][2].Longitude)
+	// THEN we get that tag's points in those seconds, oldest first.
+	require.Len(t, result, 3, "length of result array")
+
+	require.Equal(t, timeFrom("2025-09-01 12:00:02"), result[0].GpsUTC)
+	require.Equal(t, 104.0, result[0].Latitude)
+	require.Equal(t, 105.0, result[0].Longitude)
+	require.Equal(t, 106.0, result[1].Latitude)
+	require.Equal(t, 107.0, result[1].Longitude)
+	require.Equal(t, 108.0, result[2].Latitude)
+	require.Equal(t, 109.0, result[2].Longitude)
+}
+
+func TestWriteTxSkipsDuplicates(t *testing.T) {
+	// GIVEN a transmission that has been stored
+	storer := newMigratedStorer(t)
+	ctx := context.Background()
+
+	wr, err := storer.WriteTx(ctx, sampleTx1)
+	require.Nil(t, err)
+	require.Equal(t, 2, wr.New)
+	require.Equal(t, 0, wr.Duplicates)
+
+	// WHEN the device retries the same upload
+	wr, err = storer.WriteTx(ctx, sampleTx1)
+	require.Nil(t, err)
+
+	// THEN nothing new is written
+	require.Equal(t, 0, wr.New)
+	require.Equal(t, 2, wr.Duplicates)
+	require.Empty(t, wr.TxID)
+
+	// WHEN a later upload repeats one record and adds another
+	retry := sampleTx1
+	retry.Records = []model.Record{sampleTx1.Records[1], sampleTx1.Records[1]}
+	retry.Records[1].SeqNo = 7496
+	wr, err = storer.WriteTx(ctx, retry)
+	require.Nil(t, err)
+
+	// THEN only the new one is written
+	require.Equal(t, 1, wr.New)
+	require.Equal(t, 1, wr.Duplicates)
+	require.NotEmpty(t, wr.TxID)
+
+	var count int
+	err = storer.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM record;").Scan(&count)
+	require.Nil(t, err)
+	require.Equal(t, 3, count)
+
+	// AND the same sequence number from another tag isn't a duplicate.
+	other := sampleTx1
+	other.SerNo = 810243
+	wr, err = storer.WriteTx(ctx, other)
+	require.Nil(t, err)
+	require.Equal(t, 2, wr.New)
+}
+
+func TestWriteTxSkipsDuplicatesWithinATx(t *testing.T) {
+	// GIVEN a transmission with one record in it twice
+	storer := newMigratedStorer(t)
+	ctx := context.Background()
+
+	tx := sampleTx1
+	tx.Records = []model.Record{sampleTx1.Records[0], sampleTx1.Records[1], sampleTx1.Records[0]}
+
+	// WHEN it's stored
+	wr, err := storer.WriteTx(ctx, tx)
+	require.Nil(t, err)
+
+	// THEN the repeat is only written once.
+	require.Equal(t, 2, wr.New)
+	require.Equal(t, 1, wr.Duplicates)
+
+	var count int
+	err = storer.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM record;").Scan(&count)
+	require.Nil(t, err)
+	require.Equal(t, 2, count)
+}
+
+func TestWriteTxIsAtomic(t *testing.T) {
+	// GIVEN a transmission whose second record can't be stored
+	storer := newMigratedStorer(t)
+	ctx := context.Background()
+
+	_, err := storer.db.ExecContext(ctx, "DROP TABLE tripTypeReading;")
+	require.Nil(t, err)
+
+	tx := sampleTx1
+	tx.Records = []model.Record{sampleTx1.Records[0], sampleTx1.Records[1]}
+	tx.Records[0].TripTypeReading = nil
+
+	// WHEN it's written
+	_, err = storer.WriteTx(ctx, tx)
+	require.NotNil(t, err)
+
+	// THEN none of it was kept.
+	for _, table := range []string{"tx", "record", "gpsReading"} {
+		var count int
+		err = storer.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table+";").Scan(&count) //nolint:gosec // test code
+		require.Nil(t, err)
+		require.Equal(t, 0, count, table)
+	}
 }
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bitwombat/gps-tags/model"
+)
+
+// GetTrack returns a page of a tag's GPS fixes of at least some quality from
+// one time up to another, oldest first. A fix uploaded more than once is only
+// returned once.
+func (s SqliteStorer) GetTrack(ctx context.Context, serNo int, from, to time.Time, quality FixQuality, page Page) ([]TrackPoint, error) {
+	// SQLite takes the bare columns from the row with the MAX.
+	rows, err := s.db.QueryContext(ctx, `
+SELECT gpsReading.GpsUTC, MAX(gpsReading.Lat), gpsReading.Lng, gpsReading.Alt, gpsReading.Spd, gpsReading.Head,
+	gpsReading.PosAcc, gpsReading.Pdop, gpsReading.GpsStat
+FROM tx
+JOIN record ON record.TxID = tx.ID
+JOIN gpsReading ON gpsReading.RecordID = record.ID
+WHERE tx.SerNo = ? AND gpsReading.GpsUTC >= ? AND gpsReading.GpsUTC < ?
+	AND gpsReading.GpsStat & ? = 0
+	AND (? = 0 OR gpsReading.PosAcc <= ?)
+	AND (? = 0 OR gpsReading.Pdop <= ?)
+GROUP BY gpsReading.GpsUTC
+ORDER BY gpsReading.GpsUTC
+LIMIT ? OFFSET ?;`,
+		serNo, model.Time{T: from}, model.Time{T: to},
+		quality.GpsStatMask,
+		quality.MaxPosAcc, quality.MaxPosAcc,
+		quality.MaxPDOP, quality.MaxPDOP,
+		page.limit(), page.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database for track: %w", err)
+	}
+	defer rows.Close()
+
+	var track []TrackPoint
+
+	for rows.Next() {
+		var gpsUTC model.Time
+		var p TrackPoint
+		err := rows.Scan(&gpsUTC, &p.Latitude, &p.Longitude, &p.Altitude, &p.Speed, &p.Heading, &p.PosAcc, &p.PDOP, &p.GpsStat)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		p.GpsUTC = gpsUTC.T
+		track = append(track, p)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error after scanning rows: %w", err)
+	}
+
+	return track, nil
+}
+
+// GetBatteryHistory returns a page of a tag's battery voltages from one time
+// up to another, oldest first.
+func (s SqliteStorer) GetBatteryHistory(ctx context.Context, serNo int, from, to time.Time, page Page) ([]BatteryReading, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT record.DeviceUTC, MAX(analogueReading.InternalBatteryVoltage)
+FROM tx
+JOIN record ON record.TxID = tx.ID
+JOIN analogueReading ON analogueReading.RecordID = record.ID
+WHERE tx.SerNo = ? AND record.DeviceUTC >= ? AND record.DeviceUTC < ?
+GROUP BY record.DeviceUTC
+ORDER BY record.DeviceUTC
+LIMIT ? OFFSET ?;`,
+		serNo, model.Time{T: from}, model.Time{T: to}, page.limit(), page.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database for battery readings: %w", err)
+	}
+	defer rows.Close()
+
+	var readings []BatteryReading
+
+	for rows.Next() {
+		var deviceUTC model.Time
+		var millivolts int
+		err := rows.Scan(&deviceUTC, &millivolts)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		readings = append(readings, BatteryReading{DeviceUTC: deviceUTC.T, Volts: float64(millivolts) / 1000})
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error after scanning rows: %w", err)
+	}
+
+	return readings, nil
+}
+
+// GetStatus returns a tag's latest record with both a GPS and an analogue
+// reading, as GetLastStatuses does for every tag.
+func (s SqliteStorer) GetStatus(ctx context.Context, serNo int) (Status, error) {
+	var st Status
+	var deviceUTC, gpsUTC model.Time
+
+	err := s.db.QueryRowContext(ctx, `
+SELECT
+	record.SeqNo,
+	record.Reason,
+	gpsReading.Lat,
+	gpsReading.Lng,
+	gpsReading.Alt,
+	gpsReading.Spd,
+	record.DeviceUTC,
+	gpsReading.GpsUTC,
+	gpsReading.PosAcc,
+	gpsReading.GpsStat,
+	analogueReading.InternalBatteryVoltage
+FROM tx
+JOIN record ON record.TxID = tx.ID
+JOIN gpsReading ON gpsReading.RecordID = record.ID
+JOIN analogueReading ON analogueReading.RecordID = record.ID
+WHERE tx.SerNo = ?
+ORDER BY record.DeviceUTC DESC
+LIMIT 1;`, serNo).Scan(
+		&st.SeqNo,
+		&st.Reason,
+		&st.Latitude,
+		&st.Longitude,
+		&st.Altitude,
+		&st.Speed,
+		&deviceUTC,
+		&gpsUTC,
+		&st.PosAcc,
+		&st.GpsStatus,
+		&st.Battery)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Status{}, fmt.Errorf("status of tag %d: %w", serNo, ErrNotFound)
+	}
+	if err != nil {
+		return Status{}, fmt.Errorf("error querying database for status of tag %d: %w", serNo, err)
+	}
+	st.DateUTC, st.GpsUTC = deviceUTC.T, gpsUTC.T
+
+	return st, nil
+}
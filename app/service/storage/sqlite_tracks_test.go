@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bitwombat/gps-tags/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetTrackAndBatteryHistoryPages(t *testing.T) {
+	// GIVEN five records in a day
+	storer := newMigratedStorer(t)
+	ctx := context.Background()
+
+	var records []model.Record
+	for i, ts := range []string{"2025-09-01 01:00:00", "2025-09-01 02:00:00", "2025-09-01 03:00:00", "2025-09-01 04:00:00", "2025-09-01 05:00:00"} {
+		records = append(records, model.Record{
+			SeqNo:           i + 1,
+			DateUTC:         model.Time{T: timeFrom(ts)},
+			GPSReading:      &model.GPSReading{GpsUTC: model.Time{T: timeFrom(ts)}, Lat: float64(i), Long: float64(i)},
+			AnalogueReading: &model.AnalogueReading{InternalBatteryVoltage: 4100 - i*10},
+		})
+	}
+	_, err := storer.WriteTx(ctx, model.TagTx{SerNo: 810095, Records: records})
+	require.Nil(t, err)
+
+	from, to := timeFrom("2025-09-01 00:00:00"), timeFrom("2025-09-02 00:00:00")
+
+	// WHEN the second page of two is got
+	track, err := storer.GetTrack(ctx, 810095, from, to, AnyValidFix, Page{Limit: 2, Offset: 2})
+	require.Nil(t, err)
+	battery, err := storer.GetBatteryHistory(ctx, 810095, from, to, Page{Limit: 2, Offset: 2})
+	require.Nil(t, err)
+
+	// THEN it's the third and fourth.
+	require.Equal(t, []TrackPoint{
+		{GpsUTC: timeFrom("2025-09-01 03:00:00"), Latitude: 2, Longitude: 2},
+		{GpsUTC: timeFrom("2025-09-01 04:00:00"), Latitude: 3, Longitude: 3},
+	}, track)
+	require.Equal(t, []BatteryReading{
+		{DeviceUTC: timeFrom("2025-09-01 03:00:00"), Volts: 4.08},
+		{DeviceUTC: timeFrom("2025-09-01 04:00:00"), Volts: 4.07},
+	}, battery)
+
+	// AND the zero page is all of them.
+	track, err = storer.GetTrack(ctx, 810095, from, to, AnyValidFix, Page{})
+	require.Nil(t, err)
+	require.Len(t, track, 5)
+}
+
+func TestGetTrackFixQuality(t *testing.T) {
+	// GIVEN readings of every quality
+	storer := newMigratedStorer(t)
+	ctx := context.Background()
+
+	reading := func(seqNo int, ts string, gpsStat, posAcc, pdop int) model.Record {
+		return model.Record{
+			SeqNo:   seqNo,
+			DateUTC: model.Time{T: timeFrom(ts)},
+			GPSReading: &model.GPSReading{
+				GpsUTC: model.Time{T: timeFrom(ts)}, Lat: -31.5, Long: 152.6,
+				Alt: 40, Spd: 6, Head: 90, GpsStat: gpsStat, PosAcc: posAcc, PDOP: pdop,
+			},
+		}
+	}
+	_, err := storer.WriteTx(ctx, model.TagTx{SerNo: 810095, Records: []model.Record{
+		reading(1, "2025-09-01 01:00:00", 3, 5, 12),  // Good
+		reading(2, "2025-09-01 02:00:00", 4, 5, 12),  // No fix
+		reading(3, "2025-09-01 03:00:00", 3, 80, 12), // Inaccurate
+		reading(4, "2025-09-01 04:00:00", 3, 5, 60),  // Poor geometry
+		reading(5, "2025-09-01 05:00:00", 1, 5, 12),  // Good, without the 2 bit
+	}})
+	require.Nil(t, err)
+
+	from, to := timeFrom("2025-09-01 00:00:00"), timeFrom("2025-09-02 00:00:00")
+	times := func(track []TrackPoint) []string {
+		var ts []string
+		for _, p := range track {
+			ts = append(ts, p.GpsUTC.Format("15:04"))
+		}
+		return ts
+	}
+
+	for _, tc := range []struct {
+		name    string
+		quality FixQuality
+		want    []string
+	}{
+		{"anything", FixQuality{}, []string{"01:00", "02:00", "03:00", "04:00", "05:00"}},
+		{"valid fixes", AnyValidFix, []string{"01:00", "03:00", "04:00", "05:00"}},
+		{"accurate", FixQuality{GpsStatMask: GpsStatNoFix, MaxPosAcc: 20}, []string{"01:00", "04:00", "05:00"}},
+		{"good geometry", FixQuality{GpsStatMask: GpsStatNoFix, MaxPosAcc: 20, MaxPDOP: 30}, []string{"01:00", "05:00"}},
+		{"more status bits", FixQuality{GpsStatMask: GpsStatNoFix | 2, MaxPosAcc: 20, MaxPDOP: 30}, []string{"05:00"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			track, err := storer.GetTrack(ctx, 810095, from, to, tc.quality, Page{})
+			require.Nil(t, err)
+			require.Equal(t, tc.want, times(track))
+		})
+	}
+
+	// Each point has all its details.
+	track, err := storer.GetTrack(ctx, 810095, from, to, AnyValidFix, Page{Limit: 1})
+	require.Nil(t, err)
+	require.Equal(t, []TrackPoint{{
+		GpsUTC: from.Add(time.Hour), Latitude: -31.5, Longitude: 152.6,
+		Altitude: 40, Speed: 6, Heading: 90, PosAcc: 5, PDOP: 12, GpsStat: 3,
+	}}, track)
+}
+
+func TestGetStatus(t *testing.T) {
+	storer := newMigratedStorer(t)
+	ctx := context.Background()
+
+	// A tag that's never uploaded has no status.
+	_, err := storer.GetStatus(ctx, 810095)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// GIVEN two records
+	_, err = storer.WriteTx(ctx, model.TagTx{SerNo: 810095, Records: []model.Record{
+		{
+			SeqNo:           1,
+			DateUTC:         model.Time{T: timeFrom("2025-09-01 11:00:00")},
+			GPSReading:      &model.GPSReading{GpsUTC: model.Time{T: timeFrom("2025-09-01 11:00:00")}, Lat: -31.4, Long: 152.5},
+			AnalogueReading: &model.AnalogueReading{InternalBatteryVoltage: 4100},
+		},
+		{
+			SeqNo:           2,
+			Reason:          11,
+			DateUTC:         model.Time{T: timeFrom("2025-09-01 12:00:00")},
+			GPSReading:      &model.GPSReading{GpsUTC: model.Time{T: timeFrom("2025-09-01 11:55:00")}, Lat: -31.5, Long: 152.6, Alt: 40, Spd: 3, PosAcc: 5},
+			AnalogueReading: &model.AnalogueReading{InternalBatteryVoltage: 4090},
+		},
+	}})
+	require.Nil(t, err)
+
+	// WHEN its status is got
+	got, err := storer.GetStatus(ctx, 810095)
+	require.Nil(t, err)
+
+	// THEN it's the latest record.
+	require.Equal(t, Status{
+		SeqNo:     2,
+		Reason:    11,
+		Latitude:  -31.5,
+		Longitude: 152.6,
+		Altitude:  40,
+		Speed:     3,
+		DateUTC:   timeFrom("2025-09-01 12:00:00"),
+		GpsUTC:    timeFrom("2025-09-01 11:55:00"),
+		PosAcc:    5,
+		Battery:   4090,
+	}, got)
+}
@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/bitwombat/gps-tags/model"
+)
+
+// GetFixesAfter returns a tag's valid GPS fixes after a time, oldest first.
+// A fix uploaded more than once is only returned once.
+func (s SqliteStorer) GetFixesAfter(ctx context.Context, serNo int, after time.Time) ([]Fix, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT gpsReading.GpsUTC, MAX(gpsReading.Lat), MAX(gpsReading.Lng)
+FROM tx
+JOIN record ON record.TxID = tx.ID
+JOIN gpsReading ON gpsReading.RecordID = record.ID
+WHERE tx.SerNo = ? AND gpsReading.GpsStat & ? = 0 AND gpsReading.GpsUTC > ?
+GROUP BY gpsReading.GpsUTC
+ORDER BY gpsReading.GpsUTC;`,
+		serNo, AnyValidFix.GpsStatMask, model.Time{T: after})
+	if err != nil {
+		return nil, fmt.Errorf("error querying database for fixes: %w", err)
+	}
+	defer rows.Close()
+
+	var fixes []Fix
+
+	for rows.Next() {
+		var gpsUTC model.Time
+		var f Fix
+		err := rows.Scan(&gpsUTC, &f.Latitude, &f.Longitude)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		f.GpsUTC = gpsUTC.T
+		fixes = append(fixes, f)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error after scanning rows: %w", err)
+	}
+
+	return fixes, nil
+}
+
+const zoneVisitColumns = `ID, SerNo, Zone, Entered, LastSeen, Exited`
+
+func scanZoneVisits(rows *sql.Rows) ([]model.ZoneVisit, error) {
+	var visits []model.ZoneVisit
+
+	for rows.Next() {
+		var v model.ZoneVisit
+		var entered, lastSeen, exited model.Time
+		err := rows.Scan(&v.ID, &v.SerNo, &v.Zone, &entered, &lastSeen, &exited)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		v.Entered, v.LastSeen, v.Exited = entered.T, lastSeen.T, exited.T
+		visits = append(visits, v)
+	}
+
+	err := rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error after scanning rows: %w", err)
+	}
+
+	return visits, nil
+}
+
+// GetLatestZoneVisit returns the tag's most recent zone visit, or ErrNotFound
+// if it hasn't got one.
+func (s SqliteStorer) GetLatestZoneVisit(ctx context.Context, serNo int) (model.ZoneVisit, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+zoneVisitColumns+` FROM zoneVisit
+WHERE SerNo = ? ORDER BY Entered DESC LIMIT 1;`, serNo)
+	if err != nil {
+		return model.ZoneVisit{}, fmt.Errorf("error querying database for latest zone visit: %w", err)
+	}
+	defer rows.Close()
+
+	visits, err := scanZoneVisits(rows)
+	if err != nil {
+		return model.ZoneVisit{}, err
+	}
+	if len(visits) == 0 {
+		return model.ZoneVisit{}, ErrNotFound
+	}
+
+	return visits[0], nil
+}
+
+// SaveZoneVisits stores visits all together, updating those that have an ID
+// and adding those that don't.
+func (s SqliteStorer) SaveZoneVisits(ctx context.Context, visits []model.ZoneVisit) error {
+	dbTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting database transaction: %w", err)
+	}
+	defer dbTx.Rollback() //nolint:errcheck // no-op after commit
+
+	err = saveZoneVisits(ctx, dbTx, visits)
+	if err != nil {
+		return err
+	}
+
+	err = dbTx.Commit()
+	if err != nil {
+		return fmt.Errorf("error committing zone visits: %w", err)
+	}
+
+	return nil
+}
+
+// ReplaceZoneVisits removes all zone visits and stores new ones in their
+// place (e.g. worked out again after the zones change), all together, so
+// there's never a time with no history.
+func (s SqliteStorer) ReplaceZoneVisits(ctx context.Context, visits []model.ZoneVisit) error {
+	dbTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting database transaction: %w", err)
+	}
+	defer dbTx.Rollback() //nolint:errcheck // no-op after commit
+
+	_, err = dbTx.ExecContext(ctx, `DELETE FROM zoneVisit;`)
+	if err != nil {
+		return fmt.Errorf("error deleting zone visits: %w", err)
+	}
+
+	err = saveZoneVisits(ctx, dbTx, visits)
+	if err != nil {
+		return err
+	}
+
+	err = dbTx.Commit()
+	if err != nil {
+		return fmt.Errorf("error committing zone visits: %w", err)
+	}
+
+	return nil
+}
+
+func saveZoneVisits(ctx context.Context, dbTx *sql.Tx, visits []model.ZoneVisit) error {
+	for _, v := range visits {
+		var exited any
+		if !v.Exited.IsZero() {
+			exited = model.Time{T: v.Exited}
+		}
+
+		var err error
+		if v.ID == 0 {
+			_, err = dbTx.ExecContext(ctx, `INSERT INTO zoneVisit (SerNo, Zone, Entered, LastSeen, Exited)
+VALUES (?, ?, ?, ?, ?);`,
+				v.SerNo, v.Zone, model.Time{T: v.Entered}, model.Time{T: v.LastSeen}, exited)
+		} else {
+			_, err = dbTx.ExecContext(ctx, `UPDATE zoneVisit SET LastSeen = ?, Exited = ? WHERE ID = ?;`,
+				model.Time{T: v.LastSeen}, exited, v.ID)
+		}
+		if err != nil {
+			return fmt.Errorf("error saving zone visit to %q for %d: %w", v.Zone, v.SerNo, err)
+		}
+	}
+
+	return nil
+}
+
+// GetZoneVisits returns a tag's zone visits that overlap the time from from
+// to to, oldest first.
+func (s SqliteStorer) GetZoneVisits(ctx context.Context, serNo int, from, to time.Time) ([]model.ZoneVisit, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+zoneVisitColumns+` FROM zoneVisit
+WHERE SerNo = ? AND Entered < ? AND COALESCE(Exited, LastSeen) > ?
+ORDER BY Entered;`, serNo, model.Time{T: to}, model.Time{T: from})
+	if err != nil {
+		return nil, fmt.Errorf("error querying database for zone visits: %w", err)
+	}
+	defer rows.Close()
+
+	return scanZoneVisits(rows)
+}
+
+// GetLastZoneVisits returns a tag's most recent visit to each zone it's been
+// in, in zone name order.
+func (s SqliteStorer) GetLastZoneVisits(ctx context.Context, serNo int) ([]model.ZoneVisit, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+zoneVisitColumns+` FROM (
+    SELECT *, ROW_NUMBER() OVER (PARTITION BY Zone ORDER BY Entered DESC) AS rn
+    FROM zoneVisit
+    WHERE SerNo = ? AND Zone != ''
+)
+WHERE rn = 1
+ORDER BY Zone;`, serNo)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database for last zone visits: %w", err)
+	}
+	defer rows.Close()
+
+	return scanZoneVisits(rows)
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bitwombat/gps-tags/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetFixesAfter(t *testing.T) {
+	// GIVEN a tag's fixes, one of them without a valid position and one sent twice
+	storer := newMigratedStorer(t)
+	ctx := context.Background()
+
+	gps := func(ts string, lat float64, stat int) *model.GPSReading {
+		return &model.GPSReading{GpsUTC: model.Time{T: timeFrom(ts)}, Lat: lat, Long: lat + 1, GpsStat: stat}
+	}
+	_, err := storer.WriteTx(ctx, model.TagTx{SerNo: 810095, Records: []model.Record{
+		{SeqNo: 1, GPSReading: gps("2025-09-01 12:00:00", 10, 0)},
+		{SeqNo: 2, GPSReading: gps("2025-09-01 12:05:00", 20, 0)},
+		{SeqNo: 3, GPSReading: gps("2025-09-01 12:10:00", 30, 4)},
+		{SeqNo: 4, GPSReading: gps("2025-09-01 12:15:00", 40, 0)},
+		{SeqNo: 5, GPSReading: gps("2025-09-01 12:15:00", 40, 0)},
+	}})
+	require.Nil(t, err)
+	_, err = storer.WriteTx(ctx, model.TagTx{SerNo: 810243, Records: []model.Record{
+		{SeqNo: 1, GPSReading: gps("2025-09-01 12:20:00", 50, 0)},
+	}})
+	require.Nil(t, err)
+
+	// WHEN we get the fixes after the first one
+	fixes, err := storer.GetFixesAfter(ctx, 810095, timeFrom("2025-09-01 12:00:00"))
+	require.Nil(t, err)
+
+	// THEN we get the valid ones, once each, oldest first, for that tag only.
+	require.Equal(t, []Fix{
+		{GpsUTC: timeFrom("2025-09-01 12:05:00"), Latitude: 20, Longitude: 21},
+		{GpsUTC: timeFrom("2025-09-01 12:15:00"), Latitude: 40, Longitude: 41},
+	}, fixes)
+}
+
+func TestZoneVisits(t *testing.T) {
+	// GIVEN a freshly migrated database
+	storer := newMigratedStorer(t)
+	ctx := context.Background()
+
+	// THEN there's no latest visit.
+	_, err := storer.GetLatestZoneVisit(ctx, 810095)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// WHEN we save some visits, the last one still going
+	err = storer.SaveZoneVisits(ctx, []model.ZoneVisit{
+		{SerNo: 810095, Zone: "East dam", Entered: timeFrom("2025-09-01 08:00:00"), LastSeen: timeFrom("2025-09-01 09:50:00"), Exited: timeFrom("2025-09-01 10:00:00")},
+		{SerNo: 810095, Zone: "", Entered: timeFrom("2025-09-01 10:00:00"), LastSeen: timeFrom("2025-09-01 10:30:00"), Exited: timeFrom("2025-09-01 11:00:00")},
+		{SerNo: 810095, Zone: "East dam", Entered: timeFrom("2025-09-01 11:00:00"), LastSeen: timeFrom("2025-09-01 11:00:00")},
+		{SerNo: 810243, Zone: "House", Entered: timeFrom("2025-09-01 07:00:00"), LastSeen: timeFrom("2025-09-01 12:00:00")},
+	})
+	require.Nil(t, err)
+
+	// THEN the latest one is still open
+	latest, err := storer.GetLatestZoneVisit(ctx, 810095)
+	require.Nil(t, err)
+	require.Equal(t, "East dam", latest.Zone)
+	require.True(t, latest.Exited.IsZero())
+
+	// WHEN it's extended and closed
+	latest.LastSeen = timeFrom("2025-09-01 12:00:00")
+	latest.Exited = timeFrom("2025-09-01 12:10:00")
+	err = storer.SaveZoneVisits(ctx, []model.ZoneVisit{latest})
+	require.Nil(t, err)
+
+	// THEN it's updated, not added
+	got, err := storer.GetLatestZoneVisit(ctx, 810095)
+	require.Nil(t, err)
+	require.Equal(t, latest, got)
+
+	// AND visits overlapping a time range are found, oldest first
+	visits, err := storer.GetZoneVisits(ctx, 810095, timeFrom("2025-09-01 09:00:00"), timeFrom("2025-09-01 10:30:00"))
+	require.Nil(t, err)
+	require.Len(t, visits, 2)
+	require.Equal(t, timeFrom("2025-09-01 08:00:00"), visits[0].Entered)
+	require.Equal(t, "", visits[1].Zone)
+
+	// AND the last visit to each named zone is found.
+	last, err := storer.GetLastZoneVisits(ctx, 810095)
+	require.Nil(t, err)
+	require.Len(t, last, 1)
+	require.Equal(t, latest, last[0])
+
+	// WHEN they're replaced
+	err = storer.ReplaceZoneVisits(ctx, []model.ZoneVisit{
+		{SerNo: 810095, Zone: "House", Entered: timeFrom("2025-09-01 08:00:00"), LastSeen: timeFrom("2025-09-01 12:00:00")},
+	})
+	require.Nil(t, err)
+
+	// THEN only the new ones are there.
+	_, err = storer.GetLatestZoneVisit(ctx, 810243)
+	require.ErrorIs(t, err, ErrNotFound)
+	visits, err = storer.GetZoneVisits(ctx, 810095, timeFrom("2025-09-01 00:00:00"), timeFrom("2025-09-02 00:00:00"))
+	require.Nil(t, err)
+	require.Len(t, visits, 1)
+	require.Equal(t, "House", visits[0].Zone)
+}
@@ -1,11 +1,25 @@
 package storage
 
 import (
+	"errors"
 	"time"
 
 	"github.com/bitwombat/gps-tags/model"
 )
 
+// ErrNotFound is returned when a lookup by key finds nothing.
+var ErrNotFound = errors.New("not found")
+
+// ErrExists is returned when adding something whose key is already taken.
+var ErrExists = errors.New("already exists")
+
+// WriteResult says what WriteTx did with a transmission's records.
+type WriteResult struct {
+	TxID       string // Empty if nothing was written
+	New        int
+	Duplicates int
+}
+
 type Status struct {
 	SeqNo     int32
 	Reason    model.ReasonCode
@@ -22,9 +36,64 @@ type Status struct {
 
 type Statuses map[int32]Status
 
-type Coord struct {
+// Fix is one valid GPS position of a tag.
+type Fix struct {
+	GpsUTC    time.Time
 	Latitude  float64
 	Longitude float64
 }
 
-type Coords map[int32][]Coord
+// TrackPoint is one GPS fix in a tag's track.
+type TrackPoint struct {
+	GpsUTC    time.Time
+	Latitude  float64
+	Longitude float64
+	Altitude  int // Metres
+	Speed     int // km/h
+	Heading   int // Degrees clockwise from north
+	PosAcc    int // Metres
+	PDOP      int // Tenths
+	GpsStat   int
+}
+
+// GpsStatNoFix is the GpsStat bit set when a reading isn't a valid fix.
+const GpsStatNoFix = 4
+
+// FixQuality says which fixes are good enough to be in a track.
+type FixQuality struct {
+	GpsStatMask int // Fixes with any of these GpsStat bits set are left out
+	MaxPosAcc   int // Metres. 0 for any.
+	MaxPDOP     int // Tenths. 0 for any.
+}
+
+// AnyValidFix leaves out only readings that aren't fixes.
+var AnyValidFix = FixQuality{GpsStatMask: GpsStatNoFix}
+
+// Page is which part of a long list to return. The zero Page is all of it.
+type Page struct {
+	Limit  int // 0 for no limit
+	Offset int
+}
+
+// limit is Limit for SQL, where -1 is no limit.
+func (p Page) limit() int {
+	if p.Limit == 0 {
+		return -1
+	}
+
+	return p.Limit
+}
+
+// LastSeen is when a tag last checked in, and where it last had a fix.
+type LastSeen struct {
+	SerNo     int
+	DeviceUTC time.Time
+	HasFix    bool // Whether it's ever had a valid fix
+	Fix       Fix  // The latest valid fix
+}
+
+// BatteryReading is a tag's battery voltage at a time.
+type BatteryReading struct {
+	DeviceUTC time.Time
+	Volts     float64
+}
@@ -7,8 +7,8 @@ import (
 	"text/template"
 )
 
-// ContentsOf substitutes contents of the file at the filename with the substitutions.
-func ContentsOf(path string, subs map[string]string) (string, error) {
+// ContentsOf executes the file at the filename as a template, with data.
+func ContentsOf(path string, data any) (string, error) {
 	asBytes, err := os.ReadFile(path)
 	if err != nil {
 		return "", err
@@ -23,7 +23,7 @@ func ContentsOf(path string, subs map[string]string) (string, error) {
 
 	var w io.Writer = &buf
 
-	err = tmpl.Execute(w, subs)
+	err = tmpl.Execute(w, data)
 	if err != nil {
 		return "", err
 	}
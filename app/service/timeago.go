@@ -41,9 +41,10 @@ const (
 	deadColour  = "#8d8d8d"
 )
 
-func timeAgoInColour(t time.Time, now func() time.Time) string {
-	const heartBeatTime = 10 * time.Minute
+// heartBeatTime is how often a tag reports in when all's well.
+const heartBeatTime = 10 * time.Minute
 
+func timeAgoInColour(t time.Time, now func() time.Time) string {
 	// Calculate the difference
 	diff := now().Sub(t)
 
@@ -0,0 +1,68 @@
+package tracks
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// The parts of a GeoJSON (RFC 7946) FeatureCollection we write.
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+type geoJSONFeature struct {
+	Type       string            `json:"type"`
+	Properties geoJSONProperties `json:"properties"`
+	Geometry   geoJSONGeometry   `json:"geometry"`
+}
+
+// geoJSONProperties has each position's time in coordinateProperties, as
+// togeojson writes them from GPX and KML tracks.
+type geoJSONProperties struct {
+	Name                 string `json:"name"`
+	CoordinateProperties struct {
+		Times []string `json:"times"`
+	} `json:"coordinateProperties"`
+}
+
+type geoJSONGeometry struct {
+	Type        string `json:"type"`
+	Coordinates any    `json:"coordinates"`
+}
+
+// A position is [lng, lat, alt].
+type geoJSONPosition [3]float64
+
+// MarshalGeoJSON returns the track as a FeatureCollection of one LineString
+// Feature. A LineString needs two positions, so a track of one point is a
+// Point, and an empty track has no Features.
+func MarshalGeoJSON(track Track) ([]byte, error) {
+	fc := geoJSONFeatureCollection{Type: "FeatureCollection", Features: []geoJSONFeature{}}
+
+	if len(track.Points) > 0 {
+		f := geoJSONFeature{Type: "Feature"}
+		f.Properties.Name = track.Name
+
+		positions := make([]geoJSONPosition, 0, len(track.Points))
+		for _, p := range track.Points {
+			positions = append(positions, geoJSONPosition{p.Longitude, p.Latitude, p.Altitude})
+			f.Properties.CoordinateProperties.Times = append(f.Properties.CoordinateProperties.Times, timestamp(p.Time))
+		}
+
+		if len(positions) == 1 {
+			f.Geometry = geoJSONGeometry{Type: "Point", Coordinates: positions[0]}
+		} else {
+			f.Geometry = geoJSONGeometry{Type: "LineString", Coordinates: positions}
+		}
+
+		fc.Features = append(fc.Features, f)
+	}
+
+	blob, err := json.Marshal(fc)
+	if err != nil {
+		return nil, fmt.Errorf("while marshalling GeoJSON: %w", err)
+	}
+
+	return blob, nil
+}
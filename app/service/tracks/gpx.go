@@ -0,0 +1,54 @@
+package tracks
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// The parts of a GPX 1.1 document we write. Elements must be in the order the
+// schema gives.
+type gpxDocument struct {
+	XMLName xml.Name `xml:"http://www.topografix.com/GPX/1/1 gpx"`
+	Version string   `xml:"version,attr"`
+	Creator string   `xml:"creator,attr"`
+	Name    string   `xml:"metadata>name"`
+	Track   gpxTrack `xml:"trk"`
+}
+
+type gpxTrack struct {
+	Name   string     `xml:"name"`
+	Points []gpxPoint `xml:"trkseg>trkpt"`
+}
+
+type gpxPoint struct {
+	Lat  float64  `xml:"lat,attr"`
+	Lon  float64  `xml:"lon,attr"`
+	Ele  float64  `xml:"ele"`
+	Time string   `xml:"time"`
+	PDOP *float64 `xml:"pdop,omitempty"`
+}
+
+// MarshalGPX returns the track as a GPX 1.1 document with one track segment.
+func MarshalGPX(track Track) ([]byte, error) {
+	doc := gpxDocument{
+		Version: "1.1",
+		Creator: "gps-tags",
+		Name:    track.Name,
+		Track:   gpxTrack{Name: track.Name},
+	}
+
+	for _, p := range track.Points {
+		gp := gpxPoint{Lat: p.Latitude, Lon: p.Longitude, Ele: p.Altitude, Time: timestamp(p.Time)}
+		if p.PDOP > 0 {
+			gp.PDOP = &p.PDOP
+		}
+		doc.Track.Points = append(doc.Track.Points, gp)
+	}
+
+	blob, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("while marshalling GPX: %w", err)
+	}
+
+	return append([]byte(xml.Header), blob...), nil
+}
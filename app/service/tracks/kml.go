@@ -0,0 +1,52 @@
+package tracks
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// The parts of a KML document we write. A gx:Track is all its times, then
+// all its positions, in the same order.
+type kmlDocument struct {
+	XMLName   xml.Name     `xml:"http://www.opengis.net/kml/2.2 kml"`
+	GX        string       `xml:"xmlns:gx,attr"`
+	Name      string       `xml:"Document>name"`
+	Placemark kmlPlacemark `xml:"Document>Placemark"`
+}
+
+type kmlPlacemark struct {
+	Name  string   `xml:"name"`
+	Track kmlTrack `xml:"gx:Track"`
+}
+
+type kmlTrack struct {
+	// Left out, altitudeMode is clampToGround: tracks sit on the terrain,
+	// where the zones are drawn, rather than wherever the GPS thought the
+	// altitude was. The altitudes are still there for anything that wants
+	// them.
+	When  []string `xml:"when"`
+	Coord []string `xml:"gx:coord"`
+}
+
+// MarshalKML returns the track as a KML document with one Placemark holding
+// a gx:Track, which Google Earth can play back with its time slider.
+func MarshalKML(track Track) ([]byte, error) {
+	doc := kmlDocument{
+		GX:        "http://www.google.com/kml/ext/2.2",
+		Name:      track.Name,
+		Placemark: kmlPlacemark{Name: track.Name},
+	}
+
+	for _, p := range track.Points {
+		doc.Placemark.Track.When = append(doc.Placemark.Track.When, timestamp(p.Time))
+		// gx:coord is lng lat alt, separated by spaces, unlike coordinates.
+		doc.Placemark.Track.Coord = append(doc.Placemark.Track.Coord, fmt.Sprintf("%v %v %v", p.Longitude, p.Latitude, p.Altitude))
+	}
+
+	blob, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("while marshalling KML: %w", err)
+	}
+
+	return append([]byte(xml.Header), blob...), nil
+}
@@ -0,0 +1,24 @@
+// Package tracks writes a tag's track out in formats mapping apps can load:
+// GPX 1.1, KML (as a time-stamped gx:Track) and GeoJSON.
+package tracks
+
+import "time"
+
+// Track is where one tag went, oldest point first.
+type Track struct {
+	Name   string
+	Points []Point
+}
+
+type Point struct {
+	Time      time.Time
+	Latitude  float64
+	Longitude float64
+	Altitude  float64 // Metres
+	PDOP      float64 // 0 if not known
+}
+
+// timestamp is how all three formats write a time.
+func timestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,130 @@
+package tracks
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testTrack = Track{
+	Name: "Rueger",
+	Points: []Point{
+		{Time: time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC), Latitude: -31.5, Longitude: 152.6, Altitude: 40, PDOP: 1.4},
+		{Time: time.Date(2025, 9, 1, 22, 5, 0, 0, time.FixedZone("AEST", 10*60*60)), Latitude: -31.25, Longitude: 152.75, Altitude: 42.5},
+	},
+}
+
+func TestMarshalGPX(t *testing.T) {
+	// WHEN a track is written as GPX
+	blob, err := MarshalGPX(testTrack)
+	require.Nil(t, err)
+
+	// THEN it's GPX 1.1, with each point's position, elevation and time (in
+	// UTC), and PDOP if it's known.
+	require.True(t, strings.HasPrefix(string(blob), xml.Header))
+
+	var got struct {
+		XMLName xml.Name
+		Version string `xml:"version,attr"`
+		Name    string `xml:"trk>name"`
+		Points  []struct {
+			Lat  float64  `xml:"lat,attr"`
+			Lon  float64  `xml:"lon,attr"`
+			Ele  float64  `xml:"ele"`
+			Time string   `xml:"time"`
+			PDOP *float64 `xml:"pdop"`
+		} `xml:"trk>trkseg>trkpt"`
+	}
+	err = xml.Unmarshal(blob, &got)
+	require.Nil(t, err)
+
+	require.Equal(t, xml.Name{Space: "http://www.topografix.com/GPX/1/1", Local: "gpx"}, got.XMLName)
+	require.Equal(t, "1.1", got.Version)
+	require.Equal(t, "Rueger", got.Name)
+	require.Len(t, got.Points, 2)
+	require.Equal(t, -31.5, got.Points[0].Lat)
+	require.Equal(t, 152.6, got.Points[0].Lon)
+	require.Equal(t, 40.0, got.Points[0].Ele)
+	require.Equal(t, "2025-09-01T12:00:00Z", got.Points[0].Time)
+	require.Equal(t, 1.4, *got.Points[0].PDOP)
+	require.Equal(t, "2025-09-01T12:05:00Z", got.Points[1].Time)
+	require.Nil(t, got.Points[1].PDOP)
+}
+
+func TestMarshalKML(t *testing.T) {
+	// WHEN a track is written as KML
+	blob, err := MarshalKML(testTrack)
+	require.Nil(t, err)
+
+	// THEN it's a gx:Track of the times, then the positions.
+	require.Contains(t, string(blob), `xmlns:gx="http://www.google.com/kml/ext/2.2"`)
+	require.Contains(t, string(blob), `<gx:Track>
+        <when>2025-09-01T12:00:00Z</when>
+        <when>2025-09-01T12:05:00Z</when>
+        <gx:coord>152.6 -31.5 40</gx:coord>
+        <gx:coord>152.75 -31.25 42.5</gx:coord>
+      </gx:Track>`)
+
+	// AND it's well-formed.
+	var got struct {
+		Name string `xml:"Document>Placemark>name"`
+	}
+	err = xml.Unmarshal(blob, &got)
+	require.Nil(t, err)
+	require.Equal(t, "Rueger", got.Name)
+}
+
+func TestMarshalGeoJSON(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		points       []Point
+		wantFeatures int
+		wantType     string
+	}{
+		{"a line", testTrack.Points, 1, "LineString"},
+		{"one point", testTrack.Points[:1], 1, "Point"},
+		{"nothing", nil, 0, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			blob, err := MarshalGeoJSON(Track{Name: "Rueger", Points: tc.points})
+			require.Nil(t, err)
+
+			var got struct {
+				Type     string `json:"type"`
+				Features []struct {
+					Properties struct {
+						Name                 string `json:"name"`
+						CoordinateProperties struct {
+							Times []string `json:"times"`
+						} `json:"coordinateProperties"`
+					} `json:"properties"`
+					Geometry struct {
+						Type        string          `json:"type"`
+						Coordinates json.RawMessage `json:"coordinates"`
+					} `json:"geometry"`
+				} `json:"features"`
+			}
+			err = json.Unmarshal(blob, &got)
+			require.Nil(t, err)
+
+			require.Equal(t, "FeatureCollection", got.Type)
+			require.Len(t, got.Features, tc.wantFeatures)
+			if tc.wantFeatures == 0 {
+				return
+			}
+
+			f := got.Features[0]
+			require.Equal(t, tc.wantType, f.Geometry.Type)
+			require.Equal(t, "Rueger", f.Properties.Name)
+			require.Equal(t, "2025-09-01T12:00:00Z", f.Properties.CoordinateProperties.Times[0])
+			require.Len(t, f.Properties.CoordinateProperties.Times, len(tc.points))
+			if tc.wantType == "LineString" {
+				require.JSONEq(t, `[[152.6,-31.5,40],[152.75,-31.25,42.5]]`, string(f.Geometry.Coordinates))
+			}
+		})
+	}
+}
@@ -4,21 +4,24 @@ import (
 	"time"
 
 	"github.com/bitwombat/gps-tags/model"
+	"github.com/bitwombat/gps-tags/registry"
 	"github.com/bitwombat/gps-tags/zones"
 )
 
 type txLogger struct {
-	namedZones []zones.Zone
+	zones *zoneHolder
+	tags  *registry.Registry
 }
 
 func (txl txLogger) Log(now func() time.Time, tagData model.TagTx) {
-	dogName := model.UpperSerNoToName(tagData.SerNo)
+	dogName := txl.tags.UpperName(tagData.SerNo)
+	namedZones := txl.zones.Get().named
 
 	for _, r := range tagData.Records {
 		var thisZoneText string
 
 		if r.GPSReading != nil {
-			thisZoneText = zones.NameThatZone(txl.namedZones, zones.Point{Latitude: r.GPSReading.Lat, Longitude: r.GPSReading.Long})
+			thisZoneText = zones.NameThatZone(namedZones, zones.Point{Latitude: r.GPSReading.Lat, Longitude: r.GPSReading.Long})
 
 			infoLogger.Printf("%v/%s  %s (%s ago) \"%v\"  %s (%s ago) %0.7f,%0.7f \"%s\"\n",
 				tagData.SerNo,
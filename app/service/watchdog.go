@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bitwombat/gps-tags/notify"
+	oshotpkg "github.com/bitwombat/gps-tags/oneshot"
+	"github.com/bitwombat/gps-tags/registry"
+	"github.com/bitwombat/gps-tags/storage"
+	zonespkg "github.com/bitwombat/gps-tags/zones"
+)
+
+// LastSeenReader handles reading when tags last checked in.
+type LastSeenReader interface {
+	GetLastSeen(context.Context) ([]storage.LastSeen, error)
+}
+
+// watchdog notifies when an active tag stops checking in for longer than
+// silentAfter, or keeps checking in without a valid GPS fix for longer than
+// staleFixAfter, and again when that's over. 0 turns either off.
+type watchdog struct {
+	storer        LastSeenReader
+	zones         *zoneHolder
+	oneShot       oshotpkg.OneShot
+	notifier      notify.Notifier
+	tags          *registry.Registry
+	silentAfter   time.Duration
+	staleFixAfter time.Duration
+	now           func() time.Time
+}
+
+// Check sends the notifications for tags that have gone silent or lost their
+// fix, or come back, since the last check.
+func (w watchdog) Check(ctx context.Context) error {
+	lastSeen, err := w.storer.GetLastSeen(ctx)
+	if err != nil {
+		return fmt.Errorf("getting last check-ins: %w", err)
+	}
+
+	namedZones := w.zones.Get().named
+
+	for _, ls := range lastSeen {
+		tag, ok := w.tags.Lookup(ls.SerNo)
+		if !ok || !tag.Active {
+			continue
+		}
+
+		dogName := w.tags.UpperName(ls.SerNo)
+		position := lastKnownPosition(ls, namedZones, w.now)
+		isSilent := w.silentAfter > 0 && w.now().Sub(ls.DeviceUTC) > w.silentAfter
+
+		base := notify.Event{SerNo: ls.SerNo, Tag: tag.Name, Time: ls.DeviceUTC}
+		if ls.HasFix {
+			base.HasPosition = true
+			base.Latitude, base.Longitude = ls.Fix.Latitude, ls.Fix.Longitude
+		}
+		event := func(kind string, severity notify.Severity, title, message string) notify.Event {
+			e := base
+			e.Kind = kind
+			e.Severity = severity
+			e.Title = notify.Title(title)
+			e.Message = notify.Message(message)
+
+			return e
+		}
+
+		if w.silentAfter > 0 {
+			err := w.oneShot.SetReset(eventKey(ls.SerNo, "silent"),
+				oshotpkg.Config{
+					SetIf: isSilent,
+					OnSet: makeNotifier(ctx, w.notifier,
+						event(notify.EventSilent, notify.SeverityWarning, dogName+" has gone silent",
+							fmt.Sprintf("No check-in for %s.\n%s", timeAgoAsText(ls.DeviceUTC, w.now), position))),
+					ResetIf: !isSilent,
+					OnReset: makeNotifier(ctx, w.notifier,
+						event(notify.EventReporting, notify.SeverityInfo, dogName+" is checking in again", position)),
+				})
+			if err != nil {
+				debugLogger.Println("error when setting: ", err) // notifications are not important enough to return an error.
+			}
+		}
+
+		if w.staleFixAfter > 0 {
+			// A silent tag's fix is as old as its last check-in, which says
+			// enough already. Neither is set nor reset until it checks in.
+			isFresh := ls.HasFix && ls.DeviceUTC.Sub(ls.Fix.GpsUTC) <= w.staleFixAfter
+			err := w.oneShot.SetReset(eventKey(ls.SerNo, "staleFix"),
+				oshotpkg.Config{
+					SetIf: !isFresh && !isSilent,
+					OnSet: makeNotifier(ctx, w.notifier,
+						event(notify.EventStaleFix, notify.SeverityWarning, dogName+"'s position is stale",
+							"Checking in, but without a GPS fix. Don't trust the map.\n"+position)),
+					ResetIf: isFresh,
+					OnReset: makeNotifier(ctx, w.notifier,
+						event(notify.EventFreshFix, notify.SeverityInfo, dogName+" has a GPS fix again", position)),
+				})
+			if err != nil {
+				debugLogger.Println("error when setting: ", err) // notifications are not important enough to return an error.
+			}
+		}
+	}
+
+	return nil
+}
+
+// lastKnownPosition says which named zone the tag was last in, where, and
+// how long ago.
+func lastKnownPosition(ls storage.LastSeen, namedZones []zonespkg.Zone, now func() time.Time) string {
+	if !ls.HasFix {
+		return "It's never had a GPS fix."
+	}
+
+	zone := zoneNameAt(namedZones, zonespkg.Point{Latitude: ls.Fix.Latitude, Longitude: ls.Fix.Longitude})
+	if zone == "" {
+		zone = notInAnyZone
+	}
+
+	return fmt.Sprintf("Last known position: %s (%.6f, %.6f), %s ago.",
+		zone, ls.Fix.Latitude, ls.Fix.Longitude, timeAgoAsText(ls.Fix.GpsUTC, now))
+}
+
+// run checks every interval until ctx is done.
+func (w watchdog) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := w.Check(ctx)
+		if err != nil {
+			errorLogger.Printf("Error checking on tags: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
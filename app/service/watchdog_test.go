@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bitwombat/gps-tags/notify"
+	oshotpkg "github.com/bitwombat/gps-tags/oneshot"
+	"github.com/bitwombat/gps-tags/storage"
+	zonespkg "github.com/bitwombat/gps-tags/zones"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchdog(t *testing.T) {
+	// GIVEN Rueger last checked in at noon, in the square, and Charlie at
+	// 12:55 with no fix ever
+	now := mkTime("2025-09-01 13:00:00")
+	storer := &FakeLastSeenReader{lastSeen: []storage.LastSeen{
+		{
+			SerNo:     810095,
+			DeviceUTC: mkTime("2025-09-01 12:00:00"),
+			HasFix:    true,
+			Fix:       storage.Fix{GpsUTC: mkTime("2025-09-01 11:50:00"), Latitude: 0.0005, Longitude: 0.0005},
+		},
+		{SerNo: 810243, DeviceUTC: mkTime("2025-09-01 12:55:00")},
+		{SerNo: 999999, DeviceUTC: mkTime("2025-08-01 00:00:00")}, // Not registered
+	}}
+	notifier := &FakeNotifier{}
+	w := watchdog{
+		storer:      storer,
+		zones:       newStaticZoneHolder(zoneSet{named: []zonespkg.Zone{{Name: "Square", Polygons: testSquareSmall}}}),
+		oneShot:     oshotpkg.NewOneShot(),
+		notifier:    notifier,
+		tags:        newFakeRegistry(),
+		silentAfter: 30 * time.Minute,
+		now:         func() time.Time { return now },
+	}
+
+	// WHEN it checks, twice
+	require.Nil(t, w.Check(context.Background()))
+	require.Nil(t, w.Check(context.Background()))
+
+	// THEN Rueger's gone silent, once, with where it was last seen.
+	require.Len(t, notifier.notifications, 1)
+	e := notifier.notifications[0].event
+	require.Equal(t, notify.EventSilent, e.Kind)
+	require.Equal(t, notify.SeverityWarning, e.Severity)
+	require.Equal(t, 810095, e.SerNo)
+	require.True(t, e.HasPosition)
+	require.Equal(t, notify.Title("RUEGER has gone silent"), e.Title)
+	require.Equal(t, notify.Message("No check-in for 1 hours, 0 minutes.\nLast known position: Square (0.000500, 0.000500), 1 hours, 10 minutes ago."), e.Message)
+
+	// WHEN Rueger checks in again, and Charlie doesn't for an hour
+	storer.lastSeen[0].DeviceUTC = mkTime("2025-09-01 13:50:00")
+	now = mkTime("2025-09-01 14:00:00")
+	require.Nil(t, w.Check(context.Background()))
+
+	// THEN Rueger's back, and Charlie's gone silent, with no position.
+	require.Len(t, notifier.notifications, 3)
+	require.Equal(t, notify.EventReporting, notifier.notifications[1].event.Kind)
+	require.Equal(t, notify.Title("RUEGER is checking in again"), notifier.notifications[1].title)
+	require.Equal(t, notify.EventSilent, notifier.notifications[2].event.Kind)
+	require.Equal(t, notify.Message("No check-in for 1 hours, 5 minutes.\nIt's never had a GPS fix."), notifier.notifications[2].message)
+}
+
+func TestWatchdogStaleFix(t *testing.T) {
+	// GIVEN Rueger checking in at 13:00 with its last good fix at 11:50, and
+	// Charlie checking in with a fix from just before
+	now := mkTime("2025-09-01 13:00:00")
+	storer := &FakeLastSeenReader{lastSeen: []storage.LastSeen{
+		{
+			SerNo:     810095,
+			DeviceUTC: mkTime("2025-09-01 13:00:00"),
+			HasFix:    true,
+			Fix:       storage.Fix{GpsUTC: mkTime("2025-09-01 11:50:00"), Latitude: 0.0005, Longitude: 0.0005},
+		},
+		{
+			SerNo:     810243,
+			DeviceUTC: mkTime("2025-09-01 13:00:00"),
+			HasFix:    true,
+			Fix:       storage.Fix{GpsUTC: mkTime("2025-09-01 12:59:00"), Latitude: 1, Longitude: 1},
+		},
+	}}
+	notifier := &FakeNotifier{}
+	w := watchdog{
+		storer:        storer,
+		zones:         newStaticZoneHolder(zoneSet{named: []zonespkg.Zone{{Name: "Square", Polygons: testSquareSmall}}}),
+		oneShot:       oshotpkg.NewOneShot(),
+		notifier:      notifier,
+		tags:          newFakeRegistry(),
+		staleFixAfter: time.Hour,
+		now:           func() time.Time { return now },
+	}
+
+	// WHEN it checks
+	require.Nil(t, w.Check(context.Background()))
+
+	// THEN Rueger's position is stale, saying how stale.
+	require.Len(t, notifier.notifications, 1)
+	e := notifier.notifications[0].event
+	require.Equal(t, notify.EventStaleFix, e.Kind)
+	require.Equal(t, notify.Title("RUEGER's position is stale"), e.Title)
+	require.Equal(t, notify.Message("Checking in, but without a GPS fix. Don't trust the map.\nLast known position: Square (0.000500, 0.000500), 1 hours, 10 minutes ago."), e.Message)
+
+	// WHEN Rueger gets a fix again
+	storer.lastSeen[0].Fix.GpsUTC = mkTime("2025-09-01 13:05:00")
+	storer.lastSeen[0].DeviceUTC = mkTime("2025-09-01 13:05:00")
+	now = mkTime("2025-09-01 13:06:00")
+	require.Nil(t, w.Check(context.Background()))
+
+	// THEN that's said too.
+	require.Len(t, notifier.notifications, 2)
+	require.Equal(t, notify.EventFreshFix, notifier.notifications[1].event.Kind)
+	require.Equal(t, notify.Title("RUEGER has a GPS fix again"), notifier.notifications[1].title)
+}
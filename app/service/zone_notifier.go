@@ -1,20 +1,193 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"text/template"
 
 	"github.com/bitwombat/gps-tags/model"
 	"github.com/bitwombat/gps-tags/notify"
 	oshotpkg "github.com/bitwombat/gps-tags/oneshot"
 	"github.com/bitwombat/gps-tags/poly"
+	"github.com/bitwombat/gps-tags/registry"
 	"github.com/bitwombat/gps-tags/zones"
 )
 
 type zoneNotifier struct {
-	namedZones []zones.Zone
-	oneShot    oshotpkg.OneShot
-	notifier   notify.Notifier
+	zones    *zoneHolder
+	oneShot  oshotpkg.OneShot
+	notifier notify.Notifier
+	tags     *registry.Registry
+}
+
+// eventKey is what a tag's one-shot event is kept under. It's the serial
+// number, not the name, so renaming a tag doesn't lose where it's at.
+func eventKey(serNo int, event string) string {
+	return fmt.Sprintf("%d/%s", serNo, event)
+}
+
+// alertBoundary is a zone we notify about a dog leaving and coming back into,
+// and optionally about a dog inside heading for its edge.
+type alertBoundary struct {
+	zone                     zones.Zone
+	leaveTitle, leaveMessage *template.Template
+	enterTitle, enterMessage *template.Template
+
+	// What leaving is, for routing and how loudly it's sent. Critical
+	// leaves unless the boundary says otherwise, e.g. a garden bed.
+	leaveEvent    string
+	leaveSeverity notify.Severity
+
+	// Approach warnings are off if approachDistance is 0.
+	approachDistance               float64 // Metres from the edge
+	approachAngle                  float64 // Degrees either side of heading straight for the edge
+	approachMinSpeed               float64 // km/h - below this the GPS heading is meaningless
+	approachTitle, approachMessage *template.Template
+}
+
+// alertMessageData is what the alert boundary message templates can use.
+type alertMessageData struct {
+	Dog      string // Upper-cased name, e.g. RUEGER
+	Zone     string // The boundary's name
+	LastSeen string // e.g. "Last seen near the house"
+	Distance int    // Metres from the edge (approach warnings only)
+	Speed    int    // km/h (approach warnings only)
+}
+
+// Message templates used when a boundary's properties don't have their own.
+var defaultAlertTemplates = map[string]string{
+	"leaveTitle":      "{{.Dog}} has left {{.Zone}}",
+	"leaveMessage":    "{{.LastSeen}}",
+	"enterTitle":      "{{.Dog}} is back in {{.Zone}}",
+	"enterMessage":    "{{.LastSeen}}",
+	"approachTitle":   "{{.Dog}} is {{.Distance}} m from the edge of {{.Zone}} and heading toward it",
+	"approachMessage": "{{.LastSeen}}",
+}
+
+// Approach warning settings used when a boundary's properties don't have
+// their own. There's no default distance - warnings are opt-in.
+var defaultApproachSettings = map[string]float64{
+	"approachDistance": 0,
+	"approachAngle":    45,
+	"approachMinSpeed": 1,
+}
+
+// newAlertBoundaries makes alert boundaries from zones, taking the message
+// templates and approach warning settings from each zone's properties.
+// Templates are test-rendered so mistakes show up at startup rather than when
+// a dog gets out.
+func newAlertBoundaries(boundaryZones []zones.Zone) ([]alertBoundary, error) {
+	boundaries := make([]alertBoundary, 0, len(boundaryZones))
+
+	for _, zone := range boundaryZones {
+		parse := func(name string) (*template.Template, error) {
+			text, ok := zone.Properties[name]
+			if !ok {
+				text = defaultAlertTemplates[name]
+			}
+
+			tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+			if err != nil {
+				return nil, fmt.Errorf("boundary %q: parsing %s template: %w", zone.Name, name, err)
+			}
+
+			err = tmpl.Execute(&bytes.Buffer{}, alertMessageData{})
+			if err != nil {
+				return nil, fmt.Errorf("boundary %q: trying %s template: %w", zone.Name, name, err)
+			}
+
+			return tmpl, nil
+		}
+
+		b := alertBoundary{zone: zone}
+		var err error
+		for _, t := range []struct {
+			name string
+			dst  **template.Template
+		}{
+			{"leaveTitle", &b.leaveTitle},
+			{"leaveMessage", &b.leaveMessage},
+			{"enterTitle", &b.enterTitle},
+			{"enterMessage", &b.enterMessage},
+			{"approachTitle", &b.approachTitle},
+			{"approachMessage", &b.approachMessage},
+		} {
+			*t.dst, err = parse(t.name)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for _, setting := range []struct {
+			name string
+			dst  *float64
+			max  float64
+		}{
+			{"approachDistance", &b.approachDistance, math.Inf(1)},
+			{"approachAngle", &b.approachAngle, 180},
+			{"approachMinSpeed", &b.approachMinSpeed, math.Inf(1)},
+		} {
+			*setting.dst = defaultApproachSettings[setting.name]
+
+			text, ok := zone.Properties[setting.name]
+			if !ok {
+				continue
+			}
+			*setting.dst, err = strconv.ParseFloat(text, 64)
+			if err != nil || *setting.dst < 0 || *setting.dst > setting.max {
+				return nil, fmt.Errorf("boundary %q: %s should be a number from 0 to %v, got %q", zone.Name, setting.name, setting.max, text)
+			}
+		}
+
+		b.leaveEvent = notify.EventLeave
+		if text, ok := zone.Properties["event"]; ok {
+			if !slices.Contains(notify.Events, text) {
+				return nil, fmt.Errorf("boundary %q: unknown event %q (have %v)", zone.Name, text, notify.Events)
+			}
+			b.leaveEvent = text
+		}
+
+		b.leaveSeverity = notify.SeverityCritical
+		if text, ok := zone.Properties["severity"]; ok {
+			b.leaveSeverity, err = notify.ParseSeverity(text)
+			if err != nil {
+				return nil, fmt.Errorf("boundary %q: %w", zone.Name, err)
+			}
+		}
+
+		boundaries = append(boundaries, b)
+	}
+
+	return boundaries, nil
+}
+
+// alertEvent is an event about a boundary, with the title and message from
+// its templates.
+func alertEvent(base notify.Event, kind string, severity notify.Severity, title, message *template.Template, data alertMessageData) notify.Event {
+	e := base
+	e.Kind = kind
+	e.Severity = severity
+	e.Zone = data.Zone
+	e.Title = notify.Title(renderAlert(title, data))
+	e.Message = notify.Message(renderAlert(message, data))
+
+	return e
+}
+
+func renderAlert(tmpl *template.Template, data alertMessageData) string {
+	var buf bytes.Buffer
+
+	err := tmpl.Execute(&buf, data)
+	if err != nil {
+		// Checked when the boundaries were loaded, so shouldn't happen.
+		errorLogger.Printf("Error rendering %s template: %v", tmpl.Name(), err)
+	}
+
+	return buf.String()
 }
 
 func (zn zoneNotifier) Notify(ctx context.Context, tagData model.TagTx) {
@@ -32,72 +205,84 @@ func (zn zoneNotifier) Notify(ctx context.Context, tagData model.TagTx) {
 		}
 	}
 
-	dogName := model.UpperSerNoToName(tagData.SerNo)
-	notifyAboutZones(ctx, latestGPS.gr, zn.namedZones, dogName, zn.oneShot, zn.notifier)
+	dogName := zn.tags.UpperName(tagData.SerNo)
+	zoneSet := zn.zones.Get()
+	tag := notify.Event{SerNo: tagData.SerNo, Tag: zn.tags.Name(tagData.SerNo)}
+	notifyAboutZones(ctx, latestGPS.gr, zoneSet.named, zoneSet.boundaries, dogName, tag, zn.oneShot, zn.notifier)
 }
 
-func notifyAboutZones(ctx context.Context, latestGPS *model.GPSReading, namedZones []zones.Zone, dogName string, oneShot oshotpkg.OneShot, notifier notify.Notifier) {
+// notifyAboutZones sends events about the dog leaving, coming back into or
+// heading out of the boundaries. tag says which tag the events are about.
+func notifyAboutZones(ctx context.Context, latestGPS *model.GPSReading, namedZones []zones.Zone, boundaries []alertBoundary, dogName string, tag notify.Event, oneShot oshotpkg.OneShot, notifier notify.Notifier) {
 	if latestGPS == nil {
 		debugLogger.Println("No GPS reading in transmission")
 
 		return
 	}
 
+	currentLocation := zones.Point{Latitude: latestGPS.Lat, Longitude: latestGPS.Long}
+
 	var thisZoneText string
 
 	if namedZones != nil {
-		thisZoneText = "Last seen " + zones.NameThatZone(namedZones, zones.Point{Latitude: latestGPS.Lat, Longitude: latestGPS.Long})
+		thisZoneText = "Last seen " + zones.NameThatZone(namedZones, currentLocation)
 	} else {
 		thisZoneText = "<No zones loaded>"
 	}
 
-	currentLocation := poly.Point{X: latestGPS.Lat, Y: latestGPS.Long}
-	isOutsidePropertyBoundary := !poly.IsInside(propertyBoundary, currentLocation)
-	isOutsideSafeZoneBoundary := !poly.IsInside(safeZoneBoundary, currentLocation)
+	base := tag
+	base.HasPosition = true
+	base.Latitude, base.Longitude = latestGPS.Lat, latestGPS.Long
+	base.Time = latestGPS.GpsUTC.T
 
-	err := oneShot.SetReset(dogName+"offProperty",
-		oshotpkg.Config{
-			SetIf: isOutsidePropertyBoundary,
-			OnSet: makeNotifier(
-				ctx,
-				notifier,
-				notify.Title(fmt.Sprintf("%s is off the property", dogName)),
-				notify.Message(thisZoneText),
-			),
-			ResetIf: !isOutsidePropertyBoundary,
-			OnReset: makeNotifier(
-				ctx,
-				notifier,
-				notify.Title(fmt.Sprintf("%s is back on the property", dogName)),
-				notify.Message(thisZoneText),
-			),
-		})
-	if err != nil {
-		debugLogger.Println("error when setting: ", err) // notifications are not important enough to return an error.
+	for _, b := range boundaries {
+		isOutside := !b.zone.IsInside(currentLocation)
+		data := alertMessageData{Dog: dogName, Zone: b.zone.Name, LastSeen: thisZoneText}
 
-		return
+		err := oneShot.SetReset(eventKey(tag.SerNo, "outside/"+b.zone.Name),
+			oshotpkg.Config{
+				SetIf: isOutside,
+				OnSet: makeNotifier(ctx, notifier,
+					alertEvent(base, b.leaveEvent, b.leaveSeverity, b.leaveTitle, b.leaveMessage, data)),
+				ResetIf: !isOutside,
+				OnReset: makeNotifier(ctx, notifier,
+					alertEvent(base, notify.EventEnter, notify.SeverityInfo, b.enterTitle, b.enterMessage, data)),
+			})
+		if err != nil {
+			debugLogger.Println("error when setting: ", err) // notifications are not important enough to return an error.
+
+			continue // The other boundaries still get checked.
+		}
+
+		if b.approachDistance > 0 {
+			err = notifyAboutApproach(ctx, latestGPS, currentLocation, b, data, base, isOutside, oneShot, notifier)
+			if err != nil {
+				debugLogger.Println("error when setting: ", err) // notifications are not important enough to return an error.
+			}
+		}
 	}
+}
+
+// notifyAboutApproach warns when a dog inside a boundary is near its edge and
+// heading for it - with luck, before it gets out.
+func notifyAboutApproach(ctx context.Context, latestGPS *model.GPSReading, currentLocation zones.Point, b alertBoundary, data alertMessageData, base notify.Event, isOutside bool, oneShot oshotpkg.OneShot, notifier notify.Notifier) error {
+	edge := b.zone.NearestEdge(currentLocation)
+
+	speed := float64(latestGPS.Spd)
+	isHeadingForEdge := speed >= b.approachMinSpeed &&
+		poly.AngleBetween(float64(latestGPS.Head), edge.Bearing) <= b.approachAngle
+	isApproaching := !isOutside && edge.Metres <= b.approachDistance && isHeadingForEdge
+
+	data.Distance = int(math.Round(edge.Metres))
+	data.Speed = latestGPS.Spd
 
-	err = oneShot.SetReset(dogName+"outsideSafeZone",
+	return oneShot.SetReset(eventKey(base.SerNo, "approaching/"+b.zone.Name),
 		oshotpkg.Config{
-			SetIf: isOutsideSafeZoneBoundary,
-			OnSet: makeNotifier(
-				ctx,
-				notifier,
-				notify.Title(fmt.Sprintf("%s is getting far from the house", dogName)),
-				notify.Message(thisZoneText),
-			),
-			ResetIf: !isOutsideSafeZoneBoundary,
-			OnReset: makeNotifier(
-				ctx,
-				notifier,
-				notify.Title(fmt.Sprintf("%s is back close to the house", dogName)),
-				notify.Message(thisZoneText),
-			),
+			SetIf: isApproaching,
+			OnSet: makeNotifier(ctx, notifier,
+				alertEvent(base, notify.EventApproach, notify.SeverityWarning, b.approachTitle, b.approachMessage, data)),
+			// Ready to warn again once well clear of the edge. If the dog got
+			// out, the leave notification has it covered.
+			ResetIf: isOutside || edge.Metres > 2*b.approachDistance,
 		})
-	if err != nil {
-		debugLogger.Println("error when setting: ", err) // notifications are not important enough to return an error.
-
-		return
-	}
 }
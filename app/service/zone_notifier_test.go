@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bitwombat/gps-tags/model"
+	"github.com/bitwombat/gps-tags/notify"
+	oshotpkg "github.com/bitwombat/gps-tags/oneshot"
+	"github.com/bitwombat/gps-tags/zones"
+	"github.com/stretchr/testify/require"
+)
+
+// A square around 0,0.
+var testSquare = []zones.Polygon{{Outer: zones.Coordinates{Points: []zones.Point{
+	{Longitude: -1, Latitude: -1},
+	{Longitude: 1, Latitude: -1},
+	{Longitude: 1, Latitude: 1},
+	{Longitude: -1, Latitude: 1},
+	{Longitude: -1, Latitude: -1},
+}}}}
+
+// A square about 222 m across, around 0,0.
+var testSquareSmall = []zones.Polygon{{Outer: zones.Coordinates{Points: []zones.Point{
+	{Longitude: -0.001, Latitude: -0.001},
+	{Longitude: 0.001, Latitude: -0.001},
+	{Longitude: 0.001, Latitude: 0.001},
+	{Longitude: -0.001, Latitude: 0.001},
+	{Longitude: -0.001, Latitude: -0.001},
+}}}}
+
+func TestAlertBoundaryTemplates(t *testing.T) {
+	// GIVEN a boundary with only a leave title, and a boundary with nothing.
+	boundaries, err := newAlertBoundaries([]zones.Zone{
+		{Name: "Custom", Polygons: testSquare, Properties: zones.Properties{"leaveTitle": "{{.Dog}} escaped!"}},
+		{Name: "Plain", Polygons: testSquare},
+	})
+	require.Nil(t, err)
+
+	notifier := &FakeNotifier{}
+	oneShot := oshotpkg.NewOneShot()
+	outside := &model.GPSReading{Lat: 5, Long: 5}
+	inside := &model.GPSReading{Lat: 0, Long: 0}
+
+	// WHEN the dog leaves
+	notifyAboutZones(context.Background(), outside, nil, boundaries, "RUEGER", notify.Event{SerNo: 810095, Tag: "Rueger"}, oneShot, notifier)
+
+	// THEN the custom template is used where there is one, defaults otherwise.
+	require.Len(t, notifier.notifications, 2)
+	require.Equal(t, notify.Title("RUEGER escaped!"), notifier.notifications[0].title)
+	require.Equal(t, notify.Message("<No zones loaded>"), notifier.notifications[0].message)
+	require.Equal(t, notify.Title("RUEGER has left Plain"), notifier.notifications[1].title)
+	require.Equal(t, notify.Event{
+		Kind:        notify.EventLeave,
+		Severity:    notify.SeverityCritical,
+		Title:       "RUEGER has left Plain",
+		Message:     "<No zones loaded>",
+		SerNo:       810095,
+		Tag:         "Rueger",
+		HasPosition: true,
+		Latitude:    5,
+		Longitude:   5,
+		Zone:        "Plain",
+	}, notifier.notifications[1].event)
+
+	// WHEN the dog comes back
+	notifyAboutZones(context.Background(), inside, nil, boundaries, "RUEGER", notify.Event{SerNo: 810095, Tag: "Rueger"}, oneShot, notifier)
+
+	// THEN
+	require.Len(t, notifier.notifications, 4)
+	require.Equal(t, notify.Title("RUEGER is back in Custom"), notifier.notifications[2].title)
+	require.Equal(t, notify.Title("RUEGER is back in Plain"), notifier.notifications[3].title)
+	require.Equal(t, "enter", notifier.notifications[3].event.Kind)
+}
+
+func TestAlertBoundaryBadTemplates(t *testing.T) {
+	for _, tc := range []struct {
+		description string
+		template    string
+		wantErr     string
+	}{
+		{"doesn't parse", "{{.Dog", `boundary "Bad": parsing enterMessage template`},
+		{"unknown field", "{{.Dgo}}", `boundary "Bad": trying enterMessage template`},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			_, err := newAlertBoundaries([]zones.Zone{
+				{Name: "Bad", Polygons: testSquare, Properties: zones.Properties{"enterMessage": tc.template}},
+			})
+			require.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestApproachWarning(t *testing.T) {
+	// GIVEN a boundary (about 222 m square) with approach warnings within 20 m
+	boundaries, err := newAlertBoundaries([]zones.Zone{
+		{Name: "the property", Polygons: testSquareSmall, Properties: zones.Properties{"approachDistance": "20"}},
+	})
+	require.Nil(t, err)
+
+	notifier := &FakeNotifier{}
+	oneShot := oshotpkg.NewOneShot()
+	report := func(lat, lng float64, spd, head int) {
+		notifyAboutZones(context.Background(), &model.GPSReading{Lat: lat, Long: lng, Spd: spd, Head: head}, nil, boundaries, "CHARLIE", notify.Event{SerNo: 810243, Tag: "Charlie"}, oneShot, notifier)
+	}
+
+	// 15 m from the east edge (0.001 degrees is about 111 m), heading west,
+	// away from it.
+	report(0, 0.000865, 5, 270)
+	require.Len(t, notifier.notifications, 0)
+
+	// Sitting still, pointing at the edge.
+	report(0, 0.000865, 0, 90)
+	require.Len(t, notifier.notifications, 0)
+
+	// Trotting towards it, a bit north of straight at it.
+	report(0, 0.000865, 5, 60)
+	require.Len(t, notifier.notifications, 1)
+	require.Equal(t, notify.Title("CHARLIE is 15 m from the edge of the property and heading toward it"), notifier.notifications[0].title)
+
+	// Still heading for it - no repeat.
+	report(0, 0.00095, 5, 90)
+	require.Len(t, notifier.notifications, 1)
+
+	// Back well away, then heading for the edge again.
+	report(0, 0, 5, 270)
+	report(0, 0.00099, 5, 90)
+	require.Len(t, notifier.notifications, 2)
+	require.Equal(t, notify.Title("CHARLIE is 1 m from the edge of the property and heading toward it"), notifier.notifications[1].title)
+}
+
+// failingNotifier fails to send events with one title, and passes the rest
+// on.
+type failingNotifier struct {
+	FakeNotifier
+	failTitle notify.Title
+}
+
+func (n *failingNotifier) Notify(ctx context.Context, e notify.Event) error {
+	if e.Title == n.failTitle {
+		return errors.New("no signal")
+	}
+	return n.FakeNotifier.Notify(ctx, e)
+}
+
+func TestOneFailingBoundaryDoesntSilenceTheRest(t *testing.T) {
+	// GIVEN two boundaries, and a notifier that can't send the first one's
+	// leave notification
+	boundaries, err := newAlertBoundaries([]zones.Zone{
+		{Name: "the yard", Polygons: testSquareSmall},
+		{Name: "the property", Polygons: testSquareSmall},
+	})
+	require.Nil(t, err)
+
+	notifier := &failingNotifier{failTitle: "CHARLIE has left the yard"}
+	oneShot := oshotpkg.NewOneShot()
+
+	// WHEN the dog is outside both
+	notifyAboutZones(context.Background(), &model.GPSReading{Lat: 0.01, Long: 0.01}, nil, boundaries, "CHARLIE", notify.Event{SerNo: 810243, Tag: "Charlie"}, oneShot, notifier)
+
+	// THEN the second boundary's notification still goes out.
+	require.Len(t, notifier.notifications, 1)
+	require.Equal(t, notify.Title("CHARLIE has left the property"), notifier.notifications[0].title)
+}
+
+func TestBoundarySeverity(t *testing.T) {
+	// GIVEN a boundary that's only a warning to leave, and one that says
+	// nothing
+	boundaries, err := newAlertBoundaries([]zones.Zone{
+		{Name: "the garden", Polygons: testSquareSmall, Properties: zones.Properties{"severity": "warning", "event": notify.EventApproach}},
+		{Name: "the property", Polygons: testSquareSmall},
+	})
+	require.Nil(t, err)
+
+	notifier := &FakeNotifier{}
+	oneShot := oshotpkg.NewOneShot()
+
+	// WHEN the dog is outside both
+	notifyAboutZones(context.Background(), &model.GPSReading{Lat: 0.01, Long: 0.01}, nil, boundaries, "CHARLIE", notify.Event{SerNo: 810243, Tag: "Charlie"}, oneShot, notifier)
+
+	// THEN the garden stays a warning, of its own kind, and the property is
+	// critical.
+	require.Len(t, notifier.notifications, 2)
+	require.Equal(t, notify.SeverityWarning, notifier.notifications[0].event.Severity)
+	require.Equal(t, notify.EventApproach, notifier.notifications[0].event.Kind)
+	require.Equal(t, notify.SeverityCritical, notifier.notifications[1].event.Severity)
+	require.Equal(t, notify.EventLeave, notifier.notifications[1].event.Kind)
+
+	// AND nonsense is caught at startup.
+	_, err = newAlertBoundaries([]zones.Zone{{Name: "Bad", Polygons: testSquare, Properties: zones.Properties{"severity": "dire"}}})
+	require.ErrorContains(t, err, `boundary "Bad": unknown severity "dire"`)
+	_, err = newAlertBoundaries([]zones.Zone{{Name: "Bad", Polygons: testSquare, Properties: zones.Properties{"event": "escape"}}})
+	require.ErrorContains(t, err, `boundary "Bad": unknown event "escape"`)
+}
+
+func TestApproachSettingsErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name, value string
+	}{
+		{"approachDistance", "far"},
+		{"approachDistance", "-5"},
+		{"approachAngle", "270"},
+	} {
+		_, err := newAlertBoundaries([]zones.Zone{
+			{Name: "Bad", Polygons: testSquare, Properties: zones.Properties{tc.name: tc.value}},
+		})
+		require.ErrorContains(t, err, `boundary "Bad": `+tc.name+" should be a number", tc.value)
+	}
+}
+
+func TestZoneStateSurvivesRename(t *testing.T) {
+	// GIVEN Rueger has left the property
+	boundaries, err := newAlertBoundaries([]zones.Zone{{Name: "the property", Polygons: testSquare}})
+	require.Nil(t, err)
+
+	notifier := &FakeNotifier{}
+	tags := newFakeRegistry()
+	zn := zoneNotifier{
+		zones:    newStaticZoneHolder(zoneSet{boundaries: boundaries}),
+		oneShot:  oshotpkg.NewOneShot(),
+		notifier: notifier,
+		tags:     tags,
+	}
+	at := func(lat, long float64) model.TagTx {
+		return model.TagTx{SerNo: 810095, Records: []model.Record{{SeqNo: 1, GPSReading: &model.GPSReading{Lat: lat, Long: long}}}}
+	}
+
+	zn.Notify(context.Background(), at(5, 5))
+	require.Len(t, notifier.notifications, 1)
+
+	// WHEN the tag is renamed while the dog's still out, and the dog comes back
+	err = tags.Rename(context.Background(), 810095, "Rugs")
+	require.Nil(t, err)
+	zn.Notify(context.Background(), at(5, 5))
+	zn.Notify(context.Background(), at(0, 0))
+
+	// THEN leaving isn't sent again, and coming back is.
+	require.Len(t, notifier.notifications, 2)
+	require.Equal(t, notify.Title("RUGS is back in the property"), notifier.notifications[1].title)
+}
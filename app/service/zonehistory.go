@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bitwombat/gps-tags/model"
+	"github.com/bitwombat/gps-tags/registry"
+	"github.com/bitwombat/gps-tags/storage"
+	zonespkg "github.com/bitwombat/gps-tags/zones"
+)
+
+// ZoneVisitStorer handles reading GPS fixes and reading and writing the zone
+// visits worked out from them.
+type ZoneVisitStorer interface {
+	GetFixesAfter(context.Context, int, time.Time) ([]storage.Fix, error)
+	GetLatestZoneVisit(context.Context, int) (model.ZoneVisit, error)
+	SaveZoneVisits(context.Context, []model.ZoneVisit) error
+	ReplaceZoneVisits(context.Context, []model.ZoneVisit) error
+}
+
+// zoneHistory keeps the zoneVisit table up to date with the stored GPS fixes.
+// It works from what's in the database rather than from uploads as they
+// arrive, so history from before it existed (or from before the zones changed)
+// can be worked out again.
+type zoneHistory struct {
+	mu     sync.Mutex // Updates and rebuilds one at a time
+	storer ZoneVisitStorer
+	zones  *zoneHolder
+	tags   *registry.Registry
+}
+
+// Update adds visits for each tag's fixes since its latest visit. Fixes that
+// turn up late, dated before that, are left out until the next rebuild.
+func (zh *zoneHistory) Update(ctx context.Context) error {
+	zh.mu.Lock()
+	defer zh.mu.Unlock()
+
+	return zh.update(ctx)
+}
+
+// Rebuild throws away all visits and works them out again from every stored
+// fix, e.g. after the zones have been edited. The new visits replace the old
+// all at once, so a rebuild that fails part way leaves the old ones.
+func (zh *zoneHistory) Rebuild(ctx context.Context) error {
+	zh.mu.Lock()
+	defer zh.mu.Unlock()
+
+	named := zh.zones.Get().named
+
+	var visits []model.ZoneVisit
+	for _, tag := range zh.tags.All() {
+		fixes, err := zh.storer.GetFixesAfter(ctx, tag.SerNo, time.Time{})
+		if err != nil {
+			return fmt.Errorf("getting fixes for %s: %w", tag.Name, err)
+		}
+		if len(fixes) == 0 {
+			continue
+		}
+
+		visits = append(visits, zoneVisitsFrom(tag.SerNo, nil, fixes, named)...)
+	}
+
+	err := zh.storer.ReplaceZoneVisits(ctx, visits)
+	if err != nil {
+		return fmt.Errorf("replacing zone visits: %w", err)
+	}
+
+	return nil
+}
+
+func (zh *zoneHistory) update(ctx context.Context) error {
+	named := zh.zones.Get().named
+
+	for _, tag := range zh.tags.All() {
+		var open *model.ZoneVisit
+		var after time.Time
+
+		latest, err := zh.storer.GetLatestZoneVisit(ctx, tag.SerNo)
+		switch {
+		case err == nil:
+			open = &latest
+			after = latest.LastSeen
+		case !errors.Is(err, storage.ErrNotFound):
+			return fmt.Errorf("getting latest zone visit for %s: %w", tag.Name, err)
+		}
+
+		fixes, err := zh.storer.GetFixesAfter(ctx, tag.SerNo, after)
+		if err != nil {
+			return fmt.Errorf("getting fixes for %s: %w", tag.Name, err)
+		}
+		if len(fixes) == 0 {
+			continue
+		}
+
+		err = zh.storer.SaveZoneVisits(ctx, zoneVisitsFrom(tag.SerNo, open, fixes, named))
+		if err != nil {
+			return fmt.Errorf("saving zone visits for %s: %w", tag.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// keepUpdated updates the history straight away, then every interval until
+// ctx is done. Errors are logged and tried again next time.
+func (zh *zoneHistory) keepUpdated(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := zh.Update(ctx)
+		if err != nil {
+			errorLogger.Printf("Error updating zone history: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// zoneVisitsFrom carries on from the open visit (if any) through the fixes,
+// which must be oldest first. It returns the open visit, updated, followed by
+// any new ones. A visit ends at the first fix somewhere else.
+func zoneVisitsFrom(serNo int, open *model.ZoneVisit, fixes []storage.Fix, namedZones []zonespkg.Zone) []model.ZoneVisit {
+	var visits []model.ZoneVisit
+	if open != nil {
+		visits = append(visits, *open)
+	}
+
+	for _, f := range fixes {
+		zone := zoneNameAt(namedZones, zonespkg.Point{Latitude: f.Latitude, Longitude: f.Longitude})
+
+		if len(visits) > 0 {
+			current := &visits[len(visits)-1]
+			if current.Zone == zone {
+				current.LastSeen = f.GpsUTC
+				continue
+			}
+			current.Exited = f.GpsUTC
+		}
+
+		visits = append(visits, model.ZoneVisit{SerNo: serNo, Zone: zone, Entered: f.GpsUTC, LastSeen: f.GpsUTC})
+	}
+
+	return visits
+}
+
+// zoneNameAt is the name of the first named zone p is in, or "" if it's in
+// none of them.
+func zoneNameAt(namedZones []zonespkg.Zone, p zonespkg.Point) string {
+	for _, zone := range namedZones {
+		if zone.IsInside(p) {
+			return zone.Name
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bitwombat/gps-tags/model"
+	"github.com/bitwombat/gps-tags/storage"
+	"github.com/bitwombat/gps-tags/zones"
+	"github.com/stretchr/testify/require"
+)
+
+// Two zones side by side: House around 0,0 and Paddock just east of it.
+var historyZones = []zones.Zone{
+	{Name: "House", Polygons: testSquareSmall},
+	{Name: "Paddock", Polygons: []zones.Polygon{{Outer: zones.Coordinates{Points: []zones.Point{
+		{Longitude: 0.001, Latitude: -0.001},
+		{Longitude: 0.003, Latitude: -0.001},
+		{Longitude: 0.003, Latitude: 0.001},
+		{Longitude: 0.001, Latitude: 0.001},
+	}}}}},
+}
+
+func historyFix(ts string, lng float64) storage.Fix {
+	return storage.Fix{GpsUTC: mkTime(ts), Longitude: lng}
+}
+
+func TestZoneVisitsFrom(t *testing.T) {
+	// GIVEN fixes in the house, then the paddock, then nowhere in particular
+	fixes := []storage.Fix{
+		historyFix("2025-09-01 08:00:00", 0),
+		historyFix("2025-09-01 08:30:00", 0),
+		historyFix("2025-09-01 09:00:00", 0.002),
+		historyFix("2025-09-01 09:10:00", 0.002),
+		historyFix("2025-09-01 09:20:00", 0.01),
+	}
+
+	// WHEN they're made into visits from scratch
+	visits := zoneVisitsFrom(810095, nil, fixes, historyZones)
+
+	// THEN each visit ends at the first fix somewhere else, and the last is
+	// still going.
+	require.Equal(t, []model.ZoneVisit{
+		{SerNo: 810095, Zone: "House", Entered: mkTime("2025-09-01 08:00:00"), LastSeen: mkTime("2025-09-01 08:30:00"), Exited: mkTime("2025-09-01 09:00:00")},
+		{SerNo: 810095, Zone: "Paddock", Entered: mkTime("2025-09-01 09:00:00"), LastSeen: mkTime("2025-09-01 09:10:00"), Exited: mkTime("2025-09-01 09:20:00")},
+		{SerNo: 810095, Zone: "", Entered: mkTime("2025-09-01 09:20:00"), LastSeen: mkTime("2025-09-01 09:20:00")},
+	}, visits)
+
+	// WHEN carrying on from an open visit with a fix in the same zone
+	open := model.ZoneVisit{ID: 7, SerNo: 810095, Zone: "House", Entered: mkTime("2025-09-01 07:00:00"), LastSeen: mkTime("2025-09-01 07:30:00")}
+	visits = zoneVisitsFrom(810095, &open, fixes[:1], historyZones)
+
+	// THEN the open visit is just extended.
+	require.Equal(t, []model.ZoneVisit{
+		{ID: 7, SerNo: 810095, Zone: "House", Entered: mkTime("2025-09-01 07:00:00"), LastSeen: mkTime("2025-09-01 08:00:00")},
+	}, visits)
+}
+
+func TestZoneHistoryUpdateAndRebuild(t *testing.T) {
+	// GIVEN Rueger's stored fixes
+	storer := &FakeZoneVisitStorer{fixes: map[int][]storage.Fix{
+		810095: {
+			historyFix("2025-09-01 08:00:00", 0),
+			historyFix("2025-09-01 09:00:00", 0.002),
+		},
+	}}
+	zoneHolder := newStaticZoneHolder(zoneSet{named: historyZones})
+	history := &zoneHistory{storer: storer, zones: zoneHolder, tags: newFakeRegistry()}
+	ctx := context.Background()
+
+	// WHEN the history is updated (e.g. at startup)
+	err := history.Update(ctx)
+	require.Nil(t, err)
+
+	// THEN the visits so far are there
+	require.Len(t, storer.visits, 2)
+	require.Equal(t, "Paddock", storer.visits[1].Zone)
+
+	// WHEN more fixes arrive, and it's updated again
+	storer.fixes[810095] = append(storer.fixes[810095],
+		historyFix("2025-09-01 10:00:00", 0.002),
+		historyFix("2025-09-01 11:00:00", 0),
+	)
+	err = history.Update(ctx)
+	require.Nil(t, err)
+
+	// THEN the paddock visit is extended and closed, and a new one started.
+	require.Len(t, storer.visits, 3)
+	require.Equal(t, mkTime("2025-09-01 10:00:00"), storer.visits[1].LastSeen)
+	require.Equal(t, mkTime("2025-09-01 11:00:00"), storer.visits[1].Exited)
+	require.Equal(t, "House", storer.visits[2].Zone)
+
+	// WHEN the zones change (the paddock is gone) and the history is rebuilt
+	zoneHolder.set = zoneSet{named: historyZones[:1]}
+	err = history.Rebuild(ctx)
+	require.Nil(t, err)
+
+	// THEN it's worked out again from all the fixes.
+	require.Equal(t, []string{"House", "", "House"}, []string{storer.visits[0].Zone, storer.visits[1].Zone, storer.visits[2].Zone})
+	require.Equal(t, mkTime("2025-09-01 09:00:00"), storer.visits[1].Entered)
+	require.Equal(t, mkTime("2025-09-01 10:00:00"), storer.visits[1].LastSeen)
+
+	// WHEN the zones change back, but the rebuild fails part way through
+	zoneHolder.set = zoneSet{named: historyZones}
+	storer.fixesErr = errors.New("database is locked")
+	err = history.Rebuild(ctx)
+
+	// THEN the history from before is left as it was.
+	require.NotNil(t, err)
+	require.Len(t, storer.visits, 3)
+	require.Equal(t, "", storer.visits[1].Zone)
+}
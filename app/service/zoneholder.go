@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/bitwombat/gps-tags/config"
+	zonespkg "github.com/bitwombat/gps-tags/zones"
+)
+
+// zoneSet is everything loaded from the zone directories.
+type zoneSet struct {
+	named         []zonespkg.Zone
+	boundaryZones []zonespkg.Zone
+	boundaries    []alertBoundary
+}
+
+// loadZoneSet reads and validates the named zones and alert boundaries. If
+// either can't be loaded, the set has the other, and the error says why.
+func loadZoneSet(cfg config.Zones) (zoneSet, error) {
+	var set zoneSet
+
+	named, namedErr := loadNamedZones(cfg.NamedZonesDir)
+	if namedErr == nil {
+		set.named = named
+	}
+
+	boundaryZones, boundaries, boundariesErr := loadAlertBoundaries(cfg.BoundaryZonesDir)
+	if boundariesErr == nil {
+		set.boundaryZones, set.boundaries = boundaryZones, boundaries
+	}
+
+	return set, errors.Join(namedErr, boundariesErr)
+}
+
+func loadNamedZones(dir string) ([]zonespkg.Zone, error) {
+	named, err := zonespkg.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading named zones: %w", err)
+	}
+	err = zonespkg.Validate(named)
+	if err != nil {
+		return nil, fmt.Errorf("invalid named zones in %s:\n%w", dir, err)
+	}
+
+	return named, nil
+}
+
+func loadAlertBoundaries(dir string) ([]zonespkg.Zone, []alertBoundary, error) {
+	boundaryZones, err := zonespkg.ReadDir(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading alert boundaries: %w", err)
+	}
+	err = zonespkg.Validate(boundaryZones)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid alert boundaries in %s:\n%w", dir, err)
+	}
+	boundaries, err := newAlertBoundaries(boundaryZones)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading alert boundaries: %w", err)
+	}
+
+	return boundaryZones, boundaries, nil
+}
+
+// zoneHolder holds the current zone set, so it can be swapped for a freshly
+// loaded one while transmissions are being handled.
+type zoneHolder struct {
+	mu  sync.RWMutex
+	set zoneSet
+	cfg config.Zones
+}
+
+// newZoneHolder loads the zone set. Unlike a reload, there's no previous set to
+// fall back to, so if it doesn't all load the holder has whatever did (maybe
+// nothing), and the error is returned. A reload picks up the rest once it's
+// fixed.
+func newZoneHolder(cfg config.Zones) (*zoneHolder, error) {
+	set, err := loadZoneSet(cfg)
+
+	return &zoneHolder{set: set, cfg: cfg}, err
+}
+
+// newStaticZoneHolder holds a zone set that isn't loaded from (or reloaded
+// from) anywhere.
+func newStaticZoneHolder(set zoneSet) *zoneHolder {
+	return &zoneHolder{set: set}
+}
+
+// Get returns the current zone set. Zone sets are never modified, only
+// replaced, so it's safe to keep using after a reload.
+func (h *zoneHolder) Get() zoneSet {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.set
+}
+
+// Reload loads the zone set again and, if it's good, swaps it in. If not, the
+// previous set is kept and the error returned.
+func (h *zoneHolder) Reload() error {
+	set, err := loadZoneSet(h.cfg)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	h.set = set
+	h.mu.Unlock()
+
+	return nil
+}
+
+// reloadOn reloads the zone set each time something arrives on signals (e.g.
+// SIGHUP), until signals is closed. Errors are logged, and the previous set
+// kept. onReload, if not nil, is called after each successful reload.
+func (h *zoneHolder) reloadOn(signals <-chan os.Signal, onReload func()) {
+	for range signals {
+		infoLogger.Println("Reloading zones.")
+
+		err := h.Reload()
+		if err != nil {
+			errorLogger.Printf("Error reloading zones, keeping the previous ones: %v", err)
+			continue
+		}
+
+		set := h.Get()
+		infoLogger.Printf("Reloaded %d named zones and %d alert boundaries.", len(set.named), len(set.boundaries))
+
+		if onReload != nil {
+			onReload()
+		}
+	}
+}
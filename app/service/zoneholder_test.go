@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/bitwombat/gps-tags/config"
+	"github.com/stretchr/testify/require"
+)
+
+const squareKML = `<kml><Document><Placemark><name>%s</name><Polygon><outerBoundaryIs><LinearRing>
+	<coordinates>-1,-1 1,-1 1,1 -1,1 -1,-1</coordinates>
+</LinearRing></outerBoundaryIs></Polygon></Placemark></Document></kml>`
+
+func writeZoneFile(t *testing.T, dir, filename, contents string) {
+	t.Helper()
+
+	err := os.WriteFile(filepath.Join(dir, filename), []byte(contents), 0o600)
+	require.Nil(t, err)
+}
+
+func zoneNames(set zoneSet) []string {
+	var names []string
+	for _, z := range set.named {
+		names = append(names, z.Name)
+	}
+	return names
+}
+
+func newTestZoneHolder(t *testing.T) (*zoneHolder, string) {
+	t.Helper()
+
+	namedDir := t.TempDir()
+	boundaryDir := t.TempDir()
+	writeZoneFile(t, namedDir, "a.kml", fmt.Sprintf(squareKML, "near the house"))
+	writeZoneFile(t, boundaryDir, "b.kml", fmt.Sprintf(squareKML, "Property"))
+
+	zones, err := newZoneHolder(config.Zones{NamedZonesDir: namedDir, BoundaryZonesDir: boundaryDir})
+	require.Nil(t, err)
+
+	return zones, namedDir
+}
+
+func TestZoneHolderReload(t *testing.T) {
+	// GIVEN loaded zones
+	zones, namedDir := newTestZoneHolder(t)
+	require.Equal(t, []string{"near the house"}, zoneNames(zones.Get()))
+	require.Len(t, zones.Get().boundaries, 1)
+	before := zones.Get()
+
+	// WHEN a zone is added and they're reloaded
+	writeZoneFile(t, namedDir, "b.kml", fmt.Sprintf(squareKML, "near the shed"))
+	err := zones.Reload()
+
+	// THEN the new zone is there, and the set from before is untouched.
+	require.Nil(t, err)
+	require.Equal(t, []string{"near the house", "near the shed"}, zoneNames(zones.Get()))
+	require.Equal(t, []string{"near the house"}, zoneNames(before))
+
+	// WHEN a broken zone is added and they're reloaded
+	writeZoneFile(t, namedDir, "c.kml", fmt.Sprintf(squareKML, ""))
+	err = zones.Reload()
+
+	// THEN the error is returned and the previous zones kept.
+	require.ErrorContains(t, err, "zone with no name")
+	require.Equal(t, []string{"near the house", "near the shed"}, zoneNames(zones.Get()))
+}
+
+func TestZoneHolderReloadOn(t *testing.T) {
+	zones, namedDir := newTestZoneHolder(t)
+
+	signals := make(chan os.Signal)
+	done := make(chan struct{})
+	go func() {
+		zones.reloadOn(signals, nil)
+		close(done)
+	}()
+
+	// A bad reload is survived... (signals is unbuffered, so the second send
+	// waits for the first reload to finish)
+	writeZoneFile(t, namedDir, "b.kml", "<kml>")
+	signals <- syscall.SIGHUP
+	signals <- syscall.SIGHUP
+	require.Equal(t, []string{"near the house"}, zoneNames(zones.Get()))
+
+	// ...and a good one after it is picked up.
+	writeZoneFile(t, namedDir, "b.kml", fmt.Sprintf(squareKML, "near the shed"))
+	signals <- syscall.SIGHUP
+
+	close(signals)
+	<-done
+
+	require.Equal(t, []string{"near the house", "near the shed"}, zoneNames(zones.Get()))
+}
+
+func TestNewZoneHolderErrors(t *testing.T) {
+	// GIVEN good alert boundaries, but named zones that can't be read
+	boundaryDir := t.TempDir()
+	writeZoneFile(t, boundaryDir, "b.kml", fmt.Sprintf(squareKML, "Property"))
+	namedDir := filepath.Join(t.TempDir(), "named")
+
+	// WHEN they're loaded at startup
+	zones, err := newZoneHolder(config.Zones{NamedZonesDir: namedDir, BoundaryZonesDir: boundaryDir})
+
+	// THEN the error is returned, but the boundaries are still used
+	require.ErrorContains(t, err, "reading named zones")
+	require.Len(t, zones.Get().boundaries, 1)
+	require.Empty(t, zones.Get().named)
+
+	// AND once the named zones are fixed, a reload picks them up.
+	err = os.Mkdir(namedDir, 0o700)
+	require.Nil(t, err)
+	writeZoneFile(t, namedDir, "a.kml", fmt.Sprintf(squareKML, "near the house"))
+	err = zones.Reload()
+	require.Nil(t, err)
+	require.Equal(t, []string{"near the house"}, zoneNames(zones.Get()))
+	require.Len(t, zones.Get().boundaries, 1)
+}
+
+func TestNewZoneHolderBadBoundary(t *testing.T) {
+	// GIVEN a broken alert boundary file
+	namedDir := t.TempDir()
+	boundaryDir := t.TempDir()
+	writeZoneFile(t, namedDir, "a.kml", fmt.Sprintf(squareKML, "near the house"))
+	writeZoneFile(t, boundaryDir, "b.kml", "<kml>")
+
+	// WHEN they're loaded at startup
+	zones, err := newZoneHolder(config.Zones{NamedZonesDir: namedDir, BoundaryZonesDir: boundaryDir})
+
+	// THEN there's an error and no boundaries, but the named zones are there.
+	require.ErrorContains(t, err, "reading alert boundaries")
+	require.Empty(t, zones.Get().boundaries)
+	require.Equal(t, []string{"near the house"}, zoneNames(zones.Get()))
+}
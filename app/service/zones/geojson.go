@@ -0,0 +1,231 @@
+package zones
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// The parts of a GeoJSON (RFC 7946) FeatureCollection we care about.
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+type geoJSONFeature struct {
+	Type       string          `json:"type"`
+	Properties map[string]any  `json:"properties"`
+	Geometry   geoJSONGeometry `json:"geometry"`
+}
+
+type geoJSONGeometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// A position is [lng, lat] or [lng, lat, alt], a ring is a list of positions,
+// and a polygon is an outer ring followed by any holes.
+type (
+	geoJSONPosition []float64
+	geoJSONRing     []geoJSONPosition
+	geoJSONPolygon  []geoJSONRing
+)
+
+func (r geoJSONRing) toCoordinates() (Coordinates, error) {
+	var c Coordinates
+	for _, pos := range r {
+		if len(pos) != 2 && len(pos) != 3 {
+			return Coordinates{}, fmt.Errorf("bad position %v", pos)
+		}
+		p := Point{Longitude: pos[0], Latitude: pos[1]}
+		if len(pos) == 3 {
+			p.Altitude = pos[2]
+		}
+		c.Points = append(c.Points, p)
+	}
+
+	return c, nil
+}
+
+func (gp geoJSONPolygon) toPolygon() (Polygon, error) {
+	if len(gp) == 0 {
+		return Polygon{}, fmt.Errorf("polygon with no rings")
+	}
+
+	var pg Polygon
+	for i, ring := range gp {
+		c, err := ring.toCoordinates()
+		if err != nil {
+			return Polygon{}, err
+		}
+		if i == 0 {
+			pg.Outer = c
+		} else {
+			pg.Holes = append(pg.Holes, c)
+		}
+	}
+
+	return pg, nil
+}
+
+func fromCoordinates(c Coordinates) geoJSONRing {
+	ring := make(geoJSONRing, len(c.Points))
+	for i, p := range c.Points {
+		if p.Altitude != 0 {
+			ring[i] = geoJSONPosition{p.Longitude, p.Latitude, p.Altitude}
+		} else {
+			ring[i] = geoJSONPosition{p.Longitude, p.Latitude}
+		}
+	}
+
+	return ring
+}
+
+func fromPolygon(pg Polygon) geoJSONPolygon {
+	gp := geoJSONPolygon{fromCoordinates(pg.Outer)}
+	for _, hole := range pg.Holes {
+		gp = append(gp, fromCoordinates(hole))
+	}
+
+	return gp
+}
+
+// UnmarshalGeoJSON returns a zone for each Polygon or MultiPolygon Feature in a
+// FeatureCollection. The zone's name comes from the "name" property, and the
+// other properties become its Properties, numbers and booleans as text.
+// Features with other geometries are skipped.
+func UnmarshalGeoJSON(blob []byte) ([]Zone, error) {
+	var fc geoJSONFeatureCollection
+	err := json.Unmarshal(blob, &fc)
+	if err != nil {
+		return nil, fmt.Errorf("while unmarshalling GeoJSON: %w", err)
+	}
+	if fc.Type != "FeatureCollection" {
+		return nil, fmt.Errorf("expected a GeoJSON FeatureCollection, got %q", fc.Type)
+	}
+
+	var zones []Zone
+	for i, f := range fc.Features {
+		var geoPolygons []geoJSONPolygon
+
+		switch f.Geometry.Type {
+		case "Polygon":
+			var gp geoJSONPolygon
+			err = json.Unmarshal(f.Geometry.Coordinates, &gp)
+			geoPolygons = append(geoPolygons, gp)
+		case "MultiPolygon":
+			err = json.Unmarshal(f.Geometry.Coordinates, &geoPolygons)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("feature %d: while unmarshalling coordinates: %w", i, err)
+		}
+
+		var zone Zone
+		for _, gp := range geoPolygons {
+			pg, err := gp.toPolygon()
+			if err != nil {
+				return nil, fmt.Errorf("feature %d: %w", i, err)
+			}
+			zone.Polygons = append(zone.Polygons, pg)
+		}
+
+		for k, v := range f.Properties {
+			// Properties are strings, as they are in KML, but tools that
+			// write GeoJSON will make numbers and booleans of some.
+			var s string
+			switch v := v.(type) {
+			case nil:
+				continue
+			case string:
+				s = v
+			case float64:
+				s = strconv.FormatFloat(v, 'f', -1, 64)
+			case bool:
+				s = strconv.FormatBool(v)
+			default:
+				return nil, fmt.Errorf("feature %d: property %q should be a string, number or boolean", i, k)
+			}
+			if k == "name" {
+				zone.Name = s
+				continue
+			}
+			if zone.Properties == nil {
+				zone.Properties = Properties{}
+			}
+			zone.Properties[k] = s
+		}
+
+		zones = append(zones, zone)
+	}
+
+	return zones, nil
+}
+
+// MarshalGeoJSON returns the zones as a FeatureCollection, each zone a Polygon
+// Feature (or MultiPolygon, if it has more than one polygon) with its name and
+// Properties as properties.
+func MarshalGeoJSON(zones []Zone) ([]byte, error) {
+	fc := geoJSONFeatureCollection{Type: "FeatureCollection", Features: []geoJSONFeature{}}
+
+	for _, zone := range zones {
+		properties := map[string]any{"name": zone.Name}
+		for k, v := range zone.Properties {
+			properties[k] = v
+		}
+
+		var geometry geoJSONGeometry
+		var coordinates any
+		if len(zone.Polygons) == 1 {
+			geometry.Type = "Polygon"
+			coordinates = fromPolygon(zone.Polygons[0])
+		} else {
+			geometry.Type = "MultiPolygon"
+			multi := make([]geoJSONPolygon, len(zone.Polygons))
+			for i, pg := range zone.Polygons {
+				multi[i] = fromPolygon(pg)
+			}
+			coordinates = multi
+		}
+
+		var err error
+		geometry.Coordinates, err = json.Marshal(coordinates)
+		if err != nil {
+			return nil, fmt.Errorf("while marshalling zone %q: %w", zone.Name, err)
+		}
+
+		fc.Features = append(fc.Features, geoJSONFeature{Type: "Feature", Properties: properties, Geometry: geometry})
+	}
+
+	blob, err := json.Marshal(fc)
+	if err != nil {
+		return nil, fmt.Errorf("while marshalling GeoJSON: %w", err)
+	}
+
+	return blob, nil
+}
+
+func ReadGeoJSONFile(filename string) ([]Zone, error) {
+	blob, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("while reading GeoJSON file: %w", err)
+	}
+
+	return UnmarshalGeoJSON(blob)
+}
+
+func WriteGeoJSONFile(filename string, zones []Zone) error {
+	blob, err := MarshalGeoJSON(zones)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(filename, blob, 0o644) //nolint:gosec // zones aren't secret
+	if err != nil {
+		return fmt.Errorf("while writing GeoJSON file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package zones
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadGeoJSONFile(t *testing.T) {
+	zones, err := ReadGeoJSONFile("testzones/Top dam.geojson")
+	require.Nil(t, err)
+
+	// The Point feature isn't a zone.
+	require.Len(t, zones, 1)
+	zone := zones[0]
+
+	require.Equal(t, "Top dam", zone.Name)
+	// Numbers are properties too, as strings.
+	require.Equal(t, Properties{"leaveTitle": "{{.Dog}} left the top dam", "fill-opacity": "0.5"}, zone.Properties)
+
+	require.Len(t, zone.Polygons, 2)
+	require.Len(t, zone.Polygons[0].Outer.Points, 5)
+	require.Len(t, zone.Polygons[0].Holes, 1)
+	require.Equal(t, Point{Longitude: 152.6410, Latitude: -31.4560, Altitude: 100}, zone.Polygons[1].Outer.Points[0])
+
+	require.True(t, zone.IsInside(Point{Longitude: 152.6404, Latitude: -31.4564}))
+	require.False(t, zone.IsInside(Point{Longitude: 152.64012, Latitude: -31.45612}), "in the hole")
+}
+
+func TestGeoJSONRoundTrip(t *testing.T) {
+	// GIVEN zones from KML, with holes, MultiGeometry, and properties.
+	want, err := ReadKMLFile("testzones/multi/Whole property.kml")
+	require.Nil(t, err)
+	want[0].Properties = Properties{"leaveTitle": "bye"}
+
+	// WHEN they're written as GeoJSON and read back
+	filename := filepath.Join(t.TempDir(), "zones.geojson")
+	err = WriteGeoJSONFile(filename, want)
+	require.Nil(t, err)
+	got, err := ReadFile(filename)
+	require.Nil(t, err)
+
+	// THEN they're unchanged.
+	require.Equal(t, want, got)
+}
+
+func TestGeoJSONPropertyTypes(t *testing.T) {
+	// GIVEN a feature with a numeric approach distance, as a GeoJSON editor
+	// would write it
+	blob := `{"type": "FeatureCollection", "features": [{"type": "Feature",
+		"properties": {"name": "Yard", "approachDistance": 15, "approachAngle": 22.5, "quiet": true, "note": null},
+		"geometry": {"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [1, 1], [0, 0]]]}}]}`
+
+	// WHEN it's read
+	zones, err := UnmarshalGeoJSON([]byte(blob))
+	require.Nil(t, err)
+
+	// THEN the numbers and booleans are kept, as KML would have them.
+	require.Equal(t, Properties{"approachDistance": "15", "approachAngle": "22.5", "quiet": "true"}, zones[0].Properties)
+}
+
+func TestUnmarshalGeoJSONErrors(t *testing.T) {
+	for _, tc := range []struct {
+		description string
+		blob        string
+		wantErr     string
+	}{
+		{"not JSON", `{`, "while unmarshalling GeoJSON"},
+		{"not a FeatureCollection", `{"type": "Feature"}`, `expected a GeoJSON FeatureCollection, got "Feature"`},
+		{
+			"bad position",
+			`{"type": "FeatureCollection", "features": [{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[1]]]}}]}`,
+			"feature 0: bad position [1]",
+		},
+		{
+			"no rings",
+			`{"type": "FeatureCollection", "features": [{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": []}}]}`,
+			"feature 0: polygon with no rings",
+		},
+		{
+			"property that's an object",
+			`{"type": "FeatureCollection", "features": [{"type": "Feature", "properties": {"style": {"fill": "red"}}, "geometry": {"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [1, 1], [0, 0]]]}}]}`,
+			`feature 0: property "style" should be a string, number or boolean`,
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			_, err := UnmarshalGeoJSON([]byte(tc.blob))
+			require.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
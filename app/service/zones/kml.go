@@ -0,0 +1,152 @@
+package zones
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The parts of a KML document we care about. Placemarks can be at the top
+// level, in a Document, or in Folders nested any depth.
+type kmlContainer struct {
+	Name       string         `xml:"name"`
+	Documents  []kmlContainer `xml:"Document"`
+	Folders    []kmlContainer `xml:"Folder"`
+	Placemarks []kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlPlacemark struct {
+	Name          string            `xml:"name"`
+	ExtendedData  Properties        `xml:"ExtendedData"`
+	Polygon       *kmlPolygon       `xml:"Polygon"`
+	MultiGeometry *kmlMultiGeometry `xml:"MultiGeometry"`
+}
+
+type kmlMultiGeometry struct {
+	Polygons        []kmlPolygon       `xml:"Polygon"`
+	MultiGeometries []kmlMultiGeometry `xml:"MultiGeometry"`
+}
+
+type kmlPolygon struct {
+	Outer Coordinates   `xml:"outerBoundaryIs>LinearRing>coordinates"`
+	Inner []Coordinates `xml:"innerBoundaryIs>LinearRing>coordinates"`
+}
+
+func (c *Coordinates) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var value string
+	err := d.DecodeElement(&value, &start)
+	if err != nil {
+		return fmt.Errorf("while decoding XML element: %w", err)
+	}
+
+	// Tuples are lng,lat[,alt], separated by whitespace.
+	for _, str := range strings.Fields(value) {
+		fields := strings.Split(str, ",")
+		if len(fields) != 2 && len(fields) != 3 {
+			return fmt.Errorf("bad coordinate %q", str)
+		}
+
+		var nums [3]float64
+		for i, f := range fields {
+			nums[i], err = strconv.ParseFloat(f, 64)
+			if err != nil {
+				return fmt.Errorf("bad coordinate %q: %w", str, err)
+			}
+		}
+
+		c.Points = append(c.Points, Point{Longitude: nums[0], Latitude: nums[1], Altitude: nums[2]})
+	}
+
+	return nil
+}
+
+func (p *Properties) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var extendedData struct {
+		Data []struct {
+			Name  string `xml:"name,attr"`
+			Value string `xml:"value"`
+		} `xml:"Data"`
+	}
+	err := d.DecodeElement(&extendedData, &start)
+	if err != nil {
+		return fmt.Errorf("while decoding ExtendedData: %w", err)
+	}
+
+	if *p == nil {
+		*p = make(Properties, len(extendedData.Data))
+	}
+	for _, data := range extendedData.Data {
+		(*p)[data.Name] = strings.TrimSpace(data.Value)
+	}
+
+	return nil
+}
+
+func (pg kmlPolygon) toPolygon() Polygon {
+	return Polygon{Outer: pg.Outer, Holes: pg.Inner}
+}
+
+func (mg kmlMultiGeometry) polygons() []Polygon {
+	var polygons []Polygon
+	for _, pg := range mg.Polygons {
+		polygons = append(polygons, pg.toPolygon())
+	}
+	for _, nested := range mg.MultiGeometries {
+		polygons = append(polygons, nested.polygons()...)
+	}
+
+	return polygons
+}
+
+// zones returns the zones for every Placemark with a polygon in the container,
+// its own Placemarks first, then those of nested Documents and Folders.
+// Placemarks without polygons (points, paths) are skipped.
+func (c kmlContainer) zones() []Zone {
+	var zones []Zone
+
+	for _, pm := range c.Placemarks {
+		var polygons []Polygon
+		if pm.Polygon != nil {
+			polygons = append(polygons, pm.Polygon.toPolygon())
+		}
+		if pm.MultiGeometry != nil {
+			polygons = append(polygons, pm.MultiGeometry.polygons()...)
+		}
+		if len(polygons) == 0 {
+			continue
+		}
+
+		zones = append(zones, Zone{Name: pm.Name, Polygons: polygons, Properties: pm.ExtendedData})
+	}
+
+	for _, doc := range c.Documents {
+		zones = append(zones, doc.zones()...)
+	}
+	for _, folder := range c.Folders {
+		zones = append(zones, folder.zones()...)
+	}
+
+	return zones
+}
+
+// UnmarkshallKML returns a zone for each polygon Placemark in the KML.
+func UnmarkshallKML(kmlBlob string) ([]Zone, error) {
+	var root kmlContainer
+	err := xml.Unmarshal([]byte(kmlBlob), &root)
+	if err != nil {
+		return nil, fmt.Errorf("while unmarshalling KML: %w", err)
+	}
+
+	return root.zones(), nil
+}
+
+func ReadKMLFile(filename string) ([]Zone, error) {
+	kmlBlob, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("while reading KML file: %w", err)
+	}
+
+	return UnmarkshallKML(string(kmlBlob))
+}
@@ -1,19 +1,34 @@
 package zones
 
 import (
-	"encoding/xml"
+	"errors"
 	"fmt"
+	"math"
 	"os"
+	"path/filepath"
 	"strings"
 
 	polypkg "github.com/bitwombat/gps-tags/poly"
 )
 
+// Zone is a named area, made of one or more polygons (several if it came from
+// a KML MultiGeometry).
 type Zone struct {
-	Name    string      `xml:"Document>Placemark>name"`
-	Polygon Coordinates `xml:"Document>Placemark>Polygon>outerBoundaryIs>LinearRing>coordinates"`
+	Name     string
+	Polygons []Polygon
+	// Properties are extra name/value pairs from the file, e.g. the message
+	// templates for alert boundaries.
+	Properties Properties
 }
 
+// Polygon is an outer ring with optional holes cut out of it.
+type Polygon struct {
+	Outer Coordinates
+	Holes []Coordinates
+}
+
+type Properties map[string]string
+
 type Coordinates struct {
 	Points []Point
 }
@@ -24,73 +39,111 @@ type Point struct {
 	Altitude  float64
 }
 
-func (c *Coordinates) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
-	var value string
-	err := d.DecodeElement(&value, &start)
-	if err != nil {
-		return fmt.Errorf("while decoding XML element: %w", err)
+// ReadFile reads the zones from a KML (.kml) or GeoJSON (.geojson, .json)
+// file.
+func ReadFile(filename string) ([]Zone, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".kml":
+		return ReadKMLFile(filename)
+	case ".geojson", ".json":
+		return ReadGeoJSONFile(filename)
+	default:
+		return nil, fmt.Errorf("don't know how to read zones from %s", filename)
 	}
+}
 
-	for _, str := range strings.Fields(value) {
-		var p Point
-		_, err := fmt.Sscanf(str, "%f,%f,%f", &p.Longitude, &p.Latitude, &p.Altitude)
-		if err != nil {
-			panic("Sscanf failed")
-		}
-
-		c.Points = append(c.Points, p)
+// isZoneFile says if ReadFile can read the file.
+func isZoneFile(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".kml", ".geojson", ".json":
+		return true
+	default:
+		return false
 	}
-	return nil
 }
 
-func UnmarkshallKML(kmlBlob string) (Zone, error) {
-	var z Zone
-	err := xml.Unmarshal([]byte(kmlBlob), &z)
+// ReadDir reads the zones from every KML and GeoJSON file in a directory, in
+// filename order. Other files are ignored.
+func ReadDir(path string) ([]Zone, error) {
+	files, err := os.ReadDir(path)
 	if err != nil {
-		return Zone{}, fmt.Errorf("while unmarshalling KML: %w", err)
+		return nil, fmt.Errorf("while reading zones directory: %w", err)
 	}
 
-	return z, nil
-}
+	var zones []Zone
+	for _, file := range files {
+		if file.IsDir() || !isZoneFile(file.Name()) {
+			continue
+		}
 
-func ReadKMLFile(filename string) (Zone, error) {
-	kmlBlob, err := os.ReadFile(filename)
-	if err != nil {
-		return Zone{}, fmt.Errorf("while reading KML file: %w", err)
+		fileZones, err := ReadFile(filepath.Join(path, file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("while reading zones file %s: %w", file.Name(), err)
+		}
+		zones = append(zones, fileZones...)
 	}
 
-	return UnmarkshallKML(string(kmlBlob))
+	return zones, nil
 }
 
-func ReadKMLDir(path string) ([]Zone, error) {
-	files, err := os.ReadDir(path)
-	if err != nil {
-		return nil, fmt.Errorf("while reading KML directory: %w", err)
+func toPoly(c Coordinates) []polypkg.Point {
+	poly := make([]polypkg.Point, len(c.Points))
+	for i, point := range c.Points {
+		poly[i] = polypkg.Point{X: point.Longitude, Y: point.Latitude}
 	}
 
-	var zones []Zone
-	for _, file := range files {
-		if strings.HasSuffix(file.Name(), ".kml") {
-			zone, err := ReadKMLFile(path + "/" + file.Name())
-			if err != nil {
-				return nil, fmt.Errorf("while reading KML file: %w", err)
-			}
-			zones = append(zones, zone)
-		}
+	return poly
+}
+
+// IsInside says if the point is inside the polygon's outer ring but not in
+// any of its holes. Points on an edge count as inside.
+func (pg Polygon) IsInside(p Point) bool {
+	holes := make([][]polypkg.Point, len(pg.Holes))
+	for i, hole := range pg.Holes {
+		holes[i] = toPoly(hole)
 	}
 
-	return zones, nil
+	return polypkg.Polygon{Outer: toPoly(pg.Outer), Holes: holes}.Contains(polypkg.Point{X: p.Longitude, Y: p.Latitude})
 }
 
+// IsInside says if the point is inside any of the zone's polygons.
 func (z *Zone) IsInside(p Point) bool {
-	poly := make([]polypkg.Point, len(z.Polygon.Points))
-	for i, point := range z.Polygon.Points {
-		poly[i] = polypkg.Point{X: point.Longitude, Y: point.Latitude}
+	for _, pg := range z.Polygons {
+		if pg.IsInside(p) {
+			return true
+		}
 	}
 
+	return false
+}
+
+// EdgeDistance is where the nearest edge of a zone is from a point.
+type EdgeDistance struct {
+	Metres  float64 // +Inf if the zone has no polygons
+	Bearing float64 // Towards the edge, in degrees clockwise from north
+}
+
+// NearestEdge finds the nearest edge (outer or hole) of any of the zone's
+// polygons to the point, whether the point is inside the zone or not.
+func (z *Zone) NearestEdge(p Point) EdgeDistance {
 	point := polypkg.Point{X: p.Longitude, Y: p.Latitude}
+	best := EdgeDistance{Metres: math.Inf(1)}
+
+	consider := func(c Coordinates) {
+		nearest := polypkg.NearestOnRing(toPoly(c), point)
+		if nearest.Distance < best.Metres {
+			best = EdgeDistance{Metres: nearest.Distance, Bearing: nearest.Bearing}
+		}
+	}
 
-	return polypkg.IsInside(poly, point)
+	for _, pg := range z.Polygons {
+		consider(pg.Outer)
+		for _, hole := range pg.Holes {
+			consider(hole)
+		}
+	}
+
+	return best
 }
 
 func NameThatZone(zones []Zone, p Point) string {
@@ -102,3 +155,36 @@ func NameThatZone(zones []Zone, p Point) string {
 
 	return "Not in any known zone."
 }
+
+// Validate returns all the problems with the zones, joined, or nil.
+func Validate(zones []Zone) error {
+	var errs []error
+
+	checkRing := func(zone Zone, what string, c Coordinates) {
+		if len(c.Points) < 3 {
+			errs = append(errs, fmt.Errorf("zone %q: %s needs at least 3 points, got %d", zone.Name, what, len(c.Points)))
+		}
+		for i, p := range c.Points {
+			if p.Latitude < -90 || p.Latitude > 90 || p.Longitude < -180 || p.Longitude > 180 {
+				errs = append(errs, fmt.Errorf("zone %q: %s point %d (%v,%v) is out of range", zone.Name, what, i, p.Longitude, p.Latitude))
+			}
+		}
+	}
+
+	for _, zone := range zones {
+		if zone.Name == "" {
+			errs = append(errs, fmt.Errorf("zone with no name"))
+		}
+		if len(zone.Polygons) == 0 {
+			errs = append(errs, fmt.Errorf("zone %q has no polygons", zone.Name))
+		}
+		for i, pg := range zone.Polygons {
+			checkRing(zone, fmt.Sprintf("polygon %d", i), pg.Outer)
+			for j, hole := range pg.Holes {
+				checkRing(zone, fmt.Sprintf("polygon %d hole %d", i, j), hole)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
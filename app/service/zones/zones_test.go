@@ -1,6 +1,7 @@
 package zones
 
 import (
+	"math"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -27,42 +28,171 @@ func TestReadKML(t *testing.T) {
 	   	</Document>
 	   	</kml>`
 
-	zone, err := UnmarkshallKML(kmlBlob)
+	zones, err := UnmarkshallKML(kmlBlob)
 	require.Nil(t, err)
-	require.NotNil(t, zone)
+	require.Len(t, zones, 1)
+	zone := zones[0]
 	require.Equal(t, "Dead cow gulch", zone.Name)
-	require.Equal(t, 5, len(zone.Polygon.Points))
-	require.Equal(t, 152.6423695887568, zone.Polygon.Points[0].Longitude)
-	require.Equal(t, -31.45667159676927, zone.Polygon.Points[0].Latitude)
+	require.Equal(t, 5, len(zone.Polygons[0].Outer.Points))
+	require.Equal(t, 152.6423695887568, zone.Polygons[0].Outer.Points[0].Longitude)
+	require.Equal(t, -31.45667159676927, zone.Polygons[0].Outer.Points[0].Latitude)
 	// good enough.
 }
 
 func TestReadKMLFile(t *testing.T) {
-	zone, err := ReadKMLFile("testzones/Dead cow gulch.kml")
+	zones, err := ReadKMLFile("testzones/Dead cow gulch.kml")
 	require.Nil(t, err)
-	require.NotNil(t, zone)
+	require.Len(t, zones, 1)
+	zone := zones[0]
 	require.Equal(t, "Dead cow gulch", zone.Name)
-	require.Equal(t, 5, len(zone.Polygon.Points))
-	require.Equal(t, 152.6423695887568, zone.Polygon.Points[0].Longitude)
-	require.Equal(t, -31.45667159676927, zone.Polygon.Points[0].Latitude)
+	require.Equal(t, 5, len(zone.Polygons[0].Outer.Points))
+	require.Equal(t, 152.6423695887568, zone.Polygons[0].Outer.Points[0].Longitude)
+	require.Equal(t, -31.45667159676927, zone.Polygons[0].Outer.Points[0].Latitude)
 	// good enough.
 }
 
-func TestReadKMLDir(t *testing.T) {
-	zones, err := ReadKMLDir("testzones")
+func TestReadDir(t *testing.T) {
+	zones, err := ReadDir("testzones")
 	require.Nil(t, err)
 	require.NotNil(t, zones)
 
-	require.Equal(t, 2, len(zones))
+	// Both formats, in filename order.
+	require.Equal(t, 3, len(zones))
 
 	require.Equal(t, "Dead cow gulch", zones[0].Name)
-	require.Equal(t, 5, len(zones[0].Polygon.Points))
-	require.Equal(t, 152.6423695887568, zones[0].Polygon.Points[0].Longitude)
-	require.Equal(t, -31.45667159676927, zones[0].Polygon.Points[0].Latitude)
-
-	require.Equal(t, "Upper slopes", zones[1].Name)
-	require.Equal(t, 5, len(zones[1].Polygon.Points))
-	require.Equal(t, 152.6406784366888, zones[1].Polygon.Points[0].Longitude)
-	require.Equal(t, -31.45642573808971, zones[1].Polygon.Points[0].Latitude)
+	require.Equal(t, 5, len(zones[0].Polygons[0].Outer.Points))
+	require.Equal(t, 152.6423695887568, zones[0].Polygons[0].Outer.Points[0].Longitude)
+	require.Equal(t, -31.45667159676927, zones[0].Polygons[0].Outer.Points[0].Latitude)
+
+	require.Equal(t, "Top dam", zones[1].Name)
+	require.Equal(t, 2, len(zones[1].Polygons))
+
+	require.Equal(t, "Upper slopes", zones[2].Name)
+	require.Equal(t, 5, len(zones[2].Polygons[0].Outer.Points))
+	require.Equal(t, 152.6406784366888, zones[2].Polygons[0].Outer.Points[0].Longitude)
+	require.Equal(t, -31.45642573808971, zones[2].Polygons[0].Outer.Points[0].Latitude)
 	// good enough.
 }
+
+func TestReadKMLExtendedData(t *testing.T) {
+	kmlBlob := `
+		<?xml version="1.0" encoding="UTF-8"?>
+		<kml xmlns="http://www.opengis.net/kml/2.2">
+		<Document>
+			<Placemark>
+				<name>Safe zone</name>
+				<ExtendedData>
+					<Data name="leaveTitle">
+						<value>{{.Dog}} is getting far from the house</value>
+					</Data>
+					<Data name="enterTitle"><value>{{.Dog}} is back</value></Data>
+				</ExtendedData>
+				<Polygon>
+					<outerBoundaryIs>
+						<LinearRing>
+							<coordinates>152.64,-31.45,0 152.65,-31.45,0 152.65,-31.46,0 152.64,-31.45,0</coordinates>
+						</LinearRing>
+					</outerBoundaryIs>
+				</Polygon>
+			</Placemark>
+		</Document>
+		</kml>`
+
+	zones, err := UnmarkshallKML(kmlBlob)
+	require.Nil(t, err)
+	require.Len(t, zones, 1)
+	require.Equal(t, Properties{
+		"leaveTitle": "{{.Dog}} is getting far from the house",
+		"enterTitle": "{{.Dog}} is back",
+	}, zones[0].Properties)
+}
+
+func TestReadKMLFileMultiPlacemark(t *testing.T) {
+	zones, err := ReadKMLFile("testzones/multi/Whole property.kml")
+	require.Nil(t, err)
+
+	// The Point Placemark isn't a zone.
+	require.Len(t, zones, 2)
+
+	require.Equal(t, "near the house", zones[0].Name)
+	require.Len(t, zones[0].Polygons, 1)
+	require.Len(t, zones[0].Polygons[0].Outer.Points, 5)
+	require.Len(t, zones[0].Polygons[0].Holes, 1)
+	require.Equal(t, Point{Longitude: 4, Latitude: 4}, zones[0].Polygons[0].Holes[0].Points[0])
+
+	require.Equal(t, "near the dams", zones[1].Name)
+	require.Len(t, zones[1].Polygons, 2)
+	require.Equal(t, Point{Longitude: 40, Latitude: 0}, zones[1].Polygons[1].Outer.Points[0])
+}
+
+func TestNameThatZoneMultiPlacemark(t *testing.T) {
+	zones, err := ReadKMLFile("testzones/multi/Whole property.kml")
+	require.Nil(t, err)
+
+	for _, tc := range []struct {
+		description string
+		p           Point
+		want        string
+	}{
+		{"in the outer ring", Point{Longitude: 2, Latitude: 2}, "near the house"},
+		{"in the hole", Point{Longitude: 5, Latitude: 5}, "Not in any known zone."},
+		{"on the hole's edge", Point{Longitude: 4, Latitude: 5}, "near the house"},
+		{"in the first polygon of a MultiGeometry", Point{Longitude: 25, Latitude: 5}, "near the dams"},
+		{"in a nested MultiGeometry", Point{Longitude: 45, Latitude: 5}, "near the dams"},
+		{"between polygons", Point{Longitude: 35, Latitude: 5}, "Not in any known zone."},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			require.Equal(t, tc.want, NameThatZone(zones, tc.p))
+		})
+	}
+}
+
+func TestReadKMLBadCoordinates(t *testing.T) {
+	_, err := UnmarkshallKML(`<kml><Placemark><name>x</name><Polygon><outerBoundaryIs><LinearRing>
+		<coordinates>1,2,3 oops,2,3</coordinates>
+	</LinearRing></outerBoundaryIs></Polygon></Placemark></kml>`)
+	require.ErrorContains(t, err, `bad coordinate "oops,2,3"`)
+}
+
+func TestValidate(t *testing.T) {
+	zones, err := ReadDir("testzones")
+	require.Nil(t, err)
+	require.Nil(t, Validate(zones))
+
+	bad := []Zone{
+		{Polygons: zones[0].Polygons},
+		{Name: "Empty"},
+		{Name: "Skinny", Polygons: []Polygon{{
+			Outer: Coordinates{Points: []Point{{Longitude: 1, Latitude: 1}, {Longitude: 2, Latitude: 2}}},
+			Holes: []Coordinates{{Points: []Point{{Longitude: 1, Latitude: 1}, {Longitude: 2, Latitude: 200}, {Longitude: 1, Latitude: 1}}}},
+		}}},
+	}
+
+	err = Validate(bad)
+	require.ErrorContains(t, err, "zone with no name")
+	require.ErrorContains(t, err, `zone "Empty" has no polygons`)
+	require.ErrorContains(t, err, `zone "Skinny": polygon 0 needs at least 3 points, got 2`)
+	require.ErrorContains(t, err, `zone "Skinny": polygon 0 hole 0 point 1 (2,200) is out of range`)
+}
+
+func TestNearestEdge(t *testing.T) {
+	zones, err := ReadKMLFile("testzones/multi/Whole property.kml")
+	require.Nil(t, err)
+	house := zones[0] // 0-10 square, with a 4-6 hole
+
+	// Of longitude, at 5 degrees latitude.
+	metresPerDegree := 111195.0 * math.Cos(5*math.Pi/180)
+
+	// Nearer the outer edge.
+	got := house.NearestEdge(Point{Longitude: 1, Latitude: 5})
+	require.InDelta(t, metresPerDegree, got.Metres, 1)
+	require.InDelta(t, 270, got.Bearing, 0.1)
+
+	// Nearer the hole.
+	got = house.NearestEdge(Point{Longitude: 3, Latitude: 5})
+	require.InDelta(t, metresPerDegree, got.Metres, 1)
+	require.InDelta(t, 90, got.Bearing, 0.1)
+
+	var empty Zone
+	require.True(t, math.IsInf(empty.NearestEdge(Point{}).Metres, 1))
+}